@@ -2,7 +2,9 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -10,17 +12,57 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/options/mac"
 	"github.com/wailsapp/wails/v2/pkg/options/windows"
 
+	"github.com/francescoizzo/markdown-editor-go/internal/cli"
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/instance"
 	"github.com/francescoizzo/markdown-editor-go/internal/ui"
 )
 
 var assets embed.FS
 
 func main() {
+	// --config-dir applies to the window and the subcommands alike
+	args, err := config.TakeDirFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "markdown-editor: "+err.Error())
+		os.Exit(cli.ExitError)
+	}
+
+	// Subcommands run headless, without creating a window
+	if len(args) > 0 && cli.IsCommand(args[0]) {
+		os.Exit(cli.Run(args, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	// Other arguments are files and folders to open
+	dir, _ := os.Getwd()
+	launch, err := instance.ParseArgs(args, dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "markdown-editor: "+err.Error())
+		os.Exit(cli.ExitError)
+	}
+
+	// Hand the files to the editor already running, unless asked for a new window
+	var lock *instance.Lock
+	if !launch.NewWindow {
+		var forwarded bool
+		lock, forwarded, err = instance.Acquire(launch)
+		if forwarded {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "markdown-editor: "+err.Error())
+				os.Exit(cli.ExitError)
+			}
+			os.Exit(cli.ExitOK)
+		}
+		if err != nil {
+			log.Println("Running without the single instance lock: " + err.Error())
+		}
+	}
+
 	// Create a new instance of the MainWindow
-	mainWindow := ui.NewMainWindow()
+	mainWindow := ui.NewMainWindow(launch, lock)
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:             "Markdown Editor",
 		Width:             1024,
 		Height:            768,
@@ -34,7 +76,7 @@ func main() {
 		AssetServer: &assetserver.Options{
 			Assets: assets,
 		},
-		Menu:             nil,
+		Menu:             ui.ApplicationMenu(mainWindow),
 		Logger:           nil,
 		LogLevel:         0,
 		OnStartup:        mainWindow.OnStartup,
@@ -5,10 +5,16 @@
 let editor; // Monaco editor instance
 let editorValue = "";
 let isDarkMode = false;
+let themeDefinition = null; // the theme last sent by the backend
 let wordCount = 0;
 let autoSaveEnabled = true;
-let hasUnsavedChanges = false;
+let hasUnsavedChanges = false; // of the document in the active tab
+let tabs = []; // open documents: { path, model, viewState, unsaved }
+let activeTab = null;
 let editorChangeTimeout;
+let keybindings = new Map(); // commands by the key sequences the frontend handles
+let keybindingPrefixes = new Set(); // the starts of multi-key sequences
+let pendingChords = []; // the chords typed so far of a multi-key sequence
 
 // Initialize application when DOM content is loaded
 document.addEventListener("DOMContentLoaded", () => {
@@ -25,11 +31,11 @@ async function initializeApp() {
   // Initialize event listeners
   setupEventListeners();
 
-  // Initialize theme based on system preference or saved preference
-  const prefersDarkMode =
-    window.matchMedia &&
-    window.matchMedia("(prefers-color-scheme: dark)").matches;
-  setTheme(prefersDarkMode);
+  // The backend chooses between light and dark mode; tell it the web view's
+  // appearance, which it follows where the system cannot be asked
+  window.go.main.MainWindow.IsDarkMode().then(setTheme);
+  window.go.main.MainWindow.GetTheme().then(applyThemeDefinition);
+  reportSystemAppearance();
 
   // Set up auto save indicator
   updateAutoSaveIndicator(autoSaveEnabled);
@@ -77,11 +83,31 @@ function initMonacoEditor() {
       clearTimeout(editorChangeTimeout);
       editorChangeTimeout = setTimeout(() => {
         window.go.main.Editor.SetContent(editorValue);
+        lintDocument();
+        applyEditorSettings();
+        renderTabs();
       }, 300);
     });
 
+    // The document the editor starts with is the first tab
+    activeTab = { path: "", model: editor.getModel(), viewState: null, unsaved: false };
+    tabs = [activeTab];
+
+    // Pasting a table copied from a spreadsheet or web page inserts a markdown table
+    editor.getDomNode().addEventListener("paste", pasteHTMLTable, true);
+
     // Initial focus on editor
     editor.focus();
+
+    // Open the files the editor was launched with
+    loadKeybindings();
+    applyEditorSettings();
+    if (themeDefinition) {
+      applyThemeDefinition(themeDefinition);
+    } else {
+      window.go.main.MainWindow.GetTheme().then(applyThemeDefinition);
+    }
+    openRequestedFiles();
   });
 }
 
@@ -98,8 +124,30 @@ function setupEventListeners() {
     .getElementById("btn-theme-toggle")
     .addEventListener("click", toggleTheme);
 
-  // Keyboard shortcuts
-  document.addEventListener("keydown", handleKeyboardShortcuts);
+  // Keybindings, ahead of the editor's own key handling
+  document.addEventListener("keydown", handleKeybindings, true);
+
+  // Command palette
+  document
+    .getElementById("command-palette-input")
+    .addEventListener("input", filterCommandPalette);
+  document
+    .getElementById("command-palette-input")
+    .addEventListener("keydown", handleCommandPaletteKeys);
+  document
+    .getElementById("command-palette")
+    .addEventListener("mousedown", (event) => {
+      if (event.target.id === "command-palette") {
+        closeCommandPalette();
+      }
+    });
+
+  // Slideshow navigation, ahead of the editor's own key handling
+  document.addEventListener("keydown", handlePresentationKeys, true);
+  document
+    .getElementById("presentation-current")
+    .addEventListener("click", handleSlideClick);
+  window.addEventListener("resize", fitPresentation);
 }
 
 // Register Wails event listeners
@@ -126,10 +174,61 @@ function registerWailsEvents() {
     document.getElementById("status-message").textContent = `Error: ${message}`;
   });
 
+  // Apply edits made to the document by the backend, such as format on save
+  window.runtime.EventsOn("editor:apply-edits", (edits) => {
+    applyEdits(edits);
+  });
+
   // Handle theme updates
+  window.runtime.EventsOn("import:report", (warnings) => {
+    if (warnings && warnings.length > 0) {
+      alert(`Some content could not be converted:\n\n- ${warnings.join("\n- ")}`);
+    }
+  });
+
   window.runtime.EventsOn("theme:update", (darkMode) => {
     setTheme(darkMode);
   });
+
+  // Apply the colors and typography of the theme in use
+  window.runtime.EventsOn("theme:definition", applyThemeDefinition);
+
+  // Reload the keybindings when the configuration changes them
+  window.runtime.EventsOn("keybindings:update", loadKeybindings);
+
+  // Apply settings changed in the configuration or workspace settings files
+  window.runtime.EventsOn("settings:changed", (changes) => {
+    if (!editor) {
+      return;
+    }
+    applyEditorSettings();
+    for (const change of changes) {
+      if (change.key === "autoSaveEnabled") {
+        autoSaveEnabled = change.new;
+        updateAutoSaveIndicator(autoSaveEnabled);
+      }
+    }
+    if (
+      changes.some(
+        (change) =>
+          change.key.startsWith("lint") || change.key.startsWith("markdown.")
+      )
+    ) {
+      lintDocument();
+    }
+  });
+
+  // Run commands chosen in the application menu that need the editor
+  window.runtime.EventsOn("command:run", (id) => {
+    runFrontendCommand(id);
+  });
+
+  // Open files handed over by a later launch of the editor
+  window.runtime.EventsOn("files:open", () => {
+    if (editor) {
+      openRequestedFiles();
+    }
+  });
 }
 
 // File operations
@@ -144,6 +243,8 @@ function newFile() {
   editor.setValue("");
   hasUnsavedChanges = false;
   updateWordCount("");
+  applyEditorSettings();
+  updateActiveTab();
 }
 
 function openFile() {
@@ -159,15 +260,166 @@ function openFile() {
         editor.setValue(content);
         hasUnsavedChanges = false;
         updateWordCount(content);
+        applyEditorSettings();
+        updateActiveTab();
       });
     }
   });
 }
 
+// Open the files and folders given on the command line, each in a tab of
+// its own
+async function openRequestedFiles() {
+  const targets = await window.go.main.MainWindow.TakeOpenRequests();
+  for (const target of targets || []) {
+    await openTarget(target);
+  }
+}
+
+// Open a file or folder in a new tab, or switch to the tab it is open in,
+// and move to its line and column
+async function openTarget(target) {
+  const open = !target.folder && tabs.find((tab) => tab.path === target.path);
+  if (open) {
+    await switchTab(open);
+    revealTarget(target);
+    return;
+  }
+
+  // The changes typed in the active tab stay in it; they must not reach the
+  // document opened in its place
+  clearTimeout(editorChangeTimeout);
+  const success = await (target.folder
+    ? window.go.main.MainWindow.OpenFolder(target.path)
+    : window.go.main.MainWindow.OpenPath(target.path));
+  if (!success) {
+    return;
+  }
+  const content = await window.go.main.MainWindow.GetContent();
+  const path = await window.go.main.MainWindow.GetCurrentFilePath();
+
+  // The empty untitled document of a new window is replaced
+  const blank = !activeTab.path && !hasUnsavedChanges && editor.getValue() === "";
+  if (blank && tabs.length === 1) {
+    activeTab.model.setValue(content);
+    activeTab.path = path;
+  } else {
+    showTab({ path, model: monaco.editor.createModel(content, "markdown"), viewState: null, unsaved: false }, true);
+  }
+  hasUnsavedChanges = false;
+  updateWordCount(content);
+  lintDocument();
+  applyEditorSettings();
+  renderTabs();
+  revealTarget(target);
+}
+
+// Show a tab's document in the editor, adding the tab when it is new
+function showTab(tab, added) {
+  activeTab.unsaved = hasUnsavedChanges;
+  activeTab.viewState = editor.saveViewState();
+  if (added) {
+    tabs.push(tab);
+  }
+  activeTab = tab;
+  editor.setModel(tab.model);
+  if (tab.viewState) {
+    editor.restoreViewState(tab.viewState);
+  }
+  hasUnsavedChanges = tab.unsaved;
+  editor.focus();
+}
+
+// Make another tab's document the current one, here and in the backend
+async function switchTab(tab) {
+  if (tab === activeTab) {
+    return;
+  }
+  clearTimeout(editorChangeTimeout);
+  showTab(tab, false);
+  await window.go.main.MainWindow.SwitchDocument(tab.path, tab.model.getValue(), tab.unsaved);
+  updateWordCount(tab.model.getValue());
+  lintDocument();
+  applyEditorSettings();
+  renderTabs();
+}
+
+// Close a tab, asking first when its document has unsaved changes. The last
+// tab stays open.
+async function closeTab(tab) {
+  if (tabs.length === 1) {
+    return;
+  }
+  const unsaved = tab === activeTab ? hasUnsavedChanges : tab.unsaved;
+  if (unsaved && !confirm("You have unsaved changes. Do you want to continue?")) {
+    return;
+  }
+
+  const index = tabs.indexOf(tab);
+  if (tab === activeTab) {
+    await switchTab(tabs[index + 1] || tabs[index - 1]);
+  }
+  tabs.splice(tabs.indexOf(tab), 1);
+  tab.model.dispose();
+  renderTabs();
+}
+
+// Take the path of the active tab's document from the backend, after it was
+// opened, saved as another file or replaced
+function updateActiveTab() {
+  window.go.main.MainWindow.GetCurrentFilePath().then((path) => {
+    activeTab.path = path;
+    renderTabs();
+  });
+}
+
+// Draw the tab bar, which is hidden while a single document is open
+function renderTabs() {
+  const bar = document.getElementById("tab-bar");
+  bar.hidden = tabs.length < 2;
+  bar.replaceChildren();
+  if (bar.hidden) {
+    return;
+  }
+
+  for (const tab of tabs) {
+    const unsaved = tab === activeTab ? hasUnsavedChanges : tab.unsaved;
+    const button = document.createElement("button");
+    button.className = tab === activeTab ? "tab active" : "tab";
+    button.title = tab.path || "Untitled";
+    button.textContent = (tab.path.split(/[\\/]/).pop() || "Untitled") + (unsaved ? " \u2022" : "");
+    button.addEventListener("click", () => switchTab(tab));
+
+    const close = document.createElement("span");
+    close.className = "tab-close";
+    close.textContent = "\u00d7";
+    close.title = "Close";
+    close.addEventListener("click", (event) => {
+      event.stopPropagation();
+      closeTab(tab);
+    });
+    button.appendChild(close);
+    bar.appendChild(button);
+  }
+}
+
+// Move the cursor to the line and column a file was opened at
+function revealTarget(target) {
+  if (!target.line) {
+    return;
+  }
+  const line = Math.min(target.line, editor.getModel().getLineCount());
+  const position = { lineNumber: line, column: target.column || 1 };
+  editor.setPosition(position);
+  editor.revealPositionInCenter(position);
+  editor.focus();
+}
+
 function saveFile() {
   window.go.main.MainWindow.SaveFile().then((success) => {
     if (success) {
       hasUnsavedChanges = false;
+      updateActiveTab();
     }
   });
 }
@@ -176,17 +428,42 @@ function saveFileAs() {
   window.go.main.MainWindow.SaveFileAs().then((success) => {
     if (success) {
       hasUnsavedChanges = false;
+      applyEditorSettings();
+      updateActiveTab();
     }
   });
 }
 
+// Apply the font, tab size and line numbers in effect for the document, which
+// its workspace settings and front matter may change
+function applyEditorSettings() {
+  window.go.main.MainWindow.GetEditorSettings().then((settings) => {
+    editor.updateOptions({
+      fontSize: settings.fontSize,
+      fontFamily: settings.fontFamily,
+      lineNumbers: settings.lineNumbers ? "on" : "off",
+    });
+    editor.getModel().updateOptions({ tabSize: settings.tabSize });
+  });
+}
+
 // Theme operations
 function toggleTheme() {
-  isDarkMode = !isDarkMode;
-  setTheme(isDarkMode);
+  // The backend sends the new theme with the theme:update event
   window.go.main.MainWindow.ToggleTheme();
 }
 
+function reportSystemAppearance() {
+  if (!window.matchMedia) {
+    return;
+  }
+  const query = window.matchMedia("(prefers-color-scheme: dark)");
+  window.go.main.MainWindow.ReportSystemAppearance(query.matches);
+  query.addEventListener("change", (event) => {
+    window.go.main.MainWindow.ReportSystemAppearance(event.matches);
+  });
+}
+
 function setTheme(darkMode) {
   isDarkMode = darkMode;
 
@@ -222,6 +499,62 @@ function setTheme(darkMode) {
   }
 }
 
+// Variables of the stylesheet set from a theme's colors and typography
+const themeVariables = {
+  background: "--bg",
+  backgroundSecondary: "--bg-secondary",
+  text: "--text",
+  textSecondary: "--text-secondary",
+  border: "--border",
+  accent: "--accent",
+  accentHover: "--accent-hover",
+  editorBackground: "--editor-bg",
+  previewBackground: "--preview-bg",
+  toolbar: "--toolbar",
+  statusBar: "--status-bar",
+  highlight: "--highlight",
+};
+
+const typographyVariables = {
+  fontFamily: "--preview-font-family",
+  fontSize: "--preview-font-size",
+  lineHeight: "--preview-line-height",
+  headingFontFamily: "--preview-heading-font-family",
+  codeFontFamily: "--preview-code-font-family",
+  maxWidth: "--preview-max-width",
+};
+
+// Apply a theme to the interface, the preview and the editor
+function applyThemeDefinition(definition) {
+  themeDefinition = definition;
+  const style = document.body.style;
+  for (const [key, variable] of Object.entries(themeVariables)) {
+    style.setProperty(variable, definition.colors[key]);
+  }
+  for (const [key, variable] of Object.entries(typographyVariables)) {
+    style.setProperty(variable, definition.preview[key]);
+  }
+
+  if (!editor) {
+    return;
+  }
+  // Monaco takes theme names of letters, digits and dashes, and token
+  // colors without the #
+  const name = `theme-${definition.id.replace(/[^a-z0-9-]/gi, "-")}`;
+  monaco.editor.defineTheme(name, {
+    base: definition.dark ? "vs-dark" : "vs",
+    inherit: true,
+    rules: definition.editor.tokens.map((rule) => ({
+      token: rule.token,
+      foreground: rule.foreground && rule.foreground.replace("#", ""),
+      background: rule.background && rule.background.replace("#", ""),
+      fontStyle: rule.fontStyle,
+    })),
+    colors: definition.editor.colors,
+  });
+  monaco.editor.setTheme(name);
+}
+
 // Autosave operations
 function toggleAutoSave() {
   window.go.main.MainWindow.ToggleAutoSave().then((enabled) => {
@@ -254,29 +587,656 @@ function updateWordCount(text) {
   }`;
 }
 
-// Keyboard shortcuts
-function handleKeyboardShortcuts(event) {
-  // Ctrl+S or Command+S: Save
-  if ((event.ctrlKey || event.metaKey) && event.key === "s") {
-    event.preventDefault();
-    if (event.shiftKey) {
-      saveFileAs();
-    } else {
-      saveFile();
+// Linting
+function lintDocument() {
+  window.go.main.MainWindow.LintDocument().then((diagnostics) => {
+    const markers = diagnostics.map((diagnostic) => ({
+      startLineNumber: diagnostic.range.start.line,
+      startColumn: diagnostic.range.start.column,
+      endLineNumber: diagnostic.range.end.line,
+      endColumn: diagnostic.range.end.column,
+      message: `${diagnostic.ruleId}/${diagnostic.ruleName}: ${diagnostic.message}`,
+      severity:
+        diagnostic.severity === "error"
+          ? monaco.MarkerSeverity.Error
+          : monaco.MarkerSeverity.Warning,
+    }));
+    monaco.editor.setModelMarkers(editor.getModel(), "lint", markers);
+  });
+}
+
+function fixLintIssues() {
+  window.go.main.MainWindow.GetLintFixes().then(applyEdits);
+}
+
+// Formatting
+function formatDocument() {
+  window.go.main.MainWindow.FormatDocument().then(applyEdits);
+}
+
+// Exporting
+// copyAs copies the selection, or the whole document when nothing is
+// selected, converted to another markup format
+function copyAs(format) {
+  const selection = editor.getSelection();
+  const text = selection.isEmpty() ? editor.getValue() : editor.getModel().getValueInRange(selection);
+  window.go.main.MainWindow.CopyAs(format, text);
+}
+
+// Importing
+function importDocument() {
+  if (hasUnsavedChanges) {
+    if (!confirm("You have unsaved changes. Do you want to continue?")) {
+      return;
     }
   }
 
-  // Ctrl+N or Command+N: New File
-  if ((event.ctrlKey || event.metaKey) && event.key === "n") {
-    event.preventDefault();
-    newFile();
+  window.go.main.MainWindow.ImportDocument().then(showImported);
+}
+
+async function importClipboardHTML() {
+  if (hasUnsavedChanges) {
+    if (!confirm("You have unsaved changes. Do you want to continue?")) {
+      return;
+    }
   }
 
-  // Ctrl+O or Command+O: Open File
-  if ((event.ctrlKey || event.metaKey) && event.key === "o") {
-    event.preventDefault();
-    openFile();
+  // The clipboard's HTML flavour is only readable from the webview
+  let html = "";
+  try {
+    for (const item of await navigator.clipboard.read()) {
+      if (item.types.includes("text/html")) {
+        html = await (await item.getType("text/html")).text();
+        break;
+      }
+    }
+  } catch (err) {
+    console.error("Error:", err);
   }
+
+  window.go.main.MainWindow.ImportClipboardHTML(html).then(showImported);
+}
+
+function showImported(success) {
+  if (success) {
+    window.go.main.MainWindow.GetContent().then((content) => {
+      editor.setValue(content);
+      // Imported documents are unsaved until the user saves them
+      hasUnsavedChanges = true;
+      updateWordCount(content);
+      updateActiveTab();
+    });
+  }
+}
+
+// Presenting
+let presentation = null; // the deck being shown and the position in it
+
+const incrementalItems = ".incremental > ul > li, .incremental > ol > li";
+
+async function startPresentation(presenter) {
+  // The slides are split from the latest text, which may not have been sent yet
+  clearTimeout(editorChangeTimeout);
+  await window.go.main.Editor.SetContent(editor.getValue());
+  const deck = await window.go.main.MainWindow.GetSlides();
+
+  let style = document.getElementById("presentation-style");
+  if (!style) {
+    style = document.createElement("style");
+    style.id = "presentation-style";
+    document.head.appendChild(style);
+  }
+  style.textContent = deck.css;
+
+  presentation = {
+    deck,
+    slide: 0,
+    step: 0,
+    started: Date.now(),
+    timer: setInterval(updatePresentationTimer, 1000),
+  };
+  const element = document.getElementById("presentation");
+  element.classList.toggle("audience", !presenter);
+  element.hidden = false;
+  window.runtime.WindowFullscreen();
+
+  updatePresentationTimer();
+  showSlide(0, 0);
+}
+
+function stopPresentation() {
+  clearInterval(presentation.timer);
+  presentation = null;
+  document.getElementById("presentation").hidden = true;
+  document.getElementById("presentation-current").innerHTML = "";
+  document.getElementById("presentation-next").innerHTML = "";
+  window.runtime.WindowUnfullscreen();
+  editor.focus();
+}
+
+// showSlide shows a slide with its first steps revealed; -1 reveals all
+function showSlide(index, steps) {
+  const slides = presentation.deck.slides;
+  index = Math.max(0, Math.min(slides.length - 1, index));
+  const slide = slides[index];
+  presentation.slide = index;
+  presentation.step = steps < 0 ? slide.steps : Math.min(steps, slide.steps);
+
+  renderSlide(document.getElementById("presentation-current"), slide, presentation.step);
+  renderSlide(document.getElementById("presentation-next"), slides[index + 1], -1);
+  document.getElementById("presentation-notes").innerHTML =
+    slide.notes || '<p class="presenter-empty">No notes for this slide</p>';
+  document.getElementById("presentation-counter").textContent =
+    `${index + 1} / ${slides.length}`;
+}
+
+function renderSlide(container, slide, steps) {
+  container.innerHTML = "";
+  if (!slide) {
+    return;
+  }
+
+  const section = document.createElement("section");
+  section.className = `slide active layout-${slide.layout}`;
+  if (slide.class) {
+    section.className += ` ${slide.class}`;
+  }
+  section.style.background = slide.background;
+  section.innerHTML = `<div class="slide-content">${slide.html}</div>`;
+  section.querySelectorAll(incrementalItems).forEach((item, i) => {
+    item.classList.toggle("pending", steps >= 0 && i >= steps);
+  });
+  container.appendChild(section);
+  fitSlide(container);
+}
+
+// Slides are laid out at 1280x720 and scaled to their container
+function fitSlide(container) {
+  const scale = Math.min(container.clientWidth / 1280, container.clientHeight / 720);
+  container.style.setProperty("--slide-scale", scale);
+}
+
+function fitPresentation() {
+  if (presentation) {
+    fitSlide(document.getElementById("presentation-current"));
+    fitSlide(document.getElementById("presentation-next"));
+  }
+}
+
+function nextSlideStep() {
+  const slide = presentation.deck.slides[presentation.slide];
+  if (presentation.step < slide.steps) {
+    showSlide(presentation.slide, presentation.step + 1);
+  } else {
+    showSlide(presentation.slide + 1, 0);
+  }
+}
+
+function previousSlideStep() {
+  if (presentation.step > 0) {
+    showSlide(presentation.slide, presentation.step - 1);
+  } else if (presentation.slide > 0) {
+    showSlide(presentation.slide - 1, -1);
+  }
+}
+
+function updatePresentationTimer() {
+  const seconds = Math.floor((Date.now() - presentation.started) / 1000);
+  const minutes = String(Math.floor(seconds / 60)).padStart(2, "0");
+  document.getElementById("presentation-timer").textContent =
+    `${minutes}:${String(seconds % 60).padStart(2, "0")}`;
+}
+
+function handlePresentationKeys(event) {
+  if (!presentation || event.ctrlKey || event.metaKey || event.altKey) {
+    return;
+  }
+
+  switch (event.key) {
+    case "ArrowRight":
+    case "ArrowDown":
+    case "PageDown":
+    case " ":
+    case "Enter":
+      nextSlideStep();
+      break;
+    case "ArrowLeft":
+    case "ArrowUp":
+    case "PageUp":
+    case "Backspace":
+      previousSlideStep();
+      break;
+    case "Home":
+      showSlide(0, 0);
+      break;
+    case "End":
+      showSlide(presentation.deck.slides.length - 1, -1);
+      break;
+    case "p":
+      // Switch between the audience and presenter views
+      document.getElementById("presentation").classList.toggle("audience");
+      fitPresentation();
+      break;
+    case "r":
+      presentation.started = Date.now();
+      updatePresentationTimer();
+      break;
+    case "Escape":
+      stopPresentation();
+      break;
+    default:
+      break;
+  }
+  // The editor underneath must not receive keys while presenting
+  event.preventDefault();
+  event.stopPropagation();
+}
+
+function handleSlideClick(event) {
+  const link = event.target.closest("a");
+  if (!link) {
+    nextSlideStep();
+    return;
+  }
+
+  // Links must not navigate the app away; internal ones go to their slide
+  event.preventDefault();
+  const href = link.getAttribute("href") || "";
+  if (!href.startsWith("#")) {
+    window.runtime.BrowserOpenURL(href);
+    return;
+  }
+  const id = decodeURIComponent(href.slice(1));
+  const index = presentation.deck.slides.findIndex((slide) => {
+    const content = document.createElement("div");
+    content.innerHTML = slide.html;
+    return content.querySelector(`[id="${CSS.escape(id)}"]`) !== null;
+  });
+  if (index >= 0) {
+    showSlide(index, -1);
+  }
+}
+
+// Table editing
+function editTable(operation) {
+  const position = editor.getPosition();
+  window.go.main.MainWindow.EditTable(
+    position.lineNumber,
+    position.column,
+    operation
+  ).then(applyEdits);
+}
+
+// Table conversion
+function pasteClipboardAsTable() {
+  const position = editor.getPosition();
+  window.go.main.MainWindow.PasteClipboardAsTable(
+    position.lineNumber,
+    position.column
+  ).then(applyEdits);
+}
+
+function recalculateTable() {
+  const position = editor.getPosition();
+  window.go.main.MainWindow.RecalculateTable(
+    position.lineNumber,
+    position.column
+  ).then(applyEdits);
+}
+
+function recalculateAllTables() {
+  window.go.main.MainWindow.RecalculateAllTables().then(applyEdits);
+}
+
+function copyTableAs(format) {
+  const position = editor.getPosition();
+  window.go.main.MainWindow.CopyTableAs(position.lineNumber, position.column, format);
+}
+
+function exportTable(format) {
+  const position = editor.getPosition();
+  window.go.main.MainWindow.ExportTable(position.lineNumber, position.column, format);
+}
+
+function pasteHTMLTable(event) {
+  const html = event.clipboardData && event.clipboardData.getData("text/html");
+  if (!html || !/<table/i.test(html)) {
+    return;
+  }
+
+  event.preventDefault();
+  event.stopPropagation();
+  window.go.main.MainWindow.ConvertToMarkdownTable(html, "html").then((table) => {
+    if (table) {
+      editor.executeEdits("paste", [
+        { range: editor.getSelection(), text: table + "\n" },
+      ]);
+    }
+  });
+}
+
+// Edit commands
+// The Edit menu takes their keys, so they run in the editor or in the text
+// field that has the focus, such as the command palette's.
+function focusedTextField() {
+  const active = document.activeElement;
+  if (editor.hasTextFocus() || !active) {
+    return null;
+  }
+  return active.tagName === "INPUT" || active.tagName === "TEXTAREA" ? active : null;
+}
+
+function editCommand(action, fieldCommand) {
+  return () => {
+    if (focusedTextField()) {
+      if (fieldCommand) {
+        document.execCommand(fieldCommand);
+      }
+      return;
+    }
+    editor.focus();
+    editor.trigger("menu", action, null);
+  };
+}
+
+function pasteText() {
+  const field = focusedTextField();
+  window.runtime.ClipboardGetText().then((text) => {
+    if (!text) {
+      return;
+    }
+    if (field) {
+      field.setRangeText(text, field.selectionStart, field.selectionEnd, "end");
+      field.dispatchEvent(new Event("input"));
+      return;
+    }
+    editor.focus();
+    editor.trigger("menu", "paste", { text });
+  });
+}
+
+// Commands
+// The commands are registered in Go, which builds the application menu from
+// them. Those that need the editor's state are run here.
+const frontendCommands = {
+  "file.new": newFile,
+  "file.open": openFile,
+  "file.save": saveFile,
+  "file.saveAs": saveFileAs,
+  "file.import": importDocument,
+  "file.importClipboard": importClipboardHTML,
+  "edit.undo": editCommand("undo", "undo"),
+  "edit.redo": editCommand("redo", "redo"),
+  "edit.cut": editCommand("editor.action.clipboardCutAction", "cut"),
+  "edit.copy": editCommand("editor.action.clipboardCopyAction", "copy"),
+  "edit.paste": pasteText,
+  "edit.selectAll": editCommand("editor.action.selectAll", "selectAll"),
+  "edit.find": editCommand("actions.find"),
+  "edit.replace": editCommand("editor.action.startFindReplaceAction"),
+  "format.document": formatDocument,
+  "format.fixLint": fixLintIssues,
+  "format.recalculateTables": recalculateAllTables,
+  "table.pasteAsTable": pasteClipboardAsTable,
+  "table.copyAsCSV": () => copyTableAs("csv"),
+  "table.copyAsTSV": () => copyTableAs("tsv"),
+  "table.exportCSV": () => exportTable("csv"),
+  "table.exportTSV": () => exportTable("tsv"),
+  "table.recalculate": recalculateTable,
+  "export.copyConfluence": () => copyAs("confluence"),
+  "export.copyJira": () => copyAs("jira"),
+  "export.copyMediaWiki": () => copyAs("mediawiki"),
+  "export.copyAsciiDoc": () => copyAs("asciidoc"),
+  "view.commandPalette": openCommandPalette,
+  "view.toggleAutoSave": toggleAutoSave,
+  "view.slideshow": () => startPresentation(false),
+  "view.presenter": () => startPresentation(true),
+};
+
+function runFrontendCommand(id) {
+  if (!editor || presentation) {
+    return;
+  }
+  if (frontendCommands[id]) {
+    frontendCommands[id]();
+  } else if (id.startsWith("table.")) {
+    editTable(id.slice("table.".length));
+  }
+}
+
+// Command palette
+let allPaletteCommands = []; // the commands when the palette was opened
+let paletteCommands = []; // the commands matching the search
+let paletteSelection = 0;
+
+function openCommandPalette() {
+  window.go.main.MainWindow.GetCommands().then((commands) => {
+    allPaletteCommands = commands;
+    document.getElementById("command-palette").hidden = false;
+    const input = document.getElementById("command-palette-input");
+    input.value = "";
+    input.focus();
+    filterCommandPalette();
+  });
+}
+
+function closeCommandPalette() {
+  document.getElementById("command-palette").hidden = true;
+  if (editor) {
+    editor.focus();
+  }
+}
+
+// Show the commands whose title or menu contains every word of the search
+function filterCommandPalette() {
+  const words = document
+    .getElementById("command-palette-input")
+    .value.toLowerCase()
+    .split(/\s+/)
+    .filter((word) => word !== "");
+  paletteCommands = allPaletteCommands.filter((command) => {
+    const text = `${command.menu} ${command.title}`.toLowerCase();
+    return words.every((word) => text.includes(word));
+  });
+  paletteSelection = 0;
+  renderCommandPalette();
+}
+
+function renderCommandPalette() {
+  const list = document.getElementById("command-palette-list");
+  list.innerHTML = "";
+  paletteCommands.forEach((command, index) => {
+    const item = document.createElement("li");
+    item.className = "command-palette-item";
+    item.classList.toggle("selected", index === paletteSelection);
+    item.classList.toggle("disabled", !command.enabled);
+
+    const title = document.createElement("span");
+    const menu = command.menu.replace(/\//g, ": ");
+    title.textContent = menu ? `${menu}: ${command.title}` : command.title;
+    item.appendChild(title);
+    if (command.shortcut) {
+      const shortcut = document.createElement("kbd");
+      shortcut.textContent = command.shortcut;
+      item.appendChild(shortcut);
+    }
+
+    item.addEventListener("mousedown", (event) => {
+      event.preventDefault();
+      runPaletteCommand(command);
+    });
+    list.appendChild(item);
+  });
+
+  const selected = list.children[paletteSelection];
+  if (selected) {
+    selected.scrollIntoView({ block: "nearest" });
+  }
+}
+
+function handleCommandPaletteKeys(event) {
+  switch (event.key) {
+    case "ArrowDown":
+      paletteSelection = Math.min(paletteSelection + 1, paletteCommands.length - 1);
+      renderCommandPalette();
+      break;
+    case "ArrowUp":
+      paletteSelection = Math.max(paletteSelection - 1, 0);
+      renderCommandPalette();
+      break;
+    case "Enter":
+      if (paletteCommands[paletteSelection]) {
+        runPaletteCommand(paletteCommands[paletteSelection]);
+      }
+      break;
+    case "Escape":
+      closeCommandPalette();
+      break;
+    default:
+      return;
+  }
+  event.preventDefault();
+}
+
+function runPaletteCommand(command) {
+  if (!command.enabled) {
+    return;
+  }
+  closeCommandPalette();
+  window.go.main.MainWindow.RunCommand(command.id);
+}
+
+// Keybindings
+// The application menu handles the keybindings it can show; the others, such
+// as multi-key sequences, are handled here.
+function loadKeybindings() {
+  window.go.main.MainWindow.GetKeybindings().then((bindings) => {
+    keybindings = new Map();
+    keybindingPrefixes = new Set();
+    pendingChords = [];
+    bindings
+      .filter((binding) => !binding.native)
+      .forEach((binding) => {
+        keybindings.set(binding.key, binding.command);
+        const chords = binding.key.split(" ");
+        for (let i = 1; i < chords.length; i++) {
+          keybindingPrefixes.add(chords.slice(0, i).join(" "));
+        }
+      });
+  });
+}
+
+function handleKeybindings(event) {
+  if (presentation || !document.getElementById("command-palette").hidden) {
+    return;
+  }
+  const chord = chordFromEvent(event);
+  if (!chord) {
+    return;
+  }
+
+  const sequence = [...pendingChords, chord].join(" ");
+  const status = document.getElementById("status-message");
+  if (keybindings.has(sequence)) {
+    pendingChords = [];
+    status.textContent = "Ready";
+    window.go.main.MainWindow.RunCommand(keybindings.get(sequence));
+  } else if (keybindingPrefixes.has(sequence)) {
+    pendingChords.push(chord);
+    status.textContent = `(${sequence}) was pressed. Waiting for the next key...`;
+  } else if (pendingChords.length > 0) {
+    pendingChords = [];
+    status.textContent = `The key combination (${sequence}) is not a command`;
+  } else {
+    return;
+  }
+  event.preventDefault();
+  event.stopPropagation();
+}
+
+// Keys by the code of key events, besides letters, digits and function keys
+const keyCodes = {
+  Slash: "/",
+  Backslash: "\\",
+  Comma: ",",
+  Period: ".",
+  Semicolon: ";",
+  Quote: "'",
+  BracketLeft: "[",
+  BracketRight: "]",
+  Minus: "-",
+  Equal: "=",
+  Backquote: "`",
+  ArrowUp: "Up",
+  ArrowDown: "Down",
+  ArrowLeft: "Left",
+  ArrowRight: "Right",
+  Enter: "Enter",
+  NumpadEnter: "Enter",
+  Escape: "Escape",
+  Tab: "Tab",
+  Space: "Space",
+  Backspace: "Backspace",
+  Delete: "Delete",
+  Insert: "Insert",
+  Home: "Home",
+  End: "End",
+  PageUp: "PageUp",
+  PageDown: "PageDown",
+};
+
+// Build a chord the way the keymap writes it, such as Ctrl+Shift+S, from a
+// key event. Keys are taken from their position, so bindings do not change
+// with Shift or the keyboard layout.
+function chordFromEvent(event) {
+  let key;
+  if (/^Key[A-Z]$/.test(event.code)) {
+    key = event.code.slice(3);
+  } else if (/^Digit[0-9]$/.test(event.code)) {
+    key = event.code.slice(5);
+  } else if (/^F[0-9]+$/.test(event.code)) {
+    key = event.code;
+  } else {
+    key = keyCodes[event.code];
+  }
+  if (!key) {
+    return null;
+  }
+
+  const parts = [];
+  if (event.ctrlKey) {
+    parts.push("Ctrl");
+  }
+  if (event.altKey) {
+    parts.push("Alt");
+  }
+  if (event.shiftKey) {
+    parts.push("Shift");
+  }
+  if (event.metaKey) {
+    parts.push("Meta");
+  }
+  parts.push(key);
+  return parts.join("+");
+}
+
+// Apply text edits computed by the backend to the editor
+function applyEdits(edits) {
+  if (!edits || edits.length === 0) {
+    return;
+  }
+
+  editor.executeEdits(
+    "backend",
+    edits.map((edit) => ({
+      range: new monaco.Range(
+        edit.range.start.line,
+        edit.range.start.column,
+        edit.range.end.line,
+        edit.range.end.column
+      ),
+      text: edit.newText,
+    }))
+  );
 }
 
 // Syntax highlighting for code blocks in preview
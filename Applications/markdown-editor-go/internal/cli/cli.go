@@ -0,0 +1,261 @@
+// Package cli runs the editor's conversions and checks from the command line,
+// without starting the user interface
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+)
+
+// Exit codes
+const (
+	ExitOK     = 0 // success
+	ExitFailed = 1 // a check found problems: lint issues or unformatted files
+	ExitError  = 2 // bad usage, or a file could not be read, converted or written
+)
+
+// command is a subcommand of the command line
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(c *cli, args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"convert", "convert <input> [-o output] [--to format]", "Convert a document to HTML, PDF, Word, EPUB, LaTeX, slides or wiki markup", runConvert},
+		{"lint", "lint [--fix] [--json] <files or folders>", "Check documents against the workspace lint rules", runLint},
+		{"fmt", "fmt [--check | -w] <files or folders>", "Format documents in the configured style", runFormat},
+		{"toc", "toc [--inplace] [--depth n] <file>", "Print a table of contents, or update the one between <!-- toc --> markers", runTOC},
+		{"stats", "stats [--json] <files or folders>", "Count the words, headings, links and other parts of documents", runStats},
+		{"help", "help [command]", "Show help for a command", runHelp},
+	}
+}
+
+// cli holds what commands share: the streams and the user's configuration
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	config *config.Config
+}
+
+// IsCommand reports whether a command line argument names a subcommand
+func IsCommand(name string) bool {
+	if name == "-h" || name == "--help" {
+		return true
+	}
+	return findCommand(name) != nil
+}
+
+// Run runs the subcommand named by the first argument and returns the exit code
+func Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	c := &cli{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		config: config.DefaultConfig(),
+	}
+	problems, err := c.config.Read()
+	if err != nil {
+		c.errorf("reading configuration: %v", err)
+	}
+	for _, problem := range problems {
+		c.warnf("configuration: %s", problem)
+	}
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		return ExitOK
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		c.errorf("unknown command %q", args[0])
+		c.usage()
+		return ExitError
+	}
+	return cmd.run(c, args[1:])
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "Usage: markdown-editor [--config-dir dir] <command> [arguments]")
+	fmt.Fprintln(c.stderr, "       markdown-editor [--config-dir dir] [--new-window] [file[:line[:column]] | folder]...")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Without a command the editor window opens the files and folders given.")
+	fmt.Fprintln(c.stderr, "They open in the editor already running, unless --new-window is given.")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Settings, state, data and caches are kept in the platform's folders for them, or")
+	fmt.Fprintln(c.stderr, "all in the folder given with --config-dir or $"+config.DirEnv+".")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Exit codes: 0 success, 1 problems found by lint or fmt --check, 2 errors")
+}
+
+func runHelp(c *cli, args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return ExitOK
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		c.errorf("unknown command %q", args[0])
+		return ExitError
+	}
+	return cmd.run(c, []string{"-h"})
+}
+
+// errorf reports an error on stderr
+func (c *cli) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(c.stderr, "markdown-editor: "+format+"\n", args...)
+}
+
+// warnf reports a problem that does not stop a command
+func (c *cli) warnf(format string, args ...interface{}) {
+	fmt.Fprintf(c.stderr, "warning: "+format+"\n", args...)
+}
+
+// newFlags creates the flag set of a command, printing its usage on -h
+func (c *cli) newFlags(name string) *flag.FlagSet {
+	cmd := findCommand(name)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: markdown-editor "+cmd.usage)
+		fmt.Fprintln(c.stderr, cmd.summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses a command's arguments, which may mix flags and operands,
+// and returns the operands. ok is false when the command should stop, with
+// code as its exit code.
+func parseFlags(flags *flag.FlagSet, args []string) (operands []string, code int, ok bool) {
+	for {
+		if err := flags.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, ExitOK, false
+			}
+			return nil, ExitError, false
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return operands, ExitOK, true
+		}
+		operands = append(operands, args[0])
+		args = args[1:]
+	}
+}
+
+// stdinName is the operand that reads a document from standard input
+const stdinName = "-"
+
+// readDocument reads a markdown file, or standard input for "-"
+func (c *cli) readDocument(path string) (string, error) {
+	if path == stdinName {
+		data, err := ioutil.ReadAll(c.stdin)
+		return string(data), err
+	}
+	data, err := ioutil.ReadFile(path)
+	return string(data), err
+}
+
+// writeFile replaces the content of a file
+func writeFile(path string, content string) error {
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
+
+// Extensions of the files commands find in folders
+var markdownExtensions = map[string]bool{".md": true, ".markdown": true, ".mdown": true, ".mkd": true}
+
+// expandFiles replaces folders among the operands by the markdown files they
+// contain, skipping hidden folders. Files named directly are kept whatever
+// their extension.
+func expandFiles(operands []string) ([]string, error) {
+	var files []string
+	for _, operand := range operands {
+		info, err := os.Stat(operand)
+		if operand == stdinName || err == nil && !info.IsDir() {
+			files = append(files, operand)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var found []string
+		err = filepath.Walk(operand, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != operand && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if markdownExtensions[strings.ToLower(filepath.Ext(path))] {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// sourcePath returns the path exporters resolve images against, "" for
+// standard input
+func sourcePath(path string) string {
+	if path == stdinName {
+		return ""
+	}
+	return path
+}
+
+// settings resolves the settings in effect for a document, warning about those
+// its workspace and front matter set wrongly
+func (c *cli) settings(file string, md string) *config.Settings {
+	settings := c.config.Resolve(workspaceDir(file), md)
+	for _, problem := range settings.Problems {
+		c.warnf("%s: %s", file, problem)
+	}
+	return settings
+}
+
+// workspaceDir returns the folder whose settings apply to a file
+func workspaceDir(path string) string {
+	if path == stdinName {
+		dir, _ := os.Getwd()
+		return dir
+	}
+	return filepath.Dir(path)
+}
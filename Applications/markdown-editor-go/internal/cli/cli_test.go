@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	const (
+		clean     = "# Title\n\nSome text.\n"
+		untidy    = "# Title\n\nSome text.  \n\n\n* item\n"
+		withTOC   = "# Title\n\n<!-- toc -->\nold\n<!-- tocstop -->\n\n## One\n\n### Two\n"
+		updated   = "# Title\n\n<!-- toc -->\n\n- [Title](#title)\n  - [One](#one)\n    - [Two](#two)\n\n<!-- tocstop -->\n\n## One\n\n### Two\n"
+		formatted = "# Title\n\nSome text.\n\n- item\n"
+	)
+
+	tests := []struct {
+		name   string
+		args   []string // $DIR stands for the folder of the files
+		stdin  string
+		files  map[string]string
+		code   int
+		stdout []string          // what standard output contains
+		hidden []string          // and what it does not
+		stderr []string          // what standard error contains
+		after  map[string]string // the files afterwards, "" for a file that is not there
+	}{
+		{name: "usage", code: ExitOK, stderr: []string{"Usage: markdown-editor", "Exit codes"}},
+		{name: "help for a command", args: []string{"help", "toc"}, code: ExitOK, stderr: []string{"toc [--inplace]"}},
+		{name: "unknown command", args: []string{"publish"}, code: ExitError, stderr: []string{`unknown command "publish"`}},
+		{name: "unknown flag", args: []string{"lint", "--quick"}, code: ExitError},
+
+		{name: "lint without problems", args: []string{"lint", "$DIR/a.md"}, files: map[string]string{"a.md": clean}, code: ExitOK},
+		{name: "lint with problems", args: []string{"lint", "$DIR"}, files: map[string]string{"a.md": clean, "b.md": untidy, ".hidden/c.md": untidy}, code: ExitFailed,
+			stdout: []string{"b.md:3:11: MD009/no-trailing-spaces", "b.md:5:1: MD012/no-multiple-blanks"}, hidden: []string{"a.md", "c.md"}},
+		{name: "lint standard input", args: []string{"lint", "--json"}, stdin: untidy, code: ExitFailed, stdout: []string{`"file": "-"`, `"ruleId": "MD009"`}},
+		{name: "lint a missing file", args: []string{"lint", "$DIR/missing.md"}, code: ExitError},
+		{name: "lint a missing file and a file with problems", args: []string{"lint", "$DIR/b.md", "$DIR/missing.md"}, files: map[string]string{"b.md": untidy}, code: ExitError},
+		{name: "lint --fix", args: []string{"lint", "--fix", "$DIR/b.md"}, files: map[string]string{"b.md": "# Title\n\nSome text.  \n\n\n- item\n"}, code: ExitOK,
+			after: map[string]string{"b.md": formatted}},
+		{name: "lint --fix cannot rewrite standard input", args: []string{"lint", "--fix"}, stdin: untidy, code: ExitError, stderr: []string{"standard input cannot be rewritten"}},
+
+		{name: "fmt", args: []string{"fmt"}, stdin: untidy, code: ExitOK, stdout: []string{formatted}},
+		{name: "fmt --check formatted", args: []string{"fmt", "--check", "$DIR/a.md"}, files: map[string]string{"a.md": clean}, code: ExitOK},
+		{name: "fmt --check unformatted", args: []string{"fmt", "--check", "$DIR"}, files: map[string]string{"a.md": clean, "b.md": untidy}, code: ExitFailed,
+			stdout: []string{"b.md"}, after: map[string]string{"b.md": untidy}},
+		{name: "fmt -w", args: []string{"fmt", "-w", "$DIR/b.md"}, files: map[string]string{"b.md": untidy}, code: ExitOK, after: map[string]string{"b.md": formatted}},
+		{name: "fmt --check and -w", args: []string{"fmt", "--check", "-w", "$DIR/b.md"}, files: map[string]string{"b.md": untidy}, code: ExitError},
+
+		{name: "toc", args: []string{"toc", "--depth", "2"}, stdin: withTOC, code: ExitOK, stdout: []string{"- [Title](#title)\n  - [One](#one)\n"}},
+		{name: "toc --inplace", args: []string{"toc", "--inplace", "$DIR/a.md"}, files: map[string]string{"a.md": withTOC}, code: ExitOK, after: map[string]string{"a.md": updated}},
+		{name: "toc --inplace without markers", args: []string{"toc", "--inplace", "$DIR/a.md"}, files: map[string]string{"a.md": clean}, code: ExitError,
+			stderr: []string{"has no <!-- toc --> marker"}, after: map[string]string{"a.md": clean}},
+		{name: "toc of two files", args: []string{"toc", "$DIR/a.md", "$DIR/b.md"}, code: ExitError},
+
+		{name: "convert to standard output as HTML", args: []string{"convert", "-"}, stdin: clean, code: ExitOK, stdout: []string{"<h1", "Title</h1>"}},
+		{name: "convert --to", args: []string{"convert", "--to", "jira", "-"}, stdin: clean, code: ExitOK, stdout: []string{"h1. {anchor:title}Title"}},
+		{name: "convert by the output's extension", args: []string{"convert", "$DIR/a.md", "-o", "$DIR/a.tex"}, files: map[string]string{"a.md": clean}, code: ExitOK,
+			after: map[string]string{"a.tex": `\section`}},
+		{name: "convert to a wiki file", args: []string{"convert", "$DIR/a.md", "-o", "$DIR/a.wiki"}, files: map[string]string{"a.md": clean}, code: ExitOK,
+			after: map[string]string{"a.wiki": "= Title ="}},
+		{name: "convert to a PDF file", args: []string{"convert", "$DIR/a.md", "-o", "$DIR/a.PDF"}, files: map[string]string{"a.md": clean}, code: ExitOK,
+			after: map[string]string{"a.PDF": "%PDF-"}},
+		{name: "convert to an unknown extension", args: []string{"convert", "$DIR/a.md", "-o", "$DIR/a.txt"}, files: map[string]string{"a.md": clean}, code: ExitError,
+			stderr: []string{"cannot tell the format"}, after: map[string]string{"a.txt": ""}},
+		{name: "convert a binary format to standard output", args: []string{"convert", "--to", "docx", "-"}, stdin: clean, code: ExitError, stderr: []string{"must be written to a file"}},
+		{name: "convert a missing file", args: []string{"convert", "$DIR/missing.md"}, code: ExitError},
+	}
+
+	for _, test := range tests {
+		t.Setenv(config.DirEnv, t.TempDir())
+		dir := t.TempDir()
+		for name, data := range test.files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		args := make([]string, len(test.args))
+		for i, arg := range test.args {
+			args[i] = strings.Replace(arg, "$DIR", dir, 1)
+		}
+
+		var stdout, stderr bytes.Buffer
+		code := Run(args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.code {
+			t.Errorf("%s: exit code %d, want %d; stderr:\n%s", test.name, code, test.code, stderr.String())
+		}
+		for _, want := range test.stdout {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%s: standard output does not contain %q:\n%s", test.name, want, stdout.String())
+			}
+		}
+		for _, text := range test.hidden {
+			if strings.Contains(stdout.String(), text) {
+				t.Errorf("%s: standard output contains %q:\n%s", test.name, text, stdout.String())
+			}
+		}
+		for _, want := range test.stderr {
+			if !strings.Contains(stderr.String(), want) {
+				t.Errorf("%s: standard error does not contain %q:\n%s", test.name, want, stderr.String())
+			}
+		}
+		for name, want := range test.after {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			switch {
+			case want == "" && err == nil:
+				t.Errorf("%s: %s was written", test.name, name)
+			case want != "" && err != nil:
+				t.Errorf("%s: %v", test.name, err)
+			case want != "" && !strings.Contains(string(data), want):
+				t.Errorf("%s: %s is\n%s\nwant it to contain\n%s", test.name, name, data, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/export"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Linting
+
+// lintResult is the JSON output of lint for one file
+type lintResult struct {
+	File        string             `json:"file"`
+	Diagnostics []utils.Diagnostic `json:"diagnostics"`
+}
+
+func runLint(c *cli, args []string) int {
+	flags := c.newFlags("lint")
+	fix := flags.Bool("fix", false, "apply the automatic fixes to the files")
+	asJSON := flags.Bool("json", false, "print the diagnostics as JSON")
+	operands, code, ok := parseFlags(flags, args)
+	if !ok {
+		return code
+	}
+	files, ok := c.operandFiles(operands, *fix)
+	if !ok {
+		return ExitError
+	}
+
+	exit := ExitOK
+	results := []lintResult{}
+	for _, file := range files {
+		md, err := c.readDocument(file)
+		if err != nil {
+			c.errorf("%v", err)
+			exit = ExitError
+			continue
+		}
+		settings := c.settings(file, md)
+		linter := utils.NewLinter(utils.NewMarkdownParserWith(settings.Config.Markdown), settings.Config.LintConfig())
+
+		if *fix {
+			if fixed := linter.FixAll(md); fixed != md {
+				if err := writeFile(file, fixed); err != nil {
+					c.errorf("%v", err)
+					exit = ExitError
+					continue
+				}
+				md = fixed
+			}
+		}
+
+		diagnostics := linter.Lint(md)
+		if len(diagnostics) > 0 && exit == ExitOK {
+			exit = ExitFailed
+		}
+		if *asJSON {
+			results = append(results, lintResult{File: file, Diagnostics: diagnostics})
+			continue
+		}
+		for _, d := range diagnostics {
+			fmt.Fprintf(c.stdout, "%s:%d:%d: %s/%s %s\n", file, d.Range.Start.Line, d.Range.Start.Column, d.RuleID, d.RuleName, d.Message)
+		}
+	}
+
+	if *asJSON {
+		if err := writeJSON(c.stdout, results); err != nil {
+			c.errorf("%v", err)
+			return ExitError
+		}
+	}
+	return exit
+}
+
+// Formatting
+
+func runFormat(c *cli, args []string) int {
+	flags := c.newFlags("fmt")
+	check := flags.Bool("check", false, "list the files that are not formatted instead of printing them")
+	write := flags.Bool("w", false, "write the formatted documents back to their files")
+	operands, code, ok := parseFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if *check && *write {
+		c.errorf("fmt takes either --check or -w")
+		return ExitError
+	}
+	files, ok := c.operandFiles(operands, *write)
+	if !ok {
+		return ExitError
+	}
+
+	exit := ExitOK
+	for _, file := range files {
+		md, err := c.readDocument(file)
+		if err != nil {
+			c.errorf("%v", err)
+			exit = ExitError
+			continue
+		}
+		settings := c.settings(file, md)
+		formatter := utils.NewFormatter(utils.NewMarkdownParserWith(settings.Config.Markdown), settings.Config.Format)
+		formatted := formatter.Format(md)
+
+		switch {
+		case *check:
+			if formatted != md {
+				fmt.Fprintln(c.stdout, file)
+				if exit == ExitOK {
+					exit = ExitFailed
+				}
+			}
+		case *write:
+			if formatted != md {
+				if err := writeFile(file, formatted); err != nil {
+					c.errorf("%v", err)
+					exit = ExitError
+				}
+			}
+		default:
+			io.WriteString(c.stdout, formatted)
+		}
+	}
+	return exit
+}
+
+// operandFiles expands the operands of a command to the files it works on.
+// Commands that rewrite files cannot read standard input.
+func (c *cli) operandFiles(operands []string, rewrite bool) ([]string, bool) {
+	if len(operands) == 0 {
+		operands = []string{stdinName}
+	}
+	files, err := expandFiles(operands)
+	if err != nil {
+		c.errorf("%v", err)
+		return nil, false
+	}
+	for _, file := range files {
+		if file == stdinName && rewrite {
+			c.errorf("standard input cannot be rewritten; name the files")
+			return nil, false
+		}
+	}
+	return files, true
+}
+
+// Table of contents
+
+// Markers around the table of contents that toc --inplace updates
+const (
+	tocStart = "<!-- toc -->"
+	tocEnd   = "<!-- tocstop -->"
+)
+
+func runTOC(c *cli, args []string) int {
+	flags := c.newFlags("toc")
+	inPlace := flags.Bool("inplace", false, "replace the lines between "+tocStart+" and "+tocEnd+" in the file")
+	depth := flags.Int("depth", 3, "deepest heading `level` listed")
+	operands, code, ok := parseFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(operands) > 1 {
+		c.errorf("toc takes one file")
+		return ExitError
+	}
+	files, ok := c.operandFiles(operands, *inPlace)
+	if !ok {
+		return ExitError
+	}
+	file := files[0]
+
+	md, err := c.readDocument(file)
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitError
+	}
+	toc := c.tableOfContents(md, *depth, c.settings(file, md))
+	if !*inPlace {
+		fmt.Fprintln(c.stdout, toc)
+		return ExitOK
+	}
+
+	updated, ok := replaceTOC(md, toc)
+	if !ok {
+		c.errorf("%s has no %s marker", file, tocStart)
+		return ExitError
+	}
+	if updated != md {
+		if err := writeFile(file, updated); err != nil {
+			c.errorf("%v", err)
+			return ExitError
+		}
+	}
+	return ExitOK
+}
+
+// tableOfContents returns a list of links to the headings down to a level,
+// indented from the highest level in it
+func (c *cli) tableOfContents(md string, depth int, settings *config.Settings) string {
+	_, body := utils.SplitFrontMatter(md)
+	var headings []export.Heading
+	top := depth
+	parser := utils.NewMarkdownParserWith(settings.Config.Markdown)
+	for _, heading := range export.DocumentHeadings(parser.Parse(body)) {
+		if heading.Level <= depth {
+			headings = append(headings, heading)
+			if heading.Level < top {
+				top = heading.Level
+			}
+		}
+	}
+
+	bullet := settings.Config.Format.BulletChar
+	if bullet == "" {
+		bullet = "-"
+	}
+	escape := strings.NewReplacer("[", "\\[", "]", "\\]")
+	lines := make([]string, 0, len(headings))
+	for _, heading := range headings {
+		indent := strings.Repeat("  ", heading.Level-top)
+		lines = append(lines, indent+bullet+" ["+escape.Replace(heading.Text)+"](#"+heading.ID+")")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replaceTOC puts a table of contents between the toc markers of a document,
+// adding the end marker when only the start marker is there
+func replaceTOC(md string, toc string) (string, bool) {
+	lines := strings.Split(md, "\n")
+	start, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case tocStart:
+			if start < 0 {
+				start = i
+			}
+		case tocEnd:
+			if start >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	if start < 0 {
+		return md, false
+	}
+
+	block := []string{lines[start], ""}
+	if toc != "" {
+		block = append(block, toc, "")
+	}
+	block = append(block, tocEnd)
+
+	rest := lines[start+1:]
+	if end >= 0 {
+		rest = lines[end+1:]
+	}
+	updated := append(append(append([]string{}, lines[:start]...), block...), rest...)
+	return strings.Join(updated, "\n"), true
+}
+
+// Statistics
+
+// documentStats counts the parts of a document
+type documentStats struct {
+	File           string `json:"file"`
+	Words          int    `json:"words"`
+	Characters     int    `json:"characters"`
+	Lines          int    `json:"lines"`
+	Headings       int    `json:"headings"`
+	Paragraphs     int    `json:"paragraphs"`
+	Links          int    `json:"links"`
+	Images         int    `json:"images"`
+	CodeBlocks     int    `json:"codeBlocks"`
+	Tables         int    `json:"tables"`
+	Footnotes      int    `json:"footnotes"`
+	ReadingMinutes int    `json:"readingMinutes"`
+}
+
+// readingSpeed is the words read per minute used to estimate reading time
+const readingSpeed = 200
+
+func runStats(c *cli, args []string) int {
+	flags := c.newFlags("stats")
+	asJSON := flags.Bool("json", false, "print the statistics as JSON: an object for one file, an array for several")
+	operands, code, ok := parseFlags(flags, args)
+	if !ok {
+		return code
+	}
+	files, ok := c.operandFiles(operands, false)
+	if !ok {
+		return ExitError
+	}
+
+	exit := ExitOK
+	var all []documentStats
+	for _, file := range files {
+		md, err := c.readDocument(file)
+		if err != nil {
+			c.errorf("%v", err)
+			exit = ExitError
+			continue
+		}
+		stats := c.documentStats(md, c.settings(file, md))
+		stats.File = file
+		all = append(all, stats)
+
+		if !*asJSON {
+			fmt.Fprintf(c.stdout, "%s: %d words, %d characters, %d lines, %d headings, %d paragraphs, %d links, %d images, %d code blocks, %d tables, %d footnotes, %d min read\n",
+				file, stats.Words, stats.Characters, stats.Lines, stats.Headings, stats.Paragraphs, stats.Links,
+				stats.Images, stats.CodeBlocks, stats.Tables, stats.Footnotes, stats.ReadingMinutes)
+		}
+	}
+
+	if *asJSON {
+		var err error
+		if len(files) == 1 && len(all) == 1 {
+			err = writeJSON(c.stdout, all[0])
+		} else {
+			err = writeJSON(c.stdout, all)
+		}
+		if err != nil {
+			c.errorf("%v", err)
+			return ExitError
+		}
+	}
+	return exit
+}
+
+func (c *cli) documentStats(md string, settings *config.Settings) documentStats {
+	_, body := utils.SplitFrontMatter(md)
+	parser := utils.NewMarkdownParserWith(settings.Config.Markdown)
+	stats := documentStats{
+		Words:      parser.WordCount(body),
+		Characters: utf8.RuneCountInString(md),
+		Lines:      strings.Count(md, "\n"),
+	}
+	if md != "" && !strings.HasSuffix(md, "\n") {
+		stats.Lines++
+	}
+	stats.ReadingMinutes = (stats.Words + readingSpeed - 1) / readingSpeed
+
+	ast.WalkFunc(parser.Parse(body), func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch node := node.(type) {
+		case *ast.Heading:
+			stats.Headings++
+		case *ast.Paragraph:
+			stats.Paragraphs++
+		case *ast.Link:
+			if node.NoteID == 0 {
+				stats.Links++
+			}
+		case *ast.Image:
+			stats.Images++
+		case *ast.CodeBlock:
+			stats.CodeBlocks++
+		case *ast.Table:
+			stats.Tables++
+		case *ast.List:
+			if node.IsFootnotesList {
+				stats.Footnotes += len(node.Children)
+				return ast.SkipChildren
+			}
+		}
+		return ast.GoToNext
+	})
+	return stats
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
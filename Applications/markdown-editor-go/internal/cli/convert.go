@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/export"
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+// Formats documents can be converted to, besides the export.Markup formats
+const (
+	formatHTML   = "html"
+	formatPDF    = "pdf"
+	formatDOCX   = "docx"
+	formatEPUB   = "epub"
+	formatLaTeX  = "latex"
+	formatSlides = "slides"
+)
+
+// Formats by output file extension
+var formatsByExtension = map[string]string{
+	".html":      formatHTML,
+	".htm":       formatHTML,
+	".pdf":       formatPDF,
+	".docx":      formatDOCX,
+	".epub":      formatEPUB,
+	".tex":       formatLaTeX,
+	".adoc":      export.MarkupAsciiDoc,
+	".asciidoc":  export.MarkupAsciiDoc,
+	".wiki":      export.MarkupMediaWiki,
+	".mediawiki": export.MarkupMediaWiki,
+	".jira":      export.MarkupJira,
+}
+
+// Formats that are written to files only
+var binaryFormats = map[string]bool{formatPDF: true, formatDOCX: true, formatEPUB: true, formatSlides: true}
+
+// convertOptions are the flags of the convert command
+type convertOptions struct {
+	output   string
+	format   string
+	title    string
+	toc      bool
+	dark     bool
+	images   string
+	pageSize string
+}
+
+func runConvert(c *cli, args []string) int {
+	var options convertOptions
+	flags := c.newFlags("convert")
+	flags.StringVar(&options.output, "o", "", "output `file`; - or none writes text formats to standard output")
+	flags.StringVar(&options.output, "output", "", "same as -o")
+	flags.StringVar(&options.format, "to", "", "output `format`: html, pdf, docx, epub, latex, slides, confluence, jira, mediawiki or asciidoc; defaults to the output file's extension")
+	flags.StringVar(&options.title, "title", "", "document title, instead of the front matter title or first heading")
+	flags.BoolVar(&options.toc, "toc", false, "add a table of contents to HTML pages")
+	flags.BoolVar(&options.dark, "dark", c.config.IsDarkMode, "use the dark theme for HTML pages and slides")
+	flags.StringVar(&options.images, "images", "", "how HTML pages include images: inline, copy or link; defaults to the export.htmlImages setting")
+	flags.StringVar(&options.pageSize, "page-size", "", "PDF page size: A4, A5, Letter or Legal; defaults to the export.pdfPageSize setting")
+	operands, code, ok := parseFlags(flags, args)
+	if !ok {
+		return code
+	}
+	if len(operands) != 1 {
+		c.errorf("convert takes one input file, or - for standard input")
+		return ExitError
+	}
+	input := operands[0]
+
+	format := strings.ToLower(options.format)
+	if format == "" {
+		format = formatsByExtension[strings.ToLower(filepath.Ext(options.output))]
+	}
+	if format == "tex" {
+		format = formatLaTeX
+	}
+	if format == "" {
+		if options.output == "" || options.output == stdinName {
+			format = formatHTML
+		} else {
+			c.errorf("cannot tell the format of %s; choose one with --to", options.output)
+			return ExitError
+		}
+	}
+	if options.output == stdinName {
+		options.output = ""
+	}
+	if binaryFormats[format] && options.output == "" {
+		c.errorf("%s output must be written to a file with -o", format)
+		return ExitError
+	}
+
+	md, err := c.readDocument(input)
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitError
+	}
+
+	warnings, err := c.convert(md, sourcePath(input), format, options, c.settings(input, md))
+	for _, warning := range warnings {
+		c.warnf("%s: %s", input, warning)
+	}
+	if err != nil {
+		c.errorf("converting %s: %v", input, err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// themes returns the built-in and user's themes with those of the
+// configuration selected, warning about the ones that cannot be used
+func (c *cli) themes(settings *config.Settings) *theme.Theme {
+	themes := theme.NewTheme()
+	dir, err := config.ThemesDir()
+	if err != nil {
+		c.warnf("themes: %v", err)
+		return themes
+	}
+	_, problems := themes.LoadDir(dir)
+	problems = append(problems, themes.Select(settings.Config.LightTheme, settings.Config.DarkTheme)...)
+	for _, problem := range problems {
+		c.warnf("themes: %s", problem)
+	}
+	return themes
+}
+
+// convert writes a document in a format to the output file, or to standard
+// output when there is none, and returns the exporter's warnings
+func (c *cli) convert(md string, source string, format string, options convertOptions, settings *config.Settings) ([]string, error) {
+	parser := utils.NewMarkdownParserWith(settings.Config.Markdown)
+	if options.images == "" {
+		options.images = settings.Config.Export.HTMLImages
+	}
+	if options.pageSize == "" {
+		options.pageSize = settings.Config.Export.PDFPageSize
+	}
+
+	themes := c.themes(settings)
+	colors := themes.GetColors(theme.LightTheme)
+	if options.dark {
+		colors = themes.GetColors(theme.DarkTheme)
+	}
+
+	switch format {
+	case formatHTML:
+		exporter := export.NewHTMLExporter(parser, export.HTMLOptions{
+			Title:      options.title,
+			SourcePath: source,
+			Images:     options.images,
+			TOC:        options.toc,
+			Colors:     colors,
+			Dark:       options.dark,
+		})
+		if options.output == "" {
+			page := exporter.Render(md)
+			_, err := io.WriteString(c.stdout, page)
+			return exporter.Warnings(), err
+		}
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+
+	case formatPDF:
+		pdfOptions := export.DefaultPDFOptions()
+		pdfOptions.Title = options.title
+		pdfOptions.SourcePath = source
+		pdfOptions.PageSize = options.pageSize
+		pdfOptions.Landscape = settings.Config.Export.PDFLandscape
+		exporter := export.NewPDFExporter(parser, pdfOptions)
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+
+	case formatDOCX:
+		exporter := export.NewDOCXExporter(parser, export.DOCXOptions{
+			Title:        options.title,
+			SourcePath:   source,
+			ReferenceDoc: settings.Config.DOCXReferenceDoc,
+		})
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+
+	case formatEPUB:
+		exporter := export.NewEPUBExporter(parser, export.EPUBOptions{
+			Title:      options.title,
+			SourcePath: source,
+			Colors:     themes.GetColors(theme.LightTheme),
+		})
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+
+	case formatSlides:
+		exporter := export.NewSlidesExporter(parser, export.SlidesOptions{
+			Title:      options.title,
+			SourcePath: source,
+			Colors:     colors,
+			Dark:       options.dark,
+		})
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+
+	case formatLaTeX:
+		exporter := export.NewLaTeXExporter(parser, export.LaTeXOptions{
+			Title:      options.title,
+			SourcePath: source,
+			Template:   settings.Config.LaTeXTemplate,
+		})
+		if options.output == "" {
+			text, err := exporter.Render(md)
+			if err == nil {
+				_, err = io.WriteString(c.stdout, text)
+			}
+			return exporter.Warnings(), err
+		}
+		err := exporter.Export(md, options.output)
+		return exporter.Warnings(), err
+	}
+
+	if _, ok := export.MarkupFormatNames[format]; !ok {
+		return nil, errors.New("unknown format " + format)
+	}
+	exporter := export.NewMarkupExporter(parser, export.MarkupOptions{Format: format, Title: options.title})
+	text, err := exporter.Render(md)
+	if err != nil {
+		return exporter.Warnings(), err
+	}
+	if options.output == "" {
+		_, err = io.WriteString(c.stdout, text)
+	} else {
+		err = writeFile(options.output, text)
+	}
+	return exporter.Warnings(), err
+}
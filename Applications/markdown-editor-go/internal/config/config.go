@@ -2,16 +2,27 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
 )
 
 // Config represents the application configuration
 type Config struct {
+	// Version of the schema the file was written with
+	Version int `json:"version"`
+
 	// Theme settings
-	IsDarkMode bool `json:"isDarkMode"`
+	ThemeMode     string `json:"themeMode"`     // "manual", "system" or "schedule"
+	IsDarkMode    bool   `json:"isDarkMode"`    // the mode chosen in manual mode
+	DarkModeStart string `json:"darkModeStart"` // "15:04" the schedule switches to dark mode at
+	DarkModeEnd   string `json:"darkModeEnd"`   // "15:04" the schedule switches back to light mode at
+	LightTheme    string `json:"lightTheme"`    // id of the theme of light mode
+	DarkTheme     string `json:"darkTheme"`     // id of the theme of dark mode
 
 	// Editor settings
 	FontSize    int    `json:"fontSize"`
@@ -23,110 +34,258 @@ type Config struct {
 	AutoSaveEnabled bool `json:"autoSaveEnabled"`
 	AutoSaveDelay   int  `json:"autoSaveDelay"` // in seconds
 
+	// Formatter settings
+	FormatOnSave bool                `json:"formatOnSave"`
+	Format       utils.FormatOptions `json:"format"`
+
+	// Table settings
+	RecalculateTablesOnSave bool `json:"recalculateTablesOnSave"`
+
+	// Markdown syntax extensions
+	Markdown utils.ParserOptions `json:"markdown"`
+
+	// Lint rules in markdownlint format, over those of the workspace's
+	// .markdownlint.json
+	Lint map[string]interface{} `json:"lint"`
+
+	// Export settings
+	DOCXReferenceDoc string         `json:"docxReferenceDoc"` // .docx whose styles Word exports reuse
+	LaTeXTemplate    string         `json:"latexTemplate"`    // template LaTeX exports fill in
+	Export           ExportSettings `json:"export"`
+
+	// Keybindings added to or removing the defaults
+	Keybindings []Keybinding `json:"keybindings"`
+
+	// What is remembered between runs, kept in its own file in the state folder
+	State `json:"-"`
+
+	// Paths of the configuration and state files
+	configPath string
+	statePath  string
+}
+
+// ExportSettings are the options exports use unless a command chooses
+// otherwise
+type ExportSettings struct {
+	HTMLImages   string `json:"htmlImages"`  // "inline", "copy" or "link"
+	PDFPageSize  string `json:"pdfPageSize"` // "A4", "A5", "Letter" or "Legal"
+	PDFLandscape bool   `json:"pdfLandscape"`
+}
+
+// State is what the editor remembers between runs rather than what the user
+// sets
+type State struct {
 	// Recent files
 	RecentFiles []string `json:"recentFiles"`
 
 	// Window settings
 	WindowWidth  int `json:"windowWidth"`
 	WindowHeight int `json:"windowHeight"`
-
-	// File path of the configuration file itself
-	configPath string
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		IsDarkMode:      false,
-		FontSize:        14,
-		FontFamily:      "Roboto Mono, monospace",
-		TabSize:         4,
-		LineNumbers:     true,
-		AutoSaveEnabled: true,
-		AutoSaveDelay:   5, // 5 seconds
-		RecentFiles:     []string{},
-		WindowWidth:     1024,
-		WindowHeight:    768,
+		Version:                 CurrentVersion,
+		ThemeMode:               "system",
+		IsDarkMode:              false,
+		DarkModeStart:           "19:00",
+		DarkModeEnd:             "07:00",
+		LightTheme:              "light",
+		DarkTheme:               "dark",
+		FontSize:                14,
+		FontFamily:              "Roboto Mono, monospace",
+		TabSize:                 4,
+		LineNumbers:             true,
+		AutoSaveEnabled:         true,
+		AutoSaveDelay:           5, // 5 seconds
+		FormatOnSave:            false,
+		Format:                  utils.DefaultFormatOptions(),
+		RecalculateTablesOnSave: true,
+		Markdown:                utils.DefaultParserOptions(),
+		Lint:                    map[string]interface{}{},
+		Export: ExportSettings{
+			HTMLImages:  "inline",
+			PDFPageSize: "A4",
+		},
+		Keybindings: []Keybinding{},
+		State: State{
+			RecentFiles:  []string{},
+			WindowWidth:  1024,
+			WindowHeight: 768,
+		},
 	}
 }
 
-// Load loads the configuration from file
-func (c *Config) Load() error {
-	configPath, err := getConfigPath()
-	if err != nil {
-		return err
+// Load loads the configuration and the state from file, creating them when
+// there are none. A configuration file in the old ~/.markdown-editor folder is
+// moved to the configuration folder first. Files of an older version are
+// backed up, migrated and written back, and invalid settings are replaced. A
+// file that cannot be parsed is backed up and the defaults are used. The
+// problems describe what was changed.
+func (c *Config) Load() ([]string, error) {
+	if err := c.locate(); err != nil {
+		return nil, err
+	}
+	if err := moveLegacyConfig(c.configPath); err != nil {
+		return nil, fmt.Errorf("the configuration could not be moved from ~/.markdown-editor: %v", err)
 	}
-	c.configPath = configPath
 
-	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	// Read config file
+	data, err := ioutil.ReadFile(c.configPath)
+	if os.IsNotExist(err) {
 		// Create default config
-		defaultConfig := DefaultConfig()
-		defaultConfig.configPath = configPath
-		return defaultConfig.Save()
+		c.Version = CurrentVersion
+		problems := c.readState()
+		return append(problems, c.Validate()...), c.Save()
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Read config file
-	data, err := ioutil.ReadFile(configPath)
+	problems, migrated, err := c.decode(data)
+	save := migrated
 	if err != nil {
-		return err
+		backupPath, backupErr := backup(c.configPath, data, "corrupt")
+		if backupErr != nil {
+			return nil, fmt.Errorf("the configuration is corrupt (%v) and could not be backed up: %v", err, backupErr)
+		}
+		configPath, statePath := c.configPath, c.statePath
+		*c = *DefaultConfig()
+		c.configPath, c.statePath = configPath, statePath
+		problems = []string{fmt.Sprintf("the configuration could not be read (%v); it was moved to %s and the defaults are used", err, filepath.Base(backupPath))}
+		save = true
+	} else if migrated {
+		if _, err := backup(c.configPath, data, "pre-migration"); err != nil {
+			return problems, err
+		}
+	}
+
+	problems = append(problems, c.readState()...)
+	problems = append(problems, c.Validate()...)
+	if save {
+		return problems, c.Save()
+	}
+	return problems, nil
+}
+
+// Read loads the configuration and state files if there are any, keeping the
+// current values otherwise. Unlike Load it never writes or moves any file.
+func (c *Config) Read() ([]string, error) {
+	if err := c.locate(); err != nil {
+		return nil, err
+	}
+	configPath := c.configPath
+	if legacyPath := legacyConfigPath(configPath); legacyPath != "" {
+		configPath = legacyPath
+	}
+
+	var problems []string
+	data, err := ioutil.ReadFile(configPath)
+	if err == nil {
+		problems, _, err = c.decode(data)
 	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	problems = append(problems, c.readState()...)
+	return append(problems, c.Validate()...), nil
+}
 
-	// Parse JSON
-	err = json.Unmarshal(data, c)
+// Reload reads the configuration file again into a new configuration that
+// keeps the current state. Unlike Load it never writes: when the file cannot be
+// read the error is returned and the current configuration should stay in use.
+func (c *Config) Reload() (*Config, []string, error) {
+	next := DefaultConfig()
+	next.configPath, next.statePath = c.configPath, c.statePath
+	data, err := ioutil.ReadFile(c.configPath)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	problems, _, err := next.decode(data)
+	if err != nil {
+		return nil, nil, err
 	}
+	next.State = c.State
+	return next, append(problems, next.Validate()...), nil
+}
+
+// Path returns the path of the configuration file
+func (c *Config) Path() string {
+	return c.configPath
+}
 
+// readState loads the state file over the current state. A state file that
+// cannot be read is reported and left to be replaced on the next save.
+func (c *Config) readState() []string {
+	data, err := ioutil.ReadFile(c.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("the state could not be read (%v)", err)}
+	}
+	state := c.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return []string{fmt.Sprintf("the state could not be read (%v); recent files and the window size are reset", err)}
+	}
+	c.State = state
 	return nil
 }
 
-// Save saves the configuration to file
+// Save saves the configuration and the state to file
 func (c *Config) Save() error {
 	if c.configPath == "" {
-		configPath, err := getConfigPath()
-		if err != nil {
+		if err := c.locate(); err != nil {
 			return err
 		}
-		c.configPath = configPath
 	}
 
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(c.configPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	// Marshal to JSON
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(c.configPath, data); err != nil {
 		return err
 	}
 
-	// Marshal to JSON
-	data, err := json.MarshalIndent(c, "", "  ")
+	state, err := json.MarshalIndent(c.State, "", "  ")
 	if err != nil {
 		return err
 	}
+	return writeFile(c.statePath, state)
+}
 
-	// Write to file
-	return ioutil.WriteFile(c.configPath, data, 0644)
+// writeFile writes a file, creating its folder if it doesn't exist. The file
+// is replaced in one step, so that it is never seen half written.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
 }
 
-// AddRecentFile adds a file to the recent files list
+// AddRecentFile adds a file to the front of the recent files list. The list is
+// built anew rather than changed in place, so that copies of the configuration
+// handed out earlier keep theirs.
 func (c *Config) AddRecentFile(path string) {
-	// Remove if already exists
-	for i, file := range c.RecentFiles {
-		if file == path {
-			c.RecentFiles = append(c.RecentFiles[:i], c.RecentFiles[i+1:]...)
-			break
+	recent := make([]string, 0, maxRecentFiles)
+	recent = append(recent, path)
+	for _, file := range c.RecentFiles {
+		if file != path && len(recent) < maxRecentFiles {
+			recent = append(recent, file)
 		}
 	}
-
-	// Add to the front
-	c.RecentFiles = append([]string{path}, c.RecentFiles...)
-
-	// Limit to 10 recent files
-	if len(c.RecentFiles) > 10 {
-		c.RecentFiles = c.RecentFiles[:10]
-	}
-
-	// Save config
-	c.Save()
+	c.RecentFiles = recent
 }
 
 // GetAutoSaveDelayDuration returns the autosave delay as a time.Duration
@@ -134,19 +293,13 @@ func (c *Config) GetAutoSaveDelayDuration() time.Duration {
 	return time.Duration(c.AutoSaveDelay) * time.Second
 }
 
-// getConfigPath returns the path to the configuration file
-func getConfigPath() (string, error) {
-	// Get user's home directory
-	homeDir, err := os.UserHomeDir()
+// locate finds the configuration and state files
+func (c *Config) locate() error {
+	dirs, err := Locations()
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	// Create config directory path
-	configDir := filepath.Join(homeDir, ".markdown-editor")
-
-	// Create config file path
-	configPath := filepath.Join(configDir, "config.json")
-
-	return configPath, nil
+	c.configPath = filepath.Join(dirs.Config, "config.json")
+	c.statePath = filepath.Join(dirs.State, "state.json")
+	return nil
 }
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keybinding binds a key sequence to a command. The key is one chord, such as
+// "CmdOrCtrl+Shift+S", or several separated by spaces, such as "Ctrl+X Ctrl+S".
+// In user keybindings a command starting with "-" removes that binding.
+type Keybinding struct {
+	Key     string `json:"key"`
+	Command string `json:"command"`
+}
+
+// Chord is a key pressed with modifiers
+type Chord struct {
+	Ctrl  bool
+	Alt   bool
+	Shift bool
+	Meta  bool   // Command on macOS, the Windows or Super key elsewhere
+	Key   string // canonical key name, such as "S", "F5", "PageDown" or "/"
+}
+
+// Binding is a resolved keybinding
+type Binding struct {
+	Sequence []Chord
+	Command  string
+}
+
+// Keymap is the keybindings in effect on a platform: the defaults with the
+// user's keybindings applied
+type Keymap struct {
+	GOOS     string
+	Bindings []Binding
+}
+
+// defaultKeybindings are the keybindings of every platform
+var defaultKeybindings = []Keybinding{
+	{"CmdOrCtrl+N", "file.new"},
+	{"CmdOrCtrl+O", "file.open"},
+	{"CmdOrCtrl+S", "file.save"},
+	{"CmdOrCtrl+Shift+S", "file.saveAs"},
+	{"CmdOrCtrl+Z", "edit.undo"},
+	{"CmdOrCtrl+X", "edit.cut"},
+	{"CmdOrCtrl+C", "edit.copy"},
+	{"CmdOrCtrl+V", "edit.paste"},
+	{"CmdOrCtrl+A", "edit.selectAll"},
+	{"CmdOrCtrl+F", "edit.find"},
+	{"CmdOrCtrl+Shift+P", "view.commandPalette"},
+	{"CmdOrCtrl+K CmdOrCtrl+T", "view.toggleTheme"},
+	{"F5", "view.slideshow"},
+}
+
+// platformKeybindings are the keybindings that differ between platforms
+var platformKeybindings = map[string][]Keybinding{
+	"darwin": {
+		{"Cmd+Shift+Z", "edit.redo"},
+		{"Cmd+Alt+F", "edit.replace"},
+		{"Shift+Alt+F", "format.document"},
+	},
+	"windows": {
+		{"Ctrl+Y", "edit.redo"},
+		{"Ctrl+H", "edit.replace"},
+		{"Shift+Alt+F", "format.document"},
+	},
+	"linux": {
+		{"Ctrl+Shift+Z", "edit.redo"},
+		{"Ctrl+H", "edit.replace"},
+		{"Ctrl+Shift+I", "format.document"},
+	},
+}
+
+// DefaultKeybindings returns the keybindings a platform starts with
+func DefaultKeybindings(goos string) []Keybinding {
+	bindings := append([]Keybinding{}, defaultKeybindings...)
+	platform, ok := platformKeybindings[goos]
+	if !ok {
+		platform = platformKeybindings["linux"]
+	}
+	return append(bindings, platform...)
+}
+
+// Keymap resolves the keybindings in effect on a platform. Keybindings that do
+// not parse, name commands that known rejects, or conflict with others are
+// left out and reported as problems.
+func (c *Config) Keymap(goos string, known func(command string) bool) (*Keymap, []string) {
+	keymap := &Keymap{GOOS: goos}
+	var problems []string
+	for _, binding := range DefaultKeybindings(goos) {
+		sequence, err := ParseKeySequence(binding.Key, goos)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("default keybinding %q: %v", binding.Key, err))
+			continue
+		}
+		keymap.Bindings = append(keymap.Bindings, Binding{Sequence: sequence, Command: binding.Command})
+	}
+
+	// User keybindings replace the defaults on the same keys
+	userKeys := map[string]string{}
+	for _, binding := range c.Keybindings {
+		sequence, err := ParseKeySequence(binding.Key, goos)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("keybinding %q: %v", binding.Key, err))
+			continue
+		}
+		key := keymap.Format(sequence)
+
+		if removed := strings.TrimPrefix(binding.Command, "-"); removed != binding.Command {
+			keymap.remove(key, removed)
+			continue
+		}
+		if binding.Command == "" || !known(binding.Command) {
+			problems = append(problems, fmt.Sprintf("keybinding %q: unknown command %q", binding.Key, binding.Command))
+			continue
+		}
+		if previous, ok := userKeys[key]; ok && previous != binding.Command {
+			problems = append(problems, fmt.Sprintf("keybinding %q is bound to both %s and %s; using %s", key, previous, binding.Command, binding.Command))
+		}
+		userKeys[key] = binding.Command
+		keymap.remove(key, "")
+		keymap.Bindings = append(keymap.Bindings, Binding{Sequence: sequence, Command: binding.Command})
+	}
+
+	// A binding that starts with the whole of another one can never be typed
+	var reachable []Binding
+	for _, binding := range keymap.Bindings {
+		if prefix := keymap.prefixOf(binding); prefix != nil {
+			problems = append(problems, fmt.Sprintf("keybinding %q for %s cannot be used because %q runs %s",
+				keymap.Format(binding.Sequence), binding.Command, keymap.Format(prefix.Sequence), prefix.Command))
+			continue
+		}
+		reachable = append(reachable, binding)
+	}
+	keymap.Bindings = reachable
+	return keymap, problems
+}
+
+// remove drops the bindings of a key sequence, only those of a command when
+// one is given
+func (k *Keymap) remove(key string, command string) {
+	kept := k.Bindings[:0]
+	for _, binding := range k.Bindings {
+		if k.Format(binding.Sequence) == key && (command == "" || binding.Command == command) {
+			continue
+		}
+		kept = append(kept, binding)
+	}
+	k.Bindings = kept
+}
+
+// prefixOf returns a binding whose whole sequence starts the sequence of
+// another, longer binding
+func (k *Keymap) prefixOf(binding Binding) *Binding {
+	for i, other := range k.Bindings {
+		if len(other.Sequence) >= len(binding.Sequence) {
+			continue
+		}
+		prefix := true
+		for j, chord := range other.Sequence {
+			if chord != binding.Sequence[j] {
+				prefix = false
+				break
+			}
+		}
+		if prefix {
+			return &k.Bindings[i]
+		}
+	}
+	return nil
+}
+
+// For returns the bindings of a command, in the order they were made
+func (k *Keymap) For(command string) []Binding {
+	var bindings []Binding
+	for _, binding := range k.Bindings {
+		if binding.Command == command {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings
+}
+
+// Format returns the canonical form of a key sequence, which the frontend
+// builds from key events: the modifiers in the order Ctrl, Alt, Shift, Meta
+// and then the key, with chords separated by spaces
+func (k *Keymap) Format(sequence []Chord) string {
+	return formatSequence(sequence, "Ctrl", "Alt", "Meta")
+}
+
+// Label returns a key sequence as the platform shows it
+func (k *Keymap) Label(sequence []Chord) string {
+	if k.GOOS == "darwin" {
+		return formatSequence(sequence, "Ctrl", "Option", "Cmd")
+	}
+	return formatSequence(sequence, "Ctrl", "Alt", "Meta")
+}
+
+func formatSequence(sequence []Chord, ctrl, alt, meta string) string {
+	chords := make([]string, len(sequence))
+	for i, chord := range sequence {
+		var parts []string
+		if chord.Ctrl {
+			parts = append(parts, ctrl)
+		}
+		if chord.Alt {
+			parts = append(parts, alt)
+		}
+		if chord.Shift {
+			parts = append(parts, "Shift")
+		}
+		if chord.Meta {
+			parts = append(parts, meta)
+		}
+		chords[i] = strings.Join(append(parts, chord.Key), "+")
+	}
+	return strings.Join(chords, " ")
+}
+
+// Names of the keys that are not single characters, by lower case name
+var namedKeys = map[string]string{
+	"enter": "Enter", "return": "Enter", "escape": "Escape", "esc": "Escape",
+	"tab": "Tab", "space": "Space", "backspace": "Backspace", "delete": "Delete",
+	"insert": "Insert", "home": "Home", "end": "End", "pageup": "PageUp",
+	"pagedown": "PageDown", "up": "Up", "down": "Down", "left": "Left", "right": "Right",
+}
+
+// Characters that can be bound besides letters and digits
+const punctuationKeys = "/\\,.;'[]-=`"
+
+// ParseKeySequence parses a key sequence for a platform, where CmdOrCtrl is
+// Cmd on macOS and Ctrl elsewhere
+func ParseKeySequence(key string, goos string) ([]Chord, error) {
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		return nil, errors.New("no key given")
+	}
+	sequence := make([]Chord, 0, len(fields))
+	for _, field := range fields {
+		chord, err := parseChord(field, goos)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, chord)
+	}
+	return sequence, nil
+}
+
+func parseChord(text string, goos string) (Chord, error) {
+	var chord Chord
+	parts := strings.Split(text, "+")
+	for _, part := range parts[:len(parts)-1] {
+		var modifier *bool
+		switch strings.ToLower(part) {
+		case "ctrl", "control":
+			modifier = &chord.Ctrl
+		case "alt", "option", "opt":
+			modifier = &chord.Alt
+		case "shift":
+			modifier = &chord.Shift
+		case "cmd", "command", "meta", "super", "win":
+			modifier = &chord.Meta
+		case "cmdorctrl", "commandorcontrol":
+			modifier = &chord.Ctrl
+			if goos == "darwin" {
+				modifier = &chord.Meta
+			}
+		case "":
+			return chord, errors.New("'+' cannot be bound; use Shift+=")
+		default:
+			return chord, fmt.Errorf("unknown modifier %q", part)
+		}
+		if *modifier {
+			return chord, fmt.Errorf("modifier %q given twice", part)
+		}
+		*modifier = true
+	}
+
+	key := parts[len(parts)-1]
+	lower := strings.ToLower(key)
+	switch {
+	case key == "":
+		return chord, errors.New("no key after the modifiers")
+	case namedKeys[lower] != "":
+		chord.Key = namedKeys[lower]
+	case len(lower) >= 2 && lower[0] == 'f' && isFunctionKey(lower[1:]):
+		chord.Key = "F" + lower[1:]
+	case len(key) == 1 && (lower[0] >= 'a' && lower[0] <= 'z' || lower[0] >= '0' && lower[0] <= '9'):
+		chord.Key = strings.ToUpper(key)
+	case len(key) == 1 && strings.Contains(punctuationKeys, key):
+		chord.Key = key
+	default:
+		return chord, fmt.Errorf("unknown key %q", key)
+	}
+	return chord, nil
+}
+
+// isFunctionKey reports whether digits number a function key, F1 to F24
+func isFunctionKey(digits string) bool {
+	n := 0
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n >= 1 && n <= 24 && digits[0] != '0'
+}
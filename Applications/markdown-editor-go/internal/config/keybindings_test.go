@@ -0,0 +1,108 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeymap(t *testing.T) {
+	known := func(command string) bool { return !strings.HasPrefix(command, "unknown.") }
+
+	tests := []struct {
+		name     string
+		goos     string
+		user     []Keybinding
+		want     []string // key=command bindings that are in effect
+		absent   []string // and those that are not
+		problems int
+	}{
+		{
+			name:   "linux defaults",
+			goos:   "linux",
+			want:   []string{"Ctrl+S=file.save", "Ctrl+K Ctrl+T=view.toggleTheme", "Ctrl+Shift+I=format.document", "Ctrl+C=edit.copy", "Ctrl+Shift+Z=edit.redo"},
+			absent: []string{"Alt+Shift+F=format.document", "Ctrl+Y=edit.redo"},
+		},
+		{
+			name:   "macOS defaults",
+			goos:   "darwin",
+			want:   []string{"Meta+S=file.save", "Meta+K Meta+T=view.toggleTheme", "Alt+Shift+F=format.document", "Meta+C=edit.copy", "Shift+Meta+Z=edit.redo", "Alt+Meta+F=edit.replace"},
+			absent: []string{"Ctrl+S=file.save", "Ctrl+Shift+I=format.document"},
+		},
+		{
+			name:   "Windows defaults",
+			goos:   "windows",
+			want:   []string{"Ctrl+S=file.save", "Alt+Shift+F=format.document", "Ctrl+Y=edit.redo", "Ctrl+H=edit.replace"},
+			absent: []string{"Ctrl+Shift+I=format.document", "Ctrl+Shift+Z=edit.redo"},
+		},
+		{
+			name: "other platforms take the Linux defaults",
+			goos: "freebsd",
+			want: []string{"Ctrl+Shift+I=format.document"},
+		},
+		{
+			name:   "a user binding replaces the default on its key",
+			goos:   "linux",
+			user:   []Keybinding{{"CmdOrCtrl+S", "format.document"}},
+			want:   []string{"Ctrl+S=format.document", "Ctrl+Shift+I=format.document"},
+			absent: []string{"Ctrl+S=file.save"},
+		},
+		{
+			name: "a user binding adds to the bindings of a command",
+			goos: "linux",
+			user: []Keybinding{{"Ctrl+Alt+S", "file.save"}},
+			want: []string{"Ctrl+S=file.save", "Ctrl+Alt+S=file.save"},
+		},
+		{
+			name:   "a minus removes a default",
+			goos:   "linux",
+			user:   []Keybinding{{"Ctrl+S", "-file.save"}, {"F5", "-view.slideshow"}},
+			want:   []string{"Ctrl+O=file.open"},
+			absent: []string{"Ctrl+S=file.save", "F5=view.slideshow"},
+		},
+		{
+			name: "a minus leaves the bindings of other commands",
+			goos: "linux",
+			user: []Keybinding{{"Ctrl+S", "-file.open"}},
+			want: []string{"Ctrl+S=file.save", "Ctrl+O=file.open"},
+		},
+		{
+			name:     "unknown commands and keys are reported",
+			goos:     "linux",
+			user:     []Keybinding{{"Ctrl+J", "unknown.command"}, {"Ctrl+Nope", "file.save"}},
+			want:     []string{"Ctrl+S=file.save"},
+			absent:   []string{"Ctrl+J=unknown.command"},
+			problems: 2,
+		},
+		{
+			name:     "a binding that starts another makes it unreachable",
+			goos:     "linux",
+			user:     []Keybinding{{"Ctrl+K", "file.new"}},
+			want:     []string{"Ctrl+K=file.new"},
+			absent:   []string{"Ctrl+K Ctrl+T=view.toggleTheme"},
+			problems: 1,
+		},
+	}
+
+	for _, test := range tests {
+		config := &Config{Keybindings: test.user}
+		keymap, problems := config.Keymap(test.goos, known)
+		if len(problems) != test.problems {
+			t.Errorf("%s: problems = %q, want %d", test.name, problems, test.problems)
+		}
+
+		bindings := map[string]bool{}
+		for _, binding := range keymap.Bindings {
+			bindings[keymap.Format(binding.Sequence)+"="+binding.Command] = true
+		}
+		for _, binding := range test.want {
+			if !bindings[binding] {
+				t.Errorf("%s: %s is missing from %v", test.name, binding, bindings)
+			}
+		}
+		for _, binding := range test.absent {
+			if bindings[binding] {
+				t.Errorf("%s: %s is in effect", test.name, binding)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DirEnv names the environment variable that puts all of the editor's files in
+// one folder, as the --config-dir flag does
+const DirEnv = "MARKDOWN_EDITOR_CONFIG_DIR"
+
+// DirFlag is the command line flag that puts all of the editor's files in one
+// folder
+const DirFlag = "--config-dir"
+
+// dirOverride is the folder given with --config-dir
+var dirOverride string
+
+// Dirs are the folders of the editor's files
+type Dirs struct {
+	Config string // settings: config.json
+	State  string // what is remembered between runs: recent files, window size, the instance socket
+	Data   string // files documents link to that have no folder of their own, such as images pasted into unsaved documents
+	Cache  string // files that can be recreated
+}
+
+// SetDir puts all of the editor's files in one folder, overriding the
+// environment
+func SetDir(dir string) {
+	dirOverride = dir
+}
+
+// TakeDirFlag removes --config-dir and its folder from command line arguments,
+// wherever they are before "--", and applies it
+func TakeDirFlag(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(rest, args[i:]...), nil
+		case arg == DirFlag:
+			if i+1 >= len(args) {
+				return nil, errors.New(DirFlag + " needs a folder")
+			}
+			i++
+			SetDir(args[i])
+		case strings.HasPrefix(arg, DirFlag+"="):
+			SetDir(strings.TrimPrefix(arg, DirFlag+"="))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+// Locations returns the folders of the editor's files. They are, in order of
+// precedence, subfolders of the --config-dir folder or of $MARKDOWN_EDITOR_CONFIG_DIR,
+// or the platform's own folders: the XDG base directories on Linux and other
+// Unix systems, ~/Library on macOS and %APPDATA% and %LOCALAPPDATA% on Windows.
+func Locations() (Dirs, error) {
+	root := dirOverride
+	if root == "" {
+		root = os.Getenv(DirEnv)
+	}
+	if root != "" {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return Dirs{}, err
+		}
+		return Dirs{
+			Config: root,
+			State:  filepath.Join(root, "state"),
+			Data:   filepath.Join(root, "data"),
+			Cache:  filepath.Join(root, "cache"),
+		}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Dirs{}, err
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support", "Markdown Editor")
+		return Dirs{
+			Config: support,
+			State:  filepath.Join(support, "State"),
+			Data:   filepath.Join(support, "Data"),
+			Cache:  filepath.Join(home, "Library", "Caches", "Markdown Editor"),
+		}, nil
+
+	case "windows":
+		roaming := os.Getenv("APPDATA")
+		local := os.Getenv("LOCALAPPDATA")
+		if roaming == "" {
+			roaming = filepath.Join(home, "AppData", "Roaming")
+		}
+		if local == "" {
+			local = filepath.Join(home, "AppData", "Local")
+		}
+		return Dirs{
+			Config: filepath.Join(roaming, "Markdown Editor"),
+			State:  filepath.Join(local, "Markdown Editor", "State"),
+			Data:   filepath.Join(local, "Markdown Editor", "Data"),
+			Cache:  filepath.Join(local, "Markdown Editor", "Cache"),
+		}, nil
+	}
+
+	return Dirs{
+		Config: filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), "markdown-editor"),
+		State:  filepath.Join(xdgDir("XDG_STATE_HOME", home, ".local", "state"), "markdown-editor"),
+		Data:   filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local", "share"), "markdown-editor"),
+		Cache:  filepath.Join(xdgDir("XDG_CACHE_HOME", home, ".cache"), "markdown-editor"),
+	}, nil
+}
+
+// ThemesDir returns the folder of the user's theme files, in the
+// configuration folder
+func ThemesDir() (string, error) {
+	dirs, err := Locations()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dirs.Config, "themes"), nil
+}
+
+// xdgDir returns an XDG base directory, or its default under the home folder
+// when the variable is unset. The specification says relative paths are
+// invalid and must be ignored.
+func xdgDir(env string, home string, defaults ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, defaults...)...)
+}
+
+// legacyDir returns the folder every file was kept in before the platform
+// folders were used
+func legacyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".markdown-editor"), nil
+}
+
+// legacyConfigPath returns the configuration file in the old folder when the
+// platform folders are used and it has not been moved yet
+func legacyConfigPath(configPath string) string {
+	if dirOverride != "" || os.Getenv(DirEnv) != "" {
+		return ""
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		return ""
+	}
+	dir, err := legacyDir()
+	if err != nil {
+		return ""
+	}
+	legacyPath := filepath.Join(dir, "config.json")
+	if _, err := os.Stat(legacyPath); err != nil {
+		return ""
+	}
+	return legacyPath
+}
+
+// moveLegacyConfig moves the configuration file from the old folder to the
+// configuration folder, and the old folder away when nothing else is left
+// in it
+func moveLegacyConfig(configPath string) error {
+	legacyPath := legacyConfigPath(configPath)
+	if legacyPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(legacyPath, configPath); err != nil {
+		// The folders may be on different file systems
+		data, err := ioutil.ReadFile(legacyPath)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(configPath, data, 0644); err != nil {
+			return err
+		}
+		os.Remove(legacyPath)
+	}
+	os.Remove(filepath.Dir(legacyPath))
+	return nil
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// useDirs clears the folder override and its variable, as when the editor is
+// started without them, for the length of a test
+func useDirs(t *testing.T) {
+	t.Helper()
+	saved := dirOverride
+	dirOverride = ""
+	t.Cleanup(func() { dirOverride = saved })
+	t.Setenv(DirEnv, "")
+}
+
+// useXDG points the home folder and the XDG base directories at temporary
+// folders. The XDG variables only apply on Linux and other Unix systems.
+func useXDG(t *testing.T) (home string, configHome string, stateHome string) {
+	t.Helper()
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the XDG base directories are not used on " + runtime.GOOS)
+	}
+	useDirs(t)
+	home, configHome, stateHome = t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	return home, configHome, stateHome
+}
+
+func TestTakeDirFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		rest []string
+		dir  string
+	}{
+		{[]string{"notes.md"}, []string{"notes.md"}, ""},
+		{[]string{DirFlag, "/tmp/a", "notes.md"}, []string{"notes.md"}, "/tmp/a"},
+		{[]string{"notes.md", DirFlag + "=/tmp/b"}, []string{"notes.md"}, "/tmp/b"},
+		{[]string{"--", DirFlag, "/tmp/c"}, []string{"--", DirFlag, "/tmp/c"}, ""},
+		{[]string{"a.md", DirFlag, "/tmp/d", "--", "b.md"}, []string{"a.md", "--", "b.md"}, "/tmp/d"},
+	}
+	for _, test := range tests {
+		useDirs(t)
+		rest, err := TakeDirFlag(test.args)
+		if err != nil {
+			t.Errorf("TakeDirFlag(%q): %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("TakeDirFlag(%q) = %q, want %q", test.args, rest, test.rest)
+		}
+		if dirOverride != test.dir {
+			t.Errorf("TakeDirFlag(%q) set the folder %q, want %q", test.args, dirOverride, test.dir)
+		}
+	}
+
+	useDirs(t)
+	if _, err := TakeDirFlag([]string{"notes.md", DirFlag}); err == nil {
+		t.Errorf("TakeDirFlag accepted %s without a folder", DirFlag)
+	}
+}
+
+func TestLocationsOverride(t *testing.T) {
+	useDirs(t)
+	envDir, flagDir := t.TempDir(), t.TempDir()
+
+	t.Setenv(DirEnv, envDir)
+	dirs, err := Locations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Dirs{Config: envDir, State: filepath.Join(envDir, "state"), Data: filepath.Join(envDir, "data"), Cache: filepath.Join(envDir, "cache")}
+	if dirs != want {
+		t.Errorf("with %s: Locations() = %+v, want %+v", DirEnv, dirs, want)
+	}
+
+	// The flag comes before the variable
+	SetDir(flagDir)
+	dirs, err = Locations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirs.Config != flagDir {
+		t.Errorf("with %s: the configuration folder is %s, want %s", DirFlag, dirs.Config, flagDir)
+	}
+}
+
+func TestLocationsXDG(t *testing.T) {
+	home, configHome, stateHome := useXDG(t)
+	dirs, err := Locations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Dirs{
+		Config: filepath.Join(configHome, "markdown-editor"),
+		State:  filepath.Join(stateHome, "markdown-editor"),
+		Data:   filepath.Join(home, ".local", "share", "markdown-editor"),
+		Cache:  filepath.Join(home, ".cache", "markdown-editor"),
+	}
+	if dirs != want {
+		t.Errorf("Locations() = %+v, want %+v", dirs, want)
+	}
+
+	// Relative paths are invalid and ignored
+	t.Setenv("XDG_CONFIG_HOME", "relative/config")
+	dirs, err = Locations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "markdown-editor"); dirs.Config != want {
+		t.Errorf("with a relative XDG_CONFIG_HOME the configuration folder is %s, want %s", dirs.Config, want)
+	}
+}
+
+func TestLoadMovesLegacyConfig(t *testing.T) {
+	home, configHome, stateHome := useXDG(t)
+	legacy := filepath.Join(home, ".markdown-editor")
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A file from before versions, which kept the recent files with the settings
+	old := `{"fontSize": 18, "isDarkMode": true, "recentFiles": ["/notes/a.md"], "windowWidth": 1000, "windowHeight": 700}`
+	if err := ioutil.WriteFile(filepath.Join(legacy, "config.json"), []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := DefaultConfig()
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.FontSize != 18 || !c.IsDarkMode || c.ThemeMode != "manual" {
+		t.Errorf("settings were not kept: fontSize %d, isDarkMode %v, themeMode %s", c.FontSize, c.IsDarkMode, c.ThemeMode)
+	}
+	if !reflect.DeepEqual(c.RecentFiles, []string{"/notes/a.md"}) || c.WindowWidth != 1000 {
+		t.Errorf("the state was not kept: recent files %q, window width %d", c.RecentFiles, c.WindowWidth)
+	}
+
+	if want := filepath.Join(configHome, "markdown-editor", "config.json"); c.Path() != want {
+		t.Errorf("the configuration is at %s, want %s", c.Path(), want)
+	}
+	if _, err := os.Stat(filepath.Join(stateHome, "markdown-editor", "state.json")); err != nil {
+		t.Errorf("the state file was not written: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("the old folder was left behind: %v", err)
+	}
+
+	// Loading again reads the moved file
+	again := DefaultConfig()
+	if _, err := again.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if again.FontSize != 18 {
+		t.Errorf("after the move fontSize is %d, want 18", again.FontSize)
+	}
+}
+
+func TestLoadKeepsLegacyFolderWithOtherFiles(t *testing.T) {
+	home, _, _ := useXDG(t)
+	legacy := filepath.Join(home, ".markdown-editor")
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(legacy, "config.json"), []byte(`{"version": 3}`), 0644)
+	ioutil.WriteFile(filepath.Join(legacy, "notes.txt"), []byte("mine"), 0644)
+
+	if _, err := DefaultConfig().Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "notes.txt")); err != nil {
+		t.Errorf("a file of the user's in the old folder was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "config.json")); !os.IsNotExist(err) {
+		t.Errorf("the old configuration file was not moved: %v", err)
+	}
+}
+
+func TestOverrideSkipsLegacyConfig(t *testing.T) {
+	home, _, _ := useXDG(t)
+	legacy := filepath.Join(home, ".markdown-editor")
+	os.MkdirAll(legacy, 0755)
+	ioutil.WriteFile(filepath.Join(legacy, "config.json"), []byte(`{"fontSize": 18}`), 0644)
+
+	dir := t.TempDir()
+	SetDir(dir)
+	c := DefaultConfig()
+	if _, err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.FontSize == 18 {
+		t.Errorf("the old configuration was used with %s", DirFlag)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "config.json")); err != nil {
+		t.Errorf("the old configuration was moved with %s: %v", DirFlag, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config.json")); err != nil {
+		t.Errorf("no configuration was written to the override folder: %v", err)
+	}
+}
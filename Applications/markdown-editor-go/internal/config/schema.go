@@ -0,0 +1,225 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// CurrentVersion is the version of the configuration schema this build writes
+const CurrentVersion = 3
+
+// migration upgrades a configuration, decoded as a JSON object, from the
+// version before it to its version
+type migration struct {
+	version int
+	migrate func(fields map[string]interface{})
+}
+
+// migrations run in order on files older than their version. Renaming or
+// removing a setting needs a migration that moves or drops its field.
+var migrations = []migration{
+	// Version 1 adds the version field itself; older files need no change
+	{1, func(fields map[string]interface{}) {}},
+	// Version 2 moves recent files and the window size to the state file
+	{2, func(fields map[string]interface{}) {
+		delete(fields, "recentFiles")
+		delete(fields, "windowWidth")
+		delete(fields, "windowHeight")
+	}},
+	// Version 3 follows the system's appearance by default; files from before
+	// keep the mode chosen in them
+	{3, func(fields map[string]interface{}) {
+		if _, ok := fields["themeMode"]; !ok {
+			fields["themeMode"] = "manual"
+		}
+	}},
+}
+
+// stateVersion is the first version that keeps the state in its own file
+const stateVersion = 2
+
+// Limits of the numeric settings
+const (
+	minFontSize      = 6
+	maxFontSize      = 72
+	maxTabSize       = 16
+	maxAutoSaveDelay = 3600 // an hour, in seconds
+	minWindowWidth   = 800
+	minWindowHeight  = 600
+	maxWindowSize    = 10000
+	maxRecentFiles   = 10
+)
+
+// decode reads a configuration file over the current values, migrating it to
+// the current version. It returns what was left out, and whether the file was
+// migrated. An error means the file is not a JSON object at all.
+func (c *Config) decode(data []byte) (problems []string, migrated bool, err error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false, err
+	}
+	if fields == nil {
+		return nil, false, fmt.Errorf("the configuration is not a JSON object")
+	}
+
+	version := 0
+	if v, ok := fields["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > CurrentVersion {
+		problems = append(problems, fmt.Sprintf("the configuration was written by a newer version (%d); settings this version does not know are dropped when it is saved", version))
+	}
+	if version < stateVersion {
+		if err := json.Unmarshal(data, &c.State); err != nil {
+			problems = append(problems, typeProblem(err))
+		}
+	}
+	for _, m := range migrations {
+		if m.version > version {
+			m.migrate(fields)
+			fields["version"] = float64(m.version)
+			migrated = true
+		}
+	}
+
+	// Fields of the wrong type keep their current values
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(upgraded, c); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return nil, false, err
+		}
+		problems = append(problems, typeProblem(err))
+	}
+	return problems, migrated, nil
+}
+
+// typeProblem describes a field of the wrong type
+func typeProblem(err error) string {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return fmt.Sprintf("%s should be %s, not %s; using the default", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return err.Error()
+}
+
+// Validate replaces settings that are out of range or invalid, clamping
+// numbers to their limits and falling back to the defaults otherwise. It
+// returns a description of each change.
+func (c *Config) Validate() []string {
+	var problems []string
+	defaults := DefaultConfig()
+
+	if c.Version < CurrentVersion {
+		c.Version = CurrentVersion
+	}
+	validateRange(&problems, "fontSize", &c.FontSize, minFontSize, maxFontSize, defaults.FontSize)
+	validateRange(&problems, "tabSize", &c.TabSize, 1, maxTabSize, defaults.TabSize)
+	validateRange(&problems, "autoSaveDelay", &c.AutoSaveDelay, 1, maxAutoSaveDelay, defaults.AutoSaveDelay)
+	validateRange(&problems, "windowWidth", &c.WindowWidth, minWindowWidth, maxWindowSize, defaults.WindowWidth)
+	validateRange(&problems, "windowHeight", &c.WindowHeight, minWindowHeight, maxWindowSize, defaults.WindowHeight)
+
+	validateChoice(&problems, "themeMode", &c.ThemeMode, defaults.ThemeMode, "manual", "system", "schedule")
+	validateClock(&problems, "darkModeStart", &c.DarkModeStart, defaults.DarkModeStart)
+	validateClock(&problems, "darkModeEnd", &c.DarkModeEnd, defaults.DarkModeEnd)
+	if c.DarkModeStart == c.DarkModeEnd {
+		problems = append(problems, fmt.Sprintf("darkModeStart and darkModeEnd are both %q, which leaves no time for dark mode; using %q and %q", c.DarkModeStart, defaults.DarkModeStart, defaults.DarkModeEnd))
+		c.DarkModeStart, c.DarkModeEnd = defaults.DarkModeStart, defaults.DarkModeEnd
+	}
+	if strings.TrimSpace(c.LightTheme) == "" {
+		c.LightTheme = defaults.LightTheme
+		problems = append(problems, fmt.Sprintf("lightTheme is empty; using %q", c.LightTheme))
+	}
+	if strings.TrimSpace(c.DarkTheme) == "" {
+		c.DarkTheme = defaults.DarkTheme
+		problems = append(problems, fmt.Sprintf("darkTheme is empty; using %q", c.DarkTheme))
+	}
+	if strings.TrimSpace(c.FontFamily) == "" {
+		c.FontFamily = defaults.FontFamily
+		problems = append(problems, fmt.Sprintf("fontFamily is empty; using %q", c.FontFamily))
+	}
+	if format := c.Format.Normalize(); format != c.Format {
+		c.Format = format
+		problems = append(problems, "format has invalid values; using the defaults for them")
+	}
+
+	validateChoice(&problems, "export.htmlImages", &c.Export.HTMLImages, defaults.Export.HTMLImages, "inline", "copy", "link")
+	validateChoice(&problems, "export.pdfPageSize", &c.Export.PDFPageSize, defaults.Export.PDFPageSize, "A4", "A5", "Letter", "Legal")
+	if c.Lint == nil {
+		c.Lint = map[string]interface{}{}
+	}
+	if enabled, ok := c.Lint["default"]; ok {
+		if _, ok := enabled.(bool); !ok {
+			delete(c.Lint, "default")
+			problems = append(problems, "lint.default should be true or false; every rule is enabled")
+		}
+	}
+
+	if c.Keybindings == nil {
+		c.Keybindings = []Keybinding{}
+	}
+	recent := []string{}
+	seen := map[string]bool{}
+	for _, path := range c.RecentFiles {
+		if path != "" && !seen[path] && len(recent) < maxRecentFiles {
+			recent = append(recent, path)
+			seen[path] = true
+		}
+	}
+	if len(recent) != len(c.RecentFiles) {
+		problems = append(problems, "recentFiles had empty, repeated or extra entries; they were removed")
+	}
+	c.RecentFiles = recent
+	return problems
+}
+
+// validateRange clamps a number to its limits. Zero and negative numbers are
+// not valid for any setting and are replaced by the default.
+func validateRange(problems *[]string, name string, value *int, min int, max int, fallback int) {
+	switch {
+	case *value <= 0:
+		*problems = append(*problems, fmt.Sprintf("%s %d is not valid; using %d", name, *value, fallback))
+		*value = fallback
+	case *value < min:
+		*problems = append(*problems, fmt.Sprintf("%s %d is below %d; using %d", name, *value, min, min))
+		*value = min
+	case *value > max:
+		*problems = append(*problems, fmt.Sprintf("%s %d is above %d; using %d", name, *value, max, max))
+		*value = max
+	}
+}
+
+// validateChoice replaces a value that is not one of the choices with the
+// default
+func validateChoice(problems *[]string, name string, value *string, fallback string, choices ...string) {
+	for _, choice := range choices {
+		if *value == choice {
+			return
+		}
+	}
+	*problems = append(*problems, fmt.Sprintf("%s %q is not one of %s; using %q", name, *value, strings.Join(choices, ", "), fallback))
+	*value = fallback
+}
+
+// validateClock replaces a time of day that is not written "15:04" with the
+// default
+func validateClock(problems *[]string, name string, value *string, fallback string) {
+	if _, err := time.Parse("15:04", *value); err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s %q is not a time like \"19:30\"; using %q", name, *value, fallback))
+		*value = fallback
+	}
+}
+
+// backup copies the configuration file aside before it is replaced and
+// returns the path of the copy
+func backup(path string, data []byte, reason string) (string, error) {
+	backupPath := path + "." + reason + "-" + time.Now().Format("20060102-150405") + ".bak"
+	if err := ioutil.WriteFile(backupPath, data, 0644); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
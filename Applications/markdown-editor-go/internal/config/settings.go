@@ -0,0 +1,463 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+// Layers settings are resolved from, each overriding the ones before it
+const (
+	LayerDefault   = "default"
+	LayerUser      = "user"
+	LayerWorkspace = "workspace"
+	LayerDocument  = "document"
+)
+
+// WorkspaceSettingsFile is the settings file of a workspace, searched for in a
+// document's folder and its parents
+var WorkspaceSettingsFile = filepath.Join(".markdown-editor", "settings.json")
+
+// frontMatterSource is the source of the settings set by the document itself
+const frontMatterSource = "front matter"
+
+// userSettings belong to the user rather than to documents, so workspaces and
+// front matter cannot set them
+var userSettings = map[string]bool{
+	"version":         true,
+	"themeMode":       true,
+	"isDarkMode":      true,
+	"darkModeStart":   true,
+	"darkModeEnd":     true,
+	"lightTheme":      true,
+	"darkTheme":       true,
+	"autoSaveEnabled": true,
+	"autoSaveDelay":   true,
+	"keybindings":     true,
+}
+
+// openSettings hold keys of their own rather than a fixed set of fields
+var openSettings = map[string]bool{
+	"lint": true,
+}
+
+// pathSettings name files. Relative paths set by a workspace or a document
+// are relative to the workspace folder or the document's folder.
+var pathSettings = map[string]bool{
+	"docxReferenceDoc": true,
+	"latexTemplate":    true,
+}
+
+// Setting is the effective value of a setting and where it came from
+type Setting struct {
+	Key    string      `json:"key"` // dotted path, such as "format.bulletChar"
+	Value  interface{} `json:"value"`
+	Layer  string      `json:"layer"`  // one of the Layer constants
+	Source string      `json:"source"` // the file it was read from, "front matter", or "" for the defaults
+}
+
+// Settings are the settings in effect for a document
+type Settings struct {
+	// Config holds the effective values. It is not the user's configuration
+	// and must not be saved.
+	Config Config
+
+	// Problems are the settings of the workspace and the document that were
+	// ignored or changed
+	Problems []string
+
+	// Files whose changes change the settings: the configuration file, the
+	// workspace's lint configuration and settings file, or where the
+	// document's folder would have its settings file
+	Files []string
+
+	values map[string]Setting
+}
+
+// SettingChange is a setting whose effective value changed
+type SettingChange struct {
+	Key   string      `json:"key"`
+	Old   interface{} `json:"old"`   // nil for a setting that was not set before
+	New   interface{} `json:"new"`   // nil for a setting that is no longer set
+	Layer string      `json:"layer"` // the layer of the new value
+}
+
+// layer is what one layer sets, by dotted key
+type layer struct {
+	name   string
+	source string
+	values map[string]interface{}
+}
+
+// Resolve layers the settings in effect for a document: the defaults, then the
+// user's configuration, then the settings of the document's workspace, then the
+// document's front matter. dir is the document's folder, "" for an unsaved
+// document, and content its text. User settings equal to the defaults are
+// reported as defaults.
+func (c *Config) Resolve(dir string, content string) *Settings {
+	s := &Settings{values: map[string]Setting{}, Files: []string{c.configPath}}
+	defaults := flatten(DefaultConfig())
+
+	changed := map[string]interface{}{}
+	for key, value := range flatten(c) {
+		if !reflect.DeepEqual(value, defaults[key]) {
+			changed[key] = value
+		}
+	}
+	layers := []layer{
+		{LayerDefault, "", defaults},
+		{LayerUser, c.configPath, changed},
+	}
+	if dir != "" {
+		layers = append(layers, s.workspaceLayers(dir, defaults)...)
+	}
+	layers = append(layers, s.frontMatterLayer(dir, content, defaults))
+
+	merged := map[string]interface{}{}
+	for _, l := range layers {
+		s.apply(merged, l)
+	}
+
+	// Every key comes from the defaults or was checked against them, so
+	// the values decode into the types of the fields
+	effective := DefaultConfig()
+	data, err := json.Marshal(unflatten(merged))
+	if err == nil {
+		err = json.Unmarshal(data, effective)
+	}
+	if err != nil {
+		s.Problems = append(s.Problems, err.Error())
+	}
+	effective.State = c.State
+	effective.configPath = ""
+	effective.statePath = ""
+	s.Problems = append(s.Problems, effective.Validate()...)
+	s.Config = *effective
+
+	// Report the values validation changed
+	for key, value := range flatten(effective) {
+		if setting, ok := s.values[key]; ok {
+			setting.Value = value
+			s.values[key] = setting
+		}
+	}
+	return s
+}
+
+// Diff returns the settings whose values differ from those in effect before,
+// sorted by key. Settings that kept their value but are set by another layer
+// did not change.
+func (s *Settings) Diff(before *Settings) []SettingChange {
+	var changes []SettingChange
+	for _, setting := range s.List() {
+		old, ok := before.values[setting.Key]
+		if !ok || !reflect.DeepEqual(old.Value, setting.Value) {
+			changes = append(changes, SettingChange{Key: setting.Key, Old: old.Value, New: setting.Value, Layer: setting.Layer})
+		}
+	}
+	for _, setting := range before.List() {
+		if _, ok := s.values[setting.Key]; !ok {
+			changes = append(changes, SettingChange{Key: setting.Key, Old: setting.Value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// Get returns the setting in effect for a key
+func (s *Settings) Get(key string) (Setting, bool) {
+	setting, ok := s.values[normalizeKey(key)]
+	return setting, ok
+}
+
+// List returns every setting in effect, sorted by key
+func (s *Settings) List() []Setting {
+	list := make([]Setting, 0, len(s.values))
+	for _, setting := range s.values {
+		list = append(list, setting)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// LintConfig returns the lint rules of the settings
+func (c *Config) LintConfig() *utils.LintConfig {
+	lintConfig := utils.DefaultLintConfig()
+	data, err := json.Marshal(c.Lint)
+	if err == nil {
+		err = json.Unmarshal(data, lintConfig)
+	}
+	if err != nil {
+		return utils.DefaultLintConfig()
+	}
+	return lintConfig
+}
+
+// apply sets the values of a layer, replacing the values of the same keys and
+// of the keys inside or around them
+func (s *Settings) apply(merged map[string]interface{}, l layer) {
+	for _, key := range sortedKeys(l.values) {
+		for existing := range merged {
+			if isWithin(existing, key) || isWithin(key, existing) {
+				delete(merged, existing)
+				delete(s.values, existing)
+			}
+		}
+		merged[key] = l.values[key]
+		s.values[key] = Setting{Key: key, Value: l.values[key], Layer: l.name, Source: l.source}
+	}
+}
+
+// workspaceLayers reads the lint configuration and the settings file of the
+// workspace a folder is in. The settings file overrides the lint configuration.
+func (s *Settings) workspaceLayers(dir string, defaults map[string]interface{}) []layer {
+	var layers []layer
+	if path := utils.FindLintConfig(dir); path != "" {
+		s.Files = append(s.Files, path)
+		lintConfig, err := utils.LoadLintConfig(dir)
+		if err != nil {
+			s.Problems = append(s.Problems, err.Error())
+		} else if data, err := json.Marshal(lintConfig); err == nil {
+			var rules interface{}
+			json.Unmarshal(data, &rules)
+			values := flatten(map[string]interface{}{"lint": rules})
+			layers = append(layers, layer{LayerWorkspace, path, values})
+		}
+	}
+
+	path := findWorkspaceSettings(dir)
+	if path == "" {
+		s.Files = append(s.Files, filepath.Join(dir, WorkspaceSettingsFile))
+		return layers
+	}
+	s.Files = append(s.Files, path)
+	data, err := ioutil.ReadFile(path)
+	var fields map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		s.Problems = append(s.Problems, fmt.Sprintf("%s: %v", path, err))
+		return layers
+	}
+
+	flat := flatten(fields)
+	values := map[string]interface{}{}
+	for _, key := range sortedKeys(flat) {
+		value := flat[key]
+		root := rootKey(key)
+		def, known := defaults[key]
+		switch {
+		case userSettings[root]:
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: %s can only be set in the user configuration", path, key))
+		case openSettings[root] && key != root:
+			values[key] = value
+		case !known:
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: unknown setting %s", path, key))
+		case reflect.TypeOf(value) != reflect.TypeOf(def):
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: %s should be %s, not %s", path, key, jsonType(def), jsonType(value)))
+		default:
+			values[key] = resolvePath(key, value, filepath.Dir(filepath.Dir(path)))
+		}
+	}
+	return append(layers, layer{LayerWorkspace, path, values})
+}
+
+// frontMatterLayer reads the settings a document sets in its front matter.
+// Front matter keys that are not settings are the document's own metadata and
+// are left alone, as are the settings that belong to the user.
+func (s *Settings) frontMatterLayer(dir string, content string, defaults map[string]interface{}) layer {
+	matter, _ := utils.SplitFrontMatter(content)
+	values := map[string]interface{}{}
+	for _, name := range sortedKeys(matter) {
+		raw := matter[name]
+		key := normalizeKey(name)
+		root := rootKey(key)
+		def, known := defaults[key]
+		open := openSettings[root] && key != root
+		if userSettings[root] || !known && !open {
+			continue
+		}
+		value, ok := frontMatterValue(raw, def)
+		if !ok {
+			s.Problems = append(s.Problems, fmt.Sprintf("%s: %s should be %s", frontMatterSource, key, jsonType(def)))
+			continue
+		}
+		values[key] = resolvePath(key, value, dir)
+	}
+	return layer{LayerDocument, frontMatterSource, values}
+}
+
+// frontMatterValue converts a front matter value, which is text, to the type
+// of the setting's default. Open settings take whatever the text looks like.
+func frontMatterValue(raw interface{}, def interface{}) (interface{}, bool) {
+	text, ok := raw.(string)
+	if !ok {
+		return nil, false
+	}
+	switch def.(type) {
+	case bool:
+		return parseBool(text)
+	case float64:
+		n, err := strconv.ParseFloat(text, 64)
+		return n, err == nil
+	case string:
+		return text, true
+	case nil:
+		if b, ok := parseBool(text); ok {
+			return b, true
+		}
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n, true
+		}
+		return text, true
+	}
+	return nil, false
+}
+
+// parseBool reads the YAML words for true and false
+func parseBool(text string) (bool, bool) {
+	switch strings.ToLower(text) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// resolvePath makes a relative path setting relative to a folder
+func resolvePath(key string, value interface{}, dir string) interface{} {
+	path, ok := value.(string)
+	if !pathSettings[key] || !ok || path == "" || filepath.IsAbs(path) || dir == "" {
+		return value
+	}
+	return filepath.Join(dir, path)
+}
+
+// findWorkspaceSettings returns the path of the nearest workspace settings
+// file, or ""
+func findWorkspaceSettings(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, WorkspaceSettingsFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// flatten returns the leaves of a value's JSON form by dotted key. Lists and
+// empty objects are leaves.
+func flatten(v interface{}) map[string]interface{} {
+	var tree interface{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &tree)
+	}
+	values := map[string]interface{}{}
+	flattenInto(values, "", tree)
+	return values
+}
+
+func flattenInto(values map[string]interface{}, prefix string, v interface{}) {
+	fields, ok := v.(map[string]interface{})
+	if !ok || len(fields) == 0 && prefix != "" {
+		if prefix != "" {
+			values[normalizeKey(prefix)] = v
+		}
+		return
+	}
+	for key, value := range fields {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenInto(values, key, value)
+	}
+}
+
+// unflatten rebuilds the JSON objects of dotted keys
+func unflatten(values map[string]interface{}) map[string]interface{} {
+	tree := map[string]interface{}{}
+	for key, value := range values {
+		parts := strings.Split(key, ".")
+		node := tree
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = value
+	}
+	return tree
+}
+
+// normalizeKey spells a key the way the settings do. Lint rules are named in
+// any case, like in markdownlint files.
+func normalizeKey(key string) string {
+	parts := strings.Split(key, ".")
+	if len(parts) > 1 && parts[0] == "lint" && parts[1] != "default" {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+	return strings.Join(parts, ".")
+}
+
+// rootKey returns the top level setting of a dotted key
+func rootKey(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// isWithin reports whether a key is inside the group of settings parent
+func isWithin(key string, parent string) bool {
+	return strings.HasPrefix(key, parent+".")
+}
+
+// jsonType names the JSON type of a value for problem messages
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "true or false"
+	case float64:
+		return "a number"
+	case string:
+		return "text"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return "null"
+}
+
+// sortedKeys returns the keys of a layer in order, so that problems and
+// overrides come out the same every time
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+// Types of settings in the schema
+const (
+	TypeBoolean = "boolean"
+	TypeInteger = "integer"
+	TypeString  = "string"
+	TypePath    = "path"  // a file chosen in a dialog; empty for none
+	TypeTheme   = "theme" // the id of a theme from the list of themes
+	TypeTime    = "time"  // a time of day written "15:04"
+)
+
+// Categories group the settings on a preferences screen, in this order
+var Categories = []string{"Appearance", "Editor", "Saving", "Formatting", "Markdown", "Export"}
+
+// SettingSchema describes a setting so that a preferences screen can be
+// generated from it
+type SettingSchema struct {
+	Key         string      `json:"key"` // dotted path, such as "format.bulletChar"
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Category    string      `json:"category"`
+	Type        string      `json:"type"`              // one of the Type constants
+	Enum        []string    `json:"enum,omitempty"`    // the values a string may take
+	Minimum     int         `json:"minimum,omitempty"` // limits of an integer
+	Maximum     int         `json:"maximum,omitempty"`
+	Default     interface{} `json:"default"`
+	UserOnly    bool        `json:"userOnly"` // cannot be set by workspaces and front matter
+}
+
+// settingsSchema lists the settings a preferences screen edits. Keybindings and
+// lint rules are lists and objects of their own, edited in the configuration
+// file.
+var settingsSchema = []SettingSchema{
+	{Key: "themeMode", Title: "Theme mode", Category: "Appearance", Type: TypeString, Enum: []string{"manual", "system", "schedule"},
+		Description: "Choose between light and dark mode yourself, follow the system's appearance, or switch at set times."},
+	{Key: "isDarkMode", Title: "Dark mode", Category: "Appearance", Type: TypeBoolean,
+		Description: "Use the dark theme for the editor, the preview and HTML exports when the theme mode is manual."},
+	{Key: "darkModeStart", Title: "Dark mode from", Category: "Appearance", Type: TypeTime,
+		Description: "Time of day the schedule switches to dark mode, such as sunset. It cannot be the time it switches back."},
+	{Key: "darkModeEnd", Title: "Dark mode until", Category: "Appearance", Type: TypeTime,
+		Description: "Time of day the schedule switches back to light mode, such as sunrise."},
+	{Key: "lightTheme", Title: "Light theme", Category: "Appearance", Type: TypeTheme,
+		Description: "Theme of light mode: a built-in theme or a file in the themes folder."},
+	{Key: "darkTheme", Title: "Dark theme", Category: "Appearance", Type: TypeTheme,
+		Description: "Theme of dark mode: a built-in theme or a file in the themes folder."},
+
+	{Key: "fontSize", Title: "Font size", Category: "Editor", Type: TypeInteger, Minimum: minFontSize, Maximum: maxFontSize,
+		Description: "Size of the editor's font, in pixels."},
+	{Key: "fontFamily", Title: "Font family", Category: "Editor", Type: TypeString,
+		Description: "CSS font families of the editor, most preferred first."},
+	{Key: "tabSize", Title: "Tab size", Category: "Editor", Type: TypeInteger, Minimum: 1, Maximum: maxTabSize,
+		Description: "Number of spaces a tab is shown as and indents by."},
+	{Key: "lineNumbers", Title: "Line numbers", Category: "Editor", Type: TypeBoolean,
+		Description: "Show line numbers beside the editor."},
+
+	{Key: "autoSaveEnabled", Title: "Autosave", Category: "Saving", Type: TypeBoolean,
+		Description: "Save the document automatically after it changes."},
+	{Key: "autoSaveDelay", Title: "Autosave delay", Category: "Saving", Type: TypeInteger, Minimum: 1, Maximum: maxAutoSaveDelay,
+		Description: "Seconds to wait after the last change before saving automatically."},
+	{Key: "formatOnSave", Title: "Format on save", Category: "Saving", Type: TypeBoolean,
+		Description: "Format the document in the configured style when saving."},
+	{Key: "recalculateTablesOnSave", Title: "Recalculate tables on save", Category: "Saving", Type: TypeBoolean,
+		Description: "Evaluate the TBLFM formulas of every table when saving."},
+
+	{Key: "format.bulletChar", Title: "Bullet", Category: "Formatting", Type: TypeString, Enum: []string{"-", "*", "+"},
+		Description: "Marker of unordered list items."},
+	{Key: "format.emphasisChar", Title: "Emphasis", Category: "Formatting", Type: TypeString, Enum: []string{"*", "_"},
+		Description: "Marker around emphasized text."},
+	{Key: "format.strongChar", Title: "Strong emphasis", Category: "Formatting", Type: TypeString, Enum: []string{"*", "_"},
+		Description: "Marker, doubled, around strongly emphasized text."},
+	{Key: "format.orderedNumbering", Title: "Ordered list numbering", Category: "Formatting", Type: TypeString,
+		Enum:        []string{utils.NumberingAscending, utils.NumberingOne},
+		Description: "Number ordered list items 1, 2, 3 or all with the list's first number."},
+	{Key: "format.proseWrap", Title: "Prose wrap", Category: "Formatting", Type: TypeString,
+		Enum:        []string{utils.ProseWrapPreserve, utils.ProseWrapAlways, utils.ProseWrapNever},
+		Description: "Keep the line breaks of paragraphs, wrap them at the print width, or put each on one line."},
+	{Key: "format.printWidth", Title: "Print width", Category: "Formatting", Type: TypeInteger, Minimum: 20, Maximum: 1000,
+		Description: "Column paragraphs are wrapped at when prose wrap is always."},
+	{Key: "format.alignTables", Title: "Align tables", Category: "Formatting", Type: TypeBoolean,
+		Description: "Pad table cells so that the columns line up."},
+
+	{Key: "markdown.tables", Title: "Tables", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse pipe tables."},
+	{Key: "markdown.strikethrough", Title: "Strikethrough", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse ~~text~~ as struck through."},
+	{Key: "markdown.footnotes", Title: "Footnotes", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse [^note] references and their definitions in the preview. Exports always do."},
+	{Key: "markdown.definitionLists", Title: "Definition lists", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse a term followed by \": definition\" lines."},
+	{Key: "markdown.math", Title: "Math", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse $inline$ and $$display$$ math."},
+	{Key: "markdown.autolink", Title: "Autolink", Category: "Markdown", Type: TypeBoolean,
+		Description: "Turn bare URLs into links."},
+	{Key: "markdown.hardLineBreaks", Title: "Hard line breaks", Category: "Markdown", Type: TypeBoolean,
+		Description: "Break the line at every newline in a paragraph."},
+	{Key: "markdown.superSubscript", Title: "Superscript and subscript", Category: "Markdown", Type: TypeBoolean,
+		Description: "Parse 2^10^ and H~2~O."},
+
+	{Key: "export.htmlImages", Title: "HTML images", Category: "Export", Type: TypeString, Enum: []string{"inline", "copy", "link"},
+		Description: "Embed images in HTML exports, copy them next to the page, or link to the originals."},
+	{Key: "export.pdfPageSize", Title: "PDF page size", Category: "Export", Type: TypeString, Enum: []string{"A4", "A5", "Letter", "Legal"},
+		Description: "Page size of PDF exports."},
+	{Key: "export.pdfLandscape", Title: "PDF landscape", Category: "Export", Type: TypeBoolean,
+		Description: "Lay PDF pages out in landscape."},
+	{Key: "docxReferenceDoc", Title: "Word reference document", Category: "Export", Type: TypePath,
+		Description: "Word document whose styles Word exports reuse."},
+	{Key: "latexTemplate", Title: "LaTeX template", Category: "Export", Type: TypePath,
+		Description: "Template LaTeX exports fill in."},
+}
+
+// SettingsSchema returns the description of every setting a preferences
+// screen edits, with its default
+func SettingsSchema() []SettingSchema {
+	defaults := flatten(DefaultConfig())
+	schema := make([]SettingSchema, len(settingsSchema))
+	for i, setting := range settingsSchema {
+		setting.Default = defaults[setting.Key]
+		setting.UserOnly = userSettings[rootKey(setting.Key)]
+		schema[i] = setting
+	}
+	return schema
+}
+
+// findSchema returns the description of a setting
+func findSchema(key string) (SettingSchema, bool) {
+	for _, setting := range settingsSchema {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return SettingSchema{}, false
+}
+
+// Values returns the user's value of every setting in the schema
+func (c *Config) Values() map[string]interface{} {
+	flat := flatten(c)
+	values := map[string]interface{}{}
+	for _, setting := range settingsSchema {
+		values[setting.Key] = flat[setting.Key]
+	}
+	return values
+}
+
+// Set changes a setting of the schema in the user's configuration. Values of
+// the wrong type, outside their limits or not among their choices are
+// rejected. The problems are what validation changed besides.
+func (c *Config) Set(key string, value interface{}) ([]string, error) {
+	setting, ok := findSchema(key)
+	if !ok {
+		return nil, fmt.Errorf("unknown setting %s", key)
+	}
+	if err := setting.check(value); err != nil {
+		return nil, fmt.Errorf("%s %v", key, err)
+	}
+
+	values := flatten(c)
+	values[key] = value
+	data, err := json.Marshal(unflatten(values))
+	if err != nil {
+		return nil, err
+	}
+	next := DefaultConfig()
+	if err := json.Unmarshal(data, next); err != nil {
+		return nil, err
+	}
+	if (key == "darkModeStart" || key == "darkModeEnd") && next.DarkModeStart == next.DarkModeEnd {
+		return nil, fmt.Errorf("darkModeStart and darkModeEnd cannot both be %s", next.DarkModeStart)
+	}
+	next.State = c.State
+	next.configPath, next.statePath = c.configPath, c.statePath
+	problems := next.Validate()
+	*c = *next
+	return problems, nil
+}
+
+// check rejects a value the setting cannot take. Numbers come from JSON and
+// are float64.
+func (s SettingSchema) check(value interface{}) error {
+	switch s.Type {
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("should be true or false, not %s", jsonType(value))
+		}
+	case TypeInteger:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("should be a whole number, not %v", value)
+		}
+		if n < float64(s.Minimum) || s.Maximum > 0 && n > float64(s.Maximum) {
+			return fmt.Errorf("should be between %d and %d, not %v", s.Minimum, s.Maximum, n)
+		}
+	case TypeTime:
+		text, ok := value.(string)
+		if _, err := time.Parse("15:04", text); !ok || err != nil {
+			return fmt.Errorf("should be a time like \"19:30\", not %v", value)
+		}
+	case TypeString, TypePath, TypeTheme:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("should be text, not %s", jsonType(value))
+		}
+		if len(s.Enum) == 0 {
+			return nil
+		}
+		for _, choice := range s.Enum {
+			if text == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("should be one of %s, not %q", strings.Join(s.Enum, ", "), text)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import "testing"
+
+func TestSetRejectsValuesOutsideTheSchema(t *testing.T) {
+	tests := []struct {
+		key   string
+		value interface{}
+	}{
+		{"autoSaveDelay", float64(0)},
+		{"autoSaveDelay", float64(-5)},
+		{"autoSaveDelay", float64(maxAutoSaveDelay + 1)},
+		{"autoSaveDelay", 2.5},
+		{"autoSaveDelay", "10"},
+		{"fontSize", float64(maxFontSize + 1)},
+		{"format.bulletChar", "x"},
+		{"darkModeStart", "25:00"},
+		{"darkModeStart", "07:00"},
+		{"darkModeEnd", "19:00"},
+		{"lineNumbers", "yes"},
+		{"noSuchSetting", true},
+	}
+	for _, test := range tests {
+		c := DefaultConfig()
+		if _, err := c.Set(test.key, test.value); err == nil {
+			t.Errorf("Set(%s, %v) was accepted", test.key, test.value)
+		}
+		if c.AutoSaveDelay != DefaultConfig().AutoSaveDelay {
+			t.Errorf("Set(%s, %v) changed the autosave delay to %d", test.key, test.value, c.AutoSaveDelay)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	c := DefaultConfig()
+	if _, err := c.Set("autoSaveDelay", float64(30)); err != nil {
+		t.Fatal(err)
+	}
+	if c.AutoSaveDelay != 30 {
+		t.Errorf("AutoSaveDelay = %d, want 30", c.AutoSaveDelay)
+	}
+	if _, err := c.Set("format.bulletChar", "*"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Format.BulletChar != "*" || c.AutoSaveDelay != 30 {
+		t.Errorf("setting the bullet lost the autosave delay or the bullet: %+v", c)
+	}
+	if values := c.Values(); values["autoSaveDelay"] != float64(30) {
+		t.Errorf("Values()[autoSaveDelay] = %v, want 30", values["autoSaveDelay"])
+	}
+}
+
+func TestValidateRejectsScheduleWithoutDarkMode(t *testing.T) {
+	c := DefaultConfig()
+	c.DarkModeStart, c.DarkModeEnd = "08:00", "08:00"
+	if problems := c.Validate(); len(problems) != 1 {
+		t.Errorf("problems = %q, want one", problems)
+	}
+	defaults := DefaultConfig()
+	if c.DarkModeStart != defaults.DarkModeStart || c.DarkModeEnd != defaults.DarkModeEnd {
+		t.Errorf("schedule = %s to %s, want the default", c.DarkModeStart, c.DarkModeEnd)
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files below a folder, by slash separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     func(c *Config)
+		files    map[string]string // in the workspace folder
+		dir      string            // the document's folder in the workspace, "-" for an unsaved document
+		content  string
+		want     []Setting // the value and layer of settings, with $ROOT standing for the workspace folder
+		absent   []string
+		problems []string // what the problems start with, with $ROOT standing for the workspace folder
+	}{
+		{
+			name: "defaults",
+			want: []Setting{{Key: "tabSize", Value: 4.0, Layer: LayerDefault}, {Key: "format.bulletChar", Value: "-", Layer: LayerDefault}},
+		},
+		{
+			name: "user settings",
+			user: func(c *Config) { c.TabSize = 2; c.FontSize = 14 },
+			want: []Setting{{Key: "tabSize", Value: 2.0, Layer: LayerUser}, {Key: "fontSize", Value: 14.0, Layer: LayerDefault}},
+		},
+		{
+			name:  "the workspace overrides the user",
+			user:  func(c *Config) { c.TabSize = 2 },
+			files: map[string]string{".markdown-editor/settings.json": `{"tabSize": 8, "format": {"bulletChar": "*"}}`},
+			dir:   "docs/notes",
+			want:  []Setting{{Key: "tabSize", Value: 8.0, Layer: LayerWorkspace}, {Key: "format.bulletChar", Value: "*", Layer: LayerWorkspace}},
+		},
+		{
+			name:  "an unsaved document has no workspace",
+			files: map[string]string{".markdown-editor/settings.json": `{"tabSize": 8}`},
+			dir:   "-",
+			want:  []Setting{{Key: "tabSize", Value: 4.0, Layer: LayerDefault}},
+		},
+		{
+			name:  "the settings file overrides the lint configuration",
+			files: map[string]string{".markdownlint.json": `{"MD013": false, "MD009": false}`, ".markdown-editor/settings.json": `{"lint": {"MD013": true}}`},
+			want:  []Setting{{Key: "lint.MD013", Value: true, Layer: LayerWorkspace}, {Key: "lint.MD009", Value: false, Layer: LayerWorkspace}},
+		},
+		{
+			name:     "the workspace cannot set user settings",
+			files:    map[string]string{".markdown-editor/settings.json": `{"themeMode": "manual", "keybindings": [], "autoSaveDelay": 1}`},
+			want:     []Setting{{Key: "themeMode", Value: "system", Layer: LayerDefault}, {Key: "autoSaveDelay", Value: 5.0, Layer: LayerDefault}},
+			problems: []string{"$ROOT/.markdown-editor/settings.json: autoSaveDelay can only be set in the user configuration", "$ROOT/.markdown-editor/settings.json: keybindings can only be set", "$ROOT/.markdown-editor/settings.json: themeMode can only be set"},
+		},
+		{
+			name:     "unknown workspace settings and values of the wrong type",
+			files:    map[string]string{".markdown-editor/settings.json": `{"tabSize": "8", "colour": "red"}`},
+			want:     []Setting{{Key: "tabSize", Value: 4.0, Layer: LayerDefault}},
+			absent:   []string{"colour"},
+			problems: []string{"$ROOT/.markdown-editor/settings.json: unknown setting colour", "$ROOT/.markdown-editor/settings.json: tabSize should be a number, not text"},
+		},
+		{
+			name:  "workspace paths are relative to the workspace folder",
+			files: map[string]string{".markdown-editor/settings.json": `{"latexTemplate": "templates/paper.tex", "docxReferenceDoc": "/styles/reference.docx"}`},
+			dir:   "docs",
+			want:  []Setting{{Key: "latexTemplate", Value: "$ROOT/templates/paper.tex", Layer: LayerWorkspace}, {Key: "docxReferenceDoc", Value: "/styles/reference.docx", Layer: LayerWorkspace}},
+		},
+		{
+			name:    "front matter is converted to the types of the settings",
+			files:   map[string]string{".markdown-editor/settings.json": `{"tabSize": 8}`},
+			content: "---\ntitle: Notes\ntabSize: 3\nformatOnSave: yes\nlineNumbers: off\nformat.bulletChar: \"*\"\nlint.md013: false\nlint.md007.indent: 4\n---\n# Notes\n",
+			want: []Setting{
+				{Key: "tabSize", Value: 3.0, Layer: LayerDocument},
+				{Key: "formatOnSave", Value: true, Layer: LayerDocument},
+				{Key: "lineNumbers", Value: false, Layer: LayerDocument},
+				{Key: "format.bulletChar", Value: "*", Layer: LayerDocument},
+				{Key: "lint.MD013", Value: false, Layer: LayerDocument},
+				{Key: "lint.MD007.indent", Value: 4.0, Layer: LayerDocument},
+			},
+			absent: []string{"title"},
+		},
+		{
+			name:     "front matter of the wrong type and user settings",
+			content:  "---\ntabSize: wide\nformatOnSave: maybe\ndarkTheme: dracula\n---\n",
+			want:     []Setting{{Key: "tabSize", Value: 4.0, Layer: LayerDefault}, {Key: "formatOnSave", Value: false, Layer: LayerDefault}, {Key: "darkTheme", Value: "dark", Layer: LayerDefault}},
+			problems: []string{"front matter: formatOnSave should be true or false", "front matter: tabSize should be a number"},
+		},
+		{
+			name:    "front matter paths are relative to the document's folder",
+			dir:     "docs",
+			content: "---\ndocxReferenceDoc: styles/reference.docx\n---\n",
+			want:    []Setting{{Key: "docxReferenceDoc", Value: "$ROOT/docs/styles/reference.docx", Layer: LayerDocument}},
+		},
+		{
+			name: "a setting replaces the settings inside it",
+			user: func(c *Config) {
+				c.Lint = map[string]interface{}{"MD013": map[string]interface{}{"line_length": 100.0}}
+			},
+			content: "---\nlint.MD013: false\n---\n",
+			want:    []Setting{{Key: "lint.MD013", Value: false, Layer: LayerDocument}},
+			absent:  []string{"lint.MD013.line_length"},
+		},
+		{
+			name:    "a setting replaces the group it is in",
+			files:   map[string]string{".markdownlint.json": `{"MD013": false}`},
+			content: "---\nlint.MD013.line_length: 120\n---\n",
+			want:    []Setting{{Key: "lint.MD013.line_length", Value: 120.0, Layer: LayerDocument}},
+			absent:  []string{"lint.MD013"},
+		},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		writeFiles(t, root, test.files)
+		dir := filepath.Join(root, filepath.FromSlash(test.dir))
+		if test.dir == "-" {
+			dir = ""
+		}
+		expand := func(v interface{}) interface{} {
+			if text, ok := v.(string); ok && strings.Contains(text, "$ROOT") {
+				return filepath.FromSlash(strings.Replace(text, "$ROOT", filepath.ToSlash(root), 1))
+			}
+			return v
+		}
+
+		c := DefaultConfig()
+		c.configPath = filepath.Join(t.TempDir(), "config.json")
+		if test.user != nil {
+			test.user(c)
+		}
+		settings := c.Resolve(dir, test.content)
+
+		for _, want := range test.want {
+			got, ok := settings.Get(want.Key)
+			if !ok {
+				t.Errorf("%s: %s is not set", test.name, want.Key)
+				continue
+			}
+			if !reflect.DeepEqual(got.Value, expand(want.Value)) || got.Layer != want.Layer {
+				t.Errorf("%s: %s = %v from the %s layer, want %v from the %s layer", test.name, want.Key, got.Value, got.Layer, expand(want.Value), want.Layer)
+			}
+		}
+		for _, key := range test.absent {
+			if got, ok := settings.Get(key); ok {
+				t.Errorf("%s: %s = %v, want it not set", test.name, key, got.Value)
+			}
+		}
+
+		if len(settings.Problems) != len(test.problems) {
+			t.Errorf("%s: problems = %q, want %d", test.name, settings.Problems, len(test.problems))
+			continue
+		}
+		for i, problem := range test.problems {
+			if want := expand(problem).(string); !strings.HasPrefix(settings.Problems[i], want) {
+				t.Errorf("%s: problem %q, want it to start with %q", test.name, settings.Problems[i], want)
+			}
+		}
+	}
+}
+
+func TestResolveWatchesTheWorkspaceFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{".markdownlint.json": `{}`})
+	dir := filepath.Join(root, "docs")
+
+	c := DefaultConfig()
+	c.configPath = filepath.Join(t.TempDir(), "config.json")
+	want := []string{c.configPath, filepath.Join(root, ".markdownlint.json"), filepath.Join(dir, WorkspaceSettingsFile)}
+	if files := c.Resolve(dir, "").Files; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+}
+
+func TestSettingsDiff(t *testing.T) {
+	lineLength := func(c *Config) {
+		c.Lint = map[string]interface{}{"MD013": map[string]interface{}{"line_length": 100.0}}
+	}
+
+	tests := []struct {
+		name          string
+		user          func(c *Config)
+		before, after string // the document's content
+		want          []SettingChange
+	}{
+		{
+			name:   "nothing changed",
+			before: "# Notes\n",
+			after:  "# Notes\n\nMore notes\n",
+		},
+		{
+			name:   "a value changed",
+			before: "# Notes\n",
+			after:  "---\ntabSize: 2\n---\n# Notes\n",
+			want:   []SettingChange{{Key: "tabSize", Old: 4.0, New: 2.0, Layer: LayerDocument}},
+		},
+		{
+			name:   "a value set by another layer",
+			before: "# Notes\n",
+			after:  "---\ntabSize: 4\n---\n# Notes\n",
+		},
+		{
+			name:   "a setting no longer set gives way to the default of its group",
+			before: "---\nlint.MD013: false\n---\n",
+			after:  "",
+			want: []SettingChange{
+				{Key: "lint", New: map[string]interface{}{}, Layer: LayerDefault},
+				{Key: "lint.MD013", Old: false},
+			},
+		},
+		{
+			name:   "a setting replaced by the group it is in",
+			user:   lineLength,
+			before: "",
+			after:  "---\nlint.MD013: false\n---\n",
+			want: []SettingChange{
+				{Key: "lint.MD013", New: false, Layer: LayerDocument},
+				{Key: "lint.MD013.line_length", Old: 100.0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := DefaultConfig()
+		if test.user != nil {
+			test.user(c)
+		}
+		before := c.Resolve("", test.before)
+		after := c.Resolve("", test.after)
+		if changes := after.Diff(before); !reflect.DeepEqual(changes, test.want) {
+			t.Errorf("%s: changes = %+v, want %+v", test.name, changes, test.want)
+		}
+	}
+}
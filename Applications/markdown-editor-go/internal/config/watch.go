@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often watched files are checked. The standard library
+// has no file system notifications, so files are polled.
+const watchInterval = time.Second
+
+// Watcher calls a function when watched files are created, changed or removed
+type Watcher struct {
+	mu       sync.Mutex
+	stamps   map[string]fileStamp
+	onChange func(paths []string)
+	done     chan struct{}
+}
+
+// fileStamp tells the versions of a file apart
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher starts watching files, calling onChange from its own goroutine
+// with the files that changed since the last check
+func NewWatcher(onChange func(paths []string)) *Watcher {
+	w := &Watcher{
+		stamps:   map[string]fileStamp{},
+		onChange: onChange,
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Watch replaces the watched files. Files that were already watched keep the
+// version last seen, so changes made in between are still reported.
+func (w *Watcher) Watch(paths ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamps := map[string]fileStamp{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		stamp, ok := w.stamps[path]
+		if !ok {
+			stamp = stampOf(path)
+		}
+		stamps[path] = stamp
+	}
+	w.stamps = stamps
+}
+
+// Close stops watching
+func (w *Watcher) Close() {
+	close(w.done)
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if changed := w.check(); len(changed) > 0 {
+				w.onChange(changed)
+			}
+		}
+	}
+}
+
+// check returns the watched files whose version changed
+func (w *Watcher) check() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var changed []string
+	for path, stamp := range w.stamps {
+		if current := stampOf(path); !current.same(stamp) {
+			w.stamps[path] = current
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+func (s fileStamp) same(other fileStamp) bool {
+	return s.exists == other.exists && s.modTime.Equal(other.modTime) && s.size == other.size
+}
@@ -3,6 +3,7 @@ package editor
 import (
 	"context"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -44,6 +45,7 @@ type Editor struct {
 	lastEditTime    time.Time
 	autoSaveTimer   *time.Timer
 	fileUtils       *FileUtils
+	render          func(md string) string
 }
 
 // NewEditor creates a new instance of the Markdown editor
@@ -109,11 +111,26 @@ func (e *Editor) GetContent() string {
 	return e.content
 }
 
+// SetRenderer sets how the preview converts markdown to HTML, instead of with
+// the default extensions
+func (e *Editor) SetRenderer(render func(md string) string) {
+	e.render = render
+}
+
+// RefreshPreview renders the preview again, such as after the renderer's
+// settings changed
+func (e *Editor) RefreshPreview() {
+	runtime.EventsEmit(e.ctx, "content:update", e.RenderHTML())
+}
+
 // RenderHTML converts markdown to HTML
 func (e *Editor) RenderHTML() string {
 	if e.content == "" {
 		return ""
 	}
+	if e.render != nil {
+		return e.render(e.content)
+	}
 
 	md := []byte(e.content)
 	html := markdown.ToHTML(md, nil, nil)
@@ -180,8 +197,14 @@ func (e *Editor) SaveFileAs() bool {
 
 // OpenFile opens a markdown file
 func (e *Editor) OpenFile() bool {
+	return e.OpenFileFrom("")
+}
+
+// OpenFileFrom opens a markdown file chosen in a dialog that starts in a folder
+func (e *Editor) OpenFileFrom(dir string) bool {
 	// Show file dialog
 	filePath, err := runtime.OpenFileDialog(e.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: dir,
 		Filters: []runtime.FileFilter{
 			{
 				DisplayName: "Markdown Files (*.md, *.markdown)",
@@ -198,10 +221,16 @@ func (e *Editor) OpenFile() bool {
 		// User cancelled
 		return false
 	}
+	return e.OpenPath(filePath)
+}
 
+// OpenPath opens the file at a path. A file that does not exist yet opens
+// empty and is created when saved.
+func (e *Editor) OpenPath(filePath string) bool {
 	// Read file content
 	content, err := e.readFromFile(filePath)
-	if err != nil {
+	isNew := os.IsNotExist(err)
+	if err != nil && !isNew {
 		runtime.EventsEmit(e.ctx, "error", "Failed to open file: "+err.Error())
 		return false
 	}
@@ -213,10 +242,33 @@ func (e *Editor) OpenFile() bool {
 	// Update window title with filename
 	runtime.WindowSetTitle(e.ctx, "Markdown Editor - "+e.getFilenameFromPath())
 
-	runtime.EventsEmit(e.ctx, "status:update", "File opened")
+	if isNew {
+		runtime.EventsEmit(e.ctx, "status:update", "New file "+e.getFilenameFromPath())
+	} else {
+		runtime.EventsEmit(e.ctx, "status:update", "File opened")
+	}
 	return true
 }
 
+// SwitchTo makes another open document the current one, such as when the
+// frontend switches tabs. The document may have changes not saved yet.
+func (e *Editor) SwitchTo(filePath string, content string, unsaved bool) {
+	if e.autoSaveTimer != nil {
+		e.autoSaveTimer.Stop()
+	}
+
+	e.currentFilePath = filePath
+	e.content = content
+	e.lastSaveTime = time.Now()
+	e.lastEditTime = e.lastSaveTime
+	if unsaved {
+		e.lastSaveTime = e.lastEditTime.Add(-time.Second)
+	}
+
+	runtime.WindowSetTitle(e.ctx, "Markdown Editor - "+e.getFilenameFromPath())
+	e.RefreshPreview()
+}
+
 // AutoSave automatically saves the file if changes exist
 func (e *Editor) AutoSave() {
 	if e.currentFilePath != "" && e.hasUnsavedChanges() {
@@ -0,0 +1,444 @@
+package export
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// asciiDocWriter writes AsciiDoc as Asciidoctor reads it
+type asciiDocWriter struct {
+	markupBase
+	notes     []*ast.Link
+	listDepth int
+	nesting   int  // delimited blocks the writer is inside
+	math      bool // the document uses stem content
+	inTable   bool
+}
+
+// document writes the document header followed by the body. The header
+// enables stem content when the document holds math.
+func (w *asciiDocWriter) document(doc ast.Node, title string, authors []string) {
+	w.blocks(doc)
+	body := w.out.String()
+	w.out.Reset()
+
+	if title != "" {
+		w.write("= " + title + "\n")
+		if len(authors) > 0 {
+			w.write(strings.Join(authors, "; ") + "\n")
+		}
+	}
+	if w.math {
+		w.write(":stem: latexmath\n")
+	}
+	if w.out.Len() > 0 {
+		w.write("\n")
+	}
+	w.write(body)
+}
+
+func (w *asciiDocWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *asciiDocWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		if node.HeadingID != "" {
+			w.write("[#" + node.HeadingID + "]\n")
+		}
+		w.write(strings.Repeat("=", min(max(node.Level, 1), 5)+1) + " ")
+		w.inlines(node)
+		w.write("\n\n")
+	case *ast.Paragraph:
+		if image := soleImage(node); image != nil {
+			w.write("image::" + asciiDocTarget(string(image.Destination)) + "[" + w.macroText(image) + "]\n\n")
+			return
+		}
+		w.inlines(node)
+		w.write("\n\n")
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		if kind := blockquoteAlert(node); kind != "" {
+			w.delimited("["+strings.ToUpper(kind)+"]\n", "=", node)
+			return
+		}
+		w.delimited("", "_", node)
+	case *ast.CodeBlock:
+		language := codeLanguage(node.Info)
+		if language != "" {
+			w.write("[source," + language + "]\n")
+		}
+		w.literal(string(node.Literal), "----")
+	case *ast.MathBlock:
+		w.math = true
+		w.write("[stem]\n")
+		w.literal(strings.TrimSpace(string(node.Literal)), "++++")
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write("'''\n\n")
+	case *ast.HTMLBlock:
+		w.warnHTML(node.Literal)
+	case *ast.Footnotes:
+		// Footnotes are written where they are referenced
+	default:
+		w.blocks(node)
+	}
+}
+
+// delimited writes the blocks of a container between delimiter lines, made
+// longer for each enclosing block so nested blocks do not close it
+func (w *asciiDocWriter) delimited(attributes string, char string, container ast.Node) {
+	delimiter := strings.Repeat(char, 4+w.nesting)
+	w.nesting++
+	w.write(attributes + delimiter + "\n")
+	w.blocks(container)
+	w.endLine()
+	w.write(delimiter + "\n\n")
+	w.nesting--
+}
+
+// literal writes verbatim content between delimiter lines, lengthening the
+// delimiter until no line of the content matches it
+func (w *asciiDocWriter) literal(content string, delimiter string) {
+	content = strings.TrimRight(content, "\n")
+	lines := strings.Split(content, "\n")
+	for containsLine(lines, delimiter) {
+		delimiter += delimiter[:1]
+	}
+	w.write(delimiter + "\n" + content + "\n" + delimiter + "\n\n")
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+// list writes a list with one line per item, marked with as many * or .
+// as the list is deep. Further blocks of an item are attached with +.
+func (w *asciiDocWriter) list(list *ast.List) {
+	if list.IsFootnotesList {
+		return
+	}
+
+	w.listDepth++
+	defer func() { w.listDepth-- }()
+
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		w.definitionList(list)
+	} else {
+		marker := strings.Repeat("*", w.listDepth)
+		if list.ListFlags&ast.ListTypeOrdered != 0 {
+			marker = strings.Repeat(".", w.listDepth)
+			if list.Start > 1 {
+				w.write("[start=" + strconv.Itoa(list.Start) + "]\n")
+			}
+		}
+		for _, item := range list.Children {
+			w.write(marker + " ")
+			if list.ListFlags&ast.ListTypeOrdered == 0 && taskMarker(item) != nil {
+				if taskDone(item) {
+					w.write("[x] ")
+				} else {
+					w.write("[ ] ")
+				}
+			}
+			w.itemContent(item)
+		}
+	}
+
+	if w.listDepth == 1 {
+		w.write("\n")
+	}
+}
+
+// definitionList writes each term followed by a marker and its definition
+func (w *asciiDocWriter) definitionList(list *ast.List) {
+	marker := strings.Repeat(":", w.listDepth+1)
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			if !w.atLineStart() {
+				w.write("\n")
+			}
+			w.inlines(item)
+			w.write(marker)
+			continue
+		}
+		w.write(" ")
+		w.itemContent(item)
+	}
+	w.endLine()
+}
+
+func (w *asciiDocWriter) itemContent(item ast.Node) {
+	if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+		w.inlines(item)
+		w.write("\n")
+		return
+	}
+	for i, child := range item.GetChildren() {
+		switch child := child.(type) {
+		case *ast.Paragraph:
+			if i > 0 {
+				w.endLine()
+				w.write("+\n")
+			}
+			w.inlines(child)
+		case *ast.List:
+			w.endLine()
+			w.list(child)
+		default:
+			w.endLine()
+			if i > 0 {
+				w.write("+\n")
+			}
+			w.block(child)
+		}
+		w.endLine()
+	}
+}
+
+// table writes a table with a line per row, the column alignments in its
+// cols attribute
+func (w *asciiDocWriter) table(table *ast.Table) {
+	layout := layoutTable(table)
+	if layout.columns == 0 {
+		return
+	}
+
+	if layout.caption != nil {
+		w.write(".")
+		w.inlines(layout.caption)
+		w.write("\n")
+	}
+	var cols []string
+	for _, align := range layout.aligns {
+		switch align {
+		case ast.TableAlignmentCenter:
+			cols = append(cols, "^")
+		case ast.TableAlignmentRight:
+			cols = append(cols, ">")
+		default:
+			cols = append(cols, "<")
+		}
+	}
+	w.write(`[cols="` + strings.Join(cols, ",") + `"`)
+	if len(layout.header) > 0 {
+		w.write(`,options="header"`)
+	}
+	w.write("]\n|===\n")
+
+	w.inTable = true
+	for _, row := range layout.rows() {
+		for i := 0; i < layout.columns; i++ {
+			if i > 0 {
+				w.write(" ")
+			}
+			w.write("|")
+			if cell := layout.cell(row, i); cell != nil {
+				content := w.capture(func() { w.cellContent(cell) })
+				if content != "" {
+					w.write(" " + content)
+				}
+			}
+		}
+		w.write("\n")
+	}
+	w.inTable = false
+	w.write("|===\n\n")
+}
+
+func (w *asciiDocWriter) cellContent(cell *ast.TableCell) {
+	for i, child := range cell.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok {
+			if i > 0 {
+				w.write(" +\n")
+			}
+			w.inlines(paragraph)
+			continue
+		}
+		w.inline(child)
+	}
+}
+
+// Inline content
+
+func (w *asciiDocWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *asciiDocWriter) inline(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(plainText(node.Literal))
+	case *ast.Code:
+		w.write("`+" + string(node.Literal) + "+`")
+	case *ast.Math:
+		w.math = true
+		w.write("stem:[" + strings.ReplaceAll(string(node.Literal), "]", "\\]") + "]")
+	case *ast.Emph:
+		w.wrap("__", "__", node)
+	case *ast.Strong:
+		w.wrap("**", "**", node)
+	case *ast.Del:
+		w.wrap("[.line-through]##", "##", node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.footnote(node)
+			return
+		}
+		w.link(node)
+	case *ast.Image:
+		w.write("image:" + asciiDocTarget(string(node.Destination)) + "[" + w.macroText(node) + "]")
+	case *ast.Hardbreak:
+		w.write(" +\n")
+	case *ast.HTMLSpan:
+		w.warnHTML(node.Literal)
+	default:
+		w.inlines(node)
+	}
+}
+
+func (w *asciiDocWriter) wrap(open string, close string, node ast.Node) {
+	w.write(open)
+	w.inlines(node)
+	w.write(close)
+}
+
+// URL schemes Asciidoctor links without the link: prefix
+var asciiDocSchemes = []string{"http://", "https://", "ftp://", "irc://", "mailto:"}
+
+// link writes a cross reference for links to headings, and a URL or link
+// macro for others
+func (w *asciiDocWriter) link(link *ast.Link) {
+	dest := string(link.Destination)
+	switch {
+	case dest == "":
+		w.inlines(link)
+		return
+	case strings.HasPrefix(dest, "#"):
+		text := w.capture(func() { w.inlines(link) })
+		if text == "" {
+			w.write("<<" + dest[1:] + ">>")
+		} else {
+			w.write("<<" + dest[1:] + "," + text + ">>")
+		}
+		return
+	}
+
+	target := asciiDocTarget(dest)
+	for _, scheme := range asciiDocSchemes {
+		if strings.HasPrefix(dest, scheme) {
+			if utils.NodeText(link) == dest {
+				w.write(target)
+			} else {
+				w.write(target + "[" + w.macroText(link) + "]")
+			}
+			return
+		}
+	}
+	w.write("link:" + target + "[" + w.macroText(link) + "]")
+}
+
+// footnote writes a footnote at its first reference and refers to it by ID
+// at later ones
+func (w *asciiDocWriter) footnote(link *ast.Link) {
+	number, first := noteNumber(&w.notes, link)
+	id := "fn" + strconv.Itoa(number)
+	if !first || link.Footnote == nil {
+		w.write("footnote:" + id + "[]")
+		return
+	}
+
+	text := w.capture(func() {
+		if blocks := footnoteBlocks(link.Footnote); blocks != nil {
+			for i, block := range blocks {
+				if i > 0 {
+					w.write(" ")
+				}
+				w.inlines(block)
+			}
+		} else {
+			w.inlines(link.Footnote)
+		}
+	})
+	w.write("footnote:" + id + "[" + strings.ReplaceAll(text, "]", "\\]") + "]")
+}
+
+// macroText returns the text of a node for the brackets of an inline macro
+func (w *asciiDocWriter) macroText(node ast.Node) string {
+	return strings.ReplaceAll(w.capture(func() { w.inlines(node) }), "]", "\\]")
+}
+
+// asciiDocTarget escapes the characters that end the target of a macro
+func asciiDocTarget(target string) string {
+	return strings.NewReplacer(" ", "%20", "[", "%5B").Replace(target)
+}
+
+// asciiDocLineStart matches the starts of lines that begin lists, titles,
+// attribute lines, block delimiters and admonition paragraphs
+var asciiDocLineStart = regexp.MustCompile(`^([*.\-=\[|/:<>']|\d+\.\s|(NOTE|TIP|IMPORTANT|WARNING|CAUTION):\s)`)
+
+// asciiDocAttribute matches attribute references, which would be replaced
+var asciiDocAttribute = regexp.MustCompile(`^\{[\w-]+\}`)
+
+// text writes plain text, passing through what Asciidoctor would take for
+// formatting marks
+func (w *asciiDocWriter) text(text string) {
+	if w.atLineStart() && asciiDocLineStart.MatchString(text) {
+		w.write("{empty}")
+	}
+
+	runes := []rune(text)
+	var buf strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '|' && w.inTable:
+			buf.WriteString("\\|")
+		case r == '{' && asciiDocAttribute.MatchString(string(runes[i:])):
+			buf.WriteString("\\{")
+		case strings.ContainsRune("*_`#^~+", r):
+			end := i + 1
+			for end < len(runes) && runes[end] == r {
+				end++
+			}
+			run := string(runes[i:end])
+			// Doubled marks format text anywhere, superscript and subscript
+			// marks whenever they are paired
+			mark := end-i > 1 || isDelimiterRun(runes, i, end) ||
+				(r == '^' || r == '~') && strings.ContainsRune(string(runes[end:]), r)
+			switch {
+			case !mark:
+				buf.WriteString(run)
+			case r == '+':
+				buf.WriteString(strings.Repeat("{plus}", end-i))
+			default:
+				buf.WriteString("++" + run + "++")
+			}
+			i = end - 1
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	w.write(buf.String())
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// How exported documents reference local images
+const (
+	ImagesInline = "inline" // embedded as data URIs
+	ImagesCopy   = "copy"   // copied into a folder next to the output
+	ImagesLink   = "link"   // left pointing at the original files
+)
+
+// Image is a local image file referenced by a document
+type Image struct {
+	Path      string
+	MediaType string
+	Data      []byte
+}
+
+// isLocalReference reports whether a link destination refers to a local file
+func isLocalReference(dest string) bool {
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "//") {
+		return false
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || u.Scheme == "file" || len(u.Scheme) == 1 // Windows drive letters parse as schemes
+}
+
+// resolveLocalPath turns a local link destination into a file path
+func resolveLocalPath(dest string, baseDir string) string {
+	path := dest
+	if u, err := url.Parse(dest); err == nil && len(u.Scheme) != 1 {
+		path = u.Path
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) && baseDir != "" {
+		path = filepath.Join(baseDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// LoadImage reads a local image referenced from a document in baseDir
+func LoadImage(dest string, baseDir string) (*Image, error) {
+	if !isLocalReference(dest) {
+		return nil, errors.New("not a local file: " + dest)
+	}
+
+	path := resolveLocalPath(dest, baseDir)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Path: path, MediaType: mediaType(path, data), Data: data}, nil
+}
+
+// DataURI returns the image encoded as a data URI
+func (i *Image) DataURI() string {
+	return "data:" + i.MediaType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// mediaType returns the MIME type of a file from its extension or contents
+func mediaType(path string, data []byte) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".svg" {
+		return "image/svg+xml"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return strings.Split(t, ";")[0]
+	}
+	return http.DetectContentType(data)
+}
+
+// documentImages returns the image nodes of a document in order
+func documentImages(doc ast.Node) []*ast.Image {
+	var images []*ast.Image
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if image, ok := node.(*ast.Image); ok && entering {
+			images = append(images, image)
+		}
+		return ast.GoToNext
+	})
+	return images
+}
+
+// assetFolder collects the files copied next to an exported document
+type assetFolder struct {
+	dir   string // absolute folder the assets are written to
+	name  string // folder name used in links
+	names map[string]string
+}
+
+// newAssetFolder returns the folder holding the assets of the given output file
+func newAssetFolder(outputPath string) *assetFolder {
+	name := strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath)) + "_files"
+	return &assetFolder{
+		dir:   filepath.Join(filepath.Dir(outputPath), name),
+		name:  name,
+		names: map[string]string{},
+	}
+}
+
+// add copies an image into the folder, once per source file, and returns the
+// relative link to the copy
+func (f *assetFolder) add(image *Image) (string, error) {
+	if name, ok := f.names[image.Path]; ok {
+		return f.name + "/" + url.PathEscape(name), nil
+	}
+
+	// Keep names unique when images from different folders share a name
+	base := filepath.Base(image.Path)
+	name := base
+	for i := 2; f.taken(name); i++ {
+		ext := filepath.Ext(base)
+		name = strings.TrimSuffix(base, ext) + "-" + strconv.Itoa(i) + ext
+	}
+
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(f.dir, name), image.Data, 0644); err != nil {
+		return "", err
+	}
+
+	f.names[image.Path] = name
+	return f.name + "/" + url.PathEscape(name), nil
+}
+
+func (f *assetFolder) taken(name string) bool {
+	for _, used := range f.names {
+		if used == name {
+			return true
+		}
+	}
+	return false
+}
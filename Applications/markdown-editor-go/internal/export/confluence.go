@@ -0,0 +1,312 @@
+package export
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// confluenceWriter writes Confluence storage format, the XHTML pages are
+// stored in, with code blocks and alerts as Confluence macros
+type confluenceWriter struct {
+	markupBase
+	notes []*ast.Link
+}
+
+func (w *confluenceWriter) document(doc ast.Node) {
+	w.blocks(doc)
+	if len(w.notes) == 0 {
+		return
+	}
+
+	w.write("<hr />\n<ol>\n")
+	for _, link := range w.notes {
+		w.write("<li>")
+		if blocks := footnoteBlocks(link.Footnote); blocks != nil {
+			for _, block := range blocks {
+				w.block(block)
+			}
+		} else if link.Footnote != nil {
+			w.inlines(link.Footnote)
+		}
+		w.write("</li>\n")
+	}
+	w.write("</ol>\n")
+}
+
+func (w *confluenceWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *confluenceWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		tag := "h" + strconv.Itoa(min(max(node.Level, 1), 6))
+		w.write("<" + tag + ">")
+		w.inlines(node)
+		w.write("</" + tag + ">\n")
+	case *ast.Paragraph:
+		w.write("<p>")
+		w.inlines(node)
+		w.write("</p>\n")
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		if kind := blockquoteAlert(node); kind != "" {
+			w.write(`<ac:structured-macro ac:name="` + confluencePanels[kind] + `"><ac:rich-text-body>` + "\n")
+			w.blocks(node)
+			w.write("</ac:rich-text-body></ac:structured-macro>\n")
+			return
+		}
+		w.write("<blockquote>\n")
+		w.blocks(node)
+		w.write("</blockquote>\n")
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info))
+	case *ast.MathBlock:
+		// Confluence has no math macro of its own; the ones apps add differ
+		// between sites and show an error where they are missing, so the TeX
+		// source is kept as preformatted text
+		w.warn("math is written as its TeX source")
+		w.write("<pre>" + xmlText(strings.TrimSpace(string(node.Literal))) + "</pre>\n")
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write("<hr />\n")
+	case *ast.HTMLBlock:
+		w.warnHTML(node.Literal)
+	case *ast.Footnotes:
+		// Footnotes are listed at the end of the page
+	default:
+		w.blocks(node)
+	}
+}
+
+// Confluence macros alerts are written as, by alert kind
+var confluencePanels = map[string]string{
+	"note":      "info",
+	"tip":       "tip",
+	"important": "note",
+	"warning":   "note",
+	"caution":   "warning",
+}
+
+func (w *confluenceWriter) list(list *ast.List) {
+	if list.IsFootnotesList {
+		return
+	}
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		w.definitionList(list)
+		return
+	}
+	if isTaskList(list) {
+		w.write("<ac:task-list>\n")
+		for _, item := range list.Children {
+			status := "incomplete"
+			if taskDone(item) {
+				status = "complete"
+			}
+			w.write("<ac:task><ac:task-status>" + status + "</ac:task-status><ac:task-body>")
+			w.itemContent(item, true)
+			w.write("</ac:task-body></ac:task>\n")
+		}
+		w.write("</ac:task-list>\n")
+		return
+	}
+
+	tag := "ul"
+	if list.ListFlags&ast.ListTypeOrdered != 0 {
+		tag = "ol"
+	}
+	w.write("<" + tag + ">\n")
+	for _, item := range list.Children {
+		w.write("<li>")
+		w.itemContent(item, list.Tight)
+		w.write("</li>\n")
+	}
+	w.write("</" + tag + ">\n")
+}
+
+// definitionList writes terms as bold paragraphs followed by their definitions,
+// as Confluence has no definition lists
+func (w *confluenceWriter) definitionList(list *ast.List) {
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			w.write("<p><strong>")
+			w.inlines(item)
+			w.write("</strong></p>\n")
+			continue
+		}
+		if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+			w.write("<p>")
+			w.inlines(item)
+			w.write("</p>\n")
+			continue
+		}
+		w.blocks(item)
+	}
+}
+
+// itemContent writes the blocks of a list item, without paragraph tags in
+// tight lists
+func (w *confluenceWriter) itemContent(item ast.Node, tight bool) {
+	if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+		w.inlines(item)
+		return
+	}
+	for _, child := range item.GetChildren() {
+		if paragraph, ok := child.(*ast.Paragraph); ok && tight {
+			w.inlines(paragraph)
+			continue
+		}
+		w.block(child)
+	}
+}
+
+// Confluence code macro languages, by markdown fence name
+var confluenceLanguages = map[string]string{
+	"actionscript": "actionscript3", "applescript": "applescript",
+	"bash": "bash", "sh": "bash", "shell": "bash", "zsh": "bash",
+	"c": "cpp", "cpp": "cpp", "c++": "cpp", "cs": "c#", "csharp": "c#",
+	"coldfusion": "coldfusion", "cfm": "coldfusion", "css": "css", "delphi": "delphi", "pascal": "delphi",
+	"diff": "diff", "patch": "diff", "erlang": "erl", "go": "go", "golang": "go", "groovy": "groovy",
+	"haskell": "haskell", "hs": "haskell", "html": "xml", "xml": "xml", "svg": "xml",
+	"java": "java", "javafx": "jfx", "kotlin": "kotlin", "kt": "kotlin", "lua": "lua",
+	"javascript": "js", "js": "js", "json": "js", "typescript": "js", "ts": "js",
+	"objectivec": "objc", "objective-c": "objc", "objc": "objc",
+	"php": "php", "perl": "perl", "powershell": "powershell", "ps1": "powershell",
+	"python": "py", "py": "py", "r": "r", "ruby": "ruby", "rb": "ruby", "rust": "rust", "rs": "rust",
+	"sass": "sass", "scss": "sass", "scala": "scala", "sql": "sql", "swift": "swift",
+	"text": "text", "txt": "text", "plaintext": "text", "vb": "vb", "yaml": "yml", "yml": "yml",
+}
+
+// codeBlock writes a code macro, naming the language when Confluence knows it
+func (w *confluenceWriter) codeBlock(code string, language string) {
+	w.write(`<ac:structured-macro ac:name="code">`)
+	if name, ok := confluenceLanguages[language]; ok {
+		w.write(`<ac:parameter ac:name="language">` + xmlText(name) + `</ac:parameter>`)
+	}
+	// CDATA sections cannot contain their terminator, so it is split across two
+	code = strings.ReplaceAll(strings.TrimRight(code, "\n"), "]]>", "]]]]><![CDATA[>")
+	w.write("<ac:plain-text-body><![CDATA[" + code + "]]></ac:plain-text-body></ac:structured-macro>\n")
+}
+
+func (w *confluenceWriter) table(table *ast.Table) {
+	layout := layoutTable(table)
+	if layout.columns == 0 {
+		return
+	}
+
+	w.write("<table><tbody>\n")
+	for _, row := range layout.rows() {
+		w.write("<tr>")
+		for i := 0; i < layout.columns; i++ {
+			cell := layout.cell(row, i)
+			tag := "td"
+			if cell != nil && cell.IsHeader {
+				tag = "th"
+			}
+			w.write("<" + tag)
+			switch layout.aligns[i] {
+			case ast.TableAlignmentCenter:
+				w.write(` style="text-align: center;"`)
+			case ast.TableAlignmentRight:
+				w.write(` style="text-align: right;"`)
+			}
+			w.write(">")
+			if cell != nil {
+				w.itemContent(cell, true)
+			}
+			w.write("</" + tag + ">")
+		}
+		w.write("</tr>\n")
+	}
+	w.write("</tbody></table>\n")
+
+	if layout.caption != nil {
+		w.write("<p><em>")
+		w.inlines(layout.caption)
+		w.write("</em></p>\n")
+	}
+}
+
+// Inline content
+
+func (w *confluenceWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *confluenceWriter) inline(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Text:
+		w.write(xmlText(plainText(node.Literal)))
+	case *ast.Code:
+		w.write("<code>" + xmlText(string(node.Literal)) + "</code>")
+	case *ast.Math:
+		w.warn("math is written as its TeX source")
+		w.write("<code>" + xmlText(string(node.Literal)) + "</code>")
+	case *ast.Emph:
+		w.wrap("<em>", "</em>", node)
+	case *ast.Strong:
+		w.wrap("<strong>", "</strong>", node)
+	case *ast.Del:
+		w.wrap(`<span style="text-decoration: line-through;">`, "</span>", node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.footnote(node)
+			return
+		}
+		if len(node.Destination) == 0 {
+			w.inlines(node)
+			return
+		}
+		w.wrap(`<a href="`+xmlText(string(node.Destination))+`">`, "</a>", node)
+	case *ast.Image:
+		w.image(node)
+	case *ast.Hardbreak:
+		w.write("<br />")
+	case *ast.HTMLSpan:
+		w.warnHTML(node.Literal)
+	default:
+		w.inlines(node)
+	}
+}
+
+func (w *confluenceWriter) wrap(open string, close string, node ast.Node) {
+	w.write(open)
+	w.inlines(node)
+	w.write(close)
+}
+
+// image writes an image macro. Local images refer to attachments of the page,
+// which have to be uploaded with it.
+func (w *confluenceWriter) image(image *ast.Image) {
+	dest := string(image.Destination)
+	w.write(`<ac:image ac:alt="` + xmlText(utils.NodeText(image)) + `">`)
+	if isLocalReference(dest) {
+		name := path.Base(strings.ReplaceAll(dest, "\\", "/"))
+		w.warn("local image " + dest + " must be attached to the page as " + name)
+		w.write(`<ri:attachment ri:filename="` + xmlText(name) + `" />`)
+	} else {
+		w.write(`<ri:url ri:value="` + xmlText(dest) + `" />`)
+	}
+	w.write("</ac:image>")
+}
+
+// footnote writes a footnote's number; the footnotes are listed at the end
+func (w *confluenceWriter) footnote(link *ast.Link) {
+	number, _ := noteNumber(&w.notes, link)
+	w.write("<sup>" + strconv.Itoa(number) + "</sup>")
+}
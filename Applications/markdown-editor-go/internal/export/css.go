@@ -0,0 +1,237 @@
+package export
+
+import (
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+)
+
+// documentCSS styles exported documents like the preview pane, using the
+// colors declared by ThemeCSS
+const documentCSS = `
+* {
+    box-sizing: border-box;
+}
+
+body {
+    margin: 0;
+    background-color: var(--preview-bg);
+    color: var(--text);
+    font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+    font-size: 16px;
+}
+
+.markdown-body {
+    max-width: 800px;
+    margin: 0 auto;
+    padding: 32px 16px;
+    line-height: 1.6;
+}
+
+.markdown-body h1 {
+    font-size: 2em;
+    margin: 0.67em 0;
+    border-bottom: 1px solid var(--border);
+    padding-bottom: 0.3em;
+}
+
+.markdown-body h2 {
+    font-size: 1.5em;
+    margin: 0.83em 0;
+    border-bottom: 1px solid var(--border);
+    padding-bottom: 0.3em;
+}
+
+.markdown-body h3 {
+    font-size: 1.17em;
+    margin: 1em 0;
+}
+
+.markdown-body p {
+    margin: 1em 0;
+}
+
+.markdown-body ul, .markdown-body ol {
+    margin: 1em 0;
+    padding-left: 2em;
+}
+
+.markdown-body blockquote {
+    margin: 1em 0;
+    padding-left: 1em;
+    border-left: 4px solid var(--accent);
+    color: var(--text-secondary);
+}
+
+.markdown-body pre {
+    background-color: var(--bg-secondary);
+    padding: 16px;
+    border-radius: 4px;
+    overflow-x: auto;
+    margin: 1em 0;
+}
+
+.markdown-body code {
+    font-family: "Roboto Mono", Menlo, Consolas, "Liberation Mono", monospace;
+    font-size: 0.875em;
+    background-color: var(--bg-secondary);
+    padding: 0.2em 0.4em;
+    border-radius: 3px;
+}
+
+.markdown-body pre code {
+    padding: 0;
+    background-color: transparent;
+}
+
+.markdown-body a {
+    color: var(--accent);
+    text-decoration: none;
+}
+
+.markdown-body a:hover {
+    text-decoration: underline;
+    color: var(--accent-hover);
+}
+
+.markdown-body img {
+    max-width: 100%;
+}
+
+.markdown-body table {
+    border-collapse: collapse;
+    width: 100%;
+    margin: 1em 0;
+}
+
+.markdown-body th, .markdown-body td {
+    border: 1px solid var(--border);
+    padding: 8px;
+}
+
+.markdown-body th {
+    background-color: var(--bg-secondary);
+}
+
+.markdown-body mark {
+    background-color: var(--highlight);
+    color: inherit;
+}
+
+.markdown-body hr {
+    border: none;
+    border-top: 1px solid var(--border);
+}
+`
+
+// tocCSS lays out the table of contents as a sidebar
+const tocCSS = `
+.toc {
+    position: fixed;
+    top: 0;
+    bottom: 0;
+    left: 0;
+    width: 260px;
+    overflow-y: auto;
+    padding: 24px 16px;
+    background-color: var(--bg-secondary);
+    border-right: 1px solid var(--border);
+    font-size: 14px;
+}
+
+.toc ul {
+    list-style: none;
+    margin: 0;
+    padding-left: 1em;
+}
+
+.toc > ul {
+    padding-left: 0;
+}
+
+.toc li {
+    margin: 4px 0;
+}
+
+.toc a {
+    color: var(--text-secondary);
+    text-decoration: none;
+}
+
+.toc a:hover {
+    color: var(--accent-hover);
+}
+
+.toc + .markdown-body {
+    margin-left: 260px;
+}
+
+@media (max-width: 900px) {
+    .toc {
+        position: static;
+        width: auto;
+        border-right: none;
+        border-bottom: 1px solid var(--border);
+    }
+
+    .toc + .markdown-body {
+        margin-left: auto;
+    }
+}
+
+@media print {
+    .toc {
+        display: none;
+    }
+
+    .toc + .markdown-body {
+        margin-left: auto;
+    }
+}
+`
+
+// ThemeCSS returns the stylesheet of an exported document in the given theme colors
+func ThemeCSS(colors theme.ThemeColors, toc bool) string {
+	var buf strings.Builder
+	buf.WriteString(":root {\n")
+	for _, variable := range themeVariables(colors) {
+		buf.WriteString("    " + variable.name + ": " + variable.value + ";\n")
+	}
+	buf.WriteString("}\n")
+
+	buf.WriteString(documentCSS)
+	if toc {
+		buf.WriteString(tocCSS)
+	}
+	return buf.String()
+}
+
+// cssVariable is a custom property declared by ThemeCSS
+type cssVariable struct {
+	name, value string
+}
+
+// themeVariables returns the custom properties holding the theme colors
+func themeVariables(colors theme.ThemeColors) []cssVariable {
+	return []cssVariable{
+		{"--bg", colors.Background},
+		{"--bg-secondary", colors.BackgroundSecondary},
+		{"--text", colors.Text},
+		{"--text-secondary", colors.TextSecondary},
+		{"--border", colors.Border},
+		{"--accent", colors.Accent},
+		{"--accent-hover", colors.AccentHover},
+		{"--preview-bg", colors.PreviewBackground},
+		{"--highlight", colors.Highlight},
+	}
+}
+
+// resolvedThemeCSS returns the document stylesheet with the theme colors
+// written in place, for readers without custom property support
+func resolvedThemeCSS(colors theme.ThemeColors) string {
+	var pairs []string
+	for _, variable := range themeVariables(colors) {
+		pairs = append(pairs, "var("+variable.name+")", variable.value)
+	}
+	return strings.NewReplacer(pairs...).Replace(documentCSS)
+}
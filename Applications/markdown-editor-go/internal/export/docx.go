@@ -0,0 +1,779 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// DOCXOptions controls how a document is exported to Word
+type DOCXOptions struct {
+	// Title of the document; defaults to the front matter title or the first heading
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	SourcePath string `json:"sourcePath"`
+
+	// ReferenceDoc is an optional .docx whose styles replace the built-in ones
+	ReferenceDoc string `json:"referenceDoc"`
+}
+
+// DOCXExporter renders markdown documents as Word (OOXML) files
+type DOCXExporter struct {
+	parser   *utils.MarkdownParser
+	options  DOCXOptions
+	warnings []string
+}
+
+// NewDOCXExporter creates a Word exporter
+func NewDOCXExporter(parser *utils.MarkdownParser, options DOCXOptions) *DOCXExporter {
+	return &DOCXExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the problems found during the last export, such as missing images
+func (e *DOCXExporter) Warnings() []string {
+	return e.warnings
+}
+
+// Export writes the document as a .docx file to outputPath
+func (e *DOCXExporter) Export(md string, outputPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return e.Render(md, file)
+}
+
+// Render writes the document as a .docx package to out
+func (e *DOCXExporter) Render(md string, out io.Writer) error {
+	e.warnings = nil
+
+	styles := defaultStylesXML()
+	if e.options.ReferenceDoc != "" {
+		reference, err := referenceStyles(e.options.ReferenceDoc)
+		if err != nil {
+			return err
+		}
+		styles = mergeStyles(reference)
+	}
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(body)
+	headings := DocumentHeadings(doc)
+
+	title := e.options.Title
+	if title == "" {
+		title = DocumentTitle(matter, headings, e.options.SourcePath)
+	}
+
+	w := newDOCXWriter(e)
+	for _, heading := range headings {
+		w.bookmarks[heading.ID] = bookmarkName(heading.ID)
+	}
+	w.blocks(doc, docxContext{})
+	w.writeFootnotes()
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", packageRelsXML},
+		{"docProps/core.xml", coreXML(title, matter)},
+		{"word/document.xml", xmlHeader + `<w:document ` + wordNamespaces + `><w:body>` + "\n" + w.document.body.String() + `</w:body></w:document>`},
+		{"word/_rels/document.xml.rels", w.document.relsXML()},
+		{"word/styles.xml", styles},
+		{"word/numbering.xml", numberingXML(w.lists)},
+		{"word/settings.xml", settingsXML},
+		{"word/footnotes.xml", xmlHeader + `<w:footnotes ` + wordNamespaces + `>` + "\n" + footnoteSeparators + w.footnotes.body.String() + `</w:footnotes>`},
+		{"word/_rels/footnotes.xml.rels", w.footnotes.relsXML()},
+	}
+
+	zw := zip.NewWriter(out)
+	for _, part := range parts {
+		if err := writeZipFile(zw, part.name, []byte(part.content)); err != nil {
+			return err
+		}
+	}
+	for _, media := range w.media {
+		if err := writeZipFile(zw, "word/media/"+media.name, media.image.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// referenceStyles reads the styles part of a reference .docx
+func referenceStyles(path string) (string, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return "", errors.New("cannot read reference document: " + err.Error())
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != "word/styles.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", errors.New("reference document has no styles: " + filepath.Base(path))
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// coreXML returns the document properties shown by Word's File > Info
+func coreXML(title string, matter utils.FrontMatter) string {
+	return xmlHeader + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" ` +
+		`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" ` +
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<dc:title>` + xmlText(title) + `</dc:title>` +
+		`<dc:creator>` + xmlText(matter.String("author")) + `</dc:creator>` +
+		`<dc:description>` + xmlText(matter.String("description")) + `</dc:description>` +
+		`<cp:keywords>` + xmlText(strings.Join(matter.Strings("tags"), ", ")) + `</cp:keywords>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">` + time.Now().UTC().Format(time.RFC3339) + `</dcterms:created>` +
+		`</cp:coreProperties>`
+}
+
+// xmlText escapes text for XML content and attributes
+func xmlText(text string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+// bookmarkName turns a heading ID into a Word bookmark name, which may only
+// hold letters, digits and underscores and must start with a letter
+func bookmarkName(id string) string {
+	var buf strings.Builder
+	for _, r := range id {
+		if r < 128 && (r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	name := buf.String()
+	if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		name = "h" + name
+	}
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return name
+}
+
+// docxRelationship links a part to a hyperlink target or an image
+type docxRelationship struct {
+	id       string
+	kind     string
+	target   string
+	external bool
+}
+
+// docxPart is document.xml or footnotes.xml with its relationships
+type docxPart struct {
+	body bytes.Buffer
+	rels []docxRelationship
+}
+
+// relationship returns the ID of a relationship, adding it when new
+func (p *docxPart) relationship(kind string, target string, external bool) string {
+	for _, rel := range p.rels {
+		if rel.kind == kind && rel.target == target {
+			return rel.id
+		}
+	}
+	rel := docxRelationship{"rId" + strconv.Itoa(len(p.rels)+1), kind, target, external}
+	p.rels = append(p.rels, rel)
+	return rel.id
+}
+
+func (p *docxPart) relsXML() string {
+	var buf strings.Builder
+	buf.WriteString(xmlHeader + `<Relationships xmlns="` + relationshipsNamespace + `">` + "\n")
+	for _, rel := range p.rels {
+		buf.WriteString(`<Relationship Id="` + rel.id + `" Type="` + officeRelationships + rel.kind + `" Target="` + xmlText(rel.target) + `"`)
+		if rel.external {
+			buf.WriteString(` TargetMode="External"`)
+		}
+		buf.WriteString("/>\n")
+	}
+	buf.WriteString(`</Relationships>`)
+	return buf.String()
+}
+
+// docxMedia is an image stored in word/media
+type docxMedia struct {
+	name   string
+	image  *Image
+	width  int // EMUs
+	height int
+}
+
+// docxContext is the paragraph formatting inherited from enclosing blocks
+type docxContext struct {
+	style  string // paragraph style, "" for Normal
+	depth  int    // number of enclosing lists
+	indent int    // left indentation in twips for list continuation paragraphs
+}
+
+// docxWriter lays out a document's AST as WordprocessingML
+type docxWriter struct {
+	exporter *DOCXExporter
+	baseDir  string
+
+	document  *docxPart
+	footnotes *docxPart
+	part      *docxPart // the part being written
+
+	style inlineStyle
+	lists []docxNumbering
+	media []*docxMedia
+
+	// bookmarks maps heading IDs to the bookmark names of internal links
+	bookmarks   map[string]string
+	bookmarkIDs int
+
+	// notes maps footnote numbers to their content; queued holds the content
+	// of each Word footnote, written after the body
+	notes      map[int]ast.Node
+	queued     []ast.Node
+	drawingIDs int
+
+	// pendingNumber is the numbering of the list item whose first paragraph
+	// comes next; pendingRun is written at the start of the next paragraph
+	pendingNumber *docxNumber
+	pendingRun    string
+}
+
+// docxNumber places a paragraph in a list
+type docxNumber struct {
+	id    int
+	level int
+}
+
+func newDOCXWriter(e *DOCXExporter) *docxWriter {
+	w := &docxWriter{
+		exporter:  e,
+		baseDir:   sourceDir(e.options.SourcePath),
+		document:  &docxPart{},
+		footnotes: &docxPart{},
+		bookmarks: map[string]string{},
+		notes:     map[int]ast.Node{},
+	}
+	w.part = w.document
+	w.document.relationship("styles", "styles.xml", false)
+	w.document.relationship("numbering", "numbering.xml", false)
+	w.document.relationship("footnotes", "footnotes.xml", false)
+	w.document.relationship("settings", "settings.xml", false)
+	return w
+}
+
+func (w *docxWriter) warn(message string) {
+	w.exporter.warnings = append(w.exporter.warnings, message)
+}
+
+func (w *docxWriter) write(s string) {
+	w.part.body.WriteString(s)
+}
+
+// Blocks
+
+// blocks writes the children of a container
+func (w *docxWriter) blocks(container ast.Node, ctx docxContext) {
+	for _, child := range container.GetChildren() {
+		w.block(child, ctx)
+	}
+}
+
+func (w *docxWriter) block(node ast.Node, ctx docxContext) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		w.heading(node)
+	case *ast.Paragraph:
+		w.paragraph(node, ctx, "")
+	case *ast.List:
+		w.list(node, ctx)
+	case *ast.BlockQuote:
+		ctx.style = "Quote"
+		w.blocks(node, ctx)
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info), true)
+	case *ast.MathBlock:
+		w.codeBlock(string(node.Literal), "", false)
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="DFE6E9"/></w:pBdr></w:pPr></w:p>` + "\n")
+	case *ast.HTMLBlock:
+		if !bytes.HasPrefix(bytes.TrimSpace(node.Literal), []byte("<!--")) {
+			w.warn("raw HTML blocks are left out of the Word document")
+		}
+	case *ast.Footnotes:
+		// Footnotes are written where they are referenced
+	default:
+		w.blocks(node, ctx)
+	}
+}
+
+// paragraphStart opens a paragraph, applying the context's style and any pending list number
+func (w *docxWriter) paragraphStart(ctx docxContext, align string) {
+	var pPr string
+	if ctx.style != "" {
+		pPr += `<w:pStyle w:val="` + ctx.style + `"/>`
+	}
+	if number := w.pendingNumber; number != nil {
+		pPr += `<w:numPr><w:ilvl w:val="` + strconv.Itoa(number.level) + `"/><w:numId w:val="` + strconv.Itoa(number.id) + `"/></w:numPr>`
+		w.pendingNumber = nil
+	} else if ctx.indent > 0 {
+		pPr += `<w:ind w:left="` + strconv.Itoa(ctx.indent) + `"/>`
+	}
+	if align != "" {
+		pPr += `<w:jc w:val="` + align + `"/>`
+	}
+
+	w.write(`<w:p>`)
+	if pPr != "" {
+		w.write(`<w:pPr>` + pPr + `</w:pPr>`)
+	}
+
+	if w.pendingRun != "" {
+		w.write(w.pendingRun)
+		w.pendingRun = ""
+	}
+}
+
+func (w *docxWriter) paragraphEnd() {
+	w.write("</w:p>\n")
+}
+
+// heading writes a heading in Word's heading style, bookmarked for internal links
+func (w *docxWriter) heading(heading *ast.Heading) {
+	w.paragraphStart(docxContext{style: "Heading" + strconv.Itoa(heading.Level)}, "")
+	name, ok := w.bookmarks[heading.HeadingID]
+	if ok {
+		w.bookmarkIDs++
+		w.write(`<w:bookmarkStart w:id="` + strconv.Itoa(w.bookmarkIDs) + `" w:name="` + name + `"/>`)
+	}
+	w.inlines(heading)
+	if ok {
+		w.write(`<w:bookmarkEnd w:id="` + strconv.Itoa(w.bookmarkIDs) + `"/>`)
+	}
+	w.paragraphEnd()
+}
+
+// paragraph writes a paragraph of inline content
+func (w *docxWriter) paragraph(node ast.Node, ctx docxContext, align string) {
+	w.paragraphStart(ctx, align)
+	w.inlines(node)
+	w.paragraphEnd()
+}
+
+// list writes a list with Word numbering, restarting at the list's start number
+func (w *docxWriter) list(list *ast.List, ctx docxContext) {
+	if list.IsFootnotesList {
+		return
+	}
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		w.definitionList(list, ctx)
+		return
+	}
+
+	numbering := docxNumbering{abstract: bulletNumbering, level: ctx.depth, start: 1}
+	if list.ListFlags&ast.ListTypeOrdered != 0 {
+		numbering.abstract = decimalNumbering
+		if list.Start > 0 {
+			numbering.start = list.Start
+		}
+	}
+	w.lists = append(w.lists, numbering)
+	id := len(w.lists)
+
+	itemCtx := ctx
+	itemCtx.depth = ctx.depth + 1
+	itemCtx.indent = listIndent(ctx.depth)
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		w.pendingNumber = &docxNumber{id: id, level: ctx.depth}
+		if _, ok := firstChild(item).(*ast.Paragraph); !ok {
+			// Give items starting with another block their number on a line of their own
+			w.paragraphStart(itemCtx, "")
+			w.paragraphEnd()
+		}
+		w.blocks(item, itemCtx)
+	}
+	w.pendingNumber = nil
+}
+
+// definitionList writes terms in bold with their definitions indented below
+func (w *docxWriter) definitionList(list *ast.List, ctx docxContext) {
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			w.style.bold = true
+			w.paragraph(item, ctx, "")
+			w.style.bold = false
+			continue
+		}
+		definitionCtx := ctx
+		definitionCtx.indent = ctx.indent + 720
+		if _, ok := firstChild(item).(*ast.Paragraph); ok {
+			w.blocks(item, definitionCtx)
+		} else {
+			w.paragraph(item, definitionCtx, "")
+		}
+	}
+}
+
+func firstChild(node ast.Node) ast.Node {
+	children := node.GetChildren()
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0]
+}
+
+// codeBlock writes code in the Source Code style, highlighted when requested
+func (w *docxWriter) codeBlock(code string, language string, highlight bool) {
+	code = strings.ReplaceAll(strings.TrimRight(code, "\n"), "\t", "    ")
+
+	w.paragraphStart(docxContext{style: "SourceCode"}, "")
+	for _, token := range codeTokens(code, language) {
+		rPr := `<w:rPr><w:rStyle w:val="VerbatimChar"/>`
+		if highlight {
+			if colour, ok := tokenColor(token.Type); ok {
+				rPr += `<w:color w:val="` + strings.TrimPrefix(colour.String(), "#") + `"/>`
+			}
+		}
+		rPr += `</w:rPr>`
+
+		for i, line := range strings.Split(token.Value, "\n") {
+			if i > 0 {
+				w.write(`<w:r><w:br/></w:r>`)
+			}
+			if line != "" {
+				w.write(`<w:r>` + rPr + `<w:t xml:space="preserve">` + xmlText(line) + `</w:t></w:r>`)
+			}
+		}
+	}
+	w.paragraphEnd()
+}
+
+// table writes a table, repeating its header rows on each page
+func (w *docxWriter) table(table *ast.Table) {
+	columns := 0
+	ast.WalkFunc(table, func(node ast.Node, entering bool) ast.WalkStatus {
+		if row, ok := node.(*ast.TableRow); ok && entering {
+			if len(row.Children) > columns {
+				columns = len(row.Children)
+			}
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+	if columns == 0 {
+		return
+	}
+
+	w.write(`<w:tbl><w:tblPr><w:tblStyle w:val="Table"/><w:tblW w:w="5000" w:type="pct"/></w:tblPr><w:tblGrid>`)
+	for i := 0; i < columns; i++ {
+		w.write(`<w:gridCol w:w="` + strconv.Itoa(9000/columns) + `"/>`)
+	}
+	w.write("</w:tblGrid>\n")
+
+	ast.WalkFunc(table, func(node ast.Node, entering bool) ast.WalkStatus {
+		row, ok := node.(*ast.TableRow)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		w.write(`<w:tr>`)
+		if _, header := row.Parent.(*ast.TableHeader); header {
+			w.write(`<w:trPr><w:tblHeader/></w:trPr>`)
+		}
+		for i := 0; i < columns; i++ {
+			w.write(`<w:tc><w:tcPr><w:tcW w:w="0" w:type="auto"/></w:tcPr>`)
+			if i >= len(row.Children) {
+				w.write(`<w:p/></w:tc>`)
+				continue
+			}
+			cell, _ := row.Children[i].(*ast.TableCell)
+			if cell == nil {
+				w.write(`<w:p/></w:tc>`)
+				continue
+			}
+
+			align := ""
+			switch cell.Align {
+			case ast.TableAlignmentCenter:
+				align = "center"
+			case ast.TableAlignmentRight:
+				align = "right"
+			}
+			w.style.bold = cell.IsHeader
+			w.paragraph(cell, docxContext{}, align)
+			w.style.bold = false
+			w.write(`</w:tc>`)
+		}
+		w.write("</w:tr>\n")
+		return ast.SkipChildren
+	})
+	w.write("</w:tbl>\n")
+
+	// Keep the next table from merging with this one
+	w.write("<w:p/>\n")
+}
+
+// Inline content
+
+// inlines writes the inline children of a node as runs
+func (w *docxWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *docxWriter) inline(node ast.Node) {
+	saved := w.style
+	defer func() { w.style = saved }()
+
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(string(node.Literal))
+	case *ast.Code:
+		w.style.mono = true
+		w.text(string(node.Literal))
+	case *ast.Math:
+		w.style.mono = true
+		w.text(string(node.Literal))
+	case *ast.Emph:
+		w.style.italic = true
+		w.inlines(node)
+	case *ast.Strong:
+		w.style.bold = true
+		w.inlines(node)
+	case *ast.Del:
+		w.style.strike = true
+		w.inlines(node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.footnoteReference(node)
+			return
+		}
+		w.link(node)
+	case *ast.Image:
+		w.image(node)
+	case *ast.Hardbreak:
+		w.write(`<w:r><w:br/></w:r>`)
+	case *ast.Softbreak:
+		w.text(" ")
+	case *ast.HTMLSpan:
+		// Inline HTML has no Word equivalent
+	default:
+		w.inlines(node)
+	}
+}
+
+// text writes a run of text in the current style
+func (w *docxWriter) text(text string) {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if text == "" {
+		return
+	}
+
+	var rPr string
+	switch {
+	case w.style.mono:
+		rPr += `<w:rStyle w:val="VerbatimChar"/>`
+	case w.style.link != "":
+		rPr += `<w:rStyle w:val="Hyperlink"/>`
+	}
+	if w.style.bold {
+		rPr += `<w:b/>`
+	}
+	if w.style.italic {
+		rPr += `<w:i/>`
+	}
+	if w.style.strike {
+		rPr += `<w:strike/>`
+	}
+
+	w.write(`<w:r>`)
+	if rPr != "" {
+		w.write(`<w:rPr>` + rPr + `</w:rPr>`)
+	}
+	w.write(`<w:t xml:space="preserve">` + xmlText(text) + `</w:t></w:r>`)
+}
+
+// link writes a hyperlink to a web address or, for #id links, to a heading's bookmark
+func (w *docxWriter) link(link *ast.Link) {
+	dest := string(link.Destination)
+	switch {
+	case strings.HasPrefix(dest, "#"):
+		name, ok := w.bookmarks[dest[1:]]
+		if !ok {
+			w.inlines(link)
+			return
+		}
+		w.write(`<w:hyperlink w:anchor="` + name + `">`)
+	case dest != "":
+		id := w.part.relationship("hyperlink", dest, true)
+		w.write(`<w:hyperlink r:id="` + id + `" w:history="1">`)
+	default:
+		w.inlines(link)
+		return
+	}
+
+	w.style.link = dest
+	w.inlines(link)
+	w.write(`</w:hyperlink>`)
+}
+
+// footnoteReference writes a footnote mark, queueing the note to be written
+// after the body. Word footnotes have a single reference, so a note referenced
+// again is repeated.
+func (w *docxWriter) footnoteReference(link *ast.Link) {
+	// Only the first reference to a note links to its content
+	note, ok := w.notes[link.NoteID]
+	if !ok {
+		note = link.Footnote
+		w.notes[link.NoteID] = note
+	}
+	w.queued = append(w.queued, note)
+	id := strconv.Itoa(len(w.queued))
+	w.write(`<w:r><w:rPr><w:rStyle w:val="FootnoteReference"/></w:rPr><w:footnoteReference w:id="` + id + `"/></w:r>`)
+}
+
+// writeFootnotes writes the queued footnotes, including ones referenced from other footnotes
+func (w *docxWriter) writeFootnotes() {
+	w.part = w.footnotes
+	for i := 0; i < len(w.queued); i++ {
+		note := w.queued[i]
+		w.write(`<w:footnote w:id="` + strconv.Itoa(i+1) + `">`)
+		w.pendingRun = `<w:r><w:rPr><w:rStyle w:val="FootnoteReference"/></w:rPr><w:footnoteRef/></w:r><w:r><w:t xml:space="preserve"> </w:t></w:r>`
+
+		// Single paragraph notes hold their inline content directly
+		ctx := docxContext{style: "FootnoteText"}
+		if child := firstChild(note); child != nil && child.AsLeaf() == nil {
+			w.blocks(note, ctx)
+		} else {
+			w.paragraph(note, ctx, "")
+		}
+		w.write("</w:footnote>\n")
+	}
+	w.part = w.document
+}
+
+// image embeds a local image, or writes its alt text when it cannot be embedded
+func (w *docxWriter) image(node *ast.Image) {
+	dest := string(node.Destination)
+	alt := strings.TrimSpace(utils.NodeText(node))
+
+	media, err := w.addMedia(dest)
+	if err != nil {
+		w.warn(err.Error())
+		if alt == "" {
+			alt = dest
+		}
+		saved := w.style
+		w.style.italic = true
+		w.text("[" + alt + "]")
+		w.style = saved
+		return
+	}
+
+	id := w.part.relationship("image", "media/"+media.name, false)
+	w.drawingIDs++
+	drawingID := strconv.Itoa(w.drawingIDs)
+	extent := `cx="` + strconv.Itoa(media.width) + `" cy="` + strconv.Itoa(media.height) + `"`
+	w.write(`<w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">` +
+		`<wp:extent ` + extent + `/>` +
+		`<wp:docPr id="` + drawingID + `" name="Picture ` + drawingID + `" descr="` + xmlText(alt) + `"/>` +
+		`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>` +
+		`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>` +
+		`<pic:nvPicPr><pic:cNvPr id="0" name="` + xmlText(media.name) + `"/><pic:cNvPicPr/></pic:nvPicPr>` +
+		`<pic:blipFill><a:blip r:embed="` + id + `"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>` +
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext ` + extent + `/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>` +
+		`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`)
+}
+
+// addMedia stores a local image in the package once, sized at 96 dpi and at
+// most six inches wide
+func (w *docxWriter) addMedia(dest string) (*docxMedia, error) {
+	if !isLocalReference(dest) {
+		return nil, errors.New("remote image " + dest + " is not embedded")
+	}
+	img, err := LoadImage(dest, w.baseDir)
+	if err != nil {
+		return nil, errors.New("image " + dest + " could not be read: " + err.Error())
+	}
+	for _, media := range w.media {
+		if media.image.Path == img.Path {
+			return media, nil
+		}
+	}
+
+	ext := map[string]string{"image/png": "png", "image/jpeg": "jpeg", "image/gif": "gif"}[img.MediaType]
+	config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if ext == "" || err != nil {
+		return nil, errors.New("image " + dest + " is not a PNG, JPEG or GIF file")
+	}
+
+	const emuPerPixel = 9525
+	const maxWidth = 6 * 914400
+	width, height := config.Width*emuPerPixel, config.Height*emuPerPixel
+	if width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+
+	media := &docxMedia{
+		name:   "image" + strconv.Itoa(len(w.media)+1) + "." + ext,
+		image:  img,
+		width:  width,
+		height: height,
+	}
+	w.media = append(w.media, media)
+	return media, nil
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"strconv"
+	"strings"
+)
+
+// XML namespaces of the WordprocessingML parts
+const (
+	wordNamespaces = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+		`xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" ` +
+		`xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" ` +
+		`xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"`
+
+	xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+	relationshipsNamespace = "http://schemas.openxmlformats.org/package/2006/relationships"
+	officeRelationships    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+)
+
+// contentTypesXML declares the media type of every part in the package
+const contentTypesXML = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="jpeg" ContentType="image/jpeg"/>
+<Default Extension="gif" ContentType="image/gif"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>
+<Override PartName="/word/footnotes.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.footnotes+xml"/>
+<Override PartName="/word/settings.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.settings+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+// packageRelsXML points at the main document and its properties
+const packageRelsXML = xmlHeader + `<Relationships xmlns="` + relationshipsNamespace + `">
+<Relationship Id="rId1" Type="` + officeRelationships + `officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+// settingsXML reserves the footnote separators
+const settingsXML = xmlHeader + `<w:settings ` + wordNamespaces + `>
+<w:footnotePr><w:footnote w:id="-1"/><w:footnote w:id="0"/></w:footnotePr>
+</w:settings>`
+
+// footnoteSeparators are the separator lines Word expects at the start of footnotes.xml
+const footnoteSeparators = `<w:footnote w:type="separator" w:id="-1"><w:p><w:r><w:separator/></w:r></w:p></w:footnote>
+<w:footnote w:type="continuationSeparator" w:id="0"><w:p><w:r><w:continuationSeparator/></w:r></w:p></w:footnote>
+`
+
+// docxStyle is a style definition the exporter's output refers to
+type docxStyle struct {
+	id  string
+	xml string
+}
+
+// docxStyles are the styles used by exported documents. Headings use Word's
+// built-in heading styles so the document outline and TOC fields work.
+var docxStyles = []docxStyle{
+	{"Normal", `<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="160" w:line="276" w:lineRule="auto"/></w:pPr></w:style>`},
+	{"Heading1", headingStyle(1, 32, false)},
+	{"Heading2", headingStyle(2, 26, false)},
+	{"Heading3", headingStyle(3, 24, false)},
+	{"Heading4", headingStyle(4, 22, true)},
+	{"Heading5", headingStyle(5, 22, false)},
+	{"Heading6", headingStyle(6, 22, true)},
+	{"Quote", `<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="0984E3"/></w:pBdr><w:ind w:left="567"/></w:pPr><w:rPr><w:i/><w:color w:val="636E72"/></w:rPr></w:style>`},
+	{"SourceCode", `<w:style w:type="paragraph" w:customStyle="1" w:styleId="SourceCode"><w:name w:val="Source Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:after="160" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/></w:rPr></w:style>`},
+	{"VerbatimChar", `<w:style w:type="character" w:customStyle="1" w:styleId="VerbatimChar"><w:name w:val="Verbatim Char"/><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/></w:rPr></w:style>`},
+	{"Hyperlink", `<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>`},
+	{"FootnoteText", `<w:style w:type="paragraph" w:styleId="FootnoteText"><w:name w:val="footnote text"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:sz w:val="20"/></w:rPr></w:style>`},
+	{"FootnoteReference", `<w:style w:type="character" w:styleId="FootnoteReference"><w:name w:val="footnote reference"/><w:rPr><w:vertAlign w:val="superscript"/></w:rPr></w:style>`},
+	{"Table", `<w:style w:type="table" w:customStyle="1" w:styleId="Table"><w:name w:val="Table"/><w:pPr><w:spacing w:after="0"/></w:pPr><w:tblPr><w:tblBorders><w:top w:val="single" w:sz="4" w:color="DFE6E9"/><w:left w:val="single" w:sz="4" w:color="DFE6E9"/><w:bottom w:val="single" w:sz="4" w:color="DFE6E9"/><w:right w:val="single" w:sz="4" w:color="DFE6E9"/><w:insideH w:val="single" w:sz="4" w:color="DFE6E9"/><w:insideV w:val="single" w:sz="4" w:color="DFE6E9"/></w:tblBorders><w:tblCellMar><w:top w:w="57" w:type="dxa"/><w:left w:w="108" w:type="dxa"/><w:bottom w:w="57" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>`},
+}
+
+// headingStyle defines Word's built-in "heading n" style
+func headingStyle(level int, size int, italic bool) string {
+	n := strconv.Itoa(level)
+	rPr := `<w:b/>`
+	if italic {
+		rPr += `<w:i/>`
+	}
+	return `<w:style w:type="paragraph" w:styleId="Heading` + n + `"><w:name w:val="heading ` + n + `"/>` +
+		`<w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:uiPriority w:val="9"/><w:qFormat/>` +
+		`<w:pPr><w:keepNext/><w:keepLines/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="` + strconv.Itoa(level-1) + `"/></w:pPr>` +
+		`<w:rPr>` + rPr + `<w:color w:val="2F5496"/><w:sz w:val="` + strconv.Itoa(size) + `"/></w:rPr></w:style>`
+}
+
+// defaultStylesXML returns the styles part used without a reference document
+func defaultStylesXML() string {
+	var buf strings.Builder
+	buf.WriteString(xmlHeader + `<w:styles ` + wordNamespaces + `>` + "\n")
+	buf.WriteString(`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-US"/></w:rPr></w:rPrDefault><w:pPrDefault/></w:docDefaults>` + "\n")
+	for _, style := range docxStyles {
+		buf.WriteString(style.xml + "\n")
+	}
+	buf.WriteString(`</w:styles>`)
+	return buf.String()
+}
+
+// mergeStyles adds the styles the exporter needs but a reference document
+// does not define, keeping the reference's own definitions
+func mergeStyles(styles string) string {
+	end := strings.LastIndex(styles, "</w:styles>")
+	if end < 0 {
+		return styles
+	}
+
+	var missing strings.Builder
+	for _, style := range docxStyles {
+		if !strings.Contains(styles, `w:styleId="`+style.id+`"`) {
+			missing.WriteString(style.xml + "\n")
+		}
+	}
+	return styles[:end] + missing.String() + styles[end:]
+}
+
+// Abstract numbering definitions in numbering.xml
+const (
+	bulletNumbering  = 0
+	decimalNumbering = 1
+)
+
+// docxNumbering is a list instance, so that each list numbers from its own start
+type docxNumbering struct {
+	abstract int
+	level    int
+	start    int
+}
+
+// numberingXML returns the numbering part with one instance per list
+func numberingXML(lists []docxNumbering) string {
+	var buf strings.Builder
+	buf.WriteString(xmlHeader + `<w:numbering ` + wordNamespaces + `>` + "\n")
+
+	bullets := []string{"•", "◦", "▪"}
+	for abstract := bulletNumbering; abstract <= decimalNumbering; abstract++ {
+		buf.WriteString(`<w:abstractNum w:abstractNumId="` + strconv.Itoa(abstract) + `"><w:multiLevelType w:val="hybridMultilevel"/>`)
+		for level := 0; level < 9; level++ {
+			format, text := "bullet", bullets[level%len(bullets)]
+			if abstract == decimalNumbering {
+				format, text = "decimal", "%"+strconv.Itoa(level+1)+"."
+			}
+			buf.WriteString(`<w:lvl w:ilvl="` + strconv.Itoa(level) + `"><w:start w:val="1"/>` +
+				`<w:numFmt w:val="` + format + `"/><w:lvlText w:val="` + text + `"/><w:lvlJc w:val="left"/>` +
+				`<w:pPr><w:ind w:left="` + strconv.Itoa(listIndent(level)) + `" w:hanging="360"/></w:pPr></w:lvl>`)
+		}
+		buf.WriteString(`</w:abstractNum>` + "\n")
+	}
+
+	for i, list := range lists {
+		buf.WriteString(`<w:num w:numId="` + strconv.Itoa(i+1) + `"><w:abstractNumId w:val="` + strconv.Itoa(list.abstract) + `"/>` +
+			`<w:lvlOverride w:ilvl="` + strconv.Itoa(list.level) + `"><w:startOverride w:val="` + strconv.Itoa(list.start) + `"/></w:lvlOverride></w:num>` + "\n")
+	}
+	buf.WriteString(`</w:numbering>`)
+	return buf.String()
+}
+
+// listIndent returns the left indentation of list items at a nesting level, in twips
+func listIndent(level int) int {
+	return 720 * (level + 1)
+}
@@ -0,0 +1,767 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBOptions controls how documents are compiled into an EPUB book
+type EPUBOptions struct {
+	// Title of the book; defaults to the front matter title or the first heading
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	// and as the fallback title of a single document
+	SourcePath string `json:"sourcePath"`
+
+	Colors theme.ThemeColors `json:"colors"`
+}
+
+// Chapter is one markdown file compiled into a book
+type Chapter struct {
+	Path     string `json:"path"`
+	Markdown string `json:"markdown"`
+}
+
+// EPUBExporter compiles markdown documents into EPUB 3 books. Every level 1
+// heading starts a new content document, and the navigation document is built
+// from the heading hierarchy. Book metadata, the cover image and extra
+// stylesheets come from the front matter of the first chapter that has one:
+//
+//	title, author, lang, date, description, publisher, rights, tags,
+//	identifier or isbn, cover: images/cover.jpg, css: book.css
+type EPUBExporter struct {
+	parser   *utils.MarkdownParser
+	options  EPUBOptions
+	warnings []string
+}
+
+// NewEPUBExporter creates an EPUB exporter
+func NewEPUBExporter(parser *utils.MarkdownParser, options EPUBOptions) *EPUBExporter {
+	return &EPUBExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the problems found during the last export, such as missing images
+func (e *EPUBExporter) Warnings() []string {
+	return e.warnings
+}
+
+// Export writes a single document as an EPUB book to outputPath
+func (e *EPUBExporter) Export(md string, outputPath string) error {
+	return e.ExportBook([]Chapter{{Path: e.options.SourcePath, Markdown: md}}, outputPath)
+}
+
+// ExportBook compiles chapters, in order, into an EPUB book at outputPath
+func (e *EPUBExporter) ExportBook(chapters []Chapter, outputPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := e.RenderBook(chapters, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// RenderBook writes chapters, in order, as an EPUB package to out
+func (e *EPUBExporter) RenderBook(chapters []Chapter, out io.Writer) error {
+	e.warnings = nil
+
+	b := &epubBook{
+		exporter:     e,
+		images:       map[string]*epubItem{},
+		chapterFiles: map[string]string{},
+		chapterIDs:   map[string]map[string]string{},
+		ids:          map[string]string{},
+	}
+	for _, chapter := range chapters {
+		b.addChapter(chapter)
+	}
+	if len(b.sections) == 0 {
+		b.sections = append(b.sections, &epubSection{file: sectionFile(1)})
+	}
+	b.linkSections()
+
+	return b.write(out)
+}
+
+// epubBook collects the files of a book while its chapters are converted
+type epubBook struct {
+	exporter *EPUBExporter
+
+	// matter is the front matter the book's metadata comes from, and
+	// matterDir the folder its cover and stylesheets are relative to
+	matter    utils.FrontMatter
+	matterDir string
+
+	sections []*epubSection
+	images   map[string]*epubItem // by source path
+	items    []*epubItem          // images and stylesheets, in manifest order
+	headings []Heading            // with IDs pointing into the section files
+
+	// chapterFiles maps chapter paths to their first section, chapterIDs
+	// their element IDs to sections, and ids all element IDs to the first
+	// section holding them
+	chapterFiles map[string]string
+	chapterIDs   map[string]map[string]string
+	ids          map[string]string
+
+	// linkedImages are images shown as links or as their description
+	// because they cannot be embedded
+	linkedImages map[*ast.Image]string
+}
+
+// epubSection is a content document of the book
+type epubSection struct {
+	file       string
+	title      string
+	chapter    string // source path of the chapter it belongs to
+	chapter1   bool   // starts with a level 1 heading
+	nodes      []*nethtml.Node
+	properties map[string]bool // manifest properties such as svg and mathml
+}
+
+func sectionFile(n int) string {
+	return fmt.Sprintf("chapter-%03d.xhtml", n)
+}
+
+func (e *EPUBExporter) warn(message string) {
+	e.warnings = append(e.warnings, message)
+}
+
+// addChapter converts a chapter and splits it into sections at its level 1 headings
+func (b *epubBook) addChapter(chapter Chapter) {
+	if chapter.Path != "" {
+		chapter.Path = filepath.Clean(chapter.Path)
+	}
+	matter, body := utils.SplitFrontMatter(chapter.Markdown)
+	dir := sourceDir(chapter.Path)
+	if len(b.matter) == 0 && len(matter) > 0 {
+		b.matter = matter
+		b.matterDir = dir
+	}
+
+	doc := b.exporter.parser.Parse(body)
+	headings := map[string]Heading{}
+	for _, heading := range DocumentHeadings(doc) {
+		headings[heading.ID] = heading
+	}
+	b.embedImages(doc, dir)
+
+	// Blocks are rendered one at a time so that unclosed tags in raw HTML
+	// cannot swallow the rest of the chapter
+	var nodes []*nethtml.Node
+	for _, block := range doc.GetChildren() {
+		nodes = append(nodes, b.renderBlock(block)...)
+	}
+
+	var current *epubSection
+	ids := map[string]string{}
+	for _, child := range nodes {
+		if child.Type == nethtml.ElementNode && child.DataAtom == atom.Script {
+			// Scripted content would need the book to declare it
+			b.exporter.warn("scripts were left out")
+			continue
+		}
+
+		startsChapter := child.Type == nethtml.ElementNode && child.DataAtom == atom.H1
+		if current == nil || (startsChapter && hasHTMLContent(current.nodes)) {
+			current = &epubSection{
+				file:       sectionFile(len(b.sections) + 1),
+				chapter:    chapter.Path,
+				chapter1:   startsChapter,
+				properties: map[string]bool{},
+			}
+			b.sections = append(b.sections, current)
+			if _, ok := b.chapterFiles[chapter.Path]; !ok {
+				b.chapterFiles[chapter.Path] = current.file
+			}
+		}
+		if startsChapter && !current.chapter1 && !hasHTMLContent(current.nodes) {
+			current.chapter1 = true
+		}
+
+		b.prepareNode(child, current)
+		current.nodes = append(current.nodes, child)
+
+		// Record the section of every heading and element ID
+		walkHTML(child, func(n *nethtml.Node) {
+			id := htmlAttr(n, "id")
+			if id == "" {
+				return
+			}
+			if _, ok := ids[id]; ok {
+				// Repeated footnote references share an ID; links go to the first
+				removeHTMLAttr(n, "id")
+				return
+			}
+			ids[id] = current.file
+			if _, ok := b.ids[id]; !ok {
+				b.ids[id] = current.file
+			}
+			if heading, ok := headings[id]; ok && isHeadingElement(n) && heading.Text != "" {
+				if current.title == "" {
+					current.title = heading.Text
+				}
+				b.headings = append(b.headings, Heading{Level: heading.Level, Text: heading.Text, ID: current.file + "#" + id})
+			}
+		})
+	}
+	b.chapterIDs[chapter.Path] = ids
+
+	// Sections without headings take the chapter's title
+	for _, section := range b.sections {
+		if section.chapter == chapter.Path && section.title == "" {
+			section.title = matter.String("title")
+		}
+	}
+}
+
+// renderBlock renders a top-level block and returns its HTML nodes
+func (b *epubBook) renderBlock(block ast.Node) []*nethtml.Node {
+	page := b.exporter.parser.RenderHTML(block, html.RendererOptions{
+		RenderNodeHook: b.renderNode,
+	})
+	root, err := nethtml.Parse(strings.NewReader(page))
+	if err != nil {
+		b.exporter.warn("a block could not be converted: " + err.Error())
+		return nil
+	}
+	body := findHTMLElement(root, atom.Body)
+	if body == nil {
+		return nil
+	}
+
+	var nodes []*nethtml.Node
+	for child := body.FirstChild; child != nil; {
+		next := child.NextSibling
+		body.RemoveChild(child)
+		nodes = append(nodes, child)
+		child = next
+	}
+	return nodes
+}
+
+// renderNode highlights code and writes images that cannot be embedded as
+// links or as their description
+func (b *epubBook) renderNode(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *ast.CodeBlock:
+		if err := highlightHTML(w, string(node.Literal), codeLanguage(node.Info)); err != nil {
+			return ast.GoToNext, false
+		}
+		return ast.GoToNext, true
+	case *ast.Image:
+		href, ok := b.linkedImages[node]
+		if !ok {
+			return ast.GoToNext, false
+		}
+		switch {
+		case href == "" && entering:
+			io.WriteString(w, `<span class="image">`)
+		case href == "":
+			io.WriteString(w, "</span>")
+		case entering:
+			io.WriteString(w, `<a href="`+nethtml.EscapeString(href)+`">`)
+		default:
+			io.WriteString(w, "</a>")
+		}
+		return ast.GoToNext, true
+	}
+	return ast.GoToNext, false
+}
+
+// embedImages points local images at copies inside the book. Remote images
+// and formats reading systems need not support become links.
+func (b *epubBook) embedImages(doc ast.Node, dir string) {
+	if b.linkedImages == nil {
+		b.linkedImages = map[*ast.Image]string{}
+	}
+	for _, node := range documentImages(doc) {
+		dest := string(node.Destination)
+		if !isLocalReference(dest) {
+			b.exporter.warn("remote image " + dest + " was replaced by a link")
+			b.linkedImages[node] = dest
+			continue
+		}
+
+		item, err := b.addImage(dest, dir)
+		if err != nil {
+			b.exporter.warn("image " + dest + " could not be embedded: " + err.Error())
+			b.linkedImages[node] = ""
+			continue
+		}
+		node.Destination = []byte(item.href)
+	}
+}
+
+// addImage embeds a local image once and returns its manifest item
+func (b *epubBook) addImage(dest string, dir string) (*epubItem, error) {
+	image, err := LoadImage(dest, dir)
+	if err != nil {
+		return nil, err
+	}
+	if item, ok := b.images[image.Path]; ok {
+		return item, nil
+	}
+	if !epubCoreMediaTypes[image.MediaType] {
+		return nil, errors.New(image.MediaType + " images are not supported by EPUB readers")
+	}
+
+	item := &epubItem{
+		id:        fmt.Sprintf("image-%d", len(b.images)+1),
+		href:      "images/" + b.uniqueName("images/", filepath.Base(image.Path)),
+		mediaType: image.MediaType,
+		data:      image.Data,
+	}
+	b.images[image.Path] = item
+	b.items = append(b.items, item)
+	return item, nil
+}
+
+// uniqueName returns a file name not yet used in a folder of the book, made
+// safe for links
+func (b *epubBook) uniqueName(folder string, name string) string {
+	name = safeFileName.ReplaceAllString(name, "-")
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		taken := false
+		for _, item := range b.items {
+			if item.href == folder+name {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+}
+
+var safeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// prepareNode makes rendered HTML fit for an XHTML content document
+func (b *epubBook) prepareNode(node *nethtml.Node, section *epubSection) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == nethtml.ElementNode && child.DataAtom == atom.Script {
+			// Scripted content would need the book to declare it
+			b.exporter.warn("scripts were left out")
+			node.RemoveChild(child)
+		} else {
+			b.prepareNode(child, section)
+		}
+		child = next
+	}
+	if node.Type != nethtml.ElementNode {
+		return
+	}
+
+	// Foreign elements need their namespace declared in XHTML
+	parentNamespace := ""
+	if node.Parent != nil {
+		parentNamespace = node.Parent.Namespace
+	}
+	if node.Namespace != parentNamespace {
+		switch node.Namespace {
+		case "svg":
+			node.Attr = append(node.Attr, nethtml.Attribute{Key: "xmlns", Val: "http://www.w3.org/2000/svg"})
+			section.properties["svg"] = true
+		case "math":
+			node.Attr = append(node.Attr, nethtml.Attribute{Key: "xmlns", Val: "http://www.w3.org/1998/Math/MathML"})
+			section.properties["mathml"] = true
+		}
+	}
+}
+
+// linkSections points links at the sections holding their targets, as the
+// book no longer is a single page
+func (b *epubBook) linkSections() {
+	for _, section := range b.sections {
+		for _, node := range section.nodes {
+			walkHTML(node, func(n *nethtml.Node) {
+				if n.DataAtom != atom.A {
+					return
+				}
+				// Reading systems decide where links open
+				attrs := n.Attr[:0]
+				for _, a := range n.Attr {
+					switch a.Key {
+					case "href":
+						a.Val = b.resolveLink(a.Val, section)
+					case "target", "rel":
+						continue
+					}
+					attrs = append(attrs, a)
+				}
+				n.Attr = attrs
+			})
+		}
+	}
+}
+
+// resolveLink rewrites fragment links and links to other chapters of the book
+func (b *epubBook) resolveLink(href string, section *epubSection) string {
+	if strings.HasPrefix(href, "#") {
+		id := href[1:]
+		if file, ok := b.chapterIDs[section.chapter][id]; ok {
+			return b.relativeLink(file, id, section)
+		}
+		if file, ok := b.ids[id]; ok {
+			return b.relativeLink(file, id, section)
+		}
+		return href
+	}
+
+	if !isLocalReference(href) || section.chapter == "" {
+		return href
+	}
+	target, fragment, _ := strings.Cut(href, "#")
+	target = resolveLocalPath(target, sourceDir(section.chapter))
+	file, ok := b.chapterFiles[target]
+	if !ok {
+		return href
+	}
+	if fragment != "" {
+		if fileWithID, ok := b.chapterIDs[target][fragment]; ok {
+			return b.relativeLink(fileWithID, fragment, section)
+		}
+	}
+	return file
+}
+
+func (b *epubBook) relativeLink(file string, id string, section *epubSection) string {
+	if file == section.file {
+		return "#" + id
+	}
+	return file + "#" + url.PathEscape(id)
+}
+
+// metadata returns the book's metadata from its front matter
+func (b *epubBook) metadata() epubMetadata {
+	matter := b.matter
+	if matter == nil {
+		matter = utils.FrontMatter{}
+	}
+	options := b.exporter.options
+
+	meta := epubMetadata{
+		title:       options.Title,
+		language:    firstNonEmpty(matter.String("lang"), matter.String("language"), "en"),
+		authors:     matter.Strings("author"),
+		description: matter.String("description"),
+		publisher:   matter.String("publisher"),
+		rights:      firstNonEmpty(matter.String("rights"), matter.String("copyright")),
+		subjects:    append(matter.Strings("tags"), matter.Strings("keywords")...),
+		modified:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if meta.title == "" {
+		sourcePath := options.SourcePath
+		if sourcePath == "" && len(b.sections) > 0 {
+			sourcePath = b.sections[0].chapter
+		}
+		meta.title = DocumentTitle(matter, b.headings, sourcePath)
+	}
+	if date := matter.String("date"); epubDate.MatchString(date) {
+		meta.date = date
+	}
+
+	switch {
+	case matter.String("identifier") != "":
+		meta.identifier = matter.String("identifier")
+	case matter.String("isbn") != "":
+		meta.identifier = "urn:isbn:" + strings.ReplaceAll(matter.String("isbn"), "-", "")
+	default:
+		// Derive the identifier from the title and authors so that exporting
+		// the same book again updates it in readers' libraries
+		sum := sha1.Sum([]byte(meta.title + "\x00" + strings.Join(meta.authors, "\x00")))
+		sum[6] = sum[6]&0x0f | 0x50
+		sum[8] = sum[8]&0x3f | 0x80
+		meta.identifier = fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	}
+	return meta
+}
+
+var epubDate = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// write packages the book
+func (b *epubBook) write(out io.Writer) error {
+	meta := b.metadata()
+
+	// Stylesheets: the theme, then any listed in the front matter
+	css := "/* Generated by Markdown Editor */\n" + resolvedThemeCSS(b.exporter.options.Colors) + highlightCSS(false) + epubCSS
+	b.items = append(b.items, &epubItem{id: "style", href: "styles/book.css", mediaType: "text/css", data: []byte(css)})
+	stylesheets := []string{"styles/book.css"}
+	for _, name := range b.matterStrings("css", "stylesheet") {
+		data, err := ioutil.ReadFile(resolveLocalPath(name, b.matterDir))
+		if err != nil {
+			b.exporter.warn("stylesheet " + name + " could not be read: " + err.Error())
+			continue
+		}
+		href := "styles/" + b.uniqueName("styles/", filepath.Base(name))
+		b.items = append(b.items, &epubItem{id: fmt.Sprintf("style-%d", len(stylesheets)), href: href, mediaType: "text/css", data: data})
+		stylesheets = append(stylesheets, href)
+	}
+
+	var spine []epubSpineItem
+	var landmarks [][2]string
+
+	if cover := firstNonEmpty(b.matter.String("cover"), b.matter.String("cover-image")); cover != "" {
+		image, err := b.addImage(cover, b.matterDir)
+		if err != nil {
+			b.exporter.warn("cover " + cover + " could not be embedded: " + err.Error())
+		} else {
+			image.properties = "cover-image"
+			meta.cover = image.id
+			b.items = append(b.items, &epubItem{
+				id:        "cover",
+				href:      "cover.xhtml",
+				mediaType: "application/xhtml+xml",
+				data:      []byte(coverXHTML(meta.title, meta.language, image.href)),
+			})
+			spine = append(spine, epubSpineItem{id: "cover", linear: true})
+			landmarks = append(landmarks, [2]string{"cover", "cover.xhtml"})
+		}
+	}
+
+	// Sections without headings still need an entry in the table of contents
+	headings := b.headings
+	if len(headings) == 0 {
+		for _, section := range b.sections {
+			headings = append(headings, Heading{Level: 1, Text: firstNonEmpty(section.title, meta.title), ID: section.file})
+		}
+	}
+	landmarks = append(landmarks, [2]string{"toc", "nav.xhtml#toc"}, [2]string{"bodymatter", b.sections[0].file})
+	b.items = append(b.items, &epubItem{
+		id:         "nav",
+		href:       "nav.xhtml",
+		mediaType:  "application/xhtml+xml",
+		properties: "nav",
+		data:       []byte(navXHTML(meta.title, meta.language, stylesheets, headings, landmarks)),
+	})
+	spine = append(spine, epubSpineItem{id: "nav", linear: false})
+
+	for i, section := range b.sections {
+		var buf bytes.Buffer
+		writeXHTMLStart(&buf, firstNonEmpty(section.title, meta.title), meta.language, stylesheets)
+		if section.chapter1 {
+			buf.WriteString("<body>\n<section class=\"markdown-body\" epub:type=\"chapter\">\n")
+		} else {
+			buf.WriteString("<body>\n<section class=\"markdown-body\">\n")
+		}
+		for _, node := range section.nodes {
+			if err := nethtml.Render(&buf, node); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n</section>\n</body>\n</html>\n")
+
+		var properties []string
+		for _, property := range []string{"mathml", "svg"} {
+			if section.properties[property] {
+				properties = append(properties, property)
+			}
+		}
+		id := fmt.Sprintf("chapter-%d", i+1)
+		b.items = append(b.items, &epubItem{
+			id:         id,
+			href:       section.file,
+			mediaType:  "application/xhtml+xml",
+			properties: strings.Join(properties, " "),
+			data:       buf.Bytes(),
+		})
+		spine = append(spine, epubSpineItem{id: id, linear: true})
+	}
+
+	var opf bytes.Buffer
+	writePackageDocument(&opf, meta, b.items, spine)
+
+	// Control characters in the markdown would make the documents malformed
+	stripped := false
+	for _, item := range b.items {
+		if item.mediaType == "application/xhtml+xml" {
+			item.data = xmlChars(item.data, &stripped)
+		}
+	}
+	opfData := xmlChars(opf.Bytes(), &stripped)
+	if stripped {
+		b.exporter.warn("characters XML does not allow, such as control characters, were left out")
+	}
+
+	zw := zip.NewWriter(out)
+	// The mimetype comes first and uncompressed so the type can be sniffed
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, EPUBMediaType); err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, "META-INF/container.xml", []byte(containerXML)); err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, epubPackagePath, opfData); err != nil {
+		return err
+	}
+	for _, item := range b.items {
+		if err := writeZipFile(zw, path.Join(path.Dir(epubPackagePath), item.href), item.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xmlChars drops the characters outside the XML 1.0 Char production and the
+// bytes that are not UTF-8, setting stripped when it drops any
+func xmlChars(data []byte, stripped *bool) []byte {
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			*stripped = true
+		case r == '\t' || r == '\n' || r == '\r' || r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD || r >= 0x10000:
+			out = append(out, data[:size]...)
+		default:
+			*stripped = true
+		}
+		data = data[size:]
+	}
+	return out
+}
+
+// matterStrings returns the values of the first front matter key present
+func (b *epubBook) matterStrings(keys ...string) []string {
+	for _, key := range keys {
+		if values := b.matter.Strings(key); len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+// epubCSS adapts the document stylesheet to paged reading systems
+const epubCSS = `
+body {
+    background-color: transparent;
+}
+
+.markdown-body {
+    max-width: none;
+    padding: 0;
+}
+
+.markdown-body h1 {
+    page-break-before: always;
+}
+
+.markdown-body pre, .markdown-body table, .markdown-body img {
+    page-break-inside: avoid;
+}
+
+nav ol {
+    list-style: none;
+    padding-left: 1.5em;
+}
+`
+
+// HTML tree helpers
+
+func findHTMLElement(node *nethtml.Node, a atom.Atom) *nethtml.Node {
+	if node.Type == nethtml.ElementNode && node.DataAtom == a {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findHTMLElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// walkHTML calls fn for a node and each of its descendant elements
+func walkHTML(node *nethtml.Node, fn func(*nethtml.Node)) {
+	if node.Type == nethtml.ElementNode {
+		fn(node)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walkHTML(child, fn)
+	}
+}
+
+func htmlAttr(node *nethtml.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func removeHTMLAttr(node *nethtml.Node, name string) {
+	for i, a := range node.Attr {
+		if a.Key == name {
+			node.Attr = append(node.Attr[:i], node.Attr[i+1:]...)
+			return
+		}
+	}
+}
+
+func isHeadingElement(node *nethtml.Node) bool {
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+// hasHTMLContent reports whether nodes hold anything besides whitespace and comments
+func hasHTMLContent(nodes []*nethtml.Node) bool {
+	for _, node := range nodes {
+		switch node.Type {
+		case nethtml.ElementNode:
+			return true
+		case nethtml.TextNode:
+			if strings.TrimSpace(node.Data) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
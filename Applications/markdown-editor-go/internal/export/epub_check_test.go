@@ -0,0 +1,428 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+// checkEPUB checks the structure of an EPUB package: the uncompressed
+// mimetype entry, the container and package documents, that the manifest and
+// spine match the files in the book, that a navigation document exists, that
+// every content document is well-formed XHTML and that links inside the book
+// point at existing files and IDs. It returns all problems found.
+func checkEPUB(data []byte) []string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return []string{"not an EPUB file: " + err.Error()}
+	}
+
+	c := &epubChecker{files: map[string]*zip.File{}}
+	for _, file := range archive.File {
+		c.files[file.Name] = file
+	}
+	c.check(archive.File)
+	return c.problems
+}
+
+// epubChecker gathers the problems found in a book
+type epubChecker struct {
+	files    map[string]*zip.File
+	problems []string
+}
+
+func (c *epubChecker) problem(message string) {
+	c.problems = append(c.problems, message)
+}
+
+// opfPackage is the part of the package document the checks read
+type opfPackage struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Identifiers []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Titles    []string `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Languages []string `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Meta      []struct {
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	ItemRefs []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+func (c *epubChecker) check(entries []*zip.File) {
+	// The mimetype must come first, stored and without extra fields, so the
+	// type can be read at a fixed offset
+	if len(entries) == 0 || entries[0].Name != "mimetype" {
+		c.problem("mimetype is not the first file")
+	} else if mimetype := entries[0]; mimetype.Method != zip.Store || len(mimetype.Extra) > 0 {
+		c.problem("mimetype is compressed or has extra fields")
+	} else if data, err := c.read("mimetype"); err != nil || string(data) != EPUBMediaType {
+		c.problem("mimetype does not contain " + EPUBMediaType)
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := c.decode("META-INF/container.xml", &container); err != nil {
+		c.problem("META-INF/container.xml: " + err.Error())
+		return
+	}
+	if len(container.Rootfiles) == 0 {
+		c.problem("META-INF/container.xml names no package document")
+		return
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var opf opfPackage
+	if err := c.decode(opfPath, &opf); err != nil {
+		c.problem(opfPath + ": " + err.Error())
+		return
+	}
+	c.checkMetadata(opfPath, &opf)
+
+	// Every manifest item must exist, and every file must be in the manifest
+	base := path.Dir(opfPath)
+	items := map[string]string{}  // ID to path
+	listed := map[string]string{} // path to media type
+	navs := 0
+	for _, item := range opf.Items {
+		if item.ID == "" || item.Href == "" || item.MediaType == "" {
+			c.problem("manifest item " + item.ID + " is incomplete")
+			continue
+		}
+		if _, ok := items[item.ID]; ok {
+			c.problem("manifest ID " + item.ID + " is used twice")
+		}
+		name := resolveBookPath(base, item.Href)
+		items[item.ID] = name
+		listed[name] = item.MediaType
+		if _, ok := c.files[name]; !ok {
+			c.problem("manifest item " + item.Href + " is missing")
+		}
+		if strings.Contains(" "+item.Properties+" ", " nav ") {
+			navs++
+		}
+	}
+	if navs != 1 {
+		c.problem("the book needs exactly one navigation document")
+	}
+	for name := range c.files {
+		if name == "mimetype" || name == opfPath || strings.HasPrefix(name, "META-INF/") || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if _, ok := listed[name]; !ok {
+			c.problem(name + " is not in the manifest")
+		}
+	}
+
+	if len(opf.ItemRefs) == 0 {
+		c.problem("the spine is empty")
+	}
+	for _, ref := range opf.ItemRefs {
+		if name, ok := items[ref.IDRef]; !ok {
+			c.problem("spine item " + ref.IDRef + " is not in the manifest")
+		} else if listed[name] != "application/xhtml+xml" {
+			c.problem("spine item " + ref.IDRef + " is not a content document")
+		}
+	}
+
+	// Content documents must be well-formed, and their links must resolve
+	ids := map[string]map[string]bool{}
+	links := map[string][]string{}
+	for name, mediaType := range listed {
+		if mediaType != "application/xhtml+xml" {
+			continue
+		}
+		if _, ok := c.files[name]; !ok {
+			continue
+		}
+		docIDs, docLinks, err := c.scanXHTML(name)
+		if err != nil {
+			c.problem(name + " is not well-formed: " + err.Error())
+			continue
+		}
+		ids[name] = docIDs
+		links[name] = docLinks
+	}
+	for name, docLinks := range links {
+		for _, link := range docLinks {
+			c.checkLink(name, link, listed, ids)
+		}
+	}
+}
+
+func (c *epubChecker) checkMetadata(opfPath string, opf *opfPackage) {
+	if opf.Version != "3.0" {
+		c.problem(opfPath + " is not an EPUB 3 package")
+	}
+	found := false
+	for _, identifier := range opf.Metadata.Identifiers {
+		if identifier.ID == opf.UniqueIdentifier && strings.TrimSpace(identifier.Value) != "" {
+			found = true
+		}
+	}
+	if !found {
+		c.problem("the unique identifier is missing")
+	}
+	if len(opf.Metadata.Titles) == 0 || strings.TrimSpace(opf.Metadata.Titles[0]) == "" {
+		c.problem("the title is missing")
+	}
+	if len(opf.Metadata.Languages) == 0 || strings.TrimSpace(opf.Metadata.Languages[0]) == "" {
+		c.problem("the language is missing")
+	}
+	modified := false
+	for _, meta := range opf.Metadata.Meta {
+		if meta.Property == "dcterms:modified" && strings.TrimSpace(meta.Value) != "" {
+			modified = true
+		}
+	}
+	if !modified {
+		c.problem("the modification date is missing")
+	}
+}
+
+// checkLink reports links to files outside the manifest or to missing IDs
+func (c *epubChecker) checkLink(from string, link string, listed map[string]string, ids map[string]map[string]bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		c.problem(from + " has an invalid link " + link)
+		return
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return
+	}
+
+	target := from
+	if u.Path != "" {
+		target = resolveBookPath(path.Dir(from), u.Path)
+		if _, ok := listed[target]; !ok {
+			c.problem(from + " links to " + link + ", which is not in the book")
+			return
+		}
+	}
+	if u.Fragment != "" && ids[target] != nil && !ids[target][u.Fragment] {
+		c.problem(from + " links to the missing ID " + link)
+	}
+}
+
+// scanXHTML parses a content document strictly, returning its IDs and the
+// links and image sources in it
+func (c *epubChecker) scanXHTML(name string) (map[string]bool, []string, error) {
+	data, err := c.read(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := map[string]bool{}
+	var links []string
+	decoder := xml.NewDecoder(strings.NewReader(string(data)))
+	decoder.Strict = true
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, a := range element.Attr {
+			switch {
+			case a.Name.Local == "id":
+				if ids[a.Value] {
+					return nil, nil, errors.New("the ID " + a.Value + " is used twice")
+				}
+				ids[a.Value] = true
+			case a.Name.Local == "href" && element.Name.Local == "a",
+				a.Name.Local == "src" && element.Name.Local == "img",
+				a.Name.Local == "href" && element.Name.Local == "link":
+				links = append(links, a.Value)
+			}
+		}
+	}
+	return ids, links, nil
+}
+
+func (c *epubChecker) read(name string) ([]byte, error) {
+	file, ok := c.files[name]
+	if !ok {
+		return nil, errors.New("missing")
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func (c *epubChecker) decode(name string, v interface{}) error {
+	data, err := c.read(name)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// resolveBookPath resolves a link relative to a folder inside the book
+func resolveBookPath(dir string, href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if dir == "." {
+		return path.Clean(href)
+	}
+	return path.Clean(dir + "/" + href)
+}
+
+// renderEPUB compiles chapters into a book in memory and fails the test on
+// any problem the checks find
+func renderEPUB(t *testing.T, chapters []Chapter) (*EPUBExporter, []byte) {
+	t.Helper()
+	exporter := NewEPUBExporter(utils.NewMarkdownParser(), EPUBOptions{SourcePath: chapters[0].Path})
+	var buf bytes.Buffer
+	if err := exporter.RenderBook(chapters, &buf); err != nil {
+		t.Fatalf("RenderBook: %v", err)
+	}
+	for _, problem := range checkEPUB(buf.Bytes()) {
+		t.Errorf("invalid EPUB: %s", problem)
+	}
+	return exporter, buf.Bytes()
+}
+
+// readEntry returns a file of the book
+func readEntry(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	c := &epubChecker{files: map[string]*zip.File{}}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range archive.File {
+		c.files[file.Name] = file
+	}
+	content, err := c.read(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestEPUBDocument(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.Black)
+	file, err := os.Create(filepath.Join(dir, "dot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	md := "---\ntitle: Test Book\nauthor: Jane & Co\nlang: en\n---\n" +
+		"# One\n\nText with ![a dot](dot.png) and a [link](#two).\n\n## Section\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\n" +
+		"# Two\n\n<br>\n\n```go\nfunc main() {}\n```\n\nBack to [one](#one) & [the section](#section).\n"
+	exporter, data := renderEPUB(t, []Chapter{{Path: filepath.Join(dir, "book.md"), Markdown: md}})
+	if warnings := exporter.Warnings(); len(warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	opf := readEntry(t, data, epubPackagePath)
+	for _, want := range []string{"<dc:title>Test Book</dc:title>", "Jane &amp; Co", sectionFile(1), sectionFile(2), "image/png"} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("package document does not contain %q", want)
+		}
+	}
+	nav := readEntry(t, data, "OEBPS/nav.xhtml")
+	for _, want := range []string{">One<", ">Section<", ">Two<"} {
+		if !strings.Contains(nav, want) {
+			t.Errorf("navigation document does not contain %q", want)
+		}
+	}
+}
+
+func TestEPUBChapters(t *testing.T) {
+	dir := t.TempDir()
+	chapters := []Chapter{
+		{Path: filepath.Join(dir, "01-intro.md"), Markdown: "# Introduction\n\nSee [the details](02-details.md#details).\n"},
+		{Path: filepath.Join(dir, "02-details.md"), Markdown: "# Details\n\nBack to [the introduction](01-intro.md).\n\n![missing](missing.png)\n"},
+	}
+	exporter, data := renderEPUB(t, chapters)
+	if warnings := exporter.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "missing.png") {
+		t.Errorf("warnings = %v, want one about missing.png", warnings)
+	}
+	nav := readEntry(t, data, "OEBPS/nav.xhtml")
+	if !strings.Contains(nav, ">Introduction<") || !strings.Contains(nav, ">Details<") {
+		t.Errorf("navigation document does not list both chapters:\n%s", nav)
+	}
+}
+
+func TestCheckEPUBFindsProblems(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	// A compressed mimetype and no container
+	w, _ := archive.Create("mimetype")
+	io.WriteString(w, EPUBMediaType)
+	archive.Close()
+
+	problems := checkEPUB(buf.Bytes())
+	if len(problems) < 2 {
+		t.Fatalf("problems = %v, want the compressed mimetype and the missing container", problems)
+	}
+	if !strings.Contains(problems[0], "mimetype is compressed") {
+		t.Errorf("first problem = %q, want the compressed mimetype", problems[0])
+	}
+}
+
+func TestEPUBLeavesOutCharactersXMLDoesNotAllow(t *testing.T) {
+	dir := t.TempDir()
+	md := "---\ntitle: Bell\x07 Book\n---\n# Start\x01 here\n\nTab\tand form\x0cfeed, ünïcode and 😀.\n"
+	exporter, data := renderEPUB(t, []Chapter{{Path: filepath.Join(dir, "book.md"), Markdown: md}})
+	if warnings := exporter.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "control characters") {
+		t.Errorf("warnings = %v, want one about control characters", warnings)
+	}
+
+	chapter := readEntry(t, data, "OEBPS/"+sectionFile(1))
+	if !strings.Contains(chapter, "Start here") || !strings.Contains(chapter, "Tab\tand formfeed, ünïcode and 😀.") {
+		t.Errorf("chapter does not keep the text around the control characters:\n%s", chapter)
+	}
+	if opf := readEntry(t, data, epubPackagePath); strings.ContainsRune(opf, '\x07') {
+		t.Errorf("package document contains the bell of the title:\n%s", opf)
+	}
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EPUBMediaType is the content of an EPUB's mimetype file
+const EPUBMediaType = "application/epub+zip"
+
+// epubPackagePath is where the package document sits inside the book
+const epubPackagePath = "OEBPS/content.opf"
+
+// containerXML points reading systems at the package document
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="` + epubPackagePath + `" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// epubCoreMediaTypes are the image types reading systems must support; other
+// images would need fallbacks
+var epubCoreMediaTypes = map[string]bool{
+	"image/gif":     true,
+	"image/jpeg":    true,
+	"image/png":     true,
+	"image/svg+xml": true,
+	"image/webp":    true,
+}
+
+// epubMetadata is the book information written to the package document
+type epubMetadata struct {
+	identifier  string
+	title       string
+	language    string
+	authors     []string
+	date        string
+	description string
+	publisher   string
+	rights      string
+	subjects    []string
+	modified    string
+	cover       string // manifest ID of the cover image
+}
+
+// epubItem is a file listed in the package manifest
+type epubItem struct {
+	id         string
+	href       string // relative to the package document
+	mediaType  string
+	properties string
+	data       []byte
+}
+
+// epubSpineItem is a content document in reading order
+type epubSpineItem struct {
+	id     string
+	linear bool
+}
+
+// writePackageDocument writes content.opf, describing the book's metadata,
+// its files and their reading order
+func writePackageDocument(w io.Writer, meta epubMetadata, items []*epubItem, spine []epubSpineItem) {
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+`, xmlText(meta.language), xmlText(meta.identifier), xmlText(meta.title), xmlText(meta.language))
+
+	for i, author := range meta.authors {
+		fmt.Fprintf(w, "    <dc:creator id=\"creator-%d\">%s</dc:creator>\n", i+1, xmlText(author))
+		fmt.Fprintf(w, "    <meta refines=\"#creator-%d\" property=\"role\" scheme=\"marc:relators\">aut</meta>\n", i+1)
+	}
+	for _, element := range []struct{ name, value string }{
+		{"date", meta.date},
+		{"description", meta.description},
+		{"publisher", meta.publisher},
+		{"rights", meta.rights},
+	} {
+		if element.value != "" {
+			fmt.Fprintf(w, "    <dc:%s>%s</dc:%s>\n", element.name, xmlText(element.value), element.name)
+		}
+	}
+	for _, subject := range meta.subjects {
+		fmt.Fprintf(w, "    <dc:subject>%s</dc:subject>\n", xmlText(subject))
+	}
+	fmt.Fprintf(w, "    <meta property=\"dcterms:modified\">%s</meta>\n", meta.modified)
+	if meta.cover != "" {
+		// Older reading systems find the cover through this EPUB 2 element
+		fmt.Fprintf(w, "    <meta name=\"cover\" content=\"%s\"/>\n", meta.cover)
+	}
+	io.WriteString(w, "  </metadata>\n  <manifest>\n")
+
+	for _, item := range items {
+		fmt.Fprintf(w, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"", item.id, xmlText(item.href), item.mediaType)
+		if item.properties != "" {
+			fmt.Fprintf(w, " properties=\"%s\"", item.properties)
+		}
+		io.WriteString(w, "/>\n")
+	}
+	io.WriteString(w, "  </manifest>\n  <spine>\n")
+
+	for _, ref := range spine {
+		if ref.linear {
+			fmt.Fprintf(w, "    <itemref idref=\"%s\"/>\n", ref.id)
+		} else {
+			fmt.Fprintf(w, "    <itemref idref=\"%s\" linear=\"no\"/>\n", ref.id)
+		}
+	}
+	io.WriteString(w, "  </spine>\n</package>\n")
+}
+
+// writeXHTMLStart writes the start of a content document up to its body
+func writeXHTMLStart(w io.Writer, title string, language string, stylesheets []string) {
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">
+<head>
+  <meta charset="UTF-8"/>
+  <title>%s</title>
+`, xmlText(language), xmlText(language), xmlText(title))
+	for _, href := range stylesheets {
+		fmt.Fprintf(w, "  <link rel=\"stylesheet\" type=\"text/css\" href=\"%s\"/>\n", xmlText(href))
+	}
+	io.WriteString(w, "</head>\n")
+}
+
+// coverXHTML returns the page showing the cover image
+func coverXHTML(title string, language string, image string) string {
+	var buf strings.Builder
+	writeXHTMLStart(&buf, title, language, nil)
+	fmt.Fprintf(&buf, `<body epub:type="cover" style="margin: 0; text-align: center;">
+  <img src="%s" alt="%s" style="max-width: 100%%; max-height: 100vh;"/>
+</body>
+</html>
+`, xmlText(image), xmlText(title))
+	return buf.String()
+}
+
+// navXHTML returns the navigation document: the table of contents built from
+// the heading hierarchy and the landmarks of the book
+func navXHTML(title string, language string, stylesheets []string, headings []Heading, landmarks [][2]string) string {
+	var buf strings.Builder
+	writeXHTMLStart(&buf, title, language, stylesheets)
+	buf.WriteString("<body>\n<nav epub:type=\"toc\" id=\"toc\" class=\"markdown-body\">\n<h1>Contents</h1>\n")
+	writeNavList(&buf, buildTOC(headings))
+	buf.WriteString("</nav>\n")
+
+	if len(landmarks) > 0 {
+		buf.WriteString("<nav epub:type=\"landmarks\" id=\"landmarks\" hidden=\"hidden\">\n<ol>\n")
+		for _, landmark := range landmarks {
+			fmt.Fprintf(&buf, "<li><a epub:type=\"%s\" href=\"%s\">%s</a></li>\n",
+				landmark[0], xmlText(landmark[1]), landmarkLabels[landmark[0]])
+		}
+		buf.WriteString("</ol>\n</nav>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.String()
+}
+
+var landmarkLabels = map[string]string{
+	"cover":      "Cover",
+	"toc":        "Contents",
+	"bodymatter": "Start of Content",
+}
+
+// writeNavList writes headings as the nested ordered lists EPUB navigation requires
+func writeNavList(w io.Writer, entries []*tocEntry) {
+	io.WriteString(w, "<ol>\n")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a>", xmlText(entry.heading.ID), xmlText(entry.heading.Text))
+		if len(entry.children) > 0 {
+			io.WriteString(w, "\n")
+			writeNavList(w, entry.children)
+		}
+		io.WriteString(w, "</li>\n")
+	}
+	io.WriteString(w, "</ol>\n")
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Highlighting styles matching the light and dark app themes
+const (
+	lightHighlightStyle = "github"
+	darkHighlightStyle  = "github-dark"
+)
+
+// codeLanguage returns the language named by a fenced code block's info string
+func codeLanguage(info []byte) string {
+	fields := strings.Fields(string(info))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(strings.ToLower(fields[0]), "{}.")
+}
+
+// lexerFor returns the lexer for a language, or a plain text lexer
+func lexerFor(language string) chroma.Lexer {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return chroma.Coalesce(lexer)
+}
+
+// highlightStyle returns the highlighting style for a light or dark document
+func highlightStyle(dark bool) *chroma.Style {
+	if dark {
+		return styles.Get(darkHighlightStyle)
+	}
+	return styles.Get(lightHighlightStyle)
+}
+
+// highlightHTML writes code as a <pre> block with class-based highlighting
+func highlightHTML(w io.Writer, code string, language string) error {
+	iterator, err := lexerFor(language).Tokenise(nil, code)
+	if err != nil {
+		return err
+	}
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	return formatter.Format(w, highlightStyle(false), iterator)
+}
+
+// highlightCSS returns the stylesheet for the classes written by highlightHTML
+func highlightCSS(dark bool) string {
+	var buf bytes.Buffer
+	chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, highlightStyle(dark))
+	return buf.String()
+}
+
+// codeTokens splits code into highlighted tokens
+func codeTokens(code string, language string) []chroma.Token {
+	iterator, err := lexerFor(language).Tokenise(nil, code)
+	if err != nil {
+		return []chroma.Token{{Type: chroma.Text, Value: code}}
+	}
+	return iterator.Tokens()
+}
+
+// tokenColor returns the foreground color of a token in the light style, and
+// whether the style sets one
+func tokenColor(tokenType chroma.TokenType) (chroma.Colour, bool) {
+	entry := highlightStyle(false).Get(tokenType)
+	return entry.Colour, entry.Colour.IsSet()
+}
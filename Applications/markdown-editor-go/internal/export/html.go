@@ -0,0 +1,248 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// HTMLOptions controls how a document is exported to HTML
+type HTMLOptions struct {
+	// Title of the page; defaults to the front matter title or the first heading
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	// and as the fallback title; empty for unsaved documents
+	SourcePath string `json:"sourcePath"`
+
+	// Images is one of ImagesInline, ImagesCopy or ImagesLink
+	Images string `json:"images"`
+
+	// TOC adds a table of contents sidebar
+	TOC bool `json:"toc"`
+
+	Colors theme.ThemeColors `json:"colors"`
+	Dark   bool              `json:"dark"`
+}
+
+// Heading is an entry of a document outline
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// HTMLExporter renders markdown documents as standalone HTML pages
+type HTMLExporter struct {
+	parser   *utils.MarkdownParser
+	options  HTMLOptions
+	warnings []string
+}
+
+// NewHTMLExporter creates an HTML exporter
+func NewHTMLExporter(parser *utils.MarkdownParser, options HTMLOptions) *HTMLExporter {
+	if options.Images == "" {
+		options.Images = ImagesInline
+	}
+	return &HTMLExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Render returns the document as a complete HTML page. Images are inlined
+// unless linking was requested, since there is no folder to copy them to.
+func (e *HTMLExporter) Render(md string) string {
+	return e.render(md, nil)
+}
+
+// Export writes the document as an HTML page to outputPath, copying images
+// into a folder next to it when requested
+func (e *HTMLExporter) Export(md string, outputPath string) error {
+	var assets *assetFolder
+	if e.options.Images == ImagesCopy {
+		assets = newAssetFolder(outputPath)
+	}
+
+	page := e.render(md, assets)
+	return (&utils.FileUtils{}).SaveToFile(outputPath, page)
+}
+
+// Warnings returns the problems found during the last export, such as missing images
+func (e *HTMLExporter) Warnings() []string {
+	return e.warnings
+}
+
+func (e *HTMLExporter) render(md string, assets *assetFolder) string {
+	e.warnings = nil
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(body)
+	headings := DocumentHeadings(doc)
+	e.rewriteImages(doc, assets)
+
+	title := e.options.Title
+	if title == "" {
+		title = DocumentTitle(matter, headings, e.options.SourcePath)
+	}
+
+	head := "  <meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n"
+	if author := matter.String("author"); author != "" {
+		head += "  <meta name=\"author\" content=\"" + template.HTMLEscapeString(author) + "\">\n"
+	}
+	head += "  <style>\n" + ThemeCSS(e.options.Colors, e.options.TOC) + highlightCSS(e.options.Dark) + "  </style>\n"
+
+	return e.parser.RenderHTML(doc, html.RendererOptions{
+		Title: title,
+		Head:  []byte(head),
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			switch node := node.(type) {
+			case *ast.Document:
+				if entering {
+					if e.options.TOC && len(headings) > 0 {
+						writeTOC(w, headings)
+					}
+					io.WriteString(w, "<main class=\"markdown-body\">\n")
+				} else {
+					io.WriteString(w, "</main>\n")
+				}
+				return ast.GoToNext, true
+			case *ast.CodeBlock:
+				if err := highlightHTML(w, string(node.Literal), codeLanguage(node.Info)); err != nil {
+					return ast.GoToNext, false
+				}
+				return ast.GoToNext, true
+			}
+			return ast.GoToNext, false
+		},
+	})
+}
+
+// rewriteImages points local images at data URIs or copied files
+func (e *HTMLExporter) rewriteImages(doc ast.Node, assets *assetFolder) {
+	if e.options.Images == ImagesLink {
+		return
+	}
+
+	for _, node := range documentImages(doc) {
+		dest := string(node.Destination)
+		if !isLocalReference(dest) {
+			continue
+		}
+
+		image, err := LoadImage(dest, sourceDir(e.options.SourcePath))
+		if err != nil {
+			e.warnings = append(e.warnings, "image "+dest+" could not be read: "+err.Error())
+			continue
+		}
+
+		if assets == nil {
+			node.Destination = []byte(image.DataURI())
+			continue
+		}
+		link, err := assets.add(image)
+		if err != nil {
+			e.warnings = append(e.warnings, "image "+dest+" could not be copied: "+err.Error())
+			continue
+		}
+		node.Destination = []byte(link)
+	}
+}
+
+// DocumentHeadings returns the headings of a parsed document, giving each the
+// unique ID the HTML renderer writes for it
+func DocumentHeadings(doc ast.Node) []Heading {
+	ids := html.NewRenderer(html.RendererOptions{})
+
+	var headings []Heading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering && !heading.IsTitleblock {
+			headings = append(headings, Heading{
+				Level: heading.Level,
+				Text:  strings.TrimSpace(utils.NodeText(heading)),
+				ID:    ids.MakeUniqueHeadingID(heading),
+			})
+		}
+		return ast.GoToNext
+	})
+	return headings
+}
+
+// DocumentTitle returns the title from the front matter, else the first
+// heading, else the name of the source file
+func DocumentTitle(matter utils.FrontMatter, headings []Heading, sourcePath string) string {
+	if title := matter.String("title"); title != "" {
+		return title
+	}
+	for _, heading := range headings {
+		if heading.Level == 1 {
+			return heading.Text
+		}
+	}
+	if len(headings) > 0 {
+		return headings[0].Text
+	}
+	if sourcePath != "" {
+		return strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))
+	}
+	return "Untitled"
+}
+
+// sourceDir returns the directory of a source file, or "" for unsaved documents
+func sourceDir(sourcePath string) string {
+	if sourcePath == "" {
+		return ""
+	}
+	return filepath.Dir(sourcePath)
+}
+
+// tocEntry is a heading with the headings nested below it
+type tocEntry struct {
+	heading  Heading
+	children []*tocEntry
+}
+
+// buildTOC nests each heading under the closest preceding heading of a higher level
+func buildTOC(headings []Heading) []*tocEntry {
+	var roots []*tocEntry
+	var stack []*tocEntry
+	for _, heading := range headings {
+		entry := &tocEntry{heading: heading}
+		for len(stack) > 0 && stack[len(stack)-1].heading.Level >= heading.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, entry)
+		}
+		stack = append(stack, entry)
+	}
+	return roots
+}
+
+// writeTOC writes the headings as nested lists inside a navigation sidebar
+func writeTOC(w io.Writer, headings []Heading) {
+	io.WriteString(w, "<nav class=\"toc\">\n")
+	writeTOCList(w, buildTOC(headings))
+	io.WriteString(w, "</nav>\n")
+}
+
+func writeTOCList(w io.Writer, entries []*tocEntry) {
+	io.WriteString(w, "<ul>\n")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "<li><a href=\"#%s\">%s</a>", template.HTMLEscapeString(entry.heading.ID), template.HTMLEscapeString(entry.heading.Text))
+		if len(entry.children) > 0 {
+			io.WriteString(w, "\n")
+			writeTOCList(w, entry.children)
+		}
+		io.WriteString(w, "</li>\n")
+	}
+	io.WriteString(w, "</ul>\n")
+}
@@ -0,0 +1,381 @@
+package export
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// jiraWriter writes Jira wiki markup
+type jiraWriter struct {
+	markupBase
+	notes      []*ast.Link
+	listPrefix string
+}
+
+func (w *jiraWriter) document(doc ast.Node) {
+	w.blocks(doc)
+	if len(w.notes) == 0 {
+		return
+	}
+
+	w.write("----\n")
+	for _, link := range w.notes {
+		w.write("# ")
+		w.footnoteText(link.Footnote)
+		w.write("\n")
+	}
+}
+
+func (w *jiraWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *jiraWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		w.write("h" + strconv.Itoa(min(max(node.Level, 1), 6)) + ". ")
+		if node.HeadingID != "" {
+			w.write("{anchor:" + node.HeadingID + "}")
+		}
+		w.inlines(node)
+		w.write("\n\n")
+	case *ast.Paragraph:
+		w.inlines(node)
+		w.write("\n\n")
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		if kind := blockquoteAlert(node); kind != "" {
+			w.write("{panel:title=" + alertTitles[kind] + "}\n")
+			w.blocks(node)
+			w.endLine()
+			w.write("{panel}\n\n")
+			return
+		}
+		w.write("{quote}\n")
+		w.blocks(node)
+		w.endLine()
+		w.write("{quote}\n\n")
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info))
+	case *ast.MathBlock:
+		w.warn("math is written as code")
+		w.codeBlock(strings.TrimSpace(string(node.Literal)), "")
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write("----\n\n")
+	case *ast.HTMLBlock:
+		w.warnHTML(node.Literal)
+	case *ast.Footnotes:
+		// Footnotes are listed at the end
+	default:
+		w.blocks(node)
+	}
+}
+
+// list writes a list with one line per item, each starting with the markers
+// of the lists it is nested in
+func (w *jiraWriter) list(list *ast.List) {
+	if list.IsFootnotesList {
+		return
+	}
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		w.definitionList(list)
+		return
+	}
+
+	marker := "*"
+	if list.ListFlags&ast.ListTypeOrdered != 0 {
+		marker = "#"
+	}
+	parent := w.listPrefix
+	w.listPrefix += marker
+	for _, item := range list.Children {
+		w.write(w.listPrefix + " ")
+		w.itemContent(item)
+	}
+	w.listPrefix = parent
+	if parent == "" {
+		w.write("\n")
+	}
+}
+
+// itemContent writes a list item on one line, its paragraphs separated by
+// line breaks. Blocks other than lists end the list.
+func (w *jiraWriter) itemContent(item ast.Node) {
+	if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+		w.inlines(item)
+		w.write("\n")
+		return
+	}
+	for i, child := range item.GetChildren() {
+		switch child := child.(type) {
+		case *ast.Paragraph:
+			if i > 0 {
+				w.write(" \\\\ ")
+			}
+			w.inlines(child)
+		case *ast.List:
+			w.endLine()
+			w.list(child)
+		default:
+			w.endLine()
+			w.block(child)
+		}
+	}
+	w.endLine()
+}
+
+// definitionList writes terms in bold on a line of their own, followed by
+// their definitions, as Jira has no definition lists
+func (w *jiraWriter) definitionList(list *ast.List) {
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			w.write("*")
+			w.inlines(item)
+			w.write("*\n")
+			continue
+		}
+		w.itemContent(item)
+		w.write("\n")
+	}
+}
+
+// Languages of Jira code blocks, by markdown fence name
+var jiraLanguages = map[string]string{
+	"actionscript": "actionscript", "ada": "ada", "applescript": "applescript",
+	"bash": "bash", "sh": "bash", "shell": "bash", "zsh": "bash",
+	"c": "c", "cpp": "cpp", "c++": "cpp", "cs": "c#", "csharp": "c#", "css": "css",
+	"erlang": "erlang", "go": "go", "groovy": "groovy", "haskell": "haskell",
+	"html": "html", "java": "java", "javascript": "javascript", "js": "javascript",
+	"json": "json", "lua": "lua", "objc": "objc", "objectivec": "objc",
+	"perl": "perl", "php": "php", "python": "python", "py": "python", "r": "r",
+	"ruby": "ruby", "rb": "ruby", "scala": "scala", "sql": "sql", "swift": "swift",
+	"vb": "visualbasic", "xml": "xml", "yaml": "yaml", "yml": "yaml",
+}
+
+// codeBlock writes a code block in a language Jira highlights, or as
+// preformatted text
+func (w *jiraWriter) codeBlock(code string, language string) {
+	code = strings.TrimRight(code, "\n")
+	if name, ok := jiraLanguages[language]; ok {
+		w.write("{code:" + name + "}\n" + code + "\n{code}\n\n")
+		return
+	}
+	w.write("{noformat}\n" + code + "\n{noformat}\n\n")
+}
+
+// table writes a table with a row per line, header cells between || and
+// other cells between |
+func (w *jiraWriter) table(table *ast.Table) {
+	layout := layoutTable(table)
+	if layout.columns == 0 {
+		return
+	}
+
+	for _, row := range layout.rows() {
+		separator := "|"
+		for i := 0; i < layout.columns; i++ {
+			cell := layout.cell(row, i)
+			separator = "|"
+			if cell != nil && cell.IsHeader {
+				separator = "||"
+			}
+			w.write(separator)
+			content := ""
+			if cell != nil {
+				content = w.capture(func() { w.cellContent(cell) })
+			}
+			if strings.TrimSpace(content) == "" {
+				// Jira drops empty cells
+				content = " "
+			}
+			w.write(content)
+		}
+		w.write(separator + "\n")
+	}
+
+	if layout.caption != nil {
+		w.write("\n_")
+		w.inlines(layout.caption)
+		w.write("_\n")
+	}
+	w.write("\n")
+}
+
+func (w *jiraWriter) cellContent(cell *ast.TableCell) {
+	for i, child := range cell.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok {
+			if i > 0 {
+				w.write(" \\\\ ")
+			}
+			w.inlines(paragraph)
+			continue
+		}
+		w.inline(child)
+	}
+}
+
+// Inline content
+
+func (w *jiraWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *jiraWriter) inline(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(plainText(node.Literal))
+	case *ast.Code:
+		w.write("{{")
+		w.text(string(node.Literal))
+		w.write("}}")
+	case *ast.Math:
+		w.warn("math is written as code")
+		w.write("{{")
+		w.text(string(node.Literal))
+		w.write("}}")
+	case *ast.Emph:
+		w.wrap("_", node)
+	case *ast.Strong:
+		w.wrap("*", node)
+	case *ast.Del:
+		w.wrap("-", node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			number, _ := noteNumber(&w.notes, node)
+			w.write("^" + strconv.Itoa(number) + "^")
+			return
+		}
+		w.link(node)
+	case *ast.Image:
+		w.image(node)
+	case *ast.Hardbreak:
+		w.write(" \\\\ ")
+	case *ast.HTMLSpan:
+		w.warnHTML(node.Literal)
+	default:
+		w.inlines(node)
+	}
+}
+
+func (w *jiraWriter) wrap(delimiter string, node ast.Node) {
+	w.write(delimiter)
+	w.inlines(node)
+	w.write(delimiter)
+}
+
+func (w *jiraWriter) link(link *ast.Link) {
+	dest := jiraURL(string(link.Destination))
+	if dest == "" {
+		w.inlines(link)
+		return
+	}
+	text := w.capture(func() { w.inlines(link) })
+	if text == "" || utils.NodeText(link) == string(link.Destination) {
+		w.write("[" + dest + "]")
+		return
+	}
+	w.write("[" + text + "|" + dest + "]")
+}
+
+// image writes an image. Local images refer to attachments of the issue,
+// which have to be uploaded with it.
+func (w *jiraWriter) image(image *ast.Image) {
+	dest := string(image.Destination)
+	if isLocalReference(dest) {
+		name := path.Base(strings.ReplaceAll(dest, "\\", "/"))
+		w.warn("local image " + dest + " must be attached to the issue as " + name)
+		dest = name
+	}
+	w.write("!" + jiraURL(dest))
+	alt := strings.Map(func(r rune) rune {
+		if strings.ContainsRune("!|,=", r) {
+			return -1
+		}
+		return r
+	}, utils.NodeText(image))
+	if alt = strings.TrimSpace(alt); alt != "" {
+		w.write("|alt=" + alt)
+	}
+	w.write("!")
+}
+
+// footnoteText writes a footnote on one line
+func (w *jiraWriter) footnoteText(note ast.Node) {
+	blocks := footnoteBlocks(note)
+	if blocks == nil {
+		if note != nil {
+			w.inlines(note)
+		}
+		return
+	}
+	for i, block := range blocks {
+		if i > 0 {
+			w.write(" \\\\ ")
+		}
+		w.inlines(block)
+	}
+}
+
+// jiraURL escapes the characters that end a link in Jira markup
+func jiraURL(url string) string {
+	return strings.NewReplacer("|", "%7C", "]", "%5D", "!", "%21", " ", "%20").Replace(url)
+}
+
+// text writes plain text, escaping what Jira would take for markup
+func (w *jiraWriter) text(text string) {
+	runes := []rune(text)
+	var buf strings.Builder
+	lineStart := w.atLineStart()
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case strings.ContainsRune("{}[]|", r):
+			buf.WriteString("\\" + string(r))
+		case r == '\\':
+			buf.WriteString("&#92;")
+		case i == 0 && lineStart && strings.ContainsRune("#*-", r):
+			buf.WriteString("\\" + string(r))
+		case r == '!':
+			// ! followed by text could start an image
+			if i+1 < len(runes) && runes[i+1] != ' ' {
+				buf.WriteString("\\")
+			}
+			buf.WriteRune(r)
+		case r == '?' && i+1 < len(runes) && runes[i+1] == '?':
+			buf.WriteString("\\??")
+			i++
+		case strings.ContainsRune("*_+-^~", r):
+			end := i + 1
+			for end < len(runes) && runes[end] == r {
+				end++
+			}
+			escape := isDelimiterRun(runes, i, end)
+			for ; i < end; i++ {
+				if escape {
+					buf.WriteString("\\")
+				}
+				buf.WriteRune(r)
+			}
+			i--
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	w.write(buf.String())
+}
@@ -0,0 +1,730 @@
+package export
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// LaTeXOptions controls how a document is exported to LaTeX
+type LaTeXOptions struct {
+	// Title of the document; defaults to the front matter title
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	SourcePath string `json:"sourcePath"`
+
+	// Template is an optional template file replacing the built-in one. See
+	// FillTemplate for its syntax.
+	Template string `json:"template"`
+}
+
+// LaTeXExporter renders markdown documents as LaTeX sources
+type LaTeXExporter struct {
+	parser   *utils.MarkdownParser
+	options  LaTeXOptions
+	warnings []string
+}
+
+// NewLaTeXExporter creates a LaTeX exporter
+func NewLaTeXExporter(parser *utils.MarkdownParser, options LaTeXOptions) *LaTeXExporter {
+	return &LaTeXExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the problems found during the last export, such as missing images
+func (e *LaTeXExporter) Warnings() []string {
+	return e.warnings
+}
+
+// Render returns the document as a LaTeX source, with image paths relative to
+// the markdown file
+func (e *LaTeXExporter) Render(md string) (string, error) {
+	return e.render(md, sourceDir(e.options.SourcePath))
+}
+
+// Export writes the document as a LaTeX source to outputPath, with image paths
+// relative to it
+func (e *LaTeXExporter) Export(md string, outputPath string) error {
+	source, err := e.render(md, filepath.Dir(outputPath))
+	if err != nil {
+		return err
+	}
+	return (&utils.FileUtils{}).SaveToFile(outputPath, source)
+}
+
+func (e *LaTeXExporter) render(md string, outputDir string) (string, error) {
+	e.warnings = nil
+
+	template := defaultLaTeXTemplate
+	if e.options.Template != "" {
+		data, err := ioutil.ReadFile(e.options.Template)
+		if err != nil {
+			return "", errors.New("cannot read LaTeX template: " + err.Error())
+		}
+		template = string(data)
+	}
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(body)
+	headings := DocumentHeadings(doc)
+
+	w := &latexWriter{
+		exporter:  e,
+		baseDir:   sourceDir(e.options.SourcePath),
+		outputDir: outputDir,
+		labels:    map[string]bool{},
+		notes:     map[int]bool{},
+		chapters:  isChapterClass(matter.String("documentclass")),
+	}
+	for _, heading := range headings {
+		w.labels[heading.ID] = true
+	}
+	w.blocks(doc)
+
+	// Front matter values are markdown too
+	variables := map[string]interface{}{}
+	for key, value := range matter {
+		switch value := value.(type) {
+		case string:
+			variables[key] = w.metadata(key, value)
+		case []string:
+			var items []string
+			for _, item := range value {
+				items = append(items, w.metadata(key, item))
+			}
+			variables[key] = items
+		}
+	}
+	if e.options.Title != "" {
+		variables["title"] = w.metadata("title", e.options.Title)
+	}
+
+	// BibTeX adds the extension itself
+	var bibliography []string
+	for _, path := range matter.Strings("bibliography") {
+		bibliography = append(bibliography, strings.TrimSuffix(filepath.ToSlash(path), ".bib"))
+	}
+	if bibliography != nil {
+		variables["bibliography"] = bibliography
+	}
+	variables["body"] = strings.TrimSpace(w.buf.String())
+
+	return FillTemplate(template, variables)
+}
+
+// isChapterClass reports whether a document class has chapters above sections
+func isChapterClass(class string) bool {
+	switch class {
+	case "book", "report", "memoir", "scrbook", "scrreprt":
+		return true
+	}
+	return false
+}
+
+// Front matter keys whose values are passed to LaTeX unchanged
+var rawMetadata = map[string]bool{
+	"documentclass": true, "classoption": true, "fontsize": true, "geometry": true,
+	"bibliography": true, "biblio-style": true, "lang": true, "papersize": true,
+	"header-includes": true, "linestretch": true, "toc": true, "numbersections": true,
+}
+
+// metadata converts a front matter value, written in markdown, to LaTeX
+func (w *latexWriter) metadata(key string, value string) string {
+	if rawMetadata[key] {
+		return value
+	}
+	// A writer of its own keeps the value out of the body
+	mw := &latexWriter{
+		exporter:  w.exporter,
+		baseDir:   w.baseDir,
+		outputDir: w.outputDir,
+		labels:    w.labels,
+		notes:     w.notes,
+	}
+	doc := w.exporter.parser.Parse(value)
+	for i, block := range doc.GetChildren() {
+		if i > 0 {
+			mw.write("\n\n")
+		}
+		mw.inlines(block)
+	}
+	return mw.buf.String()
+}
+
+// latexWriter writes a document's AST as LaTeX
+type latexWriter struct {
+	exporter  *LaTeXExporter
+	buf       strings.Builder
+	baseDir   string
+	outputDir string
+
+	// labels holds the heading IDs internal links can point at
+	labels map[string]bool
+
+	// notes holds the footnotes already written
+	notes map[int]bool
+
+	chapters bool // level 1 headings are chapters
+	depth    int  // number of enclosing enumerate environments
+	inTable  bool
+}
+
+// warn records a problem once, however often it is met: an image that
+// cannot be a figure is tried again as an inline image
+func (w *latexWriter) warn(message string) {
+	for _, warning := range w.exporter.warnings {
+		if warning == message {
+			return
+		}
+	}
+	w.exporter.warnings = append(w.exporter.warnings, message)
+}
+
+func (w *latexWriter) write(s string) {
+	w.buf.WriteString(s)
+}
+
+// Blocks
+
+// blocks writes the children of a container, separated by blank lines
+func (w *latexWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *latexWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		w.heading(node)
+	case *ast.Paragraph:
+		w.paragraph(node)
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		w.write("\\begin{quote}\n")
+		w.blocks(node)
+		w.write("\\end{quote}\n\n")
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info))
+	case *ast.MathBlock:
+		w.write("\\[\n" + strings.TrimSpace(string(node.Literal)) + "\n\\]\n\n")
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write("\\begin{center}\\rule{0.5\\linewidth}{0.5pt}\\end{center}\n\n")
+	case *ast.HTMLBlock:
+		if !strings.HasPrefix(strings.TrimSpace(string(node.Literal)), "<!--") {
+			w.warn("raw HTML blocks are left out of the LaTeX document")
+		}
+	case *ast.Footnotes:
+		// Footnotes are written where they are referenced
+	default:
+		w.blocks(node)
+	}
+}
+
+// Sectioning commands by heading level
+var (
+	sectionCommands = []string{"section", "subsection", "subsubsection", "paragraph", "subparagraph", "subparagraph"}
+	chapterCommands = []string{"chapter", "section", "subsection", "subsubsection", "paragraph", "subparagraph"}
+)
+
+// heading writes a sectioning command labelled with the heading's ID
+func (w *latexWriter) heading(heading *ast.Heading) {
+	commands := sectionCommands
+	if w.chapters {
+		commands = chapterCommands
+	}
+	level := heading.Level
+	if level < 1 {
+		level = 1
+	}
+	if level > len(commands) {
+		level = len(commands)
+	}
+
+	w.write("\\" + commands[level-1] + "{")
+	w.inlines(heading)
+	w.write("}")
+	if heading.HeadingID != "" {
+		w.write("\\label{" + heading.HeadingID + "}")
+	}
+	w.write("\n\n")
+}
+
+// paragraph writes a paragraph, or a figure when it holds a single image
+func (w *latexWriter) paragraph(node *ast.Paragraph) {
+	if image := soleImage(node); image != nil && !w.inTable {
+		if w.figure(image) {
+			return
+		}
+	}
+	w.inlines(node)
+	w.write("\n\n")
+}
+
+// soleImage returns the image a paragraph consists of, if any
+func soleImage(node ast.Node) *ast.Image {
+	var image *ast.Image
+	for _, child := range node.GetChildren() {
+		switch child := child.(type) {
+		case *ast.Image:
+			if image != nil {
+				return nil
+			}
+			image = child
+		case *ast.Text:
+			if strings.TrimSpace(string(child.Literal)) != "" {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return image
+}
+
+// list writes an itemize, enumerate or description environment
+func (w *latexWriter) list(list *ast.List) {
+	if list.IsFootnotesList {
+		return
+	}
+
+	environment := "itemize"
+	switch {
+	case list.ListFlags&ast.ListTypeDefinition != 0:
+		environment = "description"
+	case list.ListFlags&ast.ListTypeOrdered != 0:
+		environment = "enumerate"
+	}
+
+	w.write("\\begin{" + environment + "}\n")
+	if environment == "enumerate" {
+		w.depth++
+		defer func() { w.depth-- }()
+		if list.Start > 1 && w.depth <= 4 {
+			counter := "enum" + strings.Repeat("i", w.depth)
+			if w.depth == 4 {
+				counter = "enumiv"
+			}
+			w.write("\\setcounter{" + counter + "}{" + strconv.Itoa(list.Start-1) + "}\n")
+		}
+	}
+	if list.Tight {
+		w.write("\\tightlist\n")
+	}
+
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		switch {
+		case item.ListFlags&ast.ListTypeTerm != 0:
+			w.write("\\item[")
+			w.inlines(item)
+			w.write("] ")
+		case environment == "description":
+			w.itemContent(item, list.Tight)
+		default:
+			w.write("\\item ")
+			w.itemContent(item, list.Tight)
+		}
+	}
+	w.write("\\end{" + environment + "}\n\n")
+}
+
+// itemContent writes the blocks of a list item, without blank lines between
+// the paragraphs of tight lists
+func (w *latexWriter) itemContent(item *ast.ListItem, tight bool) {
+	if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+		w.inlines(item)
+		w.write("\n")
+		return
+	}
+	for _, child := range item.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok && tight {
+			w.inlines(paragraph)
+			w.write("\n")
+			continue
+		}
+		w.block(child)
+	}
+}
+
+// Languages the listings package knows, by markdown fence name
+var listingsLanguages = map[string]string{
+	"ada": "Ada", "awk": "Awk", "bash": "bash", "sh": "sh", "shell": "bash", "zsh": "bash",
+	"c": "C", "cpp": "C++", "c++": "C++", "cs": "[Sharp]C", "csharp": "[Sharp]C",
+	"cobol": "Cobol", "erlang": "erlang", "fortran": "Fortran", "haskell": "Haskell",
+	"html": "HTML", "java": "Java", "lisp": "Lisp", "lua": "Lua", "make": "make", "makefile": "make",
+	"matlab": "Matlab", "ocaml": "ML", "pascal": "Pascal", "perl": "Perl", "php": "PHP",
+	"prolog": "Prolog", "python": "Python", "py": "Python", "r": "R", "ruby": "Ruby", "rb": "Ruby",
+	"scala": "Scala", "sql": "SQL", "tcl": "tcl", "tex": "TeX", "latex": "[LaTeX]TeX",
+	"vhdl": "VHDL", "verilog": "Verilog", "xml": "XML",
+}
+
+// codeBlock writes a code listing, naming its language when listings knows it
+func (w *latexWriter) codeBlock(code string, language string) {
+	code = strings.TrimRight(code, "\n")
+	if strings.Contains(code, "\\end{lstlisting}") {
+		// The listing could not be closed; fall back to escaped text
+		w.write("\\begin{flushleft}\\ttfamily\n" + strings.ReplaceAll(escapeLaTeX(code), "\n", "\\\\\n") + "\n\\end{flushleft}\n\n")
+		return
+	}
+
+	w.write("\\begin{lstlisting}")
+	if name, ok := listingsLanguages[strings.ToLower(language)]; ok {
+		w.write("[language=" + name + "]")
+	}
+	w.write("\n" + code + "\n\\end{lstlisting}\n\n")
+}
+
+// table writes a table as a tabular in a floating table, or as a longtable
+// that breaks across pages with its header repeated when it is long
+func (w *latexWriter) table(table *ast.Table) {
+	layout := layoutTable(table)
+	header, body, caption, columns := layout.header, layout.body, layout.caption, layout.columns
+	if columns == 0 {
+		return
+	}
+
+	var spec strings.Builder
+	for _, align := range layout.aligns {
+		switch align {
+		case ast.TableAlignmentCenter:
+			spec.WriteString("c")
+		case ast.TableAlignmentRight:
+			spec.WriteString("r")
+		default:
+			spec.WriteString("l")
+		}
+	}
+
+	w.inTable = true
+	defer func() { w.inTable = false }()
+
+	long := len(body) > longTableRows
+	if long {
+		w.write("\\begin{longtable}{" + spec.String() + "}\n")
+		if caption != nil {
+			w.write("\\caption{")
+			w.inlines(caption)
+			w.write("}\\\\\n")
+		}
+		w.write("\\toprule\n")
+		w.rows(header, columns)
+		w.write("\\midrule\n\\endhead\n")
+		w.rows(body, columns)
+		w.write("\\bottomrule\n\\end{longtable}\n\n")
+		return
+	}
+
+	w.write("\\begin{table}[htbp]\n\\centering\n")
+	if caption != nil {
+		w.write("\\caption{")
+		w.inlines(caption)
+		w.write("}\n")
+	}
+	w.write("\\begin{tabular}{" + spec.String() + "}\n\\toprule\n")
+	w.rows(header, columns)
+	if len(header) > 0 {
+		w.write("\\midrule\n")
+	}
+	w.rows(body, columns)
+	w.write("\\bottomrule\n\\end{tabular}\n\\end{table}\n\n")
+}
+
+// longTableRows is the number of body rows above which tables become longtables
+const longTableRows = 20
+
+func (w *latexWriter) rows(rows []*ast.TableRow, columns int) {
+	for _, row := range rows {
+		for i := 0; i < columns; i++ {
+			if i > 0 {
+				w.write(" & ")
+			}
+			if i >= len(row.Children) {
+				continue
+			}
+			cell, ok := row.Children[i].(*ast.TableCell)
+			if !ok {
+				continue
+			}
+			if cell.IsHeader {
+				w.write("\\textbf{")
+				w.cellContent(cell)
+				w.write("}")
+			} else {
+				w.cellContent(cell)
+			}
+		}
+		w.write(" \\\\\n")
+	}
+}
+
+// cellContent writes a cell's inline content, which must stay on one line
+func (w *latexWriter) cellContent(cell *ast.TableCell) {
+	for _, child := range cell.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok {
+			w.inlines(paragraph)
+			continue
+		}
+		w.inline(child)
+	}
+}
+
+// figure writes a lone image as a figure captioned with its description. It
+// returns false when the image cannot be included.
+func (w *latexWriter) figure(image *ast.Image) bool {
+	path, ok := w.imagePath(image)
+	if !ok {
+		return false
+	}
+	w.write("\\begin{figure}[htbp]\n\\centering\n\\includegraphics{" + path + "}\n")
+	if caption := strings.TrimSpace(utils.NodeText(image)); caption != "" {
+		w.write("\\caption{")
+		w.inlines(image)
+		w.write("}\n")
+	}
+	w.write("\\end{figure}\n\n")
+	return true
+}
+
+// Image formats pdflatex can include
+var latexImageTypes = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".pdf": true, ".eps": true}
+
+// imagePath returns the path \includegraphics should load for an image,
+// warning about images LaTeX cannot include
+func (w *latexWriter) imagePath(image *ast.Image) (string, bool) {
+	dest := string(image.Destination)
+	if !isLocalReference(dest) {
+		w.warn("remote image " + dest + " is not included")
+		return "", false
+	}
+	path := resolveLocalPath(dest, w.baseDir)
+	if !filepath.IsAbs(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	if _, err := ioutil.ReadFile(path); err != nil {
+		w.warn("image " + dest + " could not be read: " + err.Error())
+		return "", false
+	}
+	if !latexImageTypes[strings.ToLower(filepath.Ext(path))] {
+		w.warn("image " + dest + " is not a PNG, JPEG, PDF or EPS file")
+		return "", false
+	}
+
+	if w.outputDir != "" {
+		if rel, err := filepath.Rel(w.outputDir, path); err == nil {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(path), true
+}
+
+// Inline content
+
+func (w *latexWriter) inlines(node ast.Node) {
+	children := node.GetChildren()
+	for i := 0; i < len(children); i++ {
+		// Citations can span text nodes, so adjacent text is written together
+		if text, ok := children[i].(*ast.Text); ok {
+			literal := string(text.Literal)
+			for i+1 < len(children) {
+				next, ok := children[i+1].(*ast.Text)
+				if !ok {
+					break
+				}
+				literal += string(next.Literal)
+				i++
+			}
+			w.text(literal)
+			continue
+		}
+		w.inline(children[i])
+	}
+}
+
+func (w *latexWriter) inline(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(string(node.Literal))
+	case *ast.Code:
+		w.write("\\texttt{" + escapeLaTeX(string(node.Literal)) + "}")
+	case *ast.Math:
+		w.write("\\(" + string(node.Literal) + "\\)")
+	case *ast.Emph:
+		w.wrap("\\emph{", node)
+	case *ast.Strong:
+		w.wrap("\\textbf{", node)
+	case *ast.Del:
+		w.wrap("\\sout{", node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.footnote(node)
+			return
+		}
+		w.link(node)
+	case *ast.Image:
+		if path, ok := w.imagePath(node); ok {
+			w.write("\\includegraphics{" + path + "}")
+		} else {
+			w.inlines(node)
+		}
+	case *ast.Hardbreak:
+		if w.inTable {
+			w.write(" ")
+		} else {
+			w.write("\\\\\n")
+		}
+	case *ast.Softbreak:
+		w.write("\n")
+	case *ast.HTMLSpan:
+		// Inline HTML has no LaTeX equivalent
+		if literal := string(node.Literal); !strings.HasPrefix(literal, "<!--") {
+			w.warn("inline HTML " + literal + " is left out of the LaTeX document")
+		}
+	default:
+		w.inlines(node)
+	}
+}
+
+func (w *latexWriter) wrap(command string, node ast.Node) {
+	w.write(command)
+	w.inlines(node)
+	w.write("}")
+}
+
+// link writes a hyperlink, a URL, or a reference to a heading of the document
+func (w *latexWriter) link(link *ast.Link) {
+	dest := string(link.Destination)
+	text := utils.NodeText(link)
+	switch {
+	case strings.HasPrefix(dest, "#") && w.labels[dest[1:]]:
+		w.write("\\hyperref[" + dest[1:] + "]{")
+		w.inlines(link)
+		w.write("}")
+	case dest == "" || strings.HasPrefix(dest, "#"):
+		w.inlines(link)
+	case text == dest || "mailto:"+text == dest:
+		w.write("\\url{" + escapeURL(dest) + "}")
+	default:
+		w.write("\\href{" + escapeURL(dest) + "}{")
+		w.inlines(link)
+		w.write("}")
+	}
+}
+
+// footnote writes a footnote at its first reference and a mark referring to
+// it at later ones
+func (w *latexWriter) footnote(link *ast.Link) {
+	if _, ok := w.notes[link.NoteID]; ok {
+		w.write("\\textsuperscript{\\ref{fn:" + strconv.Itoa(link.NoteID) + "}}")
+		return
+	}
+	w.notes[link.NoteID] = true
+
+	note := link.Footnote
+	w.write("\\footnote{")
+	if child := firstChild(note); child != nil && child.AsLeaf() == nil {
+		w.blocks(note)
+	} else if note != nil {
+		w.inlines(note)
+	}
+	w.trimTrailingSpace()
+	w.write("\\label{fn:" + strconv.Itoa(link.NoteID) + "}}")
+}
+
+// trimTrailingSpace removes the line breaks written after a footnote's last paragraph
+func (w *latexWriter) trimTrailingSpace() {
+	written := w.buf.String()
+	trimmed := strings.TrimRight(written, " \n")
+	if len(trimmed) < len(written) {
+		w.buf.Reset()
+		w.buf.WriteString(trimmed)
+	}
+}
+
+// citation matches pandoc style citations: [@key], [@key, p. 4] and [@a; @b]
+var citation = regexp.MustCompile(`\[(-?@[\w:.#$%&+?<>~/-]+[^\[\]]*)\]`)
+
+// citationItem matches one key of a citation and its locator
+var citationItem = regexp.MustCompile(`^\s*-?@([\w:.#$%&+?<>~/-]+)\s*,?\s*(.*)$`)
+
+// text writes plain text, turning citations into \cite commands
+func (w *latexWriter) text(text string) {
+	for {
+		match := citation.FindStringSubmatchIndex(text)
+		if match == nil {
+			break
+		}
+		command, ok := citeCommand(text[match[2]:match[3]])
+		if !ok {
+			w.write(escapeLaTeX(text[:match[1]]))
+			text = text[match[1]:]
+			continue
+		}
+		w.write(escapeLaTeX(text[:match[0]]))
+		w.write(command)
+		text = text[match[1]:]
+	}
+	w.write(escapeLaTeX(text))
+}
+
+// citeCommand converts the inside of a citation to \cite, keeping the locator
+// when a single source is cited
+func citeCommand(inside string) (string, bool) {
+	var keys []string
+	locator := ""
+	for _, part := range strings.Split(inside, ";") {
+		match := citationItem.FindStringSubmatch(part)
+		if match == nil {
+			return "", false
+		}
+		keys = append(keys, strings.TrimRight(match[1], ".:"))
+		locator = strings.TrimSpace(match[2])
+	}
+	if len(keys) == 1 && locator != "" {
+		return "\\cite[" + strings.ReplaceAll(escapeLaTeX(locator), ". ", ".~") + "]{" + keys[0] + "}", true
+	}
+	return "\\cite{" + strings.Join(keys, ",") + "}", true
+}
+
+// escapeLaTeX escapes the characters LaTeX treats specially in text
+func escapeLaTeX(text string) string {
+	return latexEscaper.Replace(text)
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`^`, `\textasciicircum{}`,
+	`_`, `\_`,
+	`%`, `\%`,
+	`~`, `\textasciitilde{}`,
+	`|`, `\textbar{}`,
+	`[`, `{[}`,
+	`]`, `{]}`,
+	`<`, `\textless{}`,
+	`>`, `\textgreater{}`,
+)
+
+// escapeURL escapes the characters that end or comment out a URL argument
+func escapeURL(url string) string {
+	return strings.NewReplacer(`\`, `/`, `%`, `\%`, `#`, `\#`, `{`, `%7B`, `}`, `%7D`).Replace(url)
+}
@@ -0,0 +1,367 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FillTemplate fills a LaTeX template with variables, whose values are strings
+// or lists of strings. Templates use the syntax of pandoc's:
+//
+//	$name$                          the value of a variable; lists are joined with commas
+//	$$                              a literal dollar sign
+//	$if(name)$ ... $else$ ... $endif$   text kept when a variable is set, not empty and not "false"
+//	$for(name)$ ... $sep$ ... $endfor$  text repeated for each item of a list, with
+//	                                $name$ (or $it$) standing for the item and the
+//	                                text after $sep$ written between items
+//	$-- comment                     ignored up to the end of the line
+//
+// Control tags alone on a line do not leave an empty line behind.
+func FillTemplate(template string, variables map[string]interface{}) (string, error) {
+	tokens, err := tokenizeTemplate(template)
+	if err != nil {
+		return "", err
+	}
+	p := &templateParser{tokens: tokens}
+	nodes, err := p.parse()
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.tokens) {
+		return "", p.unexpected()
+	}
+
+	var buf strings.Builder
+	fillTemplate(&buf, nodes, variables)
+	return buf.String(), nil
+}
+
+// templateToken is literal text or a tag of a template
+type templateToken struct {
+	text  string
+	tag   string // keyword or variable name; empty for text
+	arg   string // variable of $if$ and $for$
+	line  int
+	isTag bool
+}
+
+func tokenizeTemplate(template string) ([]templateToken, error) {
+	var tokens []templateToken
+	var text strings.Builder
+	line := 1
+	lineHasTag := false // a tag that kept its line break sits on the current line
+
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, templateToken{text: text.String(), line: line})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '$' {
+			if c == '\n' {
+				line++
+				lineHasTag = false
+			}
+			text.WriteByte(c)
+			continue
+		}
+
+		rest := template[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			text.WriteByte('$')
+			i++
+			continue
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				i = len(template)
+			} else {
+				i += end + 1
+				line++
+				lineHasTag = false
+			}
+			continue
+		}
+
+		end := strings.IndexByte(rest, '$')
+		if end < 0 {
+			return nil, fmt.Errorf("LaTeX template line %d: unclosed $ (write $$ for a dollar sign)", line)
+		}
+		token, ok := parseTemplateTag(rest[:end])
+		if !ok {
+			return nil, fmt.Errorf("LaTeX template line %d: invalid tag $%s$ (write $$ for a dollar sign)", line, rest[:end])
+		}
+		token.line = line
+		i += end + 1
+
+		// A control tag alone on its line takes the line break with it
+		swallowed := false
+		if isTemplateKeyword(token.tag) && !lineHasTag {
+			current := text.String()
+			start := strings.LastIndexByte(current, '\n') + 1
+			if strings.TrimSpace(current[start:]) == "" && (i+1 >= len(template) || template[i+1] == '\n') {
+				text.Reset()
+				text.WriteString(current[:start])
+				if i+1 < len(template) {
+					i++
+					line++
+				}
+				swallowed = true
+			}
+		}
+		lineHasTag = !swallowed
+
+		flush()
+		tokens = append(tokens, token)
+	}
+	flush()
+	return tokens, nil
+}
+
+// parseTemplateTag reads the inside of a $...$ tag
+func parseTemplateTag(tag string) (templateToken, bool) {
+	for _, keyword := range []string{"if", "for"} {
+		if strings.HasPrefix(tag, keyword+"(") && strings.HasSuffix(tag, ")") {
+			name := tag[len(keyword)+1 : len(tag)-1]
+			if !isTemplateName(name) {
+				return templateToken{}, false
+			}
+			return templateToken{tag: keyword, arg: name, isTag: true}, true
+		}
+	}
+	if !isTemplateName(tag) {
+		return templateToken{}, false
+	}
+	return templateToken{tag: tag, isTag: true}, true
+}
+
+func isTemplateName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func isTemplateKeyword(tag string) bool {
+	switch tag {
+	case "if", "else", "endif", "for", "sep", "endfor":
+		return true
+	}
+	return false
+}
+
+// templateNode is text, a variable, or a conditional or loop with its branches
+type templateNode struct {
+	kind string // "text", "var", "if" or "for"
+	text string // text, or the name of the variable
+	body []templateNode
+	alt  []templateNode // the $else$ branch, or the $sep$ text of a loop
+}
+
+type templateParser struct {
+	tokens []templateToken
+	pos    int
+}
+
+// parse reads nodes up to the end of the template or a closing keyword
+func (p *templateParser) parse() ([]templateNode, error) {
+	var nodes []templateNode
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		switch {
+		case !token.isTag:
+			nodes = append(nodes, templateNode{kind: "text", text: token.text})
+		case token.tag == "if" || token.tag == "for":
+			p.pos++
+			node, err := p.block(token)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+			continue
+		case isTemplateKeyword(token.tag):
+			return nodes, nil
+		default:
+			nodes = append(nodes, templateNode{kind: "var", text: token.tag})
+		}
+		p.pos++
+	}
+	return nodes, nil
+}
+
+// block reads the branches of a conditional or loop up to its closing tag
+func (p *templateParser) block(open templateToken) (templateNode, error) {
+	node := templateNode{kind: open.tag, text: open.arg}
+	middle, end := "else", "endif"
+	if open.tag == "for" {
+		middle, end = "sep", "endfor"
+	}
+
+	body, err := p.parse()
+	if err != nil {
+		return node, err
+	}
+	node.body = body
+	if p.pos < len(p.tokens) && p.tokens[p.pos].tag == middle {
+		p.pos++
+		if node.alt, err = p.parse(); err != nil {
+			return node, err
+		}
+	}
+	if p.pos >= len(p.tokens) {
+		return node, fmt.Errorf("LaTeX template line %d: $%s(%s)$ has no $%s$", open.line, open.tag, open.arg, end)
+	}
+	if p.tokens[p.pos].tag != end {
+		return node, p.unexpected()
+	}
+	p.pos++
+	return node, nil
+}
+
+func (p *templateParser) unexpected() error {
+	token := p.tokens[p.pos]
+	return fmt.Errorf("LaTeX template line %d: unexpected $%s$", token.line, token.tag)
+}
+
+func fillTemplate(buf *strings.Builder, nodes []templateNode, variables map[string]interface{}) {
+	for _, node := range nodes {
+		switch node.kind {
+		case "text":
+			buf.WriteString(node.text)
+		case "var":
+			switch value := variables[node.text].(type) {
+			case string:
+				buf.WriteString(value)
+			case []string:
+				buf.WriteString(strings.Join(value, ", "))
+			}
+		case "if":
+			if isTruthy(variables[node.text]) {
+				fillTemplate(buf, node.body, variables)
+			} else {
+				fillTemplate(buf, node.alt, variables)
+			}
+		case "for":
+			var items []string
+			switch value := variables[node.text].(type) {
+			case string:
+				if value != "" {
+					items = []string{value}
+				}
+			case []string:
+				items = value
+			}
+
+			// The loop variable shadows the list inside the loop
+			scope := make(map[string]interface{}, len(variables)+2)
+			for key, value := range variables {
+				scope[key] = value
+			}
+			for i, item := range items {
+				if i > 0 {
+					fillTemplate(buf, node.alt, scope)
+				}
+				scope[node.text] = item
+				scope["it"] = item
+				fillTemplate(buf, node.body, scope)
+			}
+		}
+	}
+}
+
+// isTruthy reports whether a front matter value counts as set: not empty,
+// "false" or "no"
+func isTruthy(value interface{}) bool {
+	switch value := value.(type) {
+	case string:
+		value = strings.TrimSpace(value)
+		return value != "" && !strings.EqualFold(value, "false") && !strings.EqualFold(value, "no")
+	case []string:
+		return len(value) > 0
+	}
+	return false
+}
+
+// defaultLaTeXTemplate is used when no template file is chosen. Front matter
+// keys it reads: title, subtitle, author, date, abstract, toc, documentclass,
+// classoption, fontsize, geometry, header-includes, bibliography and
+// biblio-style.
+const defaultLaTeXTemplate = `\documentclass[$if(fontsize)$$fontsize$$endif$$for(classoption)$,$classoption$$endfor$]{$if(documentclass)$$documentclass$$else$article$endif$}
+\usepackage[T1]{fontenc}
+\usepackage[utf8]{inputenc}
+\usepackage{lmodern}
+\usepackage{amsmath,amssymb}
+\usepackage{graphicx}
+\usepackage{longtable,booktabs}
+\usepackage{listings}
+\usepackage{xcolor}
+\usepackage[normalem]{ulem}
+$if(geometry)$
+\usepackage[$for(geometry)$$geometry$$sep$,$endfor$]{geometry}
+$endif$
+\usepackage[hidelinks]{hyperref}
+
+% Scale images down to the text block, keeping their aspect ratio
+\makeatletter
+\def\maxwidth{\ifdim\Gin@nat@width>\linewidth\linewidth\else\Gin@nat@width\fi}
+\def\maxheight{\ifdim\Gin@nat@height>\textheight\textheight\else\Gin@nat@height\fi}
+\makeatother
+\setkeys{Gin}{width=\maxwidth,height=\maxheight,keepaspectratio}
+
+\lstset{
+  basicstyle=\small\ttfamily,
+  breaklines=true,
+  columns=fullflexible,
+  keepspaces=true,
+  showstringspaces=false,
+  frame=single,
+  rulecolor=\color{lightgray},
+  keywordstyle=\color{blue!70!black},
+  commentstyle=\color{gray},
+  stringstyle=\color{red!60!black}
+}
+\providecommand{\tightlist}{\setlength{\itemsep}{0pt}\setlength{\parskip}{0pt}}
+$for(header-includes)$
+$header-includes$
+$endfor$
+
+$if(title)$
+\title{$title$$if(subtitle)$\\\large $subtitle$$endif$}
+$endif$
+$if(author)$
+\author{$for(author)$$author$$sep$ \and $endfor$}
+$endif$
+$if(title)$
+\date{$date$}
+$endif$
+
+\begin{document}
+$if(title)$
+\maketitle
+$endif$
+$if(abstract)$
+\begin{abstract}
+$abstract$
+\end{abstract}
+$endif$
+$if(toc)$
+\tableofcontents
+$endif$
+
+$body$
+
+$if(bibliography)$
+\bibliographystyle{$if(biblio-style)$$biblio-style$$else$plain$endif$}
+\bibliography{$for(bibliography)$$bibliography$$sep$,$endfor$}
+$endif$
+\end{document}
+`
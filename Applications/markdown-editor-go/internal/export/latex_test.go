@@ -0,0 +1,62 @@
+package export
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+func TestLaTeXWarnings(t *testing.T) {
+	md := "---\nauthor: Jane & Co <x>\n---\n# Title <span>here</span>\n\n![missing](missing.png)\n\n" +
+		"| a | b |\n|---|---|\n| <kbd>1</kbd> | <!-- note --> |\n"
+	exporter := NewLaTeXExporter(utils.NewMarkdownParser(), LaTeXOptions{SourcePath: filepath.Join(t.TempDir(), "doc.md")})
+	source, err := exporter.Render(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(source, `Jane \& Co`) {
+		t.Errorf("the author is missing from the source:\n%s", source)
+	}
+
+	counts := map[string]int{}
+	for _, warning := range exporter.Warnings() {
+		counts[warning]++
+	}
+	for _, want := range []string{"missing.png", "<x>", "<span>", "</span>", "<kbd>"} {
+		found := false
+		for warning, count := range counts {
+			if strings.Contains(warning, want) {
+				found = true
+				if count > 1 {
+					t.Errorf("warning %q was given %d times", warning, count)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no warning about %s in %v", want, exporter.Warnings())
+		}
+	}
+	for warning := range counts {
+		if strings.Contains(warning, "note") {
+			t.Errorf("the HTML comment was reported: %q", warning)
+		}
+	}
+	if n := len(exporter.Warnings()); n != len(counts) {
+		t.Errorf("%d warnings but %d distinct ones: %v", n, len(counts), exporter.Warnings())
+	}
+}
+
+// TestLaTeXFootnotes exports footnotes with the default settings, which leave
+// them out of the preview
+func TestLaTeXFootnotes(t *testing.T) {
+	exporter := NewLaTeXExporter(utils.NewMarkdownParser(), LaTeXOptions{})
+	source, err := exporter.Render("Claim[^1].\n\n[^1]: Source.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(source, `Claim\footnote{Source.`) || strings.Contains(source, `\href`) {
+		t.Errorf("the footnote is not a \\footnote:\n%s", source)
+	}
+}
@@ -0,0 +1,345 @@
+package export
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Markup formats documents can be converted to
+const (
+	MarkupConfluence = "confluence" // Confluence storage format
+	MarkupJira       = "jira"       // Jira wiki markup
+	MarkupMediaWiki  = "mediawiki"
+	MarkupAsciiDoc   = "asciidoc"
+)
+
+// MarkupFormatNames holds the display name of each markup format
+var MarkupFormatNames = map[string]string{
+	MarkupConfluence: "Confluence Storage Format",
+	MarkupJira:       "Jira Markup",
+	MarkupMediaWiki:  "MediaWiki",
+	MarkupAsciiDoc:   "AsciiDoc",
+}
+
+// MarkupOptions controls how a document is converted to a markup format
+type MarkupOptions struct {
+	// Format is one of the Markup constants
+	Format string `json:"format"`
+
+	// Title of the document; AsciiDoc writes it as the document header.
+	// Defaults to the front matter title.
+	Title string `json:"title"`
+}
+
+// MarkupExporter converts markdown documents to wiki and markup formats
+type MarkupExporter struct {
+	parser   *utils.MarkdownParser
+	options  MarkupOptions
+	warnings []string
+}
+
+// NewMarkupExporter creates a markup exporter
+func NewMarkupExporter(parser *utils.MarkdownParser, options MarkupOptions) *MarkupExporter {
+	return &MarkupExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the parts of the last document the format cannot represent
+func (e *MarkupExporter) Warnings() []string {
+	return e.warnings
+}
+
+// Render converts a document to the exporter's format
+func (e *MarkupExporter) Render(md string) (string, error) {
+	e.warnings = nil
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(body)
+	headings := DocumentHeadings(doc)
+
+	title := e.options.Title
+	if title == "" {
+		title = matter.String("title")
+	}
+
+	base := markupBase{exporter: e, out: &strings.Builder{}, warned: map[string]bool{}, headings: map[string]string{}}
+	for _, heading := range headings {
+		base.headings[heading.ID] = heading.Text
+	}
+	switch e.options.Format {
+	case MarkupConfluence:
+		w := &confluenceWriter{markupBase: base}
+		w.document(doc)
+		return w.out.String(), nil
+	case MarkupJira:
+		w := &jiraWriter{markupBase: base}
+		w.document(doc)
+		return w.out.String(), nil
+	case MarkupMediaWiki:
+		w := &mediaWikiWriter{markupBase: base}
+		w.document(doc)
+		return w.out.String(), nil
+	case MarkupAsciiDoc:
+		w := &asciiDocWriter{markupBase: base}
+		w.document(doc, title, matter.Strings("author"))
+		return w.out.String(), nil
+	}
+	return "", errors.New("unknown markup format: " + e.options.Format)
+}
+
+// markupBase holds what the markup writers share: the output, which can be
+// redirected to capture part of it, and warnings reported once each
+type markupBase struct {
+	exporter *MarkupExporter
+	out      *strings.Builder
+	warned   map[string]bool
+	inline   bool // writing inline content captured for later
+
+	// headings maps heading IDs to their text, for formats whose anchors
+	// are named after the heading
+	headings map[string]string
+}
+
+func (b *markupBase) write(s string) {
+	b.out.WriteString(s)
+}
+
+func (b *markupBase) warn(message string) {
+	if !b.warned[message] {
+		b.warned[message] = true
+		b.exporter.warnings = append(b.exporter.warnings, message)
+	}
+}
+
+// atLineStart reports whether the next text written starts a line
+func (b *markupBase) atLineStart() bool {
+	if b.inline {
+		return false
+	}
+	return b.out.Len() == 0 || strings.HasSuffix(b.out.String(), "\n")
+}
+
+// endLine ends the line written last, removing the blank lines after it
+func (b *markupBase) endLine() {
+	written := b.out.String()
+	trimmed := strings.TrimRight(written, "\n")
+	if len(trimmed) < len(written)-1 {
+		b.out.Reset()
+		b.out.WriteString(trimmed + "\n")
+	} else if len(trimmed) == len(written) && written != "" {
+		b.out.WriteString("\n")
+	}
+}
+
+// capture returns what fn writes instead of writing it
+func (b *markupBase) capture(fn func()) string {
+	saved, inline := b.out, b.inline
+	b.out, b.inline = &strings.Builder{}, true
+	fn()
+	captured := b.out.String()
+	b.out, b.inline = saved, inline
+	return captured
+}
+
+// warnHTML reports raw HTML, which the markup formats leave out; comments
+// are dropped silently
+func (b *markupBase) warnHTML(literal []byte) {
+	if !strings.HasPrefix(strings.TrimSpace(string(literal)), "<!--") {
+		b.warn("raw HTML is left out")
+	}
+}
+
+// plainText returns a text node's content with line breaks in the source
+// turned into spaces, as they are when the paragraph is displayed
+func plainText(literal []byte) string {
+	return strings.ReplaceAll(string(literal), "\n", " ")
+}
+
+// tableLayout is a table's rows split into header and body, with the number
+// of columns and the alignment of each
+type tableLayout struct {
+	header  []*ast.TableRow
+	body    []*ast.TableRow
+	caption ast.Node
+	columns int
+	aligns  []ast.CellAlignFlags
+}
+
+// layoutTable reads the rows of a table. A column takes the alignment of its
+// first aligned cell.
+func layoutTable(table *ast.Table) tableLayout {
+	var layout tableLayout
+	ast.WalkFunc(table, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch node := node.(type) {
+		case *ast.TableRow:
+			if entering {
+				if _, ok := node.Parent.(*ast.TableHeader); ok {
+					layout.header = append(layout.header, node)
+				} else {
+					layout.body = append(layout.body, node)
+				}
+			}
+			return ast.SkipChildren
+		case *ast.Caption:
+			layout.caption = node
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+
+	for _, row := range layout.rows() {
+		for i, child := range row.Children {
+			if i >= layout.columns {
+				layout.columns = i + 1
+				layout.aligns = append(layout.aligns, 0)
+			}
+			if cell, ok := child.(*ast.TableCell); ok && layout.aligns[i] == 0 {
+				layout.aligns[i] = cell.Align
+			}
+		}
+	}
+	return layout
+}
+
+// rows returns the header rows followed by the body rows
+func (t tableLayout) rows() []*ast.TableRow {
+	return append(append([]*ast.TableRow{}, t.header...), t.body...)
+}
+
+// cell returns a row's cell in a column, or nil for missing cells
+func (t tableLayout) cell(row *ast.TableRow, column int) *ast.TableCell {
+	if column >= len(row.Children) {
+		return nil
+	}
+	cell, _ := row.Children[column].(*ast.TableCell)
+	return cell
+}
+
+// Alert kinds, written in markdown as a block quote starting with [!NOTE] and so on
+var alertKinds = []string{"note", "tip", "important", "warning", "caution"}
+
+// Titles of alerts, for formats that write them as titled boxes
+var alertTitles = map[string]string{
+	"note":      "Note",
+	"tip":       "Tip",
+	"important": "Important",
+	"warning":   "Warning",
+	"caution":   "Caution",
+}
+
+// blockquoteAlert returns the kind of alert a block quote is, removing its
+// [!KIND] marker, or "" for plain quotes
+func blockquoteAlert(quote *ast.BlockQuote) string {
+	paragraph, ok := firstChild(quote).(*ast.Paragraph)
+	if !ok {
+		return ""
+	}
+	text, ok := firstChild(paragraph).(*ast.Text)
+	if !ok {
+		return ""
+	}
+
+	literal := string(text.Literal)
+	for _, kind := range alertKinds {
+		marker := "[!" + strings.ToUpper(kind) + "]"
+		if !strings.HasPrefix(literal, marker) {
+			continue
+		}
+		rest := literal[len(marker):]
+		if rest != "" && rest[0] != '\n' && rest[0] != ' ' {
+			return ""
+		}
+		text.Literal = []byte(strings.TrimLeft(rest, " \n"))
+		if len(text.Literal) == 0 && len(paragraph.Children) == 1 {
+			ast.RemoveFromTree(paragraph)
+		}
+		return kind
+	}
+	return ""
+}
+
+// footnoteBlocks returns the blocks of a footnote, or nil when its text is not
+// wrapped in paragraphs
+func footnoteBlocks(note ast.Node) []ast.Node {
+	if note == nil {
+		return nil
+	}
+	if child := firstChild(note); child != nil && child.AsLeaf() == nil {
+		return note.GetChildren()
+	}
+	return nil
+}
+
+// noteNumber returns the number of a footnote reference among the footnotes
+// seen so far, adding it when it is referenced for the first time
+func noteNumber(notes *[]*ast.Link, link *ast.Link) (int, bool) {
+	for i, note := range *notes {
+		if note.NoteID == link.NoteID {
+			return i + 1, false
+		}
+	}
+	*notes = append(*notes, link)
+	return len(*notes), true
+}
+
+// isTaskList reports whether every item of a list starts with a task list
+// checkbox, [ ] or [x]
+func isTaskList(list *ast.List) bool {
+	if len(list.Children) == 0 || list.ListFlags&ast.ListTypeOrdered != 0 {
+		return false
+	}
+	for _, item := range list.Children {
+		if taskMarker(item) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// taskDone removes the checkbox from a task list item and reports whether
+// it is checked
+func taskDone(item ast.Node) bool {
+	text := taskMarker(item)
+	if text == nil {
+		return false
+	}
+	done := text.Literal[1] != ' '
+	text.Literal = text.Literal[4:]
+	return done
+}
+
+// taskMarker returns the text starting with an item's checkbox, if any
+func taskMarker(item ast.Node) *ast.Text {
+	first := firstChild(item)
+	if _, ok := first.(*ast.Paragraph); ok {
+		first = firstChild(first)
+	}
+	text, ok := first.(*ast.Text)
+	if !ok || len(text.Literal) < 4 {
+		return nil
+	}
+	switch string(text.Literal[:4]) {
+	case "[ ] ", "[x] ", "[X] ":
+		return text
+	}
+	return nil
+}
+
+// isDelimiterRun reports whether the run of characters text[start:end] could
+// open or close inline formatting: it touches a word on one side and a space,
+// punctuation or the end of the text on the other
+func isDelimiterRun(text []rune, start int, end int) bool {
+	boundary := func(i int) bool {
+		return i < 0 || i >= len(text) || !unicode.IsLetter(text[i]) && !unicode.IsDigit(text[i])
+	}
+	space := func(i int) bool {
+		return i < 0 || i >= len(text) || unicode.IsSpace(text[i])
+	}
+	opens := boundary(start-1) && !space(end)
+	closes := !space(start-1) && boundary(end)
+	return opens || closes
+}
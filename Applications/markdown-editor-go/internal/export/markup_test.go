@@ -0,0 +1,64 @@
+package export
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+// Extensions of the golden files of each markup format
+var markupGoldenExtensions = map[string]string{
+	MarkupConfluence: ".confluence",
+	MarkupJira:       ".jira",
+	MarkupMediaWiki:  ".wiki",
+	MarkupAsciiDoc:   ".adoc",
+}
+
+// TestMarkupGolden converts every testdata/*.md document to each markup
+// format and compares the result with the golden file next to it. Run with
+// -update to rewrite the golden files after a deliberate change.
+func TestMarkupGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.md documents")
+	}
+
+	parser := utils.NewMarkdownParser()
+	for _, input := range inputs {
+		md, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for format, ext := range markupGoldenExtensions {
+			golden := strings.TrimSuffix(input, ".md") + ext
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				got, err := NewMarkupExporter(parser, MarkupOptions{Format: format}).Render(string(md))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *update {
+					if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v; run go test -update to create it", err)
+				}
+				if got != string(want) {
+					t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package export
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// mediaWikiWriter writes MediaWiki wikitext
+type mediaWikiWriter struct {
+	markupBase
+	notes      []*ast.Link
+	listPrefix string
+}
+
+func (w *mediaWikiWriter) document(doc ast.Node) {
+	w.blocks(doc)
+	if len(w.notes) > 0 {
+		w.write("<references />\n")
+	}
+}
+
+func (w *mediaWikiWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *mediaWikiWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		marks := strings.Repeat("=", min(max(node.Level, 1), 6))
+		w.write(marks + " ")
+		w.inlines(node)
+		w.write(" " + marks + "\n\n")
+	case *ast.Paragraph:
+		w.inlines(node)
+		w.write("\n\n")
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		w.write("<blockquote>\n")
+		if kind := blockquoteAlert(node); kind != "" {
+			w.write("'''" + alertTitles[kind] + "'''\n\n")
+		}
+		w.blocks(node)
+		w.endLine()
+		w.write("</blockquote>\n\n")
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info))
+	case *ast.MathBlock:
+		w.write(`<math display="block">` + strings.TrimSpace(string(node.Literal)) + "</math>\n\n")
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule:
+		w.write("----\n\n")
+	case *ast.HTMLBlock:
+		w.warnHTML(node.Literal)
+	case *ast.Footnotes:
+		// Footnotes are written where they are referenced
+	default:
+		w.blocks(node)
+	}
+}
+
+// list writes a list with one line per item, each starting with the markers
+// of the lists it is nested in. Further paragraphs of an item continue it
+// on lines marked with a colon.
+func (w *mediaWikiWriter) list(list *ast.List) {
+	if list.IsFootnotesList {
+		return
+	}
+
+	parent := w.listPrefix
+	for _, child := range list.Children {
+		marker := "*"
+		switch {
+		case list.ListFlags&ast.ListTypeDefinition != 0:
+			marker = ":"
+			if item, ok := child.(*ast.ListItem); ok && item.ListFlags&ast.ListTypeTerm != 0 {
+				marker = ";"
+			}
+		case list.ListFlags&ast.ListTypeOrdered != 0:
+			marker = "#"
+		}
+		w.listPrefix = parent + marker
+		w.write(w.listPrefix + " ")
+		w.itemContent(child)
+	}
+	w.listPrefix = parent
+	if parent == "" {
+		w.write("\n")
+	}
+}
+
+func (w *mediaWikiWriter) itemContent(item ast.Node) {
+	if child := firstChild(item); child != nil && child.AsLeaf() != nil {
+		w.inlines(item)
+		w.write("\n")
+		return
+	}
+	for i, child := range item.GetChildren() {
+		switch child := child.(type) {
+		case *ast.Paragraph:
+			if i > 0 {
+				w.endLine()
+				w.write(w.listPrefix + ": ")
+			}
+			w.inlines(child)
+		case *ast.List:
+			w.endLine()
+			w.list(child)
+		default:
+			w.endLine()
+			w.block(child)
+		}
+	}
+	w.endLine()
+}
+
+// codeBlock writes code highlighted by the SyntaxHighlight extension when its
+// language is known, else as preformatted text
+func (w *mediaWikiWriter) codeBlock(code string, language string) {
+	code = strings.TrimRight(code, "\n")
+	if language != "" {
+		code = strings.ReplaceAll(code, "</syntaxhighlight>", "&lt;/syntaxhighlight>")
+		w.write(`<syntaxhighlight lang="` + language + `">` + "\n" + code + "\n</syntaxhighlight>\n\n")
+		return
+	}
+	w.write("<pre>\n" + escapeMediaWikiHTML(code) + "\n</pre>\n\n")
+}
+
+// table writes a wikitable with a line per cell
+func (w *mediaWikiWriter) table(table *ast.Table) {
+	layout := layoutTable(table)
+	if layout.columns == 0 {
+		return
+	}
+
+	w.write("{| class=\"wikitable\"\n")
+	if layout.caption != nil {
+		w.write("|+ ")
+		w.inlines(layout.caption)
+		w.write("\n")
+	}
+	for r, row := range layout.rows() {
+		if r > 0 {
+			w.write("|-\n")
+		}
+		for i := 0; i < layout.columns; i++ {
+			cell := layout.cell(row, i)
+			if cell != nil && cell.IsHeader {
+				w.write("!")
+			} else {
+				w.write("|")
+			}
+			switch layout.aligns[i] {
+			case ast.TableAlignmentCenter:
+				w.write(` style="text-align: center;" |`)
+			case ast.TableAlignmentRight:
+				w.write(` style="text-align: right;" |`)
+			}
+			w.write(" ")
+			if cell != nil {
+				w.cellContent(cell)
+			}
+			w.write("\n")
+		}
+	}
+	w.write("|}\n\n")
+}
+
+func (w *mediaWikiWriter) cellContent(cell *ast.TableCell) {
+	for i, child := range cell.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok {
+			if i > 0 {
+				w.write("<br />")
+			}
+			w.inlines(paragraph)
+			continue
+		}
+		w.inline(child)
+	}
+}
+
+// Inline content
+
+func (w *mediaWikiWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *mediaWikiWriter) inline(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(plainText(node.Literal))
+	case *ast.Code:
+		w.write("<code><nowiki>" + escapeMediaWikiHTML(string(node.Literal)) + "</nowiki></code>")
+	case *ast.Math:
+		w.write("<math>" + string(node.Literal) + "</math>")
+	case *ast.Emph:
+		w.wrap("''", "''", node)
+	case *ast.Strong:
+		w.wrap("'''", "'''", node)
+	case *ast.Del:
+		w.wrap("<s>", "</s>", node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.footnote(node)
+			return
+		}
+		w.link(node)
+	case *ast.Image:
+		w.image(node)
+	case *ast.Hardbreak:
+		w.write("<br />")
+	case *ast.HTMLSpan:
+		w.warnHTML(node.Literal)
+	default:
+		w.inlines(node)
+	}
+}
+
+func (w *mediaWikiWriter) wrap(open string, close string, node ast.Node) {
+	w.write(open)
+	w.inlines(node)
+	w.write(close)
+}
+
+// link writes an external link, a link to a section of the page, or a link
+// to another page for links to local markdown files
+func (w *mediaWikiWriter) link(link *ast.Link) {
+	dest := string(link.Destination)
+	text := w.capture(func() { w.inlines(link) })
+	switch {
+	case dest == "":
+		w.write(text)
+	case strings.HasPrefix(dest, "#"):
+		anchor := dest[1:]
+		if heading, ok := w.headings[anchor]; ok {
+			anchor = heading
+		}
+		w.write("[[#" + anchor + "|" + text + "]]")
+	case isLocalReference(dest):
+		page := path.Base(strings.ReplaceAll(dest, "\\", "/"))
+		page, section, _ := strings.Cut(page, "#")
+		page = strings.TrimSuffix(strings.TrimSuffix(page, ".md"), ".markdown")
+		if section != "" {
+			page += "#" + section
+		}
+		w.write("[[" + page + "|" + text + "]]")
+	case utils.NodeText(link) == dest:
+		w.write(mediaWikiURL(dest))
+	default:
+		w.write("[" + mediaWikiURL(dest) + " " + text + "]")
+	}
+}
+
+// image writes a local image as a file of the wiki, which has to be uploaded,
+// and links to remote images, which wikis do not show by default
+func (w *mediaWikiWriter) image(image *ast.Image) {
+	dest := string(image.Destination)
+	alt := w.capture(func() { w.inlines(image) })
+	if !isLocalReference(dest) {
+		w.warn("remote image " + dest + " is written as a link")
+		if alt == "" {
+			alt = dest
+		}
+		w.write("[" + mediaWikiURL(dest) + " " + alt + "]")
+		return
+	}
+
+	name := path.Base(strings.ReplaceAll(dest, "\\", "/"))
+	w.warn("local image " + dest + " must be uploaded to the wiki as " + name)
+	w.write("[[File:" + name)
+	if alt != "" {
+		w.write("|alt=" + alt + "|" + alt)
+	}
+	w.write("]]")
+}
+
+// footnote writes a footnote as a reference at its first use and refers to
+// it by name at later ones
+func (w *mediaWikiWriter) footnote(link *ast.Link) {
+	number, first := noteNumber(&w.notes, link)
+	name := "fn" + strconv.Itoa(number)
+	if !first {
+		w.write(`<ref name="` + name + `" />`)
+		return
+	}
+
+	w.write(`<ref name="` + name + `">`)
+	if blocks := footnoteBlocks(link.Footnote); blocks != nil {
+		for i, block := range blocks {
+			if i > 0 {
+				w.write("<br />")
+			}
+			w.inlines(block)
+		}
+	} else if link.Footnote != nil {
+		w.inlines(link.Footnote)
+	}
+	w.write("</ref>")
+}
+
+// mediaWikiURL escapes the characters that end an external link
+func mediaWikiURL(url string) string {
+	return strings.NewReplacer(" ", "%20", "[", "%5B", "]", "%5D", "|", "%7C").Replace(url)
+}
+
+func escapeMediaWikiHTML(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// mediaWikiMarkup matches text MediaWiki would take for markup: links,
+// templates, tables, bold and italic quotes, signatures and magic words
+var mediaWikiMarkup = regexp.MustCompile(`&(?:#39;)?|[<>\[\]{}|]|''|~~~|__`)
+
+// mediaWikiLineStart matches the starts of lines that begin lists, headings,
+// tables, rules and preformatted text
+var mediaWikiLineStart = regexp.MustCompile(`^([*#:;= ]|----|\{\|)`)
+
+// text writes plain text, escaping what MediaWiki would take for markup
+func (w *mediaWikiWriter) text(text string) {
+	if w.atLineStart() && mediaWikiLineStart.MatchString(text) {
+		w.write("<nowiki/>")
+	}
+	// Quotes next to formatting would join its quotes
+	if strings.HasPrefix(text, "'") {
+		text = "&#39;" + text[1:]
+	}
+	if strings.HasSuffix(text, "'") {
+		text = text[:len(text)-1] + "&#39;"
+	}
+	w.write(mediaWikiMarkup.ReplaceAllStringFunc(text, func(markup string) string {
+		switch markup {
+		case "''":
+			return "'&#39;"
+		case "~~~":
+			return "&#126;~~"
+		case "__":
+			return "&#95;_"
+		case "&":
+			return "&amp;"
+		case "&#39;":
+			return markup
+		case "<":
+			return "&lt;"
+		case ">":
+			return "&gt;"
+		}
+		return "&#" + strconv.Itoa(int(markup[0])) + ";"
+	}))
+}
@@ -0,0 +1,1047 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Page sizes supported by the PDF exporter
+const (
+	PageA4     = "A4"
+	PageA5     = "A5"
+	PageLetter = "Letter"
+	PageLegal  = "Legal"
+)
+
+// Font families embedded in every PDF, so output does not depend on installed fonts
+const (
+	pdfSansFont = "GoSans"
+	pdfMonoFont = "GoMono"
+)
+
+// PDFOptions controls the layout of exported PDF documents
+type PDFOptions struct {
+	// Title of the document; defaults to the front matter title or the first heading
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	SourcePath string `json:"sourcePath"`
+
+	PageSize  string `json:"pageSize"` // A4, A5, Letter or Legal
+	Landscape bool   `json:"landscape"`
+
+	// Margins in millimetres
+	MarginTop    float64 `json:"marginTop"`
+	MarginRight  float64 `json:"marginRight"`
+	MarginBottom float64 `json:"marginBottom"`
+	MarginLeft   float64 `json:"marginLeft"`
+
+	// FontSize is the body text size in points
+	FontSize float64 `json:"fontSize"`
+
+	// Header and Footer are printed on every page, with {title}, {page} and
+	// {pages} replaced; empty to leave them out
+	Header string `json:"header"`
+	Footer string `json:"footer"`
+
+	Colors theme.ThemeColors `json:"colors"`
+}
+
+// DefaultPDFOptions returns A4 pages with a title header and page numbers in the footer
+func DefaultPDFOptions() PDFOptions {
+	return PDFOptions{
+		PageSize:     PageA4,
+		MarginTop:    20,
+		MarginRight:  20,
+		MarginBottom: 20,
+		MarginLeft:   20,
+		FontSize:     11,
+		Header:       "{title}",
+		Footer:       "Page {page} of {pages}",
+		Colors:       theme.NewTheme().GetColors(theme.LightTheme),
+	}
+}
+
+// normalize replaces invalid values with their defaults
+func (o *PDFOptions) normalize() {
+	defaults := DefaultPDFOptions()
+	switch o.PageSize {
+	case PageA4, PageA5, PageLetter, PageLegal:
+	default:
+		o.PageSize = defaults.PageSize
+	}
+	for _, margin := range []*float64{&o.MarginTop, &o.MarginRight, &o.MarginBottom, &o.MarginLeft} {
+		if *margin <= 0 || *margin > 80 {
+			*margin = 20
+		}
+	}
+	if o.FontSize < 6 || o.FontSize > 32 {
+		o.FontSize = defaults.FontSize
+	}
+	if o.Colors == (theme.ThemeColors{}) {
+		o.Colors = defaults.Colors
+	}
+}
+
+// PDFExporter renders markdown documents as PDF files without a browser
+type PDFExporter struct {
+	parser   *utils.MarkdownParser
+	options  PDFOptions
+	warnings []string
+}
+
+// NewPDFExporter creates a PDF exporter
+func NewPDFExporter(parser *utils.MarkdownParser, options PDFOptions) *PDFExporter {
+	options.normalize()
+	return &PDFExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the problems found during the last export, such as missing images
+func (e *PDFExporter) Warnings() []string {
+	return e.warnings
+}
+
+// Export writes the document as a PDF file to outputPath
+func (e *PDFExporter) Export(md string, outputPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := e.Render(md, file); err != nil {
+		file.Close()
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
+
+// Render writes the document as PDF to out
+func (e *PDFExporter) Render(md string, out io.Writer) error {
+	e.warnings = nil
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(body)
+	headings := DocumentHeadings(doc)
+
+	title := e.options.Title
+	if title == "" {
+		title = DocumentTitle(matter, headings, e.options.SourcePath)
+	}
+
+	w := newPDFWriter(e, title)
+	w.pdf.SetAuthor(matter.String("author"), true)
+	w.pdf.SetSubject(matter.String("description"), true)
+	w.pdf.SetKeywords(strings.Join(matter.Strings("tags"), ", "), true)
+
+	// Every heading can be the target of an internal link
+	for _, heading := range headings {
+		if _, ok := w.anchors[heading.ID]; !ok {
+			w.anchors[heading.ID] = w.pdf.AddLink()
+		}
+	}
+	w.baseLevel = 6
+	for _, heading := range headings {
+		if heading.Level < w.baseLevel {
+			w.baseLevel = heading.Level
+		}
+	}
+
+	w.pdf.AddPage()
+	w.blocks(doc)
+
+	if err := w.pdf.Error(); err != nil {
+		return err
+	}
+	return w.pdf.Output(out)
+}
+
+// rgb is a color in a PDF
+type rgb struct {
+	r, g, b int
+}
+
+// parseColor reads a #rgb, #rrggbb or rgb()/rgba() CSS color, falling back when it cannot
+func parseColor(value string, fallback rgb) rgb {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "#") {
+		hex := value[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) >= 6 {
+			if n, err := strconv.ParseUint(hex[:6], 16, 32); err == nil {
+				return rgb{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}
+			}
+		}
+		return fallback
+	}
+
+	if open, end := strings.Index(value, "("), strings.LastIndex(value, ")"); open > 0 && end > open {
+		parts := strings.Split(value[open+1:end], ",")
+		if len(parts) >= 3 {
+			var c [3]int
+			for i := range c {
+				n, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+				if err != nil {
+					return fallback
+				}
+				c[i] = n
+			}
+			return rgb{c[0], c[1], c[2]}
+		}
+	}
+	return fallback
+}
+
+// inlineStyle is the text style of a run of inline content
+type inlineStyle struct {
+	bold   bool
+	italic bool
+	strike bool
+	mono   bool
+	link   string
+}
+
+// pdfWriter lays out a document's AST on PDF pages
+type pdfWriter struct {
+	pdf      *fpdf.Fpdf
+	exporter *PDFExporter
+	options  PDFOptions
+	baseDir  string
+
+	style  inlineStyle
+	size   float64 // current font size in points
+	indent float64 // left indentation of nested blocks in millimetres
+
+	// anchors maps heading IDs to internal link targets
+	anchors map[string]int
+
+	// baseLevel is the shallowest heading level; lastLevel the last bookmark's level
+	baseLevel int
+	lastLevel int
+
+	// replacedGlyphs is set once characters the fonts cannot hold were replaced
+	replacedGlyphs bool
+
+	textColor      rgb
+	secondaryColor rgb
+	linkColor      rgb
+	borderColor    rgb
+	fillColor      rgb
+}
+
+func newPDFWriter(e *PDFExporter, title string) *pdfWriter {
+	options := e.options
+	orientation := "P"
+	if options.Landscape {
+		orientation = "L"
+	}
+
+	pdf := fpdf.New(orientation, "mm", options.PageSize, "")
+	pdf.SetMargins(options.MarginLeft, options.MarginTop, options.MarginRight)
+	pdf.SetAutoPageBreak(true, options.MarginBottom)
+	pdf.SetCellMargin(0)
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("Markdown Editor", true)
+
+	for _, font := range []struct {
+		family string
+		style  string
+		ttf    []byte
+	}{
+		{pdfSansFont, "", goregular.TTF},
+		{pdfSansFont, "B", gobold.TTF},
+		{pdfSansFont, "I", goitalic.TTF},
+		{pdfSansFont, "BI", gobolditalic.TTF},
+		{pdfMonoFont, "", gomono.TTF},
+		{pdfMonoFont, "B", gomonobold.TTF},
+		{pdfMonoFont, "I", gomonoitalic.TTF},
+		{pdfMonoFont, "BI", gomonobolditalic.TTF},
+	} {
+		pdf.AddUTF8FontFromBytes(font.family, font.style, font.ttf)
+	}
+
+	w := &pdfWriter{
+		pdf:            pdf,
+		exporter:       e,
+		options:        options,
+		baseDir:        sourceDir(options.SourcePath),
+		size:           options.FontSize,
+		anchors:        map[string]int{},
+		lastLevel:      -1,
+		textColor:      parseColor(options.Colors.Text, rgb{0x2d, 0x34, 0x36}),
+		secondaryColor: parseColor(options.Colors.TextSecondary, rgb{0x63, 0x6e, 0x72}),
+		linkColor:      parseColor(options.Colors.AccentHover, rgb{0x09, 0x84, 0xe3}),
+		borderColor:    parseColor(options.Colors.Border, rgb{0xdf, 0xe6, 0xe9}),
+		fillColor:      parseColor(options.Colors.BackgroundSecondary, rgb{0xf0, 0xf0, 0xf0}),
+	}
+
+	replacer := strings.NewReplacer("{title}", title, "{pages}", "{nb}")
+	pdf.AliasNbPages("{nb}")
+	if options.Header != "" {
+		pdf.SetHeaderFuncMode(func() {
+			w.pageText(options.MarginTop/2, replacer.Replace(options.Header), "L")
+		}, true)
+	}
+	if options.Footer != "" {
+		pdf.SetFooterFunc(func() {
+			_, pageHeight := pdf.GetPageSize()
+			text := strings.ReplaceAll(replacer.Replace(options.Footer), "{page}", strconv.Itoa(pdf.PageNo()))
+			w.pageText(pageHeight-options.MarginBottom/2, text, "C")
+		})
+	}
+
+	return w
+}
+
+// pageText writes a header or footer line
+func (w *pdfWriter) pageText(y float64, text string, align string) {
+	text = w.fontText(text)
+	pageWidth, _ := w.pdf.GetPageSize()
+	w.pdf.SetFont(pdfSansFont, "", 8)
+	w.pdf.SetTextColor(w.secondaryColor.r, w.secondaryColor.g, w.secondaryColor.b)
+	w.pdf.SetXY(w.options.MarginLeft, y-2)
+	w.pdf.CellFormat(pageWidth-w.options.MarginLeft-w.options.MarginRight, 4, text, "", 0, align, false, 0, "")
+}
+
+func (w *pdfWriter) warn(message string) {
+	w.exporter.warnings = append(w.exporter.warnings, message)
+}
+
+// fallbackGlyph stands in for the characters the embedded fonts cannot hold
+const fallbackGlyph = '\uFFFD'
+
+// fontText replaces the characters beyond the Basic Multilingual Plane, such
+// as emoji, with fallbackGlyph. The embedded Go fonts have no glyphs for them
+// and fpdf cannot measure them. The first replacement is reported.
+func (w *pdfWriter) fontText(text string) string {
+	replaced := false
+	text = strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			replaced = true
+			return fallbackGlyph
+		}
+		return r
+	}, text)
+	if replaced && !w.replacedGlyphs {
+		w.replacedGlyphs = true
+		w.warn("characters the PDF fonts have no glyphs for, such as emoji, are written as " + string(fallbackGlyph))
+	}
+	return text
+}
+
+// Layout helpers
+
+// lineHeight returns the height of a line of text at the given size in points
+func lineHeight(size float64) float64 {
+	return size * 25.4 / 72 * 1.45
+}
+
+// left returns the x coordinate where blocks start at the current indentation
+func (w *pdfWriter) left() float64 {
+	return w.options.MarginLeft + w.indent
+}
+
+// contentWidth returns the width available to blocks at the current indentation
+func (w *pdfWriter) contentWidth() float64 {
+	pageWidth, _ := w.pdf.GetPageSize()
+	return pageWidth - w.options.MarginRight - w.left()
+}
+
+// setIndent moves the left edge of following blocks
+func (w *pdfWriter) setIndent(indent float64) {
+	w.indent = indent
+	w.pdf.SetLeftMargin(w.left())
+}
+
+// ensureSpace starts a new page unless height fits on the current one
+func (w *pdfWriter) ensureSpace(height float64) {
+	_, pageHeight := w.pdf.GetPageSize()
+	if w.pdf.GetY()+height > pageHeight-w.options.MarginBottom {
+		w.pdf.AddPage()
+	}
+}
+
+// newLine ends the current line of inline content, if any
+func (w *pdfWriter) newLine() {
+	if w.pdf.GetX() > w.left()+0.01 {
+		w.pdf.Ln(lineHeight(w.size))
+	}
+	w.pdf.SetX(w.left())
+}
+
+// space adds vertical space after a block
+func (w *pdfWriter) space(height float64) {
+	w.pdf.SetY(w.pdf.GetY() + height)
+	w.pdf.SetX(w.left())
+}
+
+// applyFont selects the font for the current inline style
+func (w *pdfWriter) applyFont() {
+	family := pdfSansFont
+	if w.style.mono {
+		family = pdfMonoFont
+	}
+	style := ""
+	if w.style.bold {
+		style += "B"
+	}
+	if w.style.italic {
+		style += "I"
+	}
+	if w.style.strike {
+		style += "S"
+	}
+	if w.style.link != "" {
+		style += "U"
+	}
+
+	size := w.size
+	if w.style.mono {
+		size *= 0.9
+	}
+	w.pdf.SetFont(family, style, size)
+
+	color := w.textColor
+	if w.style.link != "" {
+		color = w.linkColor
+	}
+	w.pdf.SetTextColor(color.r, color.g, color.b)
+}
+
+// Blocks
+
+// blocks lays out the children of a container
+func (w *pdfWriter) blocks(container ast.Node) {
+	for _, child := range container.GetChildren() {
+		w.block(child)
+	}
+}
+
+func (w *pdfWriter) block(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		w.heading(node)
+	case *ast.Paragraph:
+		w.paragraph(node, true)
+	case *ast.List:
+		w.list(node)
+	case *ast.BlockQuote:
+		w.blockQuote(node)
+	case *ast.CodeBlock:
+		w.codeBlock(string(node.Literal), codeLanguage(node.Info), true)
+	case *ast.MathBlock:
+		w.codeBlock(string(node.Literal), "", false)
+	case *ast.Table:
+		w.table(node)
+	case *ast.HorizontalRule, *ast.Footnotes:
+		w.rule()
+	case *ast.HTMLBlock:
+		if !bytes.HasPrefix(bytes.TrimSpace(node.Literal), []byte("<!--")) {
+			w.warn("raw HTML blocks are left out of the PDF")
+		}
+	default:
+		w.blocks(node)
+	}
+}
+
+// heading writes a heading, registering it as a bookmark and link target
+func (w *pdfWriter) heading(heading *ast.Heading) {
+	scale := [...]float64{2, 1.5, 1.25, 1.1, 1, 0.9}[heading.Level-1]
+	size := w.options.FontSize * scale
+
+	// Keep headings with at least two lines of the text that follows them
+	w.newLine()
+	w.space(lineHeight(size) * 0.4)
+	w.ensureSpace(lineHeight(size) + 2*lineHeight(w.options.FontSize))
+
+	level := heading.Level - w.baseLevel
+	if level > w.lastLevel+1 {
+		level = w.lastLevel + 1
+	}
+	w.lastLevel = level
+	w.pdf.Bookmark(w.fontText(strings.TrimSpace(utils.NodeText(heading))), level, -1)
+	if link, ok := w.anchors[heading.HeadingID]; ok {
+		w.pdf.SetLink(link, w.pdf.GetY(), -1)
+	}
+
+	saved := w.size
+	w.size = size
+	w.style.bold = true
+	w.inlines(heading)
+	w.style.bold = false
+	w.newLine()
+	w.size = saved
+
+	if heading.Level <= 2 {
+		y := w.pdf.GetY() + 1
+		w.pdf.SetDrawColor(w.borderColor.r, w.borderColor.g, w.borderColor.b)
+		w.pdf.SetLineWidth(0.3)
+		w.pdf.Line(w.left(), y, w.left()+w.contentWidth(), y)
+		w.space(2)
+	}
+	w.space(lineHeight(w.size) * 0.3)
+}
+
+// paragraph writes a paragraph of wrapped inline content
+func (w *pdfWriter) paragraph(paragraph *ast.Paragraph, spaced bool) {
+	w.pdf.SetX(w.left())
+	w.inlines(paragraph)
+	w.newLine()
+	if spaced {
+		w.space(lineHeight(w.size) * 0.5)
+	}
+}
+
+// list writes bullet, numbered and definition lists
+func (w *pdfWriter) list(list *ast.List) {
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		w.definitionList(list)
+		return
+	}
+
+	ordered := list.ListFlags&ast.ListTypeOrdered != 0
+	number := list.Start
+	if number == 0 {
+		number = 1
+	}
+	delimiter := string(list.Delimiter)
+	if delimiter == "" || delimiter == "\x00" {
+		delimiter = "."
+	}
+
+	saved := w.indent
+	w.setIndent(saved + 7)
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+
+		marker := "•"
+		if ordered {
+			marker = strconv.Itoa(number) + delimiter
+			number++
+		}
+
+		w.ensureSpace(lineHeight(w.size))
+		w.style = inlineStyle{}
+		w.applyFont()
+		markerWidth := w.pdf.GetStringWidth(marker) + 2
+		w.pdf.SetX(w.left() - markerWidth)
+		w.pdf.CellFormat(markerWidth-2, lineHeight(w.size), marker, "", 0, "R", false, 0, "")
+		w.pdf.SetX(w.left())
+
+		w.listItem(item, list.Tight)
+	}
+	w.setIndent(saved)
+
+	// Nested lists share their parent's spacing
+	if _, nested := list.Parent.(*ast.ListItem); !nested {
+		w.space(lineHeight(w.size) * 0.5)
+	}
+}
+
+// listItem writes the blocks of a list item; tight lists have no space between paragraphs
+func (w *pdfWriter) listItem(item *ast.ListItem, tight bool) {
+	if len(item.Children) > 0 && item.Children[0].AsLeaf() != nil {
+		// Single paragraph footnotes hold their inline content directly
+		w.inlines(item)
+		w.newLine()
+		return
+	}
+	for _, child := range item.Children {
+		if paragraph, ok := child.(*ast.Paragraph); ok {
+			w.paragraph(paragraph, !tight)
+			continue
+		}
+		w.newLine()
+		w.block(child)
+	}
+	w.newLine()
+}
+
+// definitionList writes terms in bold with their definitions indented below
+func (w *pdfWriter) definitionList(list *ast.List) {
+	saved := w.indent
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			w.setIndent(saved)
+			w.style.bold = true
+			w.inlines(item)
+			w.style.bold = false
+			w.newLine()
+			continue
+		}
+		w.setIndent(saved + 7)
+		w.listItem(item, true)
+	}
+	w.setIndent(saved)
+	w.space(lineHeight(w.size) * 0.5)
+}
+
+// blockQuote writes indented, dimmed blocks with a bar on their left
+func (w *pdfWriter) blockQuote(quote *ast.BlockQuote) {
+	w.newLine()
+	saved := w.indent
+	barX := w.left() + 1
+	startY := w.pdf.GetY()
+	startPage := w.pdf.PageNo()
+
+	savedText := w.textColor
+	w.textColor = w.secondaryColor
+	w.setIndent(saved + 6)
+	w.blocks(quote)
+	w.setIndent(saved)
+	w.textColor = savedText
+
+	// The bar is drawn once the height is known, on the page where the quote ends
+	endY := w.pdf.GetY() - lineHeight(w.size)*0.5
+	if w.pdf.PageNo() != startPage {
+		startY = w.options.MarginTop
+	}
+	w.pdf.SetDrawColor(w.linkColor.r, w.linkColor.g, w.linkColor.b)
+	w.pdf.SetLineWidth(1)
+	w.pdf.Line(barX, startY, barX, endY)
+}
+
+// codeSegment is a run of code in one color
+type codeSegment struct {
+	text  string
+	color rgb
+}
+
+// codeBlock writes code on a shaded background, highlighted when requested
+func (w *pdfWriter) codeBlock(code string, language string, highlight bool) {
+	w.newLine()
+	code = w.fontText(strings.ReplaceAll(strings.TrimRight(code, "\n"), "\t", "    "))
+
+	size := w.options.FontSize * 0.85
+	height := size * 25.4 / 72 * 1.35
+	padding := 3.0
+	width := w.contentWidth()
+
+	// Split the tokens into colored segments line by line
+	lines := [][]codeSegment{{}}
+	tokens := codeTokens(code, language)
+	for _, token := range tokens {
+		color := w.textColor
+		if highlight {
+			if colour, ok := tokenColor(token.Type); ok {
+				color = rgb{int(colour.Red()), int(colour.Green()), int(colour.Blue())}
+			}
+		}
+		for i, part := range strings.Split(token.Value, "\n") {
+			if i > 0 {
+				lines = append(lines, []codeSegment{})
+			}
+			if part != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], codeSegment{part, color})
+			}
+		}
+	}
+	if len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	w.pdf.SetFont(pdfMonoFont, "", size)
+	wrapped := [][]codeSegment{}
+	for _, line := range lines {
+		wrapped = append(wrapped, w.wrapCode(line, width-2*padding)...)
+	}
+
+	w.pdf.SetFillColor(w.fillColor.r, w.fillColor.g, w.fillColor.b)
+	w.ensureSpace(height + 2*padding)
+	w.pdf.Rect(w.left(), w.pdf.GetY(), width, padding, "F")
+	w.space(padding)
+	for _, line := range wrapped {
+		w.ensureSpace(height + padding)
+		y := w.pdf.GetY()
+		w.pdf.SetFillColor(w.fillColor.r, w.fillColor.g, w.fillColor.b)
+		w.pdf.Rect(w.left(), y, width, height, "F")
+		w.pdf.SetXY(w.left()+padding, y)
+		for _, segment := range line {
+			w.pdf.SetTextColor(segment.color.r, segment.color.g, segment.color.b)
+			w.pdf.CellFormat(w.pdf.GetStringWidth(segment.text), height, segment.text, "", 0, "L", false, 0, "")
+		}
+		w.pdf.SetXY(w.left(), y+height)
+	}
+	w.pdf.SetFillColor(w.fillColor.r, w.fillColor.g, w.fillColor.b)
+	w.pdf.Rect(w.left(), w.pdf.GetY(), width, padding, "F")
+	w.space(padding + lineHeight(w.size)*0.5)
+}
+
+// wrapCode breaks a line of code into lines no wider than width, splitting between characters
+func (w *pdfWriter) wrapCode(line []codeSegment, width float64) [][]codeSegment {
+	lines := [][]codeSegment{{}}
+	used := 0.0
+	for _, segment := range line {
+		start := 0
+		runes := []rune(segment.text)
+		for i, r := range runes {
+			charWidth := w.pdf.GetStringWidth(string(r))
+			if used+charWidth > width && used > 0 {
+				if i > start {
+					lines[len(lines)-1] = append(lines[len(lines)-1], codeSegment{string(runes[start:i]), segment.color})
+				}
+				lines = append(lines, []codeSegment{})
+				start = i
+				used = 0
+			}
+			used += charWidth
+		}
+		if start < len(runes) {
+			lines[len(lines)-1] = append(lines[len(lines)-1], codeSegment{string(runes[start:]), segment.color})
+		}
+	}
+	return lines
+}
+
+// tableCell is a cell of a table laid out in the PDF
+type tableCell struct {
+	text   string
+	header bool
+	align  string
+}
+
+// table writes a table with wrapped cells, repeating the header rows on each page
+func (w *pdfWriter) table(table *ast.Table) {
+	w.newLine()
+
+	var header, rows [][]tableCell
+	ast.WalkFunc(table, func(node ast.Node, entering bool) ast.WalkStatus {
+		row, ok := node.(*ast.TableRow)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		var cells []tableCell
+		for _, child := range row.Children {
+			cell, ok := child.(*ast.TableCell)
+			if !ok {
+				continue
+			}
+			align := "L"
+			switch cell.Align {
+			case ast.TableAlignmentCenter:
+				align = "C"
+			case ast.TableAlignmentRight:
+				align = "R"
+			}
+			cells = append(cells, tableCell{
+				text:   w.fontText(strings.TrimSpace(utils.NodeText(cell))),
+				header: cell.IsHeader,
+				align:  align,
+			})
+		}
+		if _, inHeader := row.Parent.(*ast.TableHeader); inHeader {
+			header = append(header, cells)
+		} else {
+			rows = append(rows, cells)
+		}
+		return ast.SkipChildren
+	})
+
+	columns := 0
+	for _, row := range append(header, rows...) {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return
+	}
+
+	size := w.options.FontSize * 0.9
+	padding := 1.5
+	widths := w.columnWidths(append(header, rows...), columns, size, padding)
+
+	for _, row := range header {
+		w.tableRow(row, widths, size, padding, nil)
+	}
+	for _, row := range rows {
+		w.tableRow(row, widths, size, padding, header)
+	}
+	w.pdf.SetX(w.left())
+	w.space(lineHeight(w.size) * 0.5)
+}
+
+// columnWidths sizes table columns to their content, shrinking wide columns to fit the page
+func (w *pdfWriter) columnWidths(rows [][]tableCell, columns int, size float64, padding float64) []float64 {
+	natural := make([]float64, columns)
+	for _, row := range rows {
+		for i, cell := range row {
+			style := ""
+			if cell.header {
+				style = "B"
+			}
+			w.pdf.SetFont(pdfSansFont, style, size)
+			natural[i] = math.Max(natural[i], w.pdf.GetStringWidth(cell.text)+2*padding)
+		}
+	}
+
+	available := w.contentWidth()
+	total := 0.0
+	for i := range natural {
+		natural[i] = math.Max(natural[i], 8)
+		total += natural[i]
+	}
+	if total <= available {
+		// Spread the spare room so the table spans the page like the preview's
+		spare := (available - total) / float64(columns)
+		for i := range natural {
+			natural[i] += spare
+		}
+		return natural
+	}
+
+	// Give narrow columns their natural width and share the rest among wide ones
+	fair := available / float64(columns)
+	widths := make([]float64, columns)
+	remaining, wide := available, 0.0
+	for i, width := range natural {
+		if width <= fair {
+			widths[i] = width
+			remaining -= width
+		} else {
+			wide += width
+		}
+	}
+	for i, width := range natural {
+		if width > fair {
+			widths[i] = remaining * width / wide
+		}
+	}
+	return widths
+}
+
+// tableRow writes one row, starting a new page with the header rows repeated when it does not fit
+func (w *pdfWriter) tableRow(row []tableCell, widths []float64, size float64, padding float64, header [][]tableCell) {
+	height := lineHeight(size)
+	lines := make([][]string, len(widths))
+	rowHeight := 0.0
+	for i := range widths {
+		cell := tableCell{}
+		if i < len(row) {
+			cell = row[i]
+		}
+		style := ""
+		if cell.header {
+			style = "B"
+		}
+		w.pdf.SetFont(pdfSansFont, style, size)
+		lines[i] = w.pdf.SplitText(cell.text, widths[i]-2*padding)
+		rowHeight = math.Max(rowHeight, float64(len(lines[i]))*height+2*padding)
+	}
+
+	_, pageHeight := w.pdf.GetPageSize()
+	if w.pdf.GetY()+rowHeight > pageHeight-w.options.MarginBottom {
+		w.pdf.AddPage()
+		for _, headerRow := range header {
+			w.tableRow(headerRow, widths, size, padding, nil)
+		}
+	}
+
+	y := w.pdf.GetY()
+	x := w.left()
+	w.pdf.SetDrawColor(w.borderColor.r, w.borderColor.g, w.borderColor.b)
+	w.pdf.SetLineWidth(0.2)
+	for i, width := range widths {
+		cell := tableCell{align: "L"}
+		if i < len(row) {
+			cell = row[i]
+		}
+		if cell.header {
+			w.pdf.SetFillColor(w.fillColor.r, w.fillColor.g, w.fillColor.b)
+			w.pdf.Rect(x, y, width, rowHeight, "FD")
+			w.pdf.SetFont(pdfSansFont, "B", size)
+		} else {
+			w.pdf.Rect(x, y, width, rowHeight, "D")
+			w.pdf.SetFont(pdfSansFont, "", size)
+		}
+		w.pdf.SetTextColor(w.textColor.r, w.textColor.g, w.textColor.b)
+		for j, line := range lines[i] {
+			w.pdf.SetXY(x+padding, y+padding+float64(j)*height)
+			w.pdf.CellFormat(width-2*padding, height, line, "", 0, cell.align, false, 0, "")
+		}
+		x += width
+	}
+	w.pdf.SetXY(w.left(), y+rowHeight)
+}
+
+// rule writes a horizontal rule
+func (w *pdfWriter) rule() {
+	w.newLine()
+	w.ensureSpace(lineHeight(w.size))
+	y := w.pdf.GetY() + lineHeight(w.size)/2
+	w.pdf.SetDrawColor(w.borderColor.r, w.borderColor.g, w.borderColor.b)
+	w.pdf.SetLineWidth(0.3)
+	w.pdf.Line(w.left(), y, w.left()+w.contentWidth(), y)
+	w.space(lineHeight(w.size))
+}
+
+// image writes an image on its own line, scaled to fit the page
+func (w *pdfWriter) image(node *ast.Image) {
+	dest := string(node.Destination)
+	alt := strings.TrimSpace(utils.NodeText(node))
+
+	if !isLocalReference(dest) {
+		w.warn("remote image " + dest + " is not embedded")
+		w.imagePlaceholder(alt, dest)
+		return
+	}
+	img, err := LoadImage(dest, w.baseDir)
+	if err != nil {
+		w.warn("image " + dest + " could not be read: " + err.Error())
+		w.imagePlaceholder(alt, dest)
+		return
+	}
+
+	imageType := map[string]string{"image/png": "PNG", "image/jpeg": "JPG", "image/gif": "GIF"}[img.MediaType]
+	config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if imageType == "" || err != nil {
+		w.warn("image " + dest + " is not a PNG, JPEG or GIF file")
+		w.imagePlaceholder(alt, dest)
+		return
+	}
+
+	options := fpdf.ImageOptions{ImageType: imageType}
+	w.pdf.RegisterImageOptionsReader(img.Path, options, bytes.NewReader(img.Data))
+	if err := w.pdf.Error(); err != nil {
+		// fpdf errors are sticky, so clear it to keep the rest of the document
+		w.pdf.ClearError()
+		w.warn("image " + dest + " could not be embedded: " + err.Error())
+		w.imagePlaceholder(alt, dest)
+		return
+	}
+
+	// Images are shown at 96 dpi, shrunk to fit the text width and page height
+	_, pageHeight := w.pdf.GetPageSize()
+	width := float64(config.Width) * 25.4 / 96
+	height := float64(config.Height) * 25.4 / 96
+	maxHeight := (pageHeight - w.options.MarginTop - w.options.MarginBottom) * 0.9
+	scale := math.Min(1, math.Min(w.contentWidth()/width, maxHeight/height))
+	width, height = width*scale, height*scale
+
+	w.newLine()
+	w.ensureSpace(height)
+	w.pdf.ImageOptions(img.Path, w.left(), w.pdf.GetY(), width, height, false, options, 0, w.style.link)
+	w.pdf.SetXY(w.left(), w.pdf.GetY()+height+1)
+}
+
+// imagePlaceholder writes the alt text of an image that cannot be embedded
+func (w *pdfWriter) imagePlaceholder(alt string, dest string) {
+	if alt == "" {
+		alt = dest
+	}
+	saved := w.style
+	w.style.italic = true
+	w.text(" [" + alt + "] ")
+	w.style = saved
+}
+
+// Inline content
+
+// inlines writes the inline children of a node as wrapped text
+func (w *pdfWriter) inlines(node ast.Node) {
+	for _, child := range node.GetChildren() {
+		w.inline(child)
+	}
+}
+
+func (w *pdfWriter) inline(node ast.Node) {
+	saved := w.style
+	defer func() { w.style = saved }()
+
+	switch node := node.(type) {
+	case *ast.Text:
+		w.text(string(node.Literal))
+	case *ast.Code:
+		w.style.mono = true
+		w.text(string(node.Literal))
+	case *ast.Math:
+		w.style.mono = true
+		w.text(string(node.Literal))
+	case *ast.Emph:
+		w.style.italic = true
+		w.inlines(node)
+	case *ast.Strong:
+		w.style.bold = true
+		w.inlines(node)
+	case *ast.Del:
+		w.style.strike = true
+		w.inlines(node)
+	case *ast.Link:
+		if node.NoteID > 0 {
+			w.text("[" + strconv.Itoa(node.NoteID) + "]")
+			return
+		}
+		w.style.link = string(node.Destination)
+		w.inlines(node)
+	case *ast.Image:
+		w.image(node)
+	case *ast.Hardbreak:
+		w.pdf.Ln(lineHeight(w.size))
+	case *ast.Softbreak:
+		w.text(" ")
+	case *ast.HTMLSpan:
+		// Inline HTML has no PDF equivalent
+	default:
+		w.inlines(node)
+	}
+}
+
+// text writes a run of text in the current style, wrapping at the right margin
+func (w *pdfWriter) text(text string) {
+	text = w.fontText(strings.ReplaceAll(text, "\n", " "))
+	if text == "" {
+		return
+	}
+	w.applyFont()
+
+	height := lineHeight(w.size)
+	link := w.style.link
+	switch {
+	case strings.HasPrefix(link, "#"):
+		if id, ok := w.anchors[link[1:]]; ok {
+			w.pdf.WriteLinkID(height, text, id)
+			return
+		}
+		w.pdf.Write(height, text)
+	case link != "":
+		w.pdf.WriteLinkString(height, text, link)
+	default:
+		w.pdf.Write(height, text)
+	}
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+)
+
+// TestPDFCharactersBeyondTheFonts exports emoji, which the embedded fonts
+// have no glyphs for, in each place text is written
+func TestPDFCharactersBeyondTheFonts(t *testing.T) {
+	md := `---
+title: Party 🎉
+author: Ann 😀
+---
+# Heading 😀
+
+Text 😀 with ` + "`code 😀`" + ` and a [link 😀](#heading).
+
+- item 🚀
+
+` + "```go\nfmt.Println(\"😀\")\n```" + `
+
+| name 😀 | value |
+|---------|-------|
+| cell 🎉  | 1     |
+`
+	exporter := NewPDFExporter(utils.NewMarkdownParser(), DefaultPDFOptions())
+	var out bytes.Buffer
+	if err := exporter.Render(md, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("%PDF")) {
+		t.Error("the output is not a PDF")
+	}
+	replaced := 0
+	for _, warning := range exporter.Warnings() {
+		if strings.Contains(warning, "emoji") {
+			replaced++
+		}
+	}
+	if replaced != 1 {
+		t.Errorf("warnings = %q, want one about the emoji", exporter.Warnings())
+	}
+
+	path := filepath.Join(t.TempDir(), "out.pdf")
+	if err := exporter.Export(md, path); err != nil {
+		t.Fatal(err)
+	}
+}
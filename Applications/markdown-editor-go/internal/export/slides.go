@@ -0,0 +1,472 @@
+package export
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// SlidesOptions controls how a document is split into slides
+type SlidesOptions struct {
+	// Title of the deck; defaults to the front matter title or the first heading
+	Title string `json:"title"`
+
+	// SourcePath is the markdown file's path, used to resolve relative images
+	SourcePath string `json:"sourcePath"`
+
+	Colors theme.ThemeColors `json:"colors"`
+	Dark   bool              `json:"dark"`
+}
+
+// Slide is one slide of a deck
+type Slide struct {
+	Title      string `json:"title"`
+	HTML       string `json:"html"`
+	Notes      string `json:"notes"`      // speaker notes as HTML
+	Layout     string `json:"layout"`     // one of SlideLayouts
+	Background string `json:"background"` // CSS background, with images as data URIs
+	Class      string `json:"class"`      // extra classes from the slide's front matter
+	Steps      int    `json:"steps"`      // list items revealed one at a time
+}
+
+// SlideDeck is a document split into slides, with the stylesheet they are
+// shown with
+type SlideDeck struct {
+	Title  string  `json:"title"`
+	Slides []Slide `json:"slides"`
+	CSS    string  `json:"css"`
+}
+
+// SlideLayouts are the layouts slides can ask for in their front matter
+var SlideLayouts = []string{"default", "center", "title", "section"}
+
+// slideMatterMarker starts the HTML comment a slide's front matter becomes;
+// writing the comment directly works too
+const slideMatterMarker = "<!-- slide"
+
+// SlidesExporter splits markdown documents into slides and exports them as
+// self-contained HTML decks.
+//
+// Slides are separated by thematic breaks (---), or, in documents without
+// any, by headings of level 2 and above ("slide-level" in the front matter
+// changes the level). A slide can start with its own front matter block
+// between --- lines, setting its layout, background, class and incremental
+// keys; the document's front matter sets the defaults for every slide.
+//
+// Speaker notes start at a paragraph beginning with "Note:" or "Notes:" and
+// run to the end of the slide; an HTML comment starting with "notes" is a note
+// too. Lists of slides marked incremental, and lists alone in a block quote,
+// are revealed one item at a time.
+type SlidesExporter struct {
+	parser   *utils.MarkdownParser
+	options  SlidesOptions
+	warnings []string
+}
+
+// NewSlidesExporter creates a slide exporter
+func NewSlidesExporter(parser *utils.MarkdownParser, options SlidesOptions) *SlidesExporter {
+	return &SlidesExporter{parser: parser.WithFootnotes(), options: options}
+}
+
+// Warnings returns the problems found during the last render, such as missing images
+func (e *SlidesExporter) Warnings() []string {
+	return e.warnings
+}
+
+func (e *SlidesExporter) warn(message string) {
+	e.warnings = append(e.warnings, message)
+}
+
+// Export writes the document as an HTML deck to outputPath. Images are
+// embedded so the deck works offline.
+func (e *SlidesExporter) Export(md string, outputPath string) error {
+	deck := e.Render(md)
+	var buf strings.Builder
+	writeDeckHTML(&buf, deck)
+	return (&utils.FileUtils{}).SaveToFile(outputPath, buf.String())
+}
+
+// slideSource holds the blocks of a slide while the document is split
+type slideSource struct {
+	matter  utils.FrontMatter
+	content []ast.Node
+	notes   []ast.Node
+	inNotes bool
+}
+
+// Render splits the document into slides
+func (e *SlidesExporter) Render(md string) *SlideDeck {
+	e.warnings = nil
+
+	matter, body := utils.SplitFrontMatter(md)
+	doc := e.parser.Parse(markSlideMatter(body))
+	headings := DocumentHeadings(doc)
+	e.embedImages(doc)
+
+	title := e.options.Title
+	if title == "" {
+		title = DocumentTitle(matter, headings, e.options.SourcePath)
+	}
+	deck := &SlideDeck{
+		Title: title,
+		CSS:   SlidesCSS(e.options.Colors, e.options.Dark),
+	}
+
+	for _, source := range e.splitSlides(doc, matter) {
+		deck.Slides = append(deck.Slides, e.renderSlide(source, matter))
+	}
+	return deck
+}
+
+// splitSlides divides the top-level blocks of a document into slides
+func (e *SlidesExporter) splitSlides(doc ast.Node, matter utils.FrontMatter) []*slideSource {
+	breaks := false
+	for _, block := range doc.GetChildren() {
+		if _, ok := block.(*ast.HorizontalRule); ok {
+			breaks = true
+			break
+		}
+	}
+	level := 2
+	if n, err := strconv.Atoi(matter.String("slide-level")); err == nil && n >= 1 && n <= 6 {
+		level = n
+	}
+
+	current := &slideSource{}
+	slides := []*slideSource{current}
+	next := func(matter utils.FrontMatter) {
+		if len(current.content) > 0 || len(current.notes) > 0 || current.matter != nil {
+			current = &slideSource{}
+			slides = append(slides, current)
+		}
+		if matter != nil {
+			current.matter = matter
+		}
+	}
+
+	for _, block := range doc.GetChildren() {
+		switch block := block.(type) {
+		case *ast.HorizontalRule:
+			if breaks {
+				next(nil)
+				continue
+			}
+		case *ast.Heading:
+			if !breaks && block.Level <= level && len(current.content) > 0 {
+				next(nil)
+			}
+		case *ast.HTMLBlock:
+			comment := strings.TrimSpace(string(block.Literal))
+			if matter, ok := slideMatterComment(comment); ok {
+				next(matter)
+				continue
+			}
+			if notes, ok := e.notesComment(comment); ok {
+				current.notes = append(current.notes, notes...)
+				continue
+			}
+		case *ast.Paragraph:
+			if !current.inNotes && startsNotes(block) {
+				current.inNotes = true
+			}
+		case *ast.Footnotes:
+			// Footnotes are shown on the slides referencing them
+			continue
+		case *ast.List:
+			if block.IsFootnotesList {
+				continue
+			}
+		}
+
+		if current.inNotes {
+			current.notes = append(current.notes, block)
+		} else {
+			current.content = append(current.content, block)
+		}
+	}
+
+	// Separators at the start or end of the document leave empty slides
+	var kept []*slideSource
+	for _, slide := range slides {
+		if len(slide.content) > 0 || len(slide.notes) > 0 || slide.matter != nil {
+			kept = append(kept, slide)
+		}
+	}
+	if len(kept) == 0 {
+		kept = append(kept, &slideSource{})
+	}
+	return kept
+}
+
+// slideMatterLine matches the lines of a slide's front matter block
+var slideMatterLine = regexp.MustCompile(`^([A-Za-z][\w-]*:(\s.*)?|\s+- .*)$`)
+
+// markSlideMatter turns front matter blocks at the start of slides into HTML
+// comments the parser keeps intact. Without this, the closing --- would make
+// the last line a setext heading.
+func markSlideMatter(body string) string {
+	lines := strings.Split(body, "\n")
+	out := make([]string, 0, len(lines))
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Code blocks can show front matter without it applying
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out = append(out, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			out = append(out, line)
+			continue
+		}
+
+		if strings.TrimRight(line, " \t") == "---" {
+			end := i + 1
+			for end < len(lines) && slideMatterLine.MatchString(lines[end]) {
+				end++
+			}
+			if end > i+1 && end < len(lines) && strings.TrimRight(lines[end], " \t") == "---" {
+				out = append(out, "", slideMatterMarker)
+				out = append(out, lines[i+1:end]...)
+				out = append(out, "-->", "")
+				i = end
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// slideMatterComment reads the front matter of a slide from its comment
+func slideMatterComment(comment string) (utils.FrontMatter, bool) {
+	if !strings.HasPrefix(comment, slideMatterMarker) || !strings.HasSuffix(comment, "-->") {
+		return nil, false
+	}
+	inside := strings.TrimSuffix(strings.TrimPrefix(comment, slideMatterMarker), "-->")
+	if inside != "" && inside[0] != ' ' && inside[0] != '\n' && inside[0] != ':' {
+		// Some other comment, such as <!-- slideshow -->
+		return nil, false
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimPrefix(inside, ":"), "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return utils.ParseFrontMatter(lines), true
+}
+
+// notesComment returns the blocks of a speaker notes comment
+func (e *SlidesExporter) notesComment(comment string) ([]ast.Node, bool) {
+	if !strings.HasPrefix(comment, "<!--") || !strings.HasSuffix(comment, "-->") {
+		return nil, false
+	}
+	inside := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(comment, "<!--"), "-->"))
+	lower := strings.ToLower(inside)
+	for _, prefix := range []string{"notes:", "note:", "notes"} {
+		if strings.HasPrefix(lower, prefix) {
+			text := strings.TrimSpace(inside[len(prefix):])
+			return e.parser.Parse(text).GetChildren(), true
+		}
+	}
+	return nil, false
+}
+
+// startsNotes reports whether a paragraph starts the speaker notes of a
+// slide, removing its "Note:" label if so
+func startsNotes(paragraph *ast.Paragraph) bool {
+	text, ok := firstChild(paragraph).(*ast.Text)
+	if !ok {
+		return false
+	}
+	for _, label := range []string{"Notes:", "Note:"} {
+		if strings.HasPrefix(string(text.Literal), label) {
+			text.Literal = []byte(strings.TrimLeft(string(text.Literal[len(label):]), " "))
+			return true
+		}
+	}
+	return false
+}
+
+// renderSlide renders the blocks and settings of a slide
+func (e *SlidesExporter) renderSlide(source *slideSource, deckMatter utils.FrontMatter) Slide {
+	setting := func(key string) string {
+		if value := source.matter.String(key); value != "" {
+			return value
+		}
+		return deckMatter.String(key)
+	}
+
+	slide := Slide{
+		Layout:     e.layout(setting("layout")),
+		Background: e.background(setting("background")),
+		Class:      cssClasses(setting("class")),
+	}
+	incremental := isTruthy(setting("incremental"))
+
+	var buf strings.Builder
+	var notes []*ast.Link
+	seen := map[int]bool{}
+	for _, block := range source.content {
+		if heading, ok := block.(*ast.Heading); ok && slide.Title == "" {
+			slide.Title = strings.TrimSpace(utils.NodeText(heading))
+		}
+
+		list, steps := incrementalList(block, incremental)
+		if list != nil {
+			slide.Steps += steps
+			buf.WriteString("<div class=\"incremental\">\n" + e.fragment(list) + "</div>\n")
+		} else {
+			buf.WriteString(e.fragment(block))
+		}
+
+		ast.WalkFunc(block, func(node ast.Node, entering bool) ast.WalkStatus {
+			if link, ok := node.(*ast.Link); ok && entering && link.NoteID > 0 && link.Footnote != nil && !seen[link.NoteID] {
+				seen[link.NoteID] = true
+				notes = append(notes, link)
+			}
+			return ast.GoToNext
+		})
+	}
+
+	// Footnotes go at the bottom of the slide that cites them
+	if len(notes) > 0 {
+		buf.WriteString("<ol class=\"slide-footnotes\">\n")
+		for _, link := range notes {
+			item := e.fragment(link.Footnote)
+			buf.WriteString(strings.Replace(item, "<li", "<li value=\""+strconv.Itoa(link.NoteID)+"\"", 1))
+		}
+		buf.WriteString("</ol>\n")
+	}
+	slide.HTML = buf.String()
+
+	var notesBuf strings.Builder
+	for _, block := range source.notes {
+		notesBuf.WriteString(e.fragment(block))
+	}
+	slide.Notes = notesBuf.String()
+	return slide
+}
+
+// incrementalList returns the list of a block that is revealed item by item
+// and its number of items, or nil. A list alone in a block quote is revealed
+// this way even on slides that are not incremental.
+func incrementalList(block ast.Node, incremental bool) (*ast.List, int) {
+	list, ok := block.(*ast.List)
+	if quote, isQuote := block.(*ast.BlockQuote); isQuote && len(quote.Children) == 1 {
+		list, ok = quote.Children[0].(*ast.List)
+		incremental = true
+	}
+	if !ok || !incremental || list.ListFlags&ast.ListTypeDefinition != 0 {
+		return nil, 0
+	}
+	return list, len(list.Children)
+}
+
+// fragment renders a block as HTML, highlighting code
+func (e *SlidesExporter) fragment(node ast.Node) string {
+	return e.parser.RenderFragment(node, html.RendererOptions{
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			if code, ok := node.(*ast.CodeBlock); ok {
+				if err := highlightHTML(w, string(code.Literal), codeLanguage(code.Info)); err != nil {
+					return ast.GoToNext, false
+				}
+				return ast.GoToNext, true
+			}
+			return ast.GoToNext, false
+		},
+	})
+}
+
+// layout checks the layout a slide asks for
+func (e *SlidesExporter) layout(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return SlideLayouts[0]
+	}
+	for _, layout := range SlideLayouts {
+		if name == layout {
+			return name
+		}
+	}
+	e.warn("unknown slide layout \"" + name + "\"; use " + strings.Join(SlideLayouts, ", "))
+	return SlideLayouts[0]
+}
+
+// Image files a background can name
+var backgroundImageTypes = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".avif": true,
+}
+
+// background converts a slide's background, a CSS color or gradient or an
+// image path, to a CSS background value
+func (e *SlidesExporter) background(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if strings.ContainsAny(value, ";{}<>\"\\") {
+		e.warn("slide background " + value + " is not a color, gradient or image")
+		return ""
+	}
+	if strings.Contains(value, "(") || !backgroundImageTypes[strings.ToLower(filepath.Ext(value))] {
+		return value
+	}
+
+	url := value
+	if isLocalReference(value) {
+		image, err := LoadImage(value, sourceDir(e.options.SourcePath))
+		if err != nil {
+			e.warn("background image " + value + " could not be read: " + err.Error())
+			return ""
+		}
+		url = image.DataURI()
+	} else {
+		e.warn("background image " + value + " is not embedded and needs a connection to show")
+	}
+	return "center / cover no-repeat url(\"" + url + "\")"
+}
+
+// embedImages points local images at data URIs, making the deck self-contained
+func (e *SlidesExporter) embedImages(doc ast.Node) {
+	for _, node := range documentImages(doc) {
+		dest := string(node.Destination)
+		if !isLocalReference(dest) {
+			continue
+		}
+		image, err := LoadImage(dest, sourceDir(e.options.SourcePath))
+		if err != nil {
+			e.warn("image " + dest + " could not be read: " + err.Error())
+			continue
+		}
+		node.Destination = []byte(image.DataURI())
+	}
+}
+
+// cssClass matches the class names slides accept
+var cssClass = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+
+// cssClasses keeps the valid class names of a space or comma separated list
+func cssClasses(value string) string {
+	var classes []string
+	for _, class := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if cssClass.MatchString(class) {
+			classes = append(classes, class)
+		}
+	}
+	return strings.Join(classes, " ")
+}
@@ -0,0 +1,446 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
+)
+
+// slidesCSS styles slides inside a .slides-deck element, so the same rules
+// serve exported decks and the presenter view of the app. Slides are laid out
+// at 1280x720 and scaled to fit by setting --slide-scale.
+const slidesCSS = `
+.slides-deck {
+    position: relative;
+    overflow: hidden;
+    background-color: #000;
+}
+
+.slides-deck .slide {
+    display: none;
+    flex-direction: column;
+    position: absolute;
+    left: 50%;
+    top: 50%;
+    width: 1280px;
+    height: 720px;
+    margin: -360px 0 0 -640px;
+    padding: 56px 80px;
+    box-sizing: border-box;
+    overflow: hidden;
+    transform: scale(var(--slide-scale, 1));
+    background: var(--preview-bg);
+    color: var(--text);
+    font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+    font-size: 32px;
+    line-height: 1.4;
+}
+
+.slides-deck .slide.active {
+    display: flex;
+}
+
+.slides-deck .slide-content {
+    flex: 1;
+    display: flex;
+    flex-direction: column;
+    min-height: 0;
+}
+
+.slides-deck .slide-notes {
+    display: none;
+}
+
+.slides-deck .layout-center .slide-content,
+.slides-deck .layout-title .slide-content,
+.slides-deck .layout-section .slide-content {
+    justify-content: center;
+    text-align: center;
+}
+
+.slides-deck .layout-title h1 {
+    font-size: 80px;
+    border: none;
+}
+
+.slides-deck .layout-section {
+    background: var(--accent);
+    color: var(--preview-bg);
+}
+
+.slides-deck .layout-section h1,
+.slides-deck .layout-section h2 {
+    border: none;
+    font-size: 64px;
+}
+
+.slides-deck .slide h1 {
+    font-size: 56px;
+    margin: 0 0 24px;
+}
+
+.slides-deck .slide h2 {
+    font-size: 48px;
+    margin: 0 0 24px;
+}
+
+.slides-deck .slide h3 {
+    font-size: 40px;
+    margin: 0 0 16px;
+}
+
+.slides-deck .slide p {
+    margin: 0 0 24px;
+}
+
+.slides-deck .slide ul,
+.slides-deck .slide ol {
+    margin: 0 0 24px;
+    padding-left: 1.2em;
+    text-align: left;
+}
+
+.slides-deck .slide li {
+    margin: 8px 0;
+}
+
+.slides-deck .incremental li.pending {
+    visibility: hidden;
+}
+
+.slides-deck .slide a {
+    color: var(--accent);
+    text-decoration: none;
+}
+
+.slides-deck .layout-section a {
+    color: inherit;
+    text-decoration: underline;
+}
+
+.slides-deck .slide blockquote {
+    margin: 0 0 24px;
+    padding-left: 24px;
+    border-left: 6px solid var(--accent);
+    color: var(--text-secondary);
+}
+
+.slides-deck .slide code {
+    font-family: "Roboto Mono", Menlo, Consolas, "Liberation Mono", monospace;
+    font-size: 0.85em;
+    background-color: var(--bg-secondary);
+    padding: 0.1em 0.3em;
+    border-radius: 4px;
+}
+
+.slides-deck .slide pre {
+    margin: 0 0 24px;
+    padding: 20px 24px;
+    font-size: 22px;
+    line-height: 1.45;
+    background-color: var(--bg-secondary);
+    border-radius: 6px;
+    overflow: hidden;
+    text-align: left;
+}
+
+.slides-deck .slide pre code {
+    padding: 0;
+    font-size: inherit;
+    background-color: transparent;
+}
+
+.slides-deck .slide img {
+    max-width: 100%;
+    max-height: 480px;
+    object-fit: contain;
+}
+
+.slides-deck .slide table {
+    border-collapse: collapse;
+    margin: 0 auto 24px;
+    font-size: 26px;
+}
+
+.slides-deck .slide th,
+.slides-deck .slide td {
+    border: 1px solid var(--border);
+    padding: 8px 16px;
+}
+
+.slides-deck .slide th {
+    background-color: var(--bg-secondary);
+}
+
+.slides-deck .slide mark {
+    background-color: var(--highlight);
+    color: inherit;
+}
+
+.slides-deck .slide hr {
+    border: none;
+    border-top: 1px solid var(--border);
+}
+
+.slides-deck .slide-footnotes {
+    margin: auto 0 0;
+    padding: 16px 0 0 1.2em;
+    border-top: 1px solid var(--border);
+    font-size: 18px;
+    color: var(--text-secondary);
+    text-align: left;
+}
+
+.slides-deck .slide-footnotes p {
+    margin: 0;
+}
+`
+
+// deckPageCSS lays out an exported deck over the whole window
+const deckPageCSS = `
+html, body {
+    margin: 0;
+    height: 100%;
+    background-color: #000;
+}
+
+body > .slides-deck {
+    position: fixed;
+    inset: 0;
+}
+
+.deck-counter {
+    position: absolute;
+    right: 16px;
+    bottom: 12px;
+    font: 14px -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+    color: #888;
+}
+
+.deck-progress {
+    position: absolute;
+    left: 0;
+    bottom: 0;
+    height: 4px;
+    background-color: var(--accent);
+    transition: width 0.2s;
+}
+
+.deck-notes {
+    display: none;
+    position: fixed;
+    left: 0;
+    right: 0;
+    bottom: 0;
+    max-height: 35%;
+    overflow-y: auto;
+    padding: 16px 24px;
+    background-color: rgba(0, 0, 0, 0.85);
+    color: #eee;
+    font: 20px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+}
+
+.show-notes .deck-notes {
+    display: block;
+}
+`
+
+// deckScript navigates an exported deck with the keyboard, the mouse and the
+// address bar's #/n slide numbers
+const deckScript = `
+(function () {
+  var deck = document.getElementById("deck");
+  var slides = Array.prototype.slice.call(deck.querySelectorAll(".slide"));
+  var counter = document.getElementById("deck-counter");
+  var progress = document.getElementById("deck-progress");
+  var notes = document.getElementById("deck-notes");
+  var current = 0;
+  var step = 0;
+
+  function items(slide) {
+    return slide.querySelectorAll(".incremental > ul > li, .incremental > ol > li");
+  }
+
+  // show displays a slide with its first steps revealed; -1 reveals all
+  function show(index, steps) {
+    index = Math.max(0, Math.min(slides.length - 1, index));
+    var slide = slides[index];
+    var total = items(slide).length;
+    current = index;
+    step = steps < 0 ? total : Math.min(steps, total);
+
+    slides.forEach(function (other, i) {
+      other.classList.toggle("active", i === index);
+    });
+    Array.prototype.forEach.call(items(slide), function (item, i) {
+      item.classList.toggle("pending", i >= step);
+    });
+
+    var slideNotes = slide.querySelector(".slide-notes");
+    notes.innerHTML = slideNotes ? slideNotes.innerHTML : "";
+    counter.textContent = index + 1 + " / " + slides.length;
+    progress.style.width = ((index + 1) / slides.length) * 100 + "%";
+    if (location.hash !== "#/" + (index + 1)) {
+      history.replaceState(null, "", "#/" + (index + 1));
+    }
+  }
+
+  function next() {
+    if (step < items(slides[current]).length) {
+      show(current, step + 1);
+    } else if (current < slides.length - 1) {
+      show(current + 1, 0);
+    }
+  }
+
+  function previous() {
+    if (step > 0) {
+      show(current, step - 1);
+    } else if (current > 0) {
+      show(current - 1, -1);
+    }
+  }
+
+  function fit() {
+    var scale = Math.min(window.innerWidth / 1280, window.innerHeight / 720);
+    deck.style.setProperty("--slide-scale", scale);
+  }
+
+  // Links to #/n go to slide n, and links to an element to its slide
+  function followHash() {
+    var match = /^#\/(\d+)$/.exec(location.hash);
+    if (match) {
+      show(parseInt(match[1], 10) - 1, 0);
+      return true;
+    }
+    var target = location.hash && document.getElementById(decodeURIComponent(location.hash.slice(1)));
+    var slide = target && target.closest(".slide");
+    if (slide) {
+      show(slides.indexOf(slide), -1);
+      return true;
+    }
+    return false;
+  }
+
+  document.addEventListener("keydown", function (event) {
+    if (event.ctrlKey || event.metaKey || event.altKey) {
+      return;
+    }
+    switch (event.key) {
+      case "ArrowRight":
+      case "ArrowDown":
+      case "PageDown":
+      case " ":
+      case "Enter":
+      case "l":
+      case "j":
+        next();
+        break;
+      case "ArrowLeft":
+      case "ArrowUp":
+      case "PageUp":
+      case "Backspace":
+      case "h":
+      case "k":
+        previous();
+        break;
+      case "Home":
+        show(0, 0);
+        break;
+      case "End":
+        show(slides.length - 1, -1);
+        break;
+      case "f":
+        if (document.fullscreenElement) {
+          document.exitFullscreen();
+        } else {
+          document.documentElement.requestFullscreen();
+        }
+        break;
+      case "n":
+        document.body.classList.toggle("show-notes");
+        break;
+      default:
+        return;
+    }
+    event.preventDefault();
+  });
+
+  deck.addEventListener("click", function (event) {
+    if (!event.target.closest("a")) {
+      next();
+    }
+  });
+
+  window.addEventListener("resize", fit);
+  window.addEventListener("hashchange", followHash);
+  fit();
+  if (!followHash()) {
+    show(0, 0);
+  }
+})();
+`
+
+// SlidesCSS returns the stylesheet of slides in the given theme colors,
+// scoped to .slides-deck elements
+func SlidesCSS(colors theme.ThemeColors, dark bool) string {
+	var buf strings.Builder
+	buf.WriteString(".slides-deck {\n")
+	for _, variable := range themeVariables(colors) {
+		buf.WriteString("    " + variable.name + ": " + variable.value + ";\n")
+	}
+	buf.WriteString("}\n")
+	buf.WriteString(slidesCSS)
+	buf.WriteString(highlightCSS(dark))
+	return buf.String()
+}
+
+// SlideClass returns the classes of a slide's element
+func SlideClass(slide Slide) string {
+	class := "slide layout-" + slide.Layout
+	if slide.Class != "" {
+		class += " " + slide.Class
+	}
+	return class
+}
+
+// writeDeckHTML writes a deck as a single HTML page
+func writeDeckHTML(w io.Writer, deck *SlideDeck) {
+	io.WriteString(w, `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>`+template.HTMLEscapeString(deck.Title)+`</title>
+  <style>
+`+deck.CSS+deckPageCSS+`  </style>
+</head>
+<body>
+<div class="slides-deck" id="deck">
+`)
+
+	for i, slide := range deck.Slides {
+		io.WriteString(w, `<section class="`+SlideClass(slide)+`" id="slide-`+strconv.Itoa(i+1)+`"`)
+		if slide.Background != "" {
+			io.WriteString(w, ` style="background: `+template.HTMLEscapeString(slide.Background)+`"`)
+		}
+		if slide.Title != "" {
+			io.WriteString(w, ` aria-label="`+template.HTMLEscapeString(slide.Title)+`"`)
+		}
+		io.WriteString(w, ">\n<div class=\"slide-content\">\n"+slide.HTML+"</div>\n")
+		if slide.Notes != "" {
+			io.WriteString(w, "<aside class=\"slide-notes\">\n"+slide.Notes+"</aside>\n")
+		}
+		io.WriteString(w, "</section>\n")
+	}
+
+	io.WriteString(w, `<div class="deck-progress" id="deck-progress"></div>
+<div class="deck-counter" id="deck-counter"></div>
+</div>
+<div class="deck-notes" id="deck-notes"></div>
+<script>`)
+	io.WriteString(w, deckScript+"</script>\n</body>\n</html>\n")
+}
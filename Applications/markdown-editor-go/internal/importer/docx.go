@@ -0,0 +1,569 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// xmlNode is an element of a Word document part, matched by local name so
+// the namespace prefixes used by different writers do not matter
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+}
+
+// attr returns an attribute by its local name
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with a local name
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant element with a local name
+func (n *xmlNode) find(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// flag reads an on/off property such as <w:b/> or <w:b w:val="0"/>
+func (n *xmlNode) flag(name string) bool {
+	property := n.child(name)
+	if property == nil {
+		return false
+	}
+	switch property.attr("val") {
+	case "0", "false", "off", "none":
+		return false
+	}
+	return true
+}
+
+// parseXML reads an XML part into a tree
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+	return root, nil
+}
+
+// docxRelationship is a link from the document to an image or web page
+type docxRelationship struct {
+	target   string
+	external bool
+}
+
+// docxReader converts the body of a Word document into HTML for the converter
+type docxReader struct {
+	importer *Importer
+	files    map[string]*zip.File
+
+	// styles maps style IDs to lower case style names
+	styles map[string]string
+
+	// numbering maps list IDs to the number format of each level
+	numbering map[string]map[string]string
+
+	relationships map[string]docxRelationship
+}
+
+var headingStyle = regexp.MustCompile(`^heading ?([1-6])$`)
+
+// docxToHTML reads a Word document as an HTML tree
+func (i *Importer) docxToHTML(filePath string) (*html.Node, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, errors.New("not a Word document: " + err.Error())
+	}
+	defer archive.Close()
+
+	r := &docxReader{
+		importer:      i,
+		files:         map[string]*zip.File{},
+		styles:        map[string]string{},
+		numbering:     map[string]map[string]string{},
+		relationships: map[string]docxRelationship{},
+	}
+	for _, file := range archive.File {
+		r.files[file.Name] = file
+	}
+
+	document, err := r.part("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	if document == nil {
+		return nil, errors.New("not a Word document: word/document.xml is missing")
+	}
+	body := document.find("body")
+	if body == nil {
+		return nil, errors.New("not a Word document: the document has no body")
+	}
+	r.readStyles()
+	r.readNumbering()
+	r.readRelationships()
+
+	root := newElement("body")
+	r.blocks(root, body)
+	nestListParagraphs(root)
+	return root, nil
+}
+
+// part parses a part of the package, returning nil when it is missing
+func (r *docxReader) part(name string) (*xmlNode, error) {
+	file, ok := r.files[name]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return parseXML(rc)
+}
+
+func (r *docxReader) readStyles() {
+	styles, _ := r.part("word/styles.xml")
+	if styles == nil {
+		return
+	}
+	for _, style := range styles.find("styles").children {
+		if style.name != "style" {
+			continue
+		}
+		name := style.attr("styleId")
+		if n := style.child("name"); n != nil {
+			name = n.attr("val")
+		}
+		r.styles[style.attr("styleId")] = strings.ToLower(name)
+	}
+}
+
+func (r *docxReader) readNumbering() {
+	numbering, _ := r.part("word/numbering.xml")
+	if numbering == nil {
+		return
+	}
+	root := numbering.find("numbering")
+	abstract := map[string]map[string]string{}
+	for _, node := range root.children {
+		if node.name != "abstractNum" {
+			continue
+		}
+		levels := map[string]string{}
+		for _, level := range node.children {
+			if level.name == "lvl" {
+				if format := level.child("numFmt"); format != nil {
+					levels[level.attr("ilvl")] = format.attr("val")
+				}
+			}
+		}
+		abstract[node.attr("abstractNumId")] = levels
+	}
+	for _, node := range root.children {
+		if node.name == "num" {
+			if id := node.child("abstractNumId"); id != nil {
+				r.numbering[node.attr("numId")] = abstract[id.attr("val")]
+			}
+		}
+	}
+}
+
+func (r *docxReader) readRelationships() {
+	rels, _ := r.part("word/_rels/document.xml.rels")
+	if rels == nil {
+		return
+	}
+	for _, rel := range rels.find("Relationships").children {
+		r.relationships[rel.attr("Id")] = docxRelationship{
+			target:   rel.attr("Target"),
+			external: rel.attr("TargetMode") == "External",
+		}
+	}
+}
+
+// blocks converts the paragraphs and tables of a body, table cell or content control
+func (r *docxReader) blocks(parent *html.Node, node *xmlNode) {
+	for _, child := range node.children {
+		switch child.name {
+		case "p":
+			r.paragraph(parent, child)
+		case "tbl":
+			parent.AppendChild(r.table(child))
+		case "sdt":
+			if content := child.child("sdtContent"); content != nil {
+				r.blocks(parent, content)
+			}
+		case "customXml", "ins", "smartTag":
+			r.blocks(parent, child)
+		case "altChunk":
+			r.importer.warn("embedded documents were left out")
+		}
+	}
+}
+
+// paragraph converts a paragraph by its style, merging consecutive code and
+// quote paragraphs into one block
+func (r *docxReader) paragraph(parent *html.Node, p *xmlNode) {
+	style := ""
+	var numbering *xmlNode
+	if properties := p.child("pPr"); properties != nil {
+		if s := properties.child("pStyle"); s != nil {
+			style = r.styles[s.attr("val")]
+			if style == "" {
+				style = strings.ToLower(s.attr("val"))
+			}
+		}
+		numbering = properties.child("numPr")
+	}
+
+	switch {
+	case isCodeStyle(style):
+		text := r.plainText(p)
+		if last := parent.LastChild; last != nil && last.Data == "pre" {
+			last.AppendChild(newText("\n" + text))
+			return
+		}
+		pre := newElement("pre")
+		pre.AppendChild(newText(text))
+		parent.AppendChild(pre)
+		return
+	case headingStyle.MatchString(style):
+		level := headingStyle.FindStringSubmatch(style)[1]
+		heading := newElement("h" + level)
+		r.inlines(heading, p)
+		parent.AppendChild(heading)
+		return
+	case style == "title":
+		heading := newElement("h1")
+		r.inlines(heading, p)
+		parent.AppendChild(heading)
+		return
+	}
+
+	para := newElement("p")
+	r.inlines(para, p)
+
+	if numbering != nil {
+		id := ""
+		if n := numbering.child("numId"); n != nil {
+			id = n.attr("val")
+		}
+		level := "0"
+		if l := numbering.child("ilvl"); l != nil {
+			level = l.attr("val")
+		}
+		if id != "" && id != "0" {
+			listType := "ol"
+			if format := r.numbering[id][level]; format == "bullet" || format == "none" || format == "" {
+				listType = "ul"
+			}
+			setAttr(para, listLevelAttr, level)
+			setAttr(para, listTypeAttr, listType)
+			parent.AppendChild(para)
+			return
+		}
+	}
+
+	if strings.Contains(style, "quote") || style == "block text" {
+		if last := parent.LastChild; last != nil && last.Data == "blockquote" {
+			last.AppendChild(para)
+			return
+		}
+		quote := newElement("blockquote")
+		quote.AppendChild(para)
+		parent.AppendChild(quote)
+		return
+	}
+	parent.AppendChild(para)
+}
+
+// isCodeStyle reports whether a paragraph style is meant for source code
+func isCodeStyle(style string) bool {
+	for _, name := range []string{"code", "source", "verbatim", "preformatted", "html pre"} {
+		if strings.Contains(style, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlines converts the runs of a paragraph into inline HTML
+func (r *docxReader) inlines(parent *html.Node, node *xmlNode) {
+	for _, child := range node.children {
+		switch child.name {
+		case "r":
+			r.run(parent, child)
+		case "hyperlink":
+			href := ""
+			if rel, ok := r.relationships[child.attr("id")]; ok {
+				href = rel.target
+			}
+			if anchor := child.attr("anchor"); anchor != "" {
+				href += "#" + anchor
+			}
+			a := newElement("a", "href", href)
+			r.inlines(a, child)
+			parent.AppendChild(a)
+		case "ins", "smartTag", "customXml", "fldSimple", "dir", "bdo":
+			r.inlines(parent, child)
+		case "sdt":
+			if content := child.child("sdtContent"); content != nil {
+				r.inlines(parent, content)
+			}
+		case "oMath", "oMathPara":
+			r.importer.warn("equations were left out")
+		}
+	}
+}
+
+// run converts a run of text with its character formatting
+func (r *docxReader) run(parent *html.Node, run *xmlNode) {
+	target := parent
+	wrap := func(tag string) {
+		element := newElement(tag)
+		target.AppendChild(element)
+		target = element
+	}
+	if properties := run.child("rPr"); properties != nil {
+		style := ""
+		if s := properties.child("rStyle"); s != nil {
+			style = r.styles[s.attr("val")]
+		}
+		if isCodeStyle(style) || strings.Contains(style, "verbatim") {
+			code := newElement("code")
+			code.AppendChild(newText(r.plainText(run)))
+			parent.AppendChild(code)
+			return
+		}
+		if properties.flag("b") {
+			wrap("strong")
+		}
+		if properties.flag("i") {
+			wrap("em")
+		}
+		if properties.flag("strike") || properties.flag("dstrike") {
+			wrap("del")
+		}
+		if align := properties.child("vertAlign"); align != nil {
+			switch align.attr("val") {
+			case "superscript":
+				wrap("sup")
+			case "subscript":
+				wrap("sub")
+			}
+		}
+	}
+
+	for _, child := range run.children {
+		switch child.name {
+		case "t":
+			target.AppendChild(newText(child.text))
+		case "tab", "ptab":
+			target.AppendChild(newText(" "))
+		case "br", "cr":
+			if child.attr("type") != "page" {
+				target.AppendChild(newElement("br"))
+			}
+		case "noBreakHyphen":
+			target.AppendChild(newText("-"))
+		case "drawing", "pict":
+			r.image(target, child)
+		case "AlternateContent":
+			if child.find("txbxContent") != nil {
+				r.importer.warn("text boxes were left out")
+			} else if choice := child.child("Choice"); choice != nil {
+				r.image(target, choice)
+			}
+		case "footnoteReference", "endnoteReference":
+			r.importer.warn("footnotes were left out")
+		case "commentReference":
+			r.importer.warn("comments were left out")
+		case "object":
+			r.importer.warn("embedded objects were left out")
+		}
+	}
+}
+
+// image extracts a picture into the assets folder
+func (r *docxReader) image(parent *html.Node, node *xmlNode) {
+	if node.find("txbxContent") != nil {
+		r.importer.warn("text boxes were left out")
+		return
+	}
+	id := ""
+	if blip := node.find("blip"); blip != nil {
+		id = blip.attr("embed")
+		if id == "" {
+			id = blip.attr("link")
+		}
+	} else if data := node.find("imagedata"); data != nil {
+		id = data.attr("id")
+	}
+	rel, ok := r.relationships[id]
+	if !ok {
+		r.importer.warn("drawings and shapes were left out")
+		return
+	}
+
+	alt := ""
+	if properties := node.find("docPr"); properties != nil {
+		alt = properties.attr("descr")
+		if alt == "" {
+			alt = properties.attr("title")
+		}
+	}
+	if rel.external {
+		parent.AppendChild(newElement("img", "src", rel.target, "alt", alt, assetAttr, ""))
+		return
+	}
+
+	name := path.Join("word", rel.target)
+	if strings.HasPrefix(rel.target, "/") {
+		name = strings.TrimPrefix(rel.target, "/")
+	}
+	file, ok := r.files[name]
+	if !ok {
+		r.importer.warn("missing images were left out")
+		return
+	}
+	rc, err := file.Open()
+	if err != nil {
+		r.importer.warn("unreadable images were left out")
+		return
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		r.importer.warn("unreadable images were left out")
+		return
+	}
+	link, err := r.importer.saveAsset(name, path.Base(name), data)
+	if err != nil {
+		r.importer.warn("images could not be saved: " + err.Error())
+		return
+	}
+	parent.AppendChild(newElement("img", "src", link, "alt", alt, assetAttr, ""))
+}
+
+// table converts a table, taking its first row as the header
+func (r *docxReader) table(tbl *xmlNode) *html.Node {
+	table := newElement("table")
+	first := true
+	for _, row := range tbl.children {
+		if row.name != "tr" {
+			continue
+		}
+		tr := newElement("tr")
+		for _, cell := range row.children {
+			if cell.name != "tc" {
+				continue
+			}
+			tag := "td"
+			if first {
+				tag = "th"
+			}
+			td := newElement(tag)
+			if properties := cell.child("tcPr"); properties != nil {
+				if span := properties.child("gridSpan"); span != nil {
+					if n, err := strconv.Atoi(span.attr("val")); err == nil && n > 1 {
+						setAttr(td, "colspan", span.attr("val"))
+					}
+				}
+				if properties.child("vMerge") != nil {
+					r.importer.warn("merged table cells were split")
+				}
+			}
+			if justification := cell.find("jc"); justification != nil {
+				switch justification.attr("val") {
+				case "center":
+					setAttr(td, "align", "center")
+				case "right", "end":
+					setAttr(td, "align", "right")
+				}
+			}
+			r.blocks(td, cell)
+			nestListParagraphs(td)
+			tr.AppendChild(td)
+		}
+		table.AppendChild(tr)
+		first = false
+	}
+	return table
+}
+
+// plainText returns the text of a paragraph or run without formatting
+func (r *docxReader) plainText(node *xmlNode) string {
+	var buf strings.Builder
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "t":
+				buf.WriteString(child.text)
+			case "tab":
+				buf.WriteString("\t")
+			case "br", "cr":
+				buf.WriteString("\n")
+			case "del", "instrText", "rPr", "pPr":
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return buf.String()
+}
@@ -0,0 +1,885 @@
+package importer
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Attributes marking paragraphs that belong in a list, set on Word paragraphs
+// before nestListParagraphs turns them into nested <ul> and <ol> elements
+const (
+	listLevelAttr = "data-list-level"
+	listTypeAttr  = "data-list-type"
+	listStartAttr = "data-list-start"
+)
+
+// assetAttr marks images whose source already points into the assets folder
+const assetAttr = "data-asset"
+
+// Elements whose content has no markdown equivalent
+var unsupportedElements = map[atom.Atom]string{
+	atom.Iframe:   "embedded frames",
+	atom.Object:   "embedded objects",
+	atom.Embed:    "embedded objects",
+	atom.Video:    "videos",
+	atom.Audio:    "audio",
+	atom.Canvas:   "canvas drawings",
+	atom.Svg:      "inline SVG drawings",
+	atom.Math:     "equations",
+	atom.Select:   "form fields",
+	atom.Textarea: "form fields",
+	atom.Button:   "form fields",
+}
+
+// Elements that are dropped without a warning
+var ignoredElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Meta:     true,
+	atom.Link:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+}
+
+// Elements converted to markdown blocks; the rest is inline content
+var blockElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.P: true, atom.Div: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Hr: true,
+	atom.Section: true, atom.Article: true, atom.Main: true, atom.Header: true, atom.Footer: true,
+	atom.Nav: true, atom.Aside: true, atom.Figure: true, atom.Figcaption: true, atom.Address: true,
+	atom.Details: true, atom.Summary: true, atom.Center: true, atom.Form: true, atom.Fieldset: true,
+}
+
+var (
+	wordListLevel  = regexp.MustCompile(`level(\d+)`)
+	orderedMarker  = regexp.MustCompile(`^[0-9A-Za-z]+[.)]$`)
+	whitespaceRuns = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// parseHTML parses a page or fragment, turning the list paragraphs of Word's
+// clipboard HTML into real lists
+func parseHTML(data string) (*html.Node, error) {
+	root, err := html.Parse(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	markWordListParagraphs(root)
+	nestListParagraphs(root)
+	return root, nil
+}
+
+// markWordListParagraphs marks the paragraphs Word styles with mso-list as
+// list items, removing the bullet or number Word writes as text
+func markWordListParagraphs(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		style := attr(child, "style")
+		if child.DataAtom != atom.P || !strings.Contains(style, "mso-list:") || strings.Contains(style, "mso-list:none") {
+			markWordListParagraphs(child)
+			continue
+		}
+
+		level := 0
+		if match := wordListLevel.FindStringSubmatch(style); match != nil {
+			level, _ = strconv.Atoi(match[1])
+			level--
+		}
+		listType := "ul"
+		if marker := findElement(child, func(n *html.Node) bool {
+			return strings.Contains(attr(n, "style"), "mso-list:Ignore")
+		}); marker != nil {
+			if orderedMarker.MatchString(strings.TrimSpace(strings.ReplaceAll(textContent(marker), "\u00a0", " "))) {
+				listType = "ol"
+			}
+			marker.Parent.RemoveChild(marker)
+		}
+		setAttr(child, listLevelAttr, strconv.Itoa(level))
+		setAttr(child, listTypeAttr, listType)
+	}
+}
+
+// nestListParagraphs replaces runs of marked list paragraphs with nested lists
+func nestListParagraphs(parent *html.Node) {
+	for child := parent.FirstChild; child != nil; {
+		if attr(child, listTypeAttr) == "" {
+			nestListParagraphs(child)
+			child = child.NextSibling
+			continue
+		}
+
+		var stack []*html.Node
+		for child != nil && (attr(child, listTypeAttr) != "" || isBlank(child)) {
+			next := child.NextSibling
+			if isBlank(child) {
+				parent.RemoveChild(child)
+				child = next
+				continue
+			}
+
+			level, _ := strconv.Atoi(attr(child, listLevelAttr))
+			if level < 0 {
+				level = 0
+			}
+			tag := attr(child, listTypeAttr)
+
+			if len(stack) > level+1 {
+				stack = stack[:level+1]
+			}
+			if len(stack) == level+1 && stack[level].Data != tag {
+				stack = stack[:level]
+			}
+			for len(stack) < level+1 {
+				list := newElement(tag)
+				if start := attr(child, listStartAttr); start != "" && tag == "ol" {
+					setAttr(list, "start", start)
+				}
+				if len(stack) == 0 {
+					parent.InsertBefore(list, child)
+				} else {
+					// Nested lists belong to the last item of their parent list
+					top := stack[len(stack)-1]
+					item := top.LastChild
+					if item == nil {
+						item = newElement("li")
+						top.AppendChild(item)
+					}
+					item.AppendChild(list)
+				}
+				stack = append(stack, list)
+			}
+
+			item := newElement("li")
+			stack[level].AppendChild(item)
+			parent.RemoveChild(child)
+			item.AppendChild(child)
+			removeAttr(child, listTypeAttr)
+			child = next
+		}
+	}
+}
+
+// converter writes an HTML tree as markdown
+type converter struct {
+	importer *Importer
+
+	// Inline formatting already in effect, so nested tags are not repeated
+	bold, italic, strike, link, table bool
+}
+
+// blocks converts the children of a node into markdown blocks, gathering
+// inline content into paragraphs
+func (c *converter) blocks(parent *html.Node) []string {
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if text := paragraphText(inline.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+
+	for child := parent.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && blockElements[child.DataAtom] {
+			flush()
+			blocks = append(blocks, c.block(child)...)
+			continue
+		}
+		if child.Type == html.ElementNode && !ignoredElements[child.DataAtom] && hasBlocks(child) {
+			// Inline elements wrapping blocks, like the <b> around Google Docs
+			// content, cannot be kept
+			flush()
+			blocks = append(blocks, c.blocks(child)...)
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return blocks
+}
+
+func (c *converter) block(node *html.Node) []string {
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		text := strings.ReplaceAll(paragraphText(c.children(node)), "\\\n", " ")
+		if text == "" {
+			return nil
+		}
+		return []string{strings.Repeat("#", level) + " " + text}
+	case atom.Ul, atom.Ol:
+		return []string{c.list(node)}
+	case atom.Blockquote:
+		return []string{prefixLines(strings.Join(c.blocks(node), "\n\n"), "> ", "> ")}
+	case atom.Pre:
+		return []string{codeBlock(node)}
+	case atom.Table:
+		if c.table {
+			c.importer.warn("nested tables were flattened")
+			return []string{escapeText(collapseSpace(textContent(node)))}
+		}
+		return []string{c.tableBlock(node)}
+	case atom.Hr:
+		return []string{"---"}
+	case atom.Dl:
+		return c.definitionList(node)
+	}
+	return c.blocks(node)
+}
+
+// children converts the children of a node as inline content
+func (c *converter) children(node *html.Node) string {
+	var buf strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(c.inline(child))
+	}
+	return buf.String()
+}
+
+func (c *converter) inline(node *html.Node) string {
+	switch node.Type {
+	case html.TextNode:
+		return escapeText(collapseSpace(node.Data))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if ignoredElements[node.DataAtom] {
+		return ""
+	}
+	if what, ok := unsupportedElements[node.DataAtom]; ok {
+		c.importer.warn(what + " were left out")
+		return ""
+	}
+
+	style := strings.ToLower(strings.ReplaceAll(attr(node, "style"), " ", ""))
+	switch node.DataAtom {
+	case atom.B, atom.Strong:
+		// Google Docs wraps whole documents in <b style="font-weight:normal">
+		if strings.Contains(style, "font-weight:normal") || strings.Contains(style, "font-weight:400") {
+			return c.children(node)
+		}
+		return c.emphasis(node, true, false, false)
+	case atom.I, atom.Em, atom.Cite, atom.Dfn, atom.Var:
+		return c.emphasis(node, false, true, false)
+	case atom.Del, atom.S, atom.Strike:
+		return c.emphasis(node, false, false, true)
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		return codeSpan(collapseSpace(textContent(node)))
+	case atom.A:
+		return c.anchor(node)
+	case atom.Img:
+		return c.image(node)
+	case atom.Br:
+		return "\\\n"
+	case atom.Sup, atom.Sub, atom.U, atom.Mark:
+		return "<" + node.Data + ">" + c.children(node) + "</" + node.Data + ">"
+	case atom.Input:
+		if attr(node, "type") == "checkbox" {
+			box := "[ ]"
+			if hasAttr(node, "checked") {
+				box = "[x]"
+			}
+			if next := node.NextSibling; next == nil || next.Type != html.TextNode || strings.TrimLeft(next.Data, " \t\r\n") == next.Data {
+				box += " "
+			}
+			return box
+		}
+		c.importer.warn("form fields were left out")
+		return ""
+	case atom.Span, atom.Font:
+		// Word and Google Docs format text with inline styles
+		return c.styledSpan(node, style)
+	}
+
+	if blockElements[node.DataAtom] {
+		// Blocks nested in inline content are kept on the same line
+		return " " + c.children(node) + " "
+	}
+	return c.children(node)
+}
+
+// styledSpan converts a span whose style makes its text bold, italic or struck through
+func (c *converter) styledSpan(node *html.Node, style string) string {
+	bold := strings.Contains(style, "font-weight:bold") || strings.Contains(style, "font-weight:700") ||
+		strings.Contains(style, "font-weight:800") || strings.Contains(style, "font-weight:900")
+	italic := strings.Contains(style, "font-style:italic")
+	strike := strings.Contains(style, "line-through")
+	return c.emphasis(node, bold, italic, strike)
+}
+
+// emphasis wraps the node's content in the markers for its formatting, leaving
+// out formatting already in effect and keeping surrounding spaces outside
+func (c *converter) emphasis(node *html.Node, bold, italic, strike bool) string {
+	var opening, closing string
+	var active []*bool
+	apply := func(on bool, flag *bool, marker string) {
+		if on && !*flag {
+			*flag = true
+			active = append(active, flag)
+			opening += marker
+			closing = marker + closing
+		}
+	}
+	apply(bold, &c.bold, "**")
+	apply(italic, &c.italic, "*")
+	apply(strike, &c.strike, "~~")
+
+	content := c.children(node)
+	for _, flag := range active {
+		*flag = false
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if opening == "" || trimmed == "" || trimmed == "\\" {
+		return content
+	}
+	start := strings.Index(content, trimmed)
+	return content[:start] + opening + trimmed + closing + content[start+len(trimmed):]
+}
+
+// anchor converts a link, keeping only the text of links without a usable destination
+func (c *converter) anchor(node *html.Node) string {
+	href := strings.TrimSpace(attr(node, "href"))
+	if c.link || href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return c.children(node)
+	}
+
+	c.link = true
+	text := strings.TrimSpace(strings.ReplaceAll(c.children(node), "\\\n", " "))
+	c.link = false
+	if text == "" {
+		text = escapeText(href)
+	}
+
+	dest := linkDestination(href)
+	if title := attr(node, "title"); title != "" {
+		dest += ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+	}
+	return "[" + text + "](" + dest + ")"
+}
+
+// image converts an image, extracting embedded and local images into the assets folder
+func (c *converter) image(node *html.Node) string {
+	src := strings.TrimSpace(attr(node, "src"))
+	if src == "" {
+		return ""
+	}
+	dest := src
+	if !hasAttr(node, assetAttr) {
+		dest = c.importer.imageDestination(src)
+	}
+	if dest == "" {
+		return ""
+	}
+	alt := escapeText(collapseSpace(attr(node, "alt")))
+	return "![" + alt + "](" + linkDestination(dest) + ")"
+}
+
+// imageDestination returns where an imported image should point, copying
+// data URIs and local files into the assets folder
+func (i *Importer) imageDestination(src string) string {
+	if strings.HasPrefix(src, "data:") {
+		header, data, ok := strings.Cut(src[len("data:"):], ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			i.warn("images with unreadable data were left out")
+			return ""
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			i.warn("images with unreadable data were left out")
+			return ""
+		}
+
+		ext := ".png"
+		if exts, _ := mime.ExtensionsByType(strings.TrimSuffix(header, ";base64")); len(exts) > 0 {
+			ext = exts[len(exts)-1]
+		}
+		link, err := i.saveAsset(src, "image"+ext, decoded)
+		if err != nil {
+			i.warn("embedded images could not be saved: " + err.Error())
+			return ""
+		}
+		return link
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "" && u.Scheme != "file" && len(u.Scheme) != 1) || strings.HasPrefix(src, "//") {
+		// Remote images stay where they are
+		return src
+	}
+
+	path := src
+	if u.Scheme == "file" {
+		path = u.Path
+		if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+			path = path[1:] // file:///C:/...
+		}
+	} else if unescaped, err := url.PathUnescape(u.Path); err == nil && len(u.Scheme) != 1 {
+		path = unescaped
+	}
+	if !filepath.IsAbs(path) {
+		if i.options.SourcePath == "" {
+			return src
+		}
+		path = filepath.Join(filepath.Dir(i.options.SourcePath), path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		i.warn("missing images were left as links")
+		return src
+	}
+	link, err := i.saveAsset(path, filepath.Base(path), data)
+	if err != nil {
+		i.warn("images could not be copied: " + err.Error())
+		return src
+	}
+	return link
+}
+
+// list converts a bullet or numbered list
+func (c *converter) list(node *html.Node) string {
+	ordered := node.DataAtom == atom.Ol
+	number := 1
+	if start, err := strconv.Atoi(attr(node, "start")); err == nil {
+		number = start
+	}
+
+	var items [][]string
+	loose := false
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		if child.DataAtom != atom.Li {
+			// Lists nested directly in a list belong to the previous item
+			blocks := c.block(child)
+			if len(items) == 0 {
+				items = append(items, nil)
+			}
+			items[len(items)-1] = append(items[len(items)-1], blocks...)
+			continue
+		}
+
+		paragraphs := 0
+		for grandchild := child.FirstChild; grandchild != nil; grandchild = grandchild.NextSibling {
+			if grandchild.DataAtom == atom.P {
+				paragraphs++
+			}
+		}
+		loose = loose || paragraphs > 1
+		items = append(items, c.blocks(child))
+	}
+
+	separator := "\n"
+	if loose {
+		separator = "\n\n"
+	}
+	var out []string
+	for _, blocks := range items {
+		marker := "-"
+		if ordered {
+			marker = strconv.Itoa(number) + "."
+			number++
+		}
+		content := strings.Join(blocks, separator)
+		if content == "" {
+			out = append(out, marker)
+			continue
+		}
+		out = append(out, marker+" "+prefixLines(content, "", strings.Repeat(" ", len(marker)+1))[0:])
+	}
+	return strings.Join(out, separator)
+}
+
+// definitionList converts terms and their definitions
+func (c *converter) definitionList(node *html.Node) []string {
+	var blocks []string
+	var current []string
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		switch child.DataAtom {
+		case atom.Dt:
+			if len(current) > 0 && !strings.HasPrefix(current[len(current)-1], ": ") {
+				current = append(current, paragraphText(c.children(child)))
+				continue
+			}
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+			}
+			current = []string{paragraphText(c.children(child))}
+		case atom.Dd:
+			definition := strings.Join(c.blocks(child), " ")
+			current = append(current, ": "+strings.ReplaceAll(definition, "\n", " "))
+		}
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
+
+// tableCell is a cell of an imported table
+type tableCell struct {
+	text   string
+	header bool
+	align  utils.CellAlign
+}
+
+// tableBlock converts a table to a pipe table, taking the first row as the header
+func (c *converter) tableBlock(node *html.Node) string {
+	c.table = true
+	defer func() { c.table = false }()
+
+	var rows [][]tableCell
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []tableCell
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom != atom.Td && cell.DataAtom != atom.Th {
+						continue
+					}
+					// Header cells are bold already
+					header := cell.DataAtom == atom.Th || child.Parent.DataAtom == atom.Thead
+					bold := c.bold
+					c.bold = c.bold || header
+					text := c.cellText(cell)
+					c.bold = bold
+					row = append(row, tableCell{
+						text:   text,
+						header: header,
+						align:  cellAlign(cell),
+					})
+					span, _ := strconv.Atoi(attr(cell, "colspan"))
+					rowSpan, _ := strconv.Atoi(attr(cell, "rowspan"))
+					if span > 1 || rowSpan > 1 {
+						c.importer.warn("merged table cells were split")
+					}
+					for i := 1; i < span && i < 100; i++ {
+						row = append(row, tableCell{})
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case atom.Table:
+				// Nested tables are flattened into their cell's text
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var header []string
+	var aligns []utils.CellAlign
+	for _, cell := range rows[0] {
+		header = append(header, cell.text)
+		aligns = append(aligns, cell.align)
+	}
+	var body [][]string
+	for _, row := range rows[1:] {
+		var cells []string
+		for i, cell := range row {
+			cells = append(cells, cell.text)
+			if i < len(aligns) && aligns[i] == utils.AlignNone {
+				aligns[i] = cell.align
+			}
+		}
+		body = append(body, cells)
+	}
+	for len(header) < columnCount(rows) {
+		header = append(header, "")
+		aligns = append(aligns, utils.AlignNone)
+	}
+	return strings.Join(utils.FormatPipeTable(header, aligns, body, nil, true), "\n")
+}
+
+// cellText converts a table cell to a single line, joining its blocks with <br>
+func (c *converter) cellText(cell *html.Node) string {
+	var parts []string
+	for _, block := range c.blocks(cell) {
+		block = strings.ReplaceAll(block, "\\\n", "<br>")
+		parts = append(parts, strings.ReplaceAll(block, "\n", "<br>"))
+	}
+	return strings.Join(parts, "<br>")
+}
+
+func cellAlign(cell *html.Node) utils.CellAlign {
+	align := strings.ToLower(attr(cell, "align"))
+	style := strings.ToLower(strings.ReplaceAll(attr(cell, "style"), " ", ""))
+	switch {
+	case align == "center" || strings.Contains(style, "text-align:center"):
+		return utils.AlignCenter
+	case align == "right" || strings.Contains(style, "text-align:right"):
+		return utils.AlignRight
+	}
+	return utils.AlignNone
+}
+
+func columnCount(rows [][]tableCell) int {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	return columns
+}
+
+// codeBlock converts a <pre> element to a fenced code block
+func codeBlock(node *html.Node) string {
+	language := codeLanguage(node)
+	if code := findElement(node, func(n *html.Node) bool { return n.DataAtom == atom.Code }); code != nil && language == "" {
+		language = codeLanguage(code)
+	}
+
+	code := strings.TrimRight(preText(node), "\n")
+	fence := strings.Repeat("`", max(3, longestRun(code, '`')+1))
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+// codeLanguage reads the language from a language-x or lang-x class
+func codeLanguage(node *html.Node) string {
+	for _, class := range strings.Fields(attr(node, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) {
+				return strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+// codeSpan writes inline code, using a fence longer than any backtick run in it
+func codeSpan(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+	fence := strings.Repeat("`", longestRun(text, '`')+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+func longestRun(text string, r rune) int {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == r {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// linkDestination writes a link destination, in angle brackets when it has spaces or parentheses
+func linkDestination(dest string) string {
+	if strings.ContainsAny(dest, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(dest) + ">"
+	}
+	return dest
+}
+
+// escapeText escapes the characters markdown would read as syntax. The
+// formatter drops the escapes that turn out to be unnecessary.
+func escapeText(text string) string {
+	var buf strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\`*_[]<>#|~$", r) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// paragraphText tidies converted inline content into the lines of a
+// paragraph, escaping line starts that would begin another block
+func paragraphText(text string) string {
+	lines := strings.Split(text, "\n")
+	var kept []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "\\" {
+			continue
+		}
+		kept = append(kept, escapeLineStart(line))
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	kept[len(kept)-1] = strings.TrimSpace(strings.TrimSuffix(kept[len(kept)-1], "\\"))
+	return strings.Join(kept, "\n")
+}
+
+var orderedLineStart = regexp.MustCompile(`^(\d+)([.)])(\s|$)`)
+
+// escapeLineStart escapes list markers at the start of a line
+func escapeLineStart(line string) string {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "+ ") || line == "-" || line == "+" {
+		return "\\" + line
+	}
+	if match := orderedLineStart.FindStringSubmatchIndex(line); match != nil {
+		return line[:match[3]] + "\\" + line[match[3]:]
+	}
+	return line
+}
+
+// prefixLines puts first in front of the first line and rest in front of the
+// others, leaving blank lines without trailing spaces
+func prefixLines(text string, first string, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseSpace turns runs of whitespace into single spaces, as browsers do
+func collapseSpace(text string) string {
+	return whitespaceRuns.ReplaceAllString(strings.ReplaceAll(text, "\u00a0", " "), " ")
+}
+
+// textContent returns the text of a node and its descendants
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var buf strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && ignoredElements[child.DataAtom] {
+			continue
+		}
+		buf.WriteString(textContent(child))
+	}
+	return buf.String()
+}
+
+// preText returns the text of preformatted content, with <br> as line breaks
+func preText(node *html.Node) string {
+	var buf strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case child.Type == html.TextNode:
+			buf.WriteString(strings.ReplaceAll(child.Data, "\u00a0", " "))
+		case child.Type == html.ElementNode && child.DataAtom == atom.Br:
+			buf.WriteString("\n")
+		case child.Type == html.ElementNode:
+			buf.WriteString(preText(child))
+		}
+	}
+	return buf.String()
+}
+
+// HTML tree helpers
+
+func attr(node *html.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(node *html.Node, name string) bool {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttr(node *html.Node, name string, value string) {
+	for i, a := range node.Attr {
+		if a.Key == name {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: name, Val: value})
+}
+
+func removeAttr(node *html.Node, name string) {
+	for i, a := range node.Attr {
+		if a.Key == name {
+			node.Attr = append(node.Attr[:i], node.Attr[i+1:]...)
+			return
+		}
+	}
+}
+
+// newElement creates an element node for a tag
+func newElement(tag string, attrs ...string) *html.Node {
+	node := &html.Node{Type: html.ElementNode, Data: tag, DataAtom: atom.Lookup([]byte(tag))}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		setAttr(node, attrs[i], attrs[i+1])
+	}
+	return node
+}
+
+// newText creates a text node
+func newText(text string) *html.Node {
+	return &html.Node{Type: html.TextNode, Data: text}
+}
+
+// findElement returns the first descendant element matching a predicate
+func findElement(node *html.Node, match func(*html.Node) bool) *html.Node {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		if match(child) {
+			return child
+		}
+		if found := findElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// hasBlocks reports whether an element contains block elements
+func hasBlocks(node *html.Node) bool {
+	return findElement(node, func(n *html.Node) bool { return blockElements[n.DataAtom] }) != nil
+}
+
+// isBlank reports whether a node is whitespace or a comment between elements
+func isBlank(node *html.Node) bool {
+	return node.Type == html.CommentNode || (node.Type == html.TextNode && strings.TrimSpace(node.Data) == "")
+}
@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/utils"
+
+	"golang.org/x/net/html"
+)
+
+// Options controls where imported documents keep their images and how the
+// markdown is written
+type Options struct {
+	// SourcePath is the imported file, used to resolve relative images of
+	// HTML files; empty for clipboard HTML
+	SourcePath string `json:"sourcePath"`
+
+	// AssetsDir is the folder embedded and local images are extracted to
+	AssetsDir string `json:"assetsDir"`
+
+	// BaseDir is the folder the markdown is meant to be saved in; image links
+	// are written relative to it
+	BaseDir string `json:"baseDir"`
+
+	// Format is the markdown style to write; the default style when unset
+	Format utils.FormatOptions `json:"format"`
+}
+
+// Importer converts Word documents and HTML into markdown
+type Importer struct {
+	parser  *utils.MarkdownParser
+	options Options
+
+	// unsupported counts the constructs that could not be converted
+	unsupported map[string]int
+	assets      map[string]string
+}
+
+// NewImporter creates an importer
+func NewImporter(parser *utils.MarkdownParser, options Options) *Importer {
+	if options.Format == (utils.FormatOptions{}) {
+		options.Format = utils.DefaultFormatOptions()
+	}
+	return &Importer{parser: parser, options: options}
+}
+
+// IsSupportedFile reports whether a file can be imported, by its extension
+func IsSupportedFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx", ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+// ImportFile converts a .docx or HTML file into markdown
+func (i *Importer) ImportFile(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx":
+		return i.ImportDOCX(path)
+	case ".html", ".htm", ".xhtml":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return i.ImportHTML(string(data))
+	}
+	return "", errors.New("unsupported file type: " + filepath.Ext(path))
+}
+
+// ImportHTML converts an HTML page or fragment, such as clipboard HTML, into markdown
+func (i *Importer) ImportHTML(data string) (string, error) {
+	i.reset()
+	root, err := parseHTML(data)
+	if err != nil {
+		return "", err
+	}
+	return i.markdown(root), nil
+}
+
+// ImportDOCX converts a Word document into markdown
+func (i *Importer) ImportDOCX(path string) (string, error) {
+	i.reset()
+	root, err := i.docxToHTML(path)
+	if err != nil {
+		return "", err
+	}
+	return i.markdown(root), nil
+}
+
+// Warnings returns the constructs the last import could not convert
+func (i *Importer) Warnings() []string {
+	var warnings []string
+	for what, count := range i.unsupported {
+		if count > 1 {
+			what += " (" + strconv.Itoa(count) + " times)"
+		}
+		warnings = append(warnings, what)
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+func (i *Importer) reset() {
+	i.unsupported = map[string]int{}
+	i.assets = map[string]string{}
+}
+
+// warn records a construct that was left out or simplified
+func (i *Importer) warn(what string) {
+	i.unsupported[what]++
+}
+
+// markdown converts an HTML tree and writes it in the canonical markdown style
+func (i *Importer) markdown(root *html.Node) string {
+	c := &converter{importer: i}
+	md := strings.Join(c.blocks(root), "\n\n") + "\n"
+	return utils.NewFormatter(i.parser, i.options.Format).Format(md)
+}
+
+// saveAsset writes an image into the assets folder, once per key, and returns
+// the link to it from the markdown
+func (i *Importer) saveAsset(key string, name string, data []byte) (string, error) {
+	if link, ok := i.assets[key]; ok {
+		return link, nil
+	}
+	if i.options.AssetsDir == "" {
+		return "", errors.New("no folder for images")
+	}
+	if err := os.MkdirAll(i.options.AssetsDir, 0755); err != nil {
+		return "", err
+	}
+
+	// Keep names unique among the files already in the folder, reusing
+	// identical files from an earlier import
+	base := filepath.Base(name)
+	ext := filepath.Ext(base)
+	name = base
+	path := filepath.Join(i.options.AssetsDir, name)
+	for n := 2; ; n++ {
+		existing, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				return "", err
+			}
+			break
+		}
+		if err == nil && bytes.Equal(existing, data) {
+			break
+		}
+		name = strings.TrimSuffix(base, ext) + "-" + strconv.Itoa(n) + ext
+		path = filepath.Join(i.options.AssetsDir, name)
+	}
+
+	link := path
+	if i.options.BaseDir != "" {
+		if rel, err := filepath.Rel(i.options.BaseDir, path); err == nil {
+			link = rel
+		}
+	}
+	link = linkPath(link)
+	i.assets[key] = link
+	return link, nil
+}
+
+// linkPath escapes a file path for use as a markdown link destination
+func linkPath(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for n, segment := range segments {
+		if n == 0 && len(segment) == 2 && segment[1] == ':' {
+			continue // Windows drive letter
+		}
+		segments[n] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
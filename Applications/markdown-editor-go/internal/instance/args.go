@@ -0,0 +1,94 @@
+// Package instance parses the files the editor is launched with and keeps a
+// single running instance, handing the files of later launches to it
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewWindowFlag starts a separate instance instead of handing the files to a
+// running one
+const NewWindowFlag = "--new-window"
+
+// Target is a file or folder to open, with the position to show in a file
+type Target struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`   // 1-based, 0 when not given
+	Column int    `json:"column"` // 1-based, 0 when not given
+	Folder bool   `json:"folder"`
+}
+
+// Launch is what the command line asks the editor to open
+type Launch struct {
+	Targets   []Target `json:"targets"`
+	NewWindow bool     `json:"newWindow"`
+}
+
+// ParseArgs parses the arguments of a launch without a subcommand. Paths are
+// made absolute against dir, so that another instance can open them.
+func ParseArgs(args []string, dir string) (Launch, error) {
+	var launch Launch
+	options := true
+	for _, arg := range args {
+		switch {
+		case options && arg == "--":
+			options = false
+			continue
+		case options && arg == NewWindowFlag:
+			launch.NewWindow = true
+			continue
+		case options && strings.HasPrefix(arg, "-psn_"):
+			// Process serial number added by older macOS versions
+			continue
+		case options && strings.HasPrefix(arg, "-") && arg != "-":
+			return launch, errors.New("unknown option " + arg)
+		}
+
+		target := parseTarget(arg)
+		if !filepath.IsAbs(target.Path) {
+			target.Path = filepath.Join(dir, target.Path)
+		}
+		target.Path = filepath.Clean(target.Path)
+		if info, err := os.Stat(target.Path); err == nil && info.IsDir() {
+			target.Folder = true
+			target.Line, target.Column = 0, 0
+		}
+		launch.Targets = append(launch.Targets, target)
+	}
+	return launch, nil
+}
+
+// parseTarget splits a file:line or file:line:column argument. A path that
+// exists as given is never split, so file names containing colons still open.
+func parseTarget(arg string) Target {
+	if _, err := os.Stat(arg); err == nil {
+		return Target{Path: arg}
+	}
+
+	target := Target{Path: arg}
+	var numbers []int
+	for len(numbers) < 2 {
+		i := strings.LastIndex(target.Path, ":")
+		if i <= 0 {
+			break
+		}
+		n, err := strconv.Atoi(target.Path[i+1:])
+		if err != nil || n < 1 {
+			break
+		}
+		numbers = append([]int{n}, numbers...)
+		target.Path = target.Path[:i]
+	}
+
+	switch len(numbers) {
+	case 1:
+		target.Line = numbers[0]
+	case 2:
+		target.Line, target.Column = numbers[0], numbers[1]
+	}
+	return target
+}
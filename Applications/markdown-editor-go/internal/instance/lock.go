@@ -0,0 +1,142 @@
+package instance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+)
+
+// socketName is the local socket the running instance listens on, in the
+// state folder
+const socketName = "instance.sock"
+
+// lockName is the file held locked while an instance looks for a running one
+// and replaces a stale socket, in the state folder
+const lockName = "instance.lock"
+
+// handoffTimeout bounds how long a launch waits for the running instance to
+// take its files
+const handoffTimeout = 10 * time.Second
+
+// reply the running instance sends once it has taken the files
+const accepted = "ok"
+
+// Lock is held by the running instance. It receives the launches of later
+// instances until it is closed.
+type Lock struct {
+	listener *net.UnixListener
+	path     string
+	lockPath string
+}
+
+// Acquire makes this process the running instance, or hands the launch to the
+// instance already running. forwarded is true when the launch was handed off
+// and this process should exit. An error with no lock means the editor should
+// run without being the single instance.
+func Acquire(launch Launch) (lock *Lock, forwarded bool, err error) {
+	dirs, err := config.Locations()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(dirs.State, 0700); err != nil {
+		return nil, false, err
+	}
+	path := filepath.Join(dirs.State, socketName)
+	lockPath := filepath.Join(dirs.State, lockName)
+
+	// Launches at once take turns, so none removes the socket another has
+	// just created
+	unlock, err := lockFile(lockPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		unlock()
+		return nil, true, forward(conn, launch)
+	}
+	defer unlock()
+
+	// Nobody answers, so a socket file left there is stale
+	os.Remove(path)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, false, err
+	}
+	// The socket is removed in Close, while holding the lock file
+	listener.SetUnlinkOnClose(false)
+	return &Lock{listener: listener, path: path, lockPath: lockPath}, false, nil
+}
+
+// forward sends a launch to the running instance and waits for it to answer
+func forward(conn net.Conn, launch Launch) error {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+
+	data, err := json.Marshal(launch)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return errors.New("the running editor did not answer: " + err.Error())
+	}
+	if reply != accepted+"\n" {
+		return errors.New("the running editor refused the files")
+	}
+	return nil
+}
+
+// Serve passes the launches of later instances to open until the lock is
+// closed. It returns at once; launches are handled one at a time.
+func (l *Lock) Serve(open func(Launch)) {
+	go func() {
+		for {
+			conn, err := l.listener.Accept()
+			if err != nil {
+				// The lock was closed
+				return
+			}
+			l.receive(conn, open)
+		}
+	}()
+}
+
+func (l *Lock) receive(conn net.Conn, open func(Launch)) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var launch Launch
+	if err := json.Unmarshal(line, &launch); err != nil {
+		return
+	}
+	open(launch)
+	conn.Write([]byte(accepted + "\n"))
+}
+
+// Close stops receiving launches and removes the socket
+func (l *Lock) Close() error {
+	unlock, err := lockFile(l.lockPath)
+	if err != nil {
+		// Leave the socket for the next launch to find stale
+		l.listener.Close()
+		return err
+	}
+	defer unlock()
+
+	err = l.listener.Close()
+	os.Remove(l.path)
+	return err
+}
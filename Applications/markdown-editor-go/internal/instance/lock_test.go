@@ -0,0 +1,129 @@
+package instance
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+)
+
+func TestAcquireReplacesAStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.DirEnv, dir)
+	state := filepath.Join(dir, "state")
+	if err := os.MkdirAll(state, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// A socket left behind by an instance that crashed
+	path := filepath.Join(state, socketName)
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	lock, forwarded, err := Acquire(Launch{})
+	if err != nil || forwarded {
+		t.Fatalf("Acquire = %v, forwarded %v, want the lock", err, forwarded)
+	}
+	if err := lock.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the socket is still there after Close: %v", err)
+	}
+}
+
+func TestAcquireWaitsForTheLockFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.DirEnv, dir)
+	state := filepath.Join(dir, "state")
+	if err := os.MkdirAll(state, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(state, socketName)
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockFile(filepath.Join(state, lockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *Lock)
+	go func() {
+		lock, _, err := Acquire(Launch{})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- lock
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Acquire returned while another launch held the lock file")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the socket was removed while another launch held the lock file: %v", err)
+	}
+
+	unlock()
+	if lock := <-done; lock != nil {
+		lock.Close()
+	}
+}
+
+func TestAcquireAtOnce(t *testing.T) {
+	t.Setenv(config.DirEnv, t.TempDir())
+
+	const launches = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		locks    []*Lock
+		received []Launch
+		failures []error
+	)
+	wg.Add(launches)
+	for i := 0; i < launches; i++ {
+		go func(i int) {
+			defer wg.Done()
+			lock, forwarded, err := Acquire(Launch{Targets: []Target{{Path: string(rune('a' + i))}}})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failures = append(failures, err)
+			case !forwarded:
+				locks = append(locks, lock)
+				lock.Serve(func(launch Launch) {
+					mu.Lock()
+					received = append(received, launch)
+					mu.Unlock()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Errorf("failures = %v", failures)
+	}
+	if len(locks) != 1 {
+		t.Fatalf("%d launches became the running instance, want 1", len(locks))
+	}
+	mu.Lock()
+	if len(received) != launches-1 {
+		t.Errorf("the running instance received %d launches, want %d", len(received), launches-1)
+	}
+	mu.Unlock()
+	locks[0].Close()
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package instance
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile waits for an exclusive lock on a file, creating it if needed, and
+// returns the function that releases it
+func lockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,25 @@
+package instance
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile waits for an exclusive lock on a file, creating it if needed, and
+// returns the function that releases it
+func lockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	handle := windows.Handle(file.Fd())
+	if err := windows.LockFileEx(handle, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		windows.UnlockFileEx(handle, 0, 1, 0, new(windows.Overlapped))
+		file.Close()
+	}, nil
+}
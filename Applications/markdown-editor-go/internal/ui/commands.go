@@ -0,0 +1,413 @@
+package ui
+
+import (
+	goruntime "runtime"
+	"strconv"
+	"strings"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/instance"
+
+	"github.com/wailsapp/wails/v2/pkg/menu"
+	"github.com/wailsapp/wails/v2/pkg/menu/keys"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Command is an action of the editor. The registry of commands builds the
+// application menu and fills the command palette. Their shortcuts come from
+// the keymap.
+type Command struct {
+	ID         string
+	Title      string
+	Menu       string      // menu path such as "File/Open Recent", "" for the palette only
+	BeginGroup bool        // separates the command from the ones above it in the menu
+	Enabled    func() bool // nil when always enabled
+	Run        func()
+}
+
+// CommandInfo describes a command to the command palette
+type CommandInfo struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Menu     string `json:"menu"`
+	Shortcut string `json:"shortcut"` // the first keybinding, as the platform shows it
+	Enabled  bool   `json:"enabled"`
+}
+
+// KeybindingInfo describes a keybinding to the frontend, which handles the
+// ones the application menu does not
+type KeybindingInfo struct {
+	Key     string `json:"key"`   // canonical key sequence, such as "Ctrl+K Ctrl+T"
+	Label   string `json:"label"` // the key sequence as the platform shows it
+	Command string `json:"command"`
+	Native  bool   `json:"native"` // handled by the application menu
+}
+
+// recentFileCommand prefixes the IDs of the commands opening recent files
+const recentFileCommand = "file.openRecent."
+
+// Operations of the table commands, run by the frontend. group starts a new
+// group in the menu.
+var tableOperations = []struct {
+	id, title string
+	group     bool
+}{
+	{"format", "Format Table", false},
+	{"insertRowAbove", "Insert Row Above", true},
+	{"insertRowBelow", "Insert Row Below", false},
+	{"deleteRow", "Delete Row", false},
+	{"insertColumnLeft", "Insert Column Left", true},
+	{"insertColumnRight", "Insert Column Right", false},
+	{"deleteColumn", "Delete Column", false},
+	{"moveColumnLeft", "Move Column Left", false},
+	{"moveColumnRight", "Move Column Right", false},
+	{"sortAscending", "Sort Ascending by Column", true},
+	{"sortDescending", "Sort Descending by Column", false},
+	{"transpose", "Transpose", false},
+	{"alignLeft", "Align Column Left", true},
+	{"alignCenter", "Align Column Center", false},
+	{"alignRight", "Align Column Right", false},
+	{"alignNone", "Clear Column Alignment", false},
+}
+
+// newCommands returns the registry of the editor's commands in menu order.
+// Commands that need the editor's state in the frontend are sent to it with
+// the command:run event.
+func (w *MainWindow) newCommands() []Command {
+	commands := []Command{
+		{ID: "file.new", Title: "New", Menu: "File", Run: w.frontendCommand("file.new")},
+		{ID: "file.open", Title: "Open...", Menu: "File", Run: w.frontendCommand("file.open")},
+		{ID: "file.clearRecent", Title: "Clear Recent Files", Menu: "File/Open Recent", BeginGroup: true,
+			Enabled: func() bool { return len(w.currentConfig().RecentFiles) > 0 }, Run: w.clearRecentFiles},
+		{ID: "file.save", Title: "Save", Menu: "File", BeginGroup: true, Run: w.frontendCommand("file.save")},
+		{ID: "file.saveAs", Title: "Save As...", Menu: "File", Run: w.frontendCommand("file.saveAs")},
+		{ID: "file.import", Title: "Import Word/HTML Document...", Menu: "File", BeginGroup: true, Run: w.frontendCommand("file.import")},
+		{ID: "file.importClipboard", Title: "Import Clipboard HTML as New Document", Menu: "File", Run: w.frontendCommand("file.importClipboard")},
+
+		{ID: "edit.undo", Title: "Undo", Menu: "Edit", Run: w.frontendCommand("edit.undo")},
+		{ID: "edit.redo", Title: "Redo", Menu: "Edit", Run: w.frontendCommand("edit.redo")},
+		{ID: "edit.cut", Title: "Cut", Menu: "Edit", BeginGroup: true, Run: w.frontendCommand("edit.cut")},
+		{ID: "edit.copy", Title: "Copy", Menu: "Edit", Run: w.frontendCommand("edit.copy")},
+		{ID: "edit.paste", Title: "Paste", Menu: "Edit", Run: w.frontendCommand("edit.paste")},
+		{ID: "edit.selectAll", Title: "Select All", Menu: "Edit", Run: w.frontendCommand("edit.selectAll")},
+		{ID: "edit.find", Title: "Find", Menu: "Edit", BeginGroup: true, Run: w.frontendCommand("edit.find")},
+		{ID: "edit.replace", Title: "Replace", Menu: "Edit", Run: w.frontendCommand("edit.replace")},
+
+		{ID: "format.document", Title: "Format Document", Menu: "Format", Run: w.frontendCommand("format.document")},
+		{ID: "format.fixLint", Title: "Fix All Lint Issues", Menu: "Format", Run: w.frontendCommand("format.fixLint")},
+		{ID: "format.recalculateTables", Title: "Recalculate All Table Formulas", Menu: "Format", Run: w.frontendCommand("format.recalculateTables")},
+	}
+
+	for _, operation := range tableOperations {
+		commands = append(commands, Command{
+			ID:         "table." + operation.id,
+			Title:      operation.title,
+			Menu:       "Table",
+			BeginGroup: operation.group,
+			Run:        w.frontendCommand("table." + operation.id),
+		})
+	}
+	commands = append(commands,
+		Command{ID: "table.pasteAsTable", Title: "Paste Clipboard as Table", Menu: "Table", BeginGroup: true, Run: w.frontendCommand("table.pasteAsTable")},
+		Command{ID: "table.copyAsCSV", Title: "Copy Table as CSV", Menu: "Table", Run: w.frontendCommand("table.copyAsCSV")},
+		Command{ID: "table.copyAsTSV", Title: "Copy Table as TSV", Menu: "Table", Run: w.frontendCommand("table.copyAsTSV")},
+		Command{ID: "table.exportCSV", Title: "Export Table to CSV...", Menu: "Table", Run: w.frontendCommand("table.exportCSV")},
+		Command{ID: "table.exportTSV", Title: "Export Table to TSV...", Menu: "Table", Run: w.frontendCommand("table.exportTSV")},
+		Command{ID: "table.recalculate", Title: "Recalculate Formulas", Menu: "Table", BeginGroup: true, Run: w.frontendCommand("table.recalculate")},
+
+		Command{ID: "export.html", Title: "Export to HTML...", Menu: "Export", Run: func() { w.ExportHTML(false, "") }},
+		Command{ID: "export.htmlWithTOC", Title: "Export to HTML with Table of Contents...", Menu: "Export", Run: func() { w.ExportHTML(true, "") }},
+		Command{ID: "export.pdf", Title: "Export to PDF...", Menu: "Export", Run: func() { w.ExportPDF("", false) }},
+		Command{ID: "export.pdfLetter", Title: "Export to PDF (Letter)...", Menu: "Export", Run: func() { w.ExportPDF("Letter", false) }},
+		Command{ID: "export.docx", Title: "Export to Word...", Menu: "Export", Run: func() { w.ExportDOCX() }},
+		Command{ID: "export.latex", Title: "Export to LaTeX...", Menu: "Export", Run: func() { w.ExportLaTeX() }},
+		Command{ID: "export.epub", Title: "Export to EPUB...", Menu: "Export", Run: func() { w.ExportEPUB() }},
+		Command{ID: "export.epubWorkspace", Title: "Export Folder as EPUB Book...", Menu: "Export",
+			Enabled: func() bool { return w.workspaceDir() != "" }, Run: func() { w.ExportWorkspaceEPUB() }},
+		Command{ID: "export.slides", Title: "Export Slides to HTML...", Menu: "Export", Run: func() { w.ExportSlides() }},
+		Command{ID: "export.copyConfluence", Title: "Copy as Confluence Storage Format", Menu: "Export", BeginGroup: true, Run: w.frontendCommand("export.copyConfluence")},
+		Command{ID: "export.copyJira", Title: "Copy as Jira Markup", Menu: "Export", Run: w.frontendCommand("export.copyJira")},
+		Command{ID: "export.copyMediaWiki", Title: "Copy as MediaWiki", Menu: "Export", Run: w.frontendCommand("export.copyMediaWiki")},
+		Command{ID: "export.copyAsciiDoc", Title: "Copy as AsciiDoc", Menu: "Export", Run: w.frontendCommand("export.copyAsciiDoc")},
+		Command{ID: "export.docxReference", Title: "Choose Word Reference Document...", Menu: "Export", BeginGroup: true, Run: func() { w.ChooseDOCXReferenceDoc() }},
+		Command{ID: "export.docxClearReference", Title: "Use Built-in Word Styles", Menu: "Export",
+			Enabled: func() bool { return w.currentConfig().DOCXReferenceDoc != "" }, Run: w.ClearDOCXReferenceDoc},
+		Command{ID: "export.latexTemplate", Title: "Choose LaTeX Template...", Menu: "Export", Run: func() { w.ChooseLaTeXTemplate() }},
+		Command{ID: "export.latexClearTemplate", Title: "Use Built-in LaTeX Template", Menu: "Export",
+			Enabled: func() bool { return w.currentConfig().LaTeXTemplate != "" }, Run: w.ClearLaTeXTemplate},
+
+		Command{ID: "view.commandPalette", Title: "Command Palette...", Menu: "View", Run: w.frontendCommand("view.commandPalette")},
+		Command{ID: "view.toggleTheme", Title: "Toggle Dark Mode", Menu: "View", BeginGroup: true, Run: w.ToggleTheme},
+		Command{ID: "view.importTheme", Title: "Import VS Code or TextMate Theme...", Menu: "View", Run: func() { w.ImportTheme() }},
+		Command{ID: "view.toggleAutoSave", Title: "Toggle Autosave", Menu: "View", Run: w.frontendCommand("view.toggleAutoSave")},
+		Command{ID: "view.slideshow", Title: "Start Slideshow", Menu: "View", BeginGroup: true, Run: w.frontendCommand("view.slideshow")},
+		Command{ID: "view.presenter", Title: "Presenter View", Menu: "View", Run: w.frontendCommand("view.presenter")},
+	)
+	return commands
+}
+
+// commandList returns the registry with the recent files, which change as
+// files are opened, ahead of the command clearing them
+func (w *MainWindow) commandList() []Command {
+	var commands []Command
+	for _, command := range w.commands {
+		if command.ID == "file.clearRecent" {
+			commands = append(commands, w.recentFileCommands()...)
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// recentFileCommands returns a command opening each recent file
+func (w *MainWindow) recentFileCommands() []Command {
+	recent := w.currentConfig().RecentFiles
+	commands := make([]Command, 0, len(recent))
+	for i, path := range recent {
+		path := path
+		commands = append(commands, Command{
+			ID:    recentFileCommand + strconv.Itoa(i),
+			Title: path,
+			Menu:  "File/Open Recent",
+			Run:   func() { w.requestOpen(instance.Target{Path: path}) },
+		})
+	}
+	return commands
+}
+
+// frontendCommand returns a handler that has the frontend run a command
+func (w *MainWindow) frontendCommand(id string) func() {
+	return func() {
+		runtime.EventsEmit(w.ctx, "command:run", id)
+	}
+}
+
+// GetCommands returns the commands for the command palette
+func (w *MainWindow) GetCommands() []CommandInfo {
+	commands := w.commandList()
+	keymap := w.currentKeymap()
+	infos := make([]CommandInfo, 0, len(commands))
+	for _, command := range commands {
+		title := command.Title
+		if strings.HasPrefix(command.ID, recentFileCommand) {
+			title = "Open Recent: " + title
+		}
+		info := CommandInfo{
+			ID:      command.ID,
+			Title:   title,
+			Menu:    command.Menu,
+			Enabled: command.Enabled == nil || command.Enabled(),
+		}
+		if bindings := keymap.For(command.ID); len(bindings) > 0 {
+			info.Shortcut = keymap.Label(bindings[0].Sequence)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// RunCommand runs a command chosen in the command palette
+func (w *MainWindow) RunCommand(id string) bool {
+	for _, command := range w.commandList() {
+		if command.ID != id {
+			continue
+		}
+		if command.Enabled != nil && !command.Enabled() {
+			return false
+		}
+		command.Run()
+		return true
+	}
+	runtime.EventsEmit(w.ctx, "error", "Unknown command "+id)
+	return false
+}
+
+// ApplicationMenu builds the application menu from the window's commands
+func ApplicationMenu(w *MainWindow) *menu.Menu {
+	appMenu := menu.NewMenu()
+	if goruntime.GOOS == "darwin" {
+		appMenu.Append(menu.AppMenu())
+	}
+
+	submenus := map[string]*menu.Menu{}
+	var submenu func(path string) *menu.Menu
+	submenu = func(path string) *menu.Menu {
+		if m, ok := submenus[path]; ok {
+			return m
+		}
+		parent, label := appMenu, path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, label = submenu(path[:i]), path[i+1:]
+		}
+		m := parent.AddSubmenu(label)
+		submenus[path] = m
+		return m
+	}
+
+	keymap := w.currentKeymap()
+	for _, command := range w.commandList() {
+		if command.Menu == "" {
+			continue
+		}
+		m := submenu(command.Menu)
+		if command.BeginGroup && len(m.Items) > 0 {
+			m.AddSeparator()
+		}
+		_, accelerator := w.menuAccelerator(keymap, command.ID)
+		run := command.Run
+		item := m.AddText(command.Title, accelerator, func(*menu.CallbackData) { run() })
+		if command.Enabled != nil && !command.Enabled() {
+			item.Disable()
+		}
+	}
+
+	if goruntime.GOOS == "darwin" {
+		appMenu.Append(menu.WindowMenu())
+	}
+	return appMenu
+}
+
+// GetKeybindings returns the keybindings in effect
+func (w *MainWindow) GetKeybindings() []KeybindingInfo {
+	keymap := w.currentKeymap()
+	infos := make([]KeybindingInfo, 0, len(keymap.Bindings))
+	for _, binding := range keymap.Bindings {
+		native, _ := w.menuAccelerator(keymap, binding.Command)
+		infos = append(infos, KeybindingInfo{
+			Key:     keymap.Format(binding.Sequence),
+			Label:   keymap.Label(binding.Sequence),
+			Command: binding.Command,
+			Native:  native != nil && keymap.Format(native.Sequence) == keymap.Format(binding.Sequence),
+		})
+	}
+	return infos
+}
+
+// menuAccelerator returns the binding of a command shown in the application
+// menu, which handles it: the first one of a single chord the menu can show
+func (w *MainWindow) menuAccelerator(keymap *config.Keymap, id string) (*config.Binding, *keys.Accelerator) {
+	if !w.inMenu(id) {
+		return nil, nil
+	}
+	for _, binding := range keymap.For(id) {
+		if len(binding.Sequence) != 1 {
+			continue
+		}
+		if accelerator := wailsAccelerator(binding.Sequence[0], keymap.GOOS); accelerator != nil {
+			binding := binding
+			return &binding, accelerator
+		}
+	}
+	return nil, nil
+}
+
+// inMenu reports whether a command is in the application menu
+func (w *MainWindow) inMenu(id string) bool {
+	for _, command := range w.commandList() {
+		if command.ID == id {
+			return command.Menu != ""
+		}
+	}
+	return false
+}
+
+// hasCommand reports whether a command is in the registry
+func (w *MainWindow) hasCommand(id string) bool {
+	for _, command := range w.commands {
+		if command.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Names of the keys of accelerators, by the keymap's names
+var acceleratorKeys = map[string]string{
+	"Enter": "enter", "Escape": "escape", "Tab": "tab", "Space": "space",
+	"Backspace": "backspace", "Delete": "delete", "Home": "home", "End": "end",
+	"PageUp": "page up", "PageDown": "page down", "Up": "up", "Down": "down",
+	"Left": "left", "Right": "right",
+}
+
+// wailsAccelerator converts a chord to a menu accelerator, or returns nil when
+// menus cannot show it
+func wailsAccelerator(chord config.Chord, goos string) *keys.Accelerator {
+	var accelerator keys.Accelerator
+	switch {
+	case goos == "darwin":
+		if chord.Meta {
+			accelerator.Modifiers = append(accelerator.Modifiers, keys.CmdOrCtrlKey)
+		}
+		if chord.Ctrl {
+			accelerator.Modifiers = append(accelerator.Modifiers, keys.ControlKey)
+		}
+	case chord.Meta:
+		// Menus elsewhere have no Meta modifier
+		return nil
+	case chord.Ctrl:
+		accelerator.Modifiers = append(accelerator.Modifiers, keys.CmdOrCtrlKey)
+	}
+	if chord.Alt {
+		accelerator.Modifiers = append(accelerator.Modifiers, keys.OptionOrAltKey)
+	}
+	if chord.Shift {
+		accelerator.Modifiers = append(accelerator.Modifiers, keys.ShiftKey)
+	}
+
+	switch {
+	case acceleratorKeys[chord.Key] != "":
+		accelerator.Key = acceleratorKeys[chord.Key]
+	case len(chord.Key) == 1 || chord.Key[0] == 'F':
+		accelerator.Key = strings.ToLower(chord.Key)
+	default:
+		return nil
+	}
+	return &accelerator
+}
+
+// currentKeymap returns the keybindings in effect. A keymap is not changed
+// once made, so it can be used after the lock is released.
+func (w *MainWindow) currentKeymap() *config.Keymap {
+	w.keymapMu.Lock()
+	defer w.keymapMu.Unlock()
+	return w.keymap
+}
+
+// loadKeymap resolves the keybindings of the configuration, reporting the
+// ones that cannot be used
+func (w *MainWindow) loadKeymap() {
+	cfg := w.currentConfig()
+	keymap, problems := cfg.Keymap(goruntime.GOOS, w.hasCommand)
+	w.keymapMu.Lock()
+	w.keymap = keymap
+	w.keymapMu.Unlock()
+	if w.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(w.ctx, "keybindings:update")
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		runtime.LogWarning(w.ctx, "Keybindings: "+problem)
+	}
+	runtime.EventsEmit(w.ctx, "status:update", "Some keybindings were ignored ("+strings.Join(problems, "; ")+")")
+}
+
+// refreshMenu rebuilds the application menu after the recent files or the
+// state of commands changed
+func (w *MainWindow) refreshMenu() {
+	if w.ctx == nil {
+		return
+	}
+	runtime.MenuSetApplicationMenu(w.ctx, ApplicationMenu(w))
+	runtime.MenuUpdateApplicationMenu(w.ctx)
+}
+
+// clearRecentFiles empties the recent files
+func (w *MainWindow) clearRecentFiles() {
+	w.updateConfig(func(c *config.Config) {
+		c.RecentFiles = []string{}
+	})
+	w.refreshMenu()
+}
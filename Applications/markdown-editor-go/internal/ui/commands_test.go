@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/instance"
+)
+
+func TestApplicationMenuHasEditMenu(t *testing.T) {
+	t.Setenv(config.DirEnv, t.TempDir())
+	w := NewMainWindow(instance.Launch{}, nil)
+
+	var items map[string]bool
+	accelerators := map[string]bool{}
+	for _, item := range ApplicationMenu(w).Items {
+		if item.Label != "Edit" || item.SubMenu == nil {
+			continue
+		}
+		if items != nil {
+			t.Fatal("two Edit menus")
+		}
+		items = map[string]bool{}
+		for _, entry := range item.SubMenu.Items {
+			items[entry.Label] = true
+			accelerators[entry.Label] = entry.Accelerator != nil
+		}
+	}
+	if items == nil {
+		t.Fatal("no Edit menu")
+	}
+	for _, label := range []string{"Undo", "Redo", "Cut", "Copy", "Paste", "Select All", "Find", "Replace"} {
+		if !items[label] {
+			t.Errorf("the Edit menu has no %s item", label)
+		} else if !accelerators[label] {
+			t.Errorf("%s has no shortcut in the Edit menu", label)
+		}
+	}
+}
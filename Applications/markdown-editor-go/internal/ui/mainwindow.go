@@ -2,34 +2,117 @@ package ui
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/francescoizzo/markdown-editor-go/internal/config"
 	"github.com/francescoizzo/markdown-editor-go/internal/editor"
+	"github.com/francescoizzo/markdown-editor-go/internal/export"
+	"github.com/francescoizzo/markdown-editor-go/internal/importer"
+	"github.com/francescoizzo/markdown-editor-go/internal/instance"
 	"github.com/francescoizzo/markdown-editor-go/internal/ui/theme"
 	"github.com/francescoizzo/markdown-editor-go/internal/utils"
 
+	"github.com/gomarkdown/markdown/html"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// appearanceInterval is how often the schedule is checked, and the system's
+// appearance where it cannot be watched
+const appearanceInterval = 5 * time.Second
+
 // MainWindow represents the main application window
 type MainWindow struct {
-	ctx       context.Context
-	config    *config.Config
+	ctx context.Context
+
+	// The user's configuration. Bound methods and the watcher of the settings
+	// files change it from goroutines of their own, so it is read with
+	// currentConfig and changed with updateConfig or setConfig.
+	configMu sync.Mutex
+	config   *config.Config
+
 	editor    *editor.Editor
 	theme     *theme.Theme
-	parser    *utils.MarkdownParser
 	fileUtils *utils.FileUtils
+
+	// Files from the command line waiting for the frontend to open them
+	openMu       sync.Mutex
+	openRequests []instance.Target
+	lock         *instance.Lock
+
+	// Registry of the commands in the menu and the command palette, and the
+	// keybindings running them. The settings watcher replaces the keymap, so
+	// it is read with currentKeymap.
+	commands []Command
+	keymapMu sync.Mutex
+	keymap   *config.Keymap
+
+	// What was wrong with the configuration when it was loaded
+	configProblems []string
+
+	// The settings last resolved for the current document, what was last
+	// reported wrong with them, and the watcher of the files they come from.
+	// They are used again while the document's folder and front matter are
+	// the same and settingsVersion, which changes with the configuration and
+	// the files, is the one they were resolved at.
+	settingsMu       sync.Mutex
+	lastSettings     *config.Settings
+	settingsDir      string
+	settingsMatter   utils.FrontMatter
+	settingsVersion  int
+	resolvedVersion  int
+	settingsProblems string
+	watcher          *config.Watcher
+
+	// The watcher of the theme files, and what was wrong with them when they
+	// were loaded. Loading the themes and applying those of the configuration
+	// happen in the watchers' goroutines as well as in bound methods, so they
+	// hold themesMu to run one at a time.
+	themesMu      sync.Mutex
+	themeWatcher  *config.Watcher
+	themeProblems []string
+
+	// The appearance the web view last reported, used where the system
+	// cannot be asked, and the stop of the check for the system's appearance
+	// and the schedule
+	appearanceMu    sync.Mutex
+	webViewDark     bool
+	webViewReported bool
+	appearanceDone  chan struct{}
 }
 
-// NewMainWindow creates a new main window instance
-func NewMainWindow() *MainWindow {
-	return &MainWindow{
-		config:    config.DefaultConfig(),
-		editor:    editor.NewEditor(),
-		theme:     theme.NewTheme(),
-		parser:    utils.NewMarkdownParser(),
-		fileUtils: &utils.FileUtils{},
+// EditorSettings are the settings in effect for the current document that
+// the frontend applies to the editor
+type EditorSettings struct {
+	FontSize    int    `json:"fontSize"`
+	FontFamily  string `json:"fontFamily"`
+	TabSize     int    `json:"tabSize"`
+	LineNumbers bool   `json:"lineNumbers"`
+}
+
+// NewMainWindow creates a new main window instance that opens the files it was
+// launched with. When it holds the instance lock, later launches hand their
+// files to it.
+func NewMainWindow(launch instance.Launch, lock *instance.Lock) *MainWindow {
+	w := &MainWindow{
+		config:       config.DefaultConfig(),
+		editor:       editor.NewEditor(),
+		theme:        theme.NewTheme(),
+		fileUtils:    &utils.FileUtils{},
+		openRequests: launch.Targets,
+		lock:         lock,
 	}
+	w.commands = w.newCommands()
+	w.loadKeymap()
+	w.editor.SetRenderer(w.renderPreview)
+	return w
 }
 
 // OnStartup is called when the app starts
@@ -40,14 +123,36 @@ func (w *MainWindow) OnStartup(ctx context.Context) {
 	w.editor.OnStartup(ctx)
 	w.theme.Initialize(ctx)
 
-	// Load configuration
-	err := w.config.Load()
+	// Load configuration, keeping what was wrong with it to report once the
+	// frontend can show it
+	w.configMu.Lock()
+	problems, err := w.config.Load()
+	w.configMu.Unlock()
+	w.invalidateSettings()
 	if err != nil {
 		runtime.LogError(ctx, "Failed to load configuration: "+err.Error())
+		problems = append(problems, err.Error())
+	}
+	for _, problem := range problems {
+		runtime.LogWarning(ctx, "Configuration: "+problem)
 	}
+	w.configProblems = problems
+
+	// Load the user's themes, reloading them when they change
+	w.themeWatcher = config.NewWatcher(w.themeFilesChanged)
+	w.themesMu.Lock()
+	w.themeProblems = w.loadThemes()
+	w.themesMu.Unlock()
 
 	// Apply configuration
 	w.applyConfiguration()
+
+	// Apply the changes made to the settings files while the editor runs
+	w.watcher = config.NewWatcher(w.settingsFilesChanged)
+
+	// Follow the system's appearance or the schedule
+	w.appearanceDone = make(chan struct{})
+	go w.followAppearance()
 }
 
 // OnDomReady is called when the DOM is ready
@@ -55,19 +160,43 @@ func (w *MainWindow) OnDomReady(ctx context.Context) {
 	w.editor.OnDomReady(ctx)
 
 	// Set initial theme
+	w.themesMu.Lock()
 	w.theme.SetTheme(w.getThemeFromConfig())
+	w.themesMu.Unlock()
 
 	// Set window size from config
-	runtime.WindowSetSize(ctx, w.config.WindowWidth, w.config.WindowHeight)
+	cfg := w.currentConfig()
+	runtime.WindowSetSize(ctx, cfg.WindowWidth, cfg.WindowHeight)
+
+	// Show the keybindings and recent files from the configuration in the
+	// menu, reporting keybindings that cannot be used
+	w.loadKeymap()
+	w.refreshMenu()
+
+	if len(w.configProblems) > 0 {
+		runtime.EventsEmit(ctx, "status:update", "Some settings were changed ("+strings.Join(w.configProblems, "; ")+")")
+		w.configProblems = nil
+	}
+	if len(w.themeProblems) > 0 {
+		runtime.EventsEmit(ctx, "status:update", "Some themes were left out ("+strings.Join(w.themeProblems, "; ")+")")
+		w.themeProblems = nil
+	}
+	w.settings()
+
+	// Take the files of later launches once the frontend can open them
+	if w.lock != nil {
+		w.lock.Serve(w.receiveLaunch)
+	}
 }
 
 // OnBeforeClose is called when the app is about to close
 func (w *MainWindow) OnBeforeClose(ctx context.Context) bool {
 	// Save window size to config
 	width, height := runtime.WindowGetSize(ctx)
-	w.config.WindowWidth = width
-	w.config.WindowHeight = height
-	w.config.Save()
+	w.updateConfig(func(c *config.Config) {
+		c.WindowWidth = width
+		c.WindowHeight = height
+	})
 
 	// Ask editor if it's OK to close (e.g., unsaved changes)
 	return w.editor.OnBeforeClose(ctx)
@@ -75,70 +204,292 @@ func (w *MainWindow) OnBeforeClose(ctx context.Context) bool {
 
 // OnShutdown is called when the app is shutting down
 func (w *MainWindow) OnShutdown(ctx context.Context) {
+	if w.watcher != nil {
+		w.watcher.Close()
+	}
+	if w.themeWatcher != nil {
+		w.themeWatcher.Close()
+	}
+	if w.appearanceDone != nil {
+		close(w.appearanceDone)
+	}
+	if w.lock != nil {
+		w.lock.Close()
+	}
 	w.editor.OnShutdown(ctx)
 }
 
 // NewFile creates a new file
 func (w *MainWindow) NewFile() {
 	w.editor.NewFile()
+	w.refreshMenu()
 }
 
 // OpenFile opens a markdown file
 func (w *MainWindow) OpenFile() bool {
 	success := w.editor.OpenFile()
 	if success {
-		// Add to recent files in config
-		if w.editor.GetCurrentFilePath() != "" {
-			w.config.AddRecentFile(w.editor.GetCurrentFilePath())
-			w.config.Save()
-		}
+		w.addRecentFile()
+	}
+	return success
+}
+
+// OpenPath opens the file at a path, such as one given on the command line
+func (w *MainWindow) OpenPath(path string) bool {
+	success := w.editor.OpenPath(path)
+	if success {
+		w.addRecentFile()
+	}
+	return success
+}
+
+// OpenFolder opens a markdown file chosen in a dialog that starts in a folder
+func (w *MainWindow) OpenFolder(dir string) bool {
+	success := w.editor.OpenFileFrom(dir)
+	if success {
+		w.addRecentFile()
 	}
 	return success
 }
 
+// SwitchDocument makes a document open in another tab the current one
+func (w *MainWindow) SwitchDocument(path string, content string, unsaved bool) {
+	w.editor.SwitchTo(path, content, unsaved)
+}
+
+// GetCurrentFilePath returns the path of the current document, or "" when it
+// has not been saved yet
+func (w *MainWindow) GetCurrentFilePath() string {
+	return w.editor.GetCurrentFilePath()
+}
+
+// TakeOpenRequests returns the files and folders the editor was asked to open
+// on the command line since the last call
+func (w *MainWindow) TakeOpenRequests() []instance.Target {
+	w.openMu.Lock()
+	defer w.openMu.Unlock()
+	targets := w.openRequests
+	w.openRequests = nil
+	return targets
+}
+
 // SaveFile saves the current file
 func (w *MainWindow) SaveFile() bool {
+	w.recalculateOnSave()
+	w.formatOnSave()
 	return w.editor.SaveFile()
 }
 
 // SaveFileAs prompts for a filename and saves
 func (w *MainWindow) SaveFileAs() bool {
+	w.recalculateOnSave()
+	w.formatOnSave()
 	success := w.editor.SaveFileAs()
 	if success {
-		// Add to recent files in config
-		if w.editor.GetCurrentFilePath() != "" {
-			w.config.AddRecentFile(w.editor.GetCurrentFilePath())
-			w.config.Save()
-		}
+		w.addRecentFile()
 	}
 	return success
 }
 
-// ToggleTheme switches between light and dark mode
+// ToggleTheme switches between light and dark mode. Toggling while the mode
+// follows the system or the schedule switches to manual mode.
 func (w *MainWindow) ToggleTheme() {
+	w.themesMu.Lock()
 	w.theme.ToggleTheme()
-	w.config.IsDarkMode = w.theme.IsDarkMode()
-	w.config.Save()
+	w.themesMu.Unlock()
+	wasManual := true
+	w.updateConfig(func(c *config.Config) {
+		c.IsDarkMode = w.theme.IsDarkMode()
+		wasManual = c.ThemeMode == theme.ModeManual
+		c.ThemeMode = theme.ModeManual
+	})
+	if !wasManual {
+		runtime.EventsEmit(w.ctx, "status:update", "Theme mode set to manual")
+	}
+}
+
+// IsDarkMode returns whether dark mode is in use
+func (w *MainWindow) IsDarkMode() bool {
+	return w.theme.IsDarkMode()
+}
+
+// ReportSystemAppearance takes the appearance the web view reports with
+// prefers-color-scheme, which the system mode follows where the system
+// cannot be asked directly
+func (w *MainWindow) ReportSystemAppearance(dark bool) {
+	w.appearanceMu.Lock()
+	w.webViewDark, w.webViewReported = dark, true
+	w.appearanceMu.Unlock()
+	w.updateAppearance()
+}
+
+// GetThemes returns the built-in themes and the user's themes
+func (w *MainWindow) GetThemes() []theme.Definition {
+	return w.theme.Themes()
+}
+
+// GetTheme returns the theme in use: its interface colors, editor colors and
+// preview typography
+func (w *MainWindow) GetTheme() theme.Definition {
+	return w.theme.GetCurrentDefinition()
+}
+
+// SelectTheme makes a theme the theme of dark mode when it is dark and of light
+// mode otherwise. In manual mode it also switches to that mode.
+func (w *MainWindow) SelectTheme(id string) bool {
+	definition, ok := w.theme.Find(id)
+	if !ok {
+		runtime.EventsEmit(w.ctx, "error", "There is no theme "+id)
+		return false
+	}
+	err := w.updateConfig(func(c *config.Config) {
+		if definition.Dark {
+			c.DarkTheme = id
+		} else {
+			c.LightTheme = id
+		}
+		if c.ThemeMode == theme.ModeManual {
+			c.IsDarkMode = definition.Dark
+		}
+	})
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to save settings: "+err.Error())
+	}
+	w.applySettingsChanges(nil)
+	return true
+}
+
+// ImportTheme converts a VS Code color theme or a TextMate theme into a theme
+// file in the themes folder and switches to it. What could not be mapped is
+// reported with the import:report event.
+func (w *MainWindow) ImportTheme() bool {
+	filePath, err := runtime.OpenFileDialog(w.ctx, runtime.OpenDialogOptions{
+		Title: "Import Theme",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "VS Code and TextMate Themes (*.json;*.tmTheme)",
+				Pattern:     "*.json;*.jsonc;*.tmTheme;*.plist",
+			},
+		},
+	})
+	if err != nil || filePath == "" {
+		// User cancelled
+		return false
+	}
+	if !theme.IsImportableFile(filePath) {
+		runtime.EventsEmit(w.ctx, "error", "Cannot import "+filepath.Base(filePath)+": only VS Code and TextMate themes are supported")
+		return false
+	}
+
+	definition, report, err := theme.ImportFile(filePath)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to import "+filepath.Base(filePath)+": "+err.Error())
+		return false
+	}
+	dir, err := config.ThemesDir()
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to find the themes folder: "+err.Error())
+		return false
+	}
+
+	// Keep the themes already there, numbering the new one's file
+	id := definition.ID
+	for i := 2; ; i++ {
+		if _, ok := w.theme.Find(id); !ok {
+			break
+		}
+		id = definition.ID + "-" + strconv.Itoa(i)
+	}
+	themePath := filepath.Join(dir, id+".json")
+	if err := theme.WriteFile(themePath, definition); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to save theme: "+err.Error())
+		return false
+	}
+	w.themesMu.Lock()
+	w.loadThemes()
+	w.themesMu.Unlock()
+	w.SelectTheme(id)
+	runtime.EventsEmit(w.ctx, "themes:update", w.theme.Themes())
+
+	for _, item := range report {
+		runtime.LogWarning(w.ctx, "Theme import: "+item)
+	}
+	message := "Imported theme " + definition.Name + " to " + themePath
+	if len(report) > 0 {
+		message += " (" + strings.Join(report, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", message)
+	runtime.EventsEmit(w.ctx, "import:report", report)
+	return true
 }
 
 // ToggleAutoSave enables or disables autosave
 func (w *MainWindow) ToggleAutoSave() bool {
 	enabled := w.editor.ToggleAutoSave()
-	w.config.AutoSaveEnabled = enabled
-	w.config.Save()
+	w.updateConfig(func(c *config.Config) {
+		c.AutoSaveEnabled = enabled
+	})
 	return enabled
 }
 
-// SetAutoSaveDelay updates the autosave delay
-func (w *MainWindow) SetAutoSaveDelay(seconds int) {
-	w.editor.SetAutoSaveDelay(seconds)
-	w.config.AutoSaveDelay = seconds
-	w.config.Save()
+// SetAutoSaveDelay updates the autosave delay. Delays outside the limits of
+// the settings schema are rejected.
+func (w *MainWindow) SetAutoSaveDelay(seconds int) error {
+	problems, err := w.setConfig("autoSaveDelay", float64(seconds))
+	if err != nil {
+		return err
+	}
+	w.editor.SetAutoSaveDelay(w.currentConfig().AutoSaveDelay)
+	w.applySettingsChanges(problems)
+	return nil
 }
 
 // GetRecentFiles returns the list of recent files
 func (w *MainWindow) GetRecentFiles() []string {
-	return w.config.RecentFiles
+	return w.currentConfig().RecentFiles
+}
+
+// GetEditorSettings returns the editor settings in effect for the current
+// document
+func (w *MainWindow) GetEditorSettings() EditorSettings {
+	settings := w.settings()
+	return EditorSettings{
+		FontSize:    settings.Config.FontSize,
+		FontFamily:  settings.Config.FontFamily,
+		TabSize:     settings.Config.TabSize,
+		LineNumbers: settings.Config.LineNumbers,
+	}
+}
+
+// GetEffectiveSettings returns every setting in effect for the current
+// document, with the layer that set it: the defaults, the user's
+// configuration, the workspace's settings or the document's front matter
+func (w *MainWindow) GetEffectiveSettings() []config.Setting {
+	return w.settings().List()
+}
+
+// GetSettingsSchema describes every setting a preferences screen edits: its
+// type, limits, choices, default, category and description
+func (w *MainWindow) GetSettingsSchema() []config.SettingSchema {
+	return config.SettingsSchema()
+}
+
+// GetSettings returns the user's value of every setting in the schema
+func (w *MainWindow) GetSettings() map[string]interface{} {
+	cfg := w.currentConfig()
+	return cfg.Values()
+}
+
+// UpdateSetting changes a setting in the user's configuration, saves it and
+// applies it. Invalid values are rejected with an error.
+func (w *MainWindow) UpdateSetting(key string, value interface{}) bool {
+	problems, err := w.setConfig(key, value)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Settings: "+err.Error())
+		return false
+	}
+	w.applySettingsChanges(problems)
+	return true
 }
 
 // SetContent updates the editor content
@@ -154,31 +505,1037 @@ func (w *MainWindow) GetContent() string {
 // GetWordCount returns the word count for the current content
 func (w *MainWindow) GetWordCount() int {
 	content := w.editor.GetContent()
-	return w.parser.WordCount(content)
+	return w.newParser().WordCount(content)
 }
 
 // ExtractTOC generates a table of contents from the markdown
 func (w *MainWindow) ExtractTOC() string {
 	content := w.editor.GetContent()
-	return w.parser.ExtractTOC(content)
+	return w.newParser().ExtractTOC(content)
+}
+
+// LintDocument checks the current content against the workspace lint rules
+func (w *MainWindow) LintDocument() []utils.Diagnostic {
+	return w.newLinter().Lint(w.editor.GetContent())
+}
+
+// GetLintFixes returns the edits that autofix the current lint issues
+func (w *MainWindow) GetLintFixes() []utils.TextEdit {
+	linter := w.newLinter()
+	return linter.Fixes(linter.Lint(w.editor.GetContent()))
+}
+
+// GetLintRules returns the available lint rules
+func (w *MainWindow) GetLintRules() []utils.LintRule {
+	return w.newLinter().Rules()
+}
+
+// FormatDocument rewrites the current content in the canonical style and
+// returns the edits the frontend should apply
+func (w *MainWindow) FormatDocument() []utils.TextEdit {
+	edits := w.newFormatter().FormatEdits(w.editor.GetContent())
+	w.applyDocumentEdits(edits)
+	return edits
+}
+
+// SetFormatOnSave enables or disables formatting the document when saving
+func (w *MainWindow) SetFormatOnSave(enabled bool) {
+	w.updateConfig(func(c *config.Config) {
+		c.FormatOnSave = enabled
+	})
+}
+
+// GetFormatOnSave returns whether the document is formatted when saving
+func (w *MainWindow) GetFormatOnSave() bool {
+	return w.currentConfig().FormatOnSave
+}
+
+// EditTable applies a table operation to the table at the cursor and returns
+// the edits the frontend should apply
+func (w *MainWindow) EditTable(line int, column int, operation string) []utils.TextEdit {
+	edits, err := utils.EditTable(w.editor.GetContent(), utils.Position{Line: line, Column: column}, operation)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Table: "+err.Error())
+		return []utils.TextEdit{}
+	}
+
+	w.applyDocumentEdits(edits)
+	return edits
+}
+
+// RecalculateTable evaluates the TBLFM formulas of the table at the cursor and
+// returns the edits the frontend should apply
+func (w *MainWindow) RecalculateTable(line int, column int) []utils.TextEdit {
+	edits, err := utils.EvaluateTableFormulas(w.editor.GetContent(), line)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Table formula: "+err.Error())
+		return []utils.TextEdit{}
+	}
+
+	w.applyDocumentEdits(edits)
+	return edits
+}
+
+// RecalculateAllTables evaluates the TBLFM formulas of every table in the document
+func (w *MainWindow) RecalculateAllTables() []utils.TextEdit {
+	edits, err := utils.EvaluateAllTableFormulas(w.editor.GetContent())
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Table formula: "+err.Error())
+		return []utils.TextEdit{}
+	}
+
+	w.applyDocumentEdits(edits)
+	return edits
+}
+
+// SetRecalculateTablesOnSave enables or disables evaluating table formulas when saving
+func (w *MainWindow) SetRecalculateTablesOnSave(enabled bool) {
+	w.updateConfig(func(c *config.Config) {
+		c.RecalculateTablesOnSave = enabled
+	})
+}
+
+// GetRecalculateTablesOnSave returns whether table formulas are evaluated when saving
+func (w *MainWindow) GetRecalculateTablesOnSave() bool {
+	return w.currentConfig().RecalculateTablesOnSave
+}
+
+// ConvertToMarkdownTable converts CSV, TSV or HTML table data into a markdown
+// table; format may be "auto" to detect it
+func (w *MainWindow) ConvertToMarkdownTable(data string, format string) string {
+	options := utils.DefaultTableImportOptions()
+	options.Format = format
+
+	table, err := utils.ConvertToMarkdownTable(data, options)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Table: "+err.Error())
+		return ""
+	}
+	return table
+}
+
+// PasteClipboardAsTable converts the clipboard text into a markdown table and
+// returns the edit inserting it at the cursor
+func (w *MainWindow) PasteClipboardAsTable(line int, column int) []utils.TextEdit {
+	data, err := runtime.ClipboardGetText(w.ctx)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to read clipboard: "+err.Error())
+		return []utils.TextEdit{}
+	}
+
+	table := w.ConvertToMarkdownTable(data, utils.TableFormatAuto)
+	if table == "" {
+		return []utils.TextEdit{}
+	}
+
+	// Tables need a blank line before them unless they start the line
+	if column > 1 {
+		table = "\n\n" + table
+	}
+	pos := utils.Position{Line: line, Column: column}
+	edits := []utils.TextEdit{{Range: utils.Range{Start: pos, End: pos}, NewText: table + "\n"}}
+
+	w.applyDocumentEdits(edits)
+	return edits
+}
+
+// CopyTableAs copies the table at the cursor to the clipboard as CSV or TSV
+func (w *MainWindow) CopyTableAs(line int, column int, format string) bool {
+	data, ok := w.tableAsDelimited(line, format)
+	if !ok {
+		return false
+	}
+
+	if err := runtime.ClipboardSetText(w.ctx, data); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to copy table: "+err.Error())
+		return false
+	}
+	runtime.EventsEmit(w.ctx, "status:update", "Table copied as "+strings.ToUpper(format))
+	return true
+}
+
+// ExportTable prompts for a filename and writes the table at the cursor as CSV or TSV
+func (w *MainWindow) ExportTable(line int, column int, format string) bool {
+	data, ok := w.tableAsDelimited(line, format)
+	if !ok {
+		return false
+	}
+
+	filePath := w.promptExportPath("table", format, strings.ToUpper(format)+" Files")
+	if filePath == "" {
+		return false
+	}
+
+	if err := w.fileUtils.SaveToFile(filePath, data); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export table: "+err.Error())
+		return false
+	}
+	runtime.EventsEmit(w.ctx, "status:update", "Table exported")
+	return true
+}
+
+// ExportHTML exports the document as a standalone HTML page styled with the
+// current theme. images is "inline", "copy" or "link", or "" for the way set
+// in the settings.
+func (w *MainWindow) ExportHTML(toc bool, images string) bool {
+	filePath := w.promptExportPath(w.documentName(), "html", "HTML Files")
+	if filePath == "" {
+		return false
+	}
+
+	settings := w.settings()
+	if images == "" {
+		images = settings.Config.Export.HTMLImages
+	}
+	exporter := export.NewHTMLExporter(utils.NewMarkdownParserWith(settings.Config.Markdown), export.HTMLOptions{
+		SourcePath: w.editor.GetCurrentFilePath(),
+		Images:     images,
+		TOC:        toc,
+		Colors:     w.theme.GetCurrentColors(),
+		Dark:       w.theme.IsDarkMode(),
+	})
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export HTML: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// ExportPDF exports the document as a PDF file in the light theme's colors.
+// pageSize is "A4", "A5", "Letter" or "Legal", or "" for the size set in the
+// settings. Pages are landscape when asked or when the settings say so.
+func (w *MainWindow) ExportPDF(pageSize string, landscape bool) bool {
+	filePath := w.promptExportPath(w.documentName(), "pdf", "PDF Files")
+	if filePath == "" {
+		return false
+	}
+
+	settings := w.settings()
+	if pageSize == "" {
+		pageSize = settings.Config.Export.PDFPageSize
+	}
+	options := export.DefaultPDFOptions()
+	options.SourcePath = w.editor.GetCurrentFilePath()
+	options.PageSize = pageSize
+	options.Landscape = landscape || settings.Config.Export.PDFLandscape
+	options.Colors = w.theme.GetColors(theme.LightTheme)
+
+	exporter := export.NewPDFExporter(utils.NewMarkdownParserWith(settings.Config.Markdown), options)
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export PDF: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// ExportDOCX exports the document as a Word file, using the styles of the
+// configured reference document if there is one
+func (w *MainWindow) ExportDOCX() bool {
+	filePath := w.promptExportPath(w.documentName(), "docx", "Word Documents")
+	if filePath == "" {
+		return false
+	}
+
+	settings := w.settings()
+	exporter := export.NewDOCXExporter(utils.NewMarkdownParserWith(settings.Config.Markdown), export.DOCXOptions{
+		SourcePath:   w.editor.GetCurrentFilePath(),
+		ReferenceDoc: settings.Config.DOCXReferenceDoc,
+	})
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export Word document: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// ExportLaTeX exports the document as a LaTeX source, filling the configured
+// template if there is one
+func (w *MainWindow) ExportLaTeX() bool {
+	filePath := w.promptExportPath(w.documentName(), "tex", "LaTeX Documents")
+	if filePath == "" {
+		return false
+	}
+
+	settings := w.settings()
+	exporter := export.NewLaTeXExporter(utils.NewMarkdownParserWith(settings.Config.Markdown), export.LaTeXOptions{
+		SourcePath: w.editor.GetCurrentFilePath(),
+		Template:   settings.Config.LaTeXTemplate,
+	})
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export LaTeX: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// CopyAs converts markdown to a markup format, one of the export.Markup
+// constants, and puts the result on the clipboard
+func (w *MainWindow) CopyAs(format string, md string) bool {
+	name, ok := export.MarkupFormatNames[format]
+	if !ok {
+		runtime.EventsEmit(w.ctx, "error", "Unknown format: "+format)
+		return false
+	}
+
+	exporter := export.NewMarkupExporter(w.newParser(), export.MarkupOptions{Format: format})
+	data, err := exporter.Render(md)
+	if err == nil {
+		err = runtime.ClipboardSetText(w.ctx, data)
+	}
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to copy as "+name+": "+err.Error())
+		return false
+	}
+
+	warnings := exporter.Warnings()
+	for _, warning := range warnings {
+		runtime.LogWarning(w.ctx, "Copy as "+name+": "+warning)
+	}
+	status := "Copied as " + name
+	if len(warnings) > 0 {
+		status += " (" + strings.Join(warnings, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", status)
+	return true
+}
+
+// ExportEPUB exports the document as an EPUB book, starting a new chapter at
+// every level 1 heading
+func (w *MainWindow) ExportEPUB() bool {
+	filePath := w.promptExportPath(w.documentName(), "epub", "EPUB Books")
+	if filePath == "" {
+		return false
+	}
+
+	exporter := export.NewEPUBExporter(w.newParser(), export.EPUBOptions{
+		SourcePath: w.editor.GetCurrentFilePath(),
+		Colors:     w.theme.GetColors(theme.LightTheme),
+	})
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export EPUB: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// ExportWorkspaceEPUB compiles the markdown files of the current document's
+// folder into one EPUB book. The files listed under "chapters" in the
+// document's front matter are used in that order; otherwise every markdown
+// file in the folder is, sorted by name.
+func (w *MainWindow) ExportWorkspaceEPUB() bool {
+	chapters, err := w.bookChapters()
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export EPUB: "+err.Error())
+		return false
+	}
+
+	filePath := w.promptExportPath(filepath.Base(w.workspaceDir()), "epub", "EPUB Books")
+	if filePath == "" {
+		return false
+	}
+
+	exporter := export.NewEPUBExporter(w.newParser(), export.EPUBOptions{
+		SourcePath: w.editor.GetCurrentFilePath(),
+		Colors:     w.theme.GetColors(theme.LightTheme),
+	})
+	if err := exporter.ExportBook(chapters, filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export EPUB: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// ExportSlides exports the document as a self-contained HTML slide deck
+func (w *MainWindow) ExportSlides() bool {
+	filePath := w.promptExportPath(w.documentName(), "html", "HTML Slide Decks")
+	if filePath == "" {
+		return false
+	}
+
+	exporter := w.newSlidesExporter()
+	if err := exporter.Export(w.editor.GetContent(), filePath); err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to export slides: "+err.Error())
+		return false
+	}
+
+	w.reportExport(filePath, exporter.Warnings())
+	return true
+}
+
+// GetSlides splits the document into slides for the presenter view
+func (w *MainWindow) GetSlides() *export.SlideDeck {
+	exporter := w.newSlidesExporter()
+	deck := exporter.Render(w.editor.GetContent())
+	for _, warning := range exporter.Warnings() {
+		runtime.LogWarning(w.ctx, "Slides: "+warning)
+	}
+	return deck
+}
+
+// ChooseDOCXReferenceDoc asks for a .docx whose styles Word exports reuse and
+// returns its path, or "" when cancelled
+func (w *MainWindow) ChooseDOCXReferenceDoc() string {
+	filePath, err := runtime.OpenFileDialog(w.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: w.workspaceDir(),
+		Title:            "Choose Reference Document",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Word Documents (*.docx)",
+				Pattern:     "*.docx",
+			},
+		},
+	})
+	if err != nil || filePath == "" {
+		// User cancelled
+		return ""
+	}
+
+	w.updateConfig(func(c *config.Config) {
+		c.DOCXReferenceDoc = filePath
+	})
+	w.refreshMenu()
+	runtime.EventsEmit(w.ctx, "status:update", "Word exports use the styles of "+filepath.Base(filePath))
+	return filePath
+}
+
+// ClearDOCXReferenceDoc makes Word exports use the built-in styles again
+func (w *MainWindow) ClearDOCXReferenceDoc() {
+	w.updateConfig(func(c *config.Config) {
+		c.DOCXReferenceDoc = ""
+	})
+	w.refreshMenu()
+}
+
+// ChooseLaTeXTemplate asks for a template LaTeX exports fill in and returns
+// its path, or "" when cancelled
+func (w *MainWindow) ChooseLaTeXTemplate() string {
+	filePath, err := runtime.OpenFileDialog(w.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: w.workspaceDir(),
+		Title:            "Choose LaTeX Template",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "LaTeX Templates (*.tex;*.latex)",
+				Pattern:     "*.tex;*.latex",
+			},
+		},
+	})
+	if err != nil || filePath == "" {
+		// User cancelled
+		return ""
+	}
+
+	w.updateConfig(func(c *config.Config) {
+		c.LaTeXTemplate = filePath
+	})
+	w.refreshMenu()
+	runtime.EventsEmit(w.ctx, "status:update", "LaTeX exports use the template "+filepath.Base(filePath))
+	return filePath
+}
+
+// ClearLaTeXTemplate makes LaTeX exports use the built-in template again
+func (w *MainWindow) ClearLaTeXTemplate() {
+	w.updateConfig(func(c *config.Config) {
+		c.LaTeXTemplate = ""
+	})
+	w.refreshMenu()
+}
+
+// ImportDocument asks for a Word or HTML document and opens it as a new
+// markdown document, extracting its images next to the original
+func (w *MainWindow) ImportDocument() bool {
+	filePath, err := runtime.OpenFileDialog(w.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: w.workspaceDir(),
+		Title:            "Import Document",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Word and HTML Documents (*.docx;*.html;*.htm)",
+				Pattern:     "*.docx;*.html;*.htm;*.xhtml",
+			},
+		},
+	})
+	if err != nil || filePath == "" {
+		// User cancelled
+		return false
+	}
+	if !importer.IsSupportedFile(filePath) {
+		runtime.EventsEmit(w.ctx, "error", "Cannot import "+filepath.Base(filePath)+": only Word and HTML documents are supported")
+		return false
+	}
+
+	dir := filepath.Dir(filePath)
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	settings := w.settings()
+	imp := importer.NewImporter(utils.NewMarkdownParserWith(settings.Config.Markdown), importer.Options{
+		SourcePath: filePath,
+		AssetsDir:  filepath.Join(dir, name+"_files"),
+		BaseDir:    dir,
+		Format:     settings.Config.Format,
+	})
+	md, err := imp.ImportFile(filePath)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to import "+filepath.Base(filePath)+": "+err.Error())
+		return false
+	}
+
+	w.openImported(md, filepath.Base(filePath), imp.Warnings())
+	return true
+}
+
+// ImportClipboardHTML opens HTML copied from a browser, Word or Google Docs as
+// a new markdown document
+func (w *MainWindow) ImportClipboardHTML(data string) bool {
+	if strings.TrimSpace(data) == "" {
+		runtime.EventsEmit(w.ctx, "error", "The clipboard has no HTML to import")
+		return false
+	}
+
+	// Embedded images go next to the current document, or into the data
+	// folder when there is none, where they stay as long as the document
+	// links to them
+	dir := w.workspaceDir()
+	settings := w.settings()
+	options := importer.Options{AssetsDir: filepath.Join(dir, "images"), BaseDir: dir, Format: settings.Config.Format}
+	if dir == "" {
+		dirs, err := config.Locations()
+		if err != nil {
+			runtime.EventsEmit(w.ctx, "error", "Failed to import clipboard: "+err.Error())
+			return false
+		}
+		options.AssetsDir = filepath.Join(dirs.Data, "images")
+	}
+	imp := importer.NewImporter(utils.NewMarkdownParserWith(settings.Config.Markdown), options)
+	md, err := imp.ImportHTML(data)
+	if err != nil {
+		runtime.EventsEmit(w.ctx, "error", "Failed to import clipboard: "+err.Error())
+		return false
+	}
+
+	w.openImported(md, "clipboard", imp.Warnings())
+	return true
 }
 
 // Internal helper methods
 
-// applyConfiguration applies the loaded configuration to components
+// addRecentFile adds the current file to the recent files in config
+func (w *MainWindow) addRecentFile() {
+	if path := w.editor.GetCurrentFilePath(); path != "" {
+		w.updateConfig(func(c *config.Config) {
+			c.AddRecentFile(path)
+		})
+	}
+	w.refreshMenu()
+}
+
+// currentConfig returns a copy of the user's configuration, to read without
+// holding its lock
+func (w *MainWindow) currentConfig() config.Config {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	return *w.config
+}
+
+// updateConfig changes the user's configuration and saves it
+func (w *MainWindow) updateConfig(change func(c *config.Config)) error {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	defer w.invalidateSettings()
+	change(w.config)
+	return w.config.Save()
+}
+
+// setConfig changes a setting of the schema in the user's configuration and
+// saves it. It returns what validation changed besides.
+func (w *MainWindow) setConfig(key string, value interface{}) ([]string, error) {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	defer w.invalidateSettings()
+	problems, err := w.config.Set(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return problems, w.config.Save()
+}
+
+// receiveLaunch opens the files of a later launch, bringing the window to the
+// front
+func (w *MainWindow) receiveLaunch(launch instance.Launch) {
+	runtime.WindowUnminimise(w.ctx)
+	runtime.WindowShow(w.ctx)
+	w.requestOpen(launch.Targets...)
+}
+
+// requestOpen queues files and folders to open and tells the frontend, which
+// checks for unsaved changes before opening them
+func (w *MainWindow) requestOpen(targets ...instance.Target) {
+	if len(targets) == 0 {
+		return
+	}
+	w.openMu.Lock()
+	w.openRequests = append(w.openRequests, targets...)
+	w.openMu.Unlock()
+	runtime.EventsEmit(w.ctx, "files:open")
+}
+
+// promptExportPath asks where to export the document, adding the extension
+// when the user left it out. It returns "" when cancelled.
+func (w *MainWindow) promptExportPath(name string, ext string, displayName string) string {
+	filePath, err := runtime.SaveFileDialog(w.ctx, runtime.SaveDialogOptions{
+		DefaultDirectory: w.workspaceDir(),
+		DefaultFilename:  name + "." + ext,
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: displayName + " (*." + ext + ")",
+				Pattern:     "*." + ext,
+			},
+		},
+	})
+	if err != nil || filePath == "" {
+		// User cancelled
+		return ""
+	}
+
+	if filepath.Ext(filePath) == "" {
+		filePath += "." + ext
+	}
+	return filePath
+}
+
+// reportExport tells the frontend where the document was exported, along
+// with anything that could not be exported faithfully
+func (w *MainWindow) reportExport(filePath string, warnings []string) {
+	for _, warning := range warnings {
+		runtime.LogWarning(w.ctx, "Export: "+warning)
+	}
+
+	message := "Exported to " + filepath.Base(filePath)
+	if len(warnings) > 0 {
+		message += " (" + strings.Join(warnings, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", message)
+}
+
+// openImported opens imported markdown as a new document and reports what
+// could not be converted
+func (w *MainWindow) openImported(md string, source string, warnings []string) {
+	w.editor.NewFile()
+	w.editor.SetContent(md)
+
+	for _, warning := range warnings {
+		runtime.LogWarning(w.ctx, "Import: "+warning)
+	}
+
+	message := "Imported " + source
+	if len(warnings) > 0 {
+		message += " (" + strings.Join(warnings, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", message)
+	runtime.EventsEmit(w.ctx, "import:report", warnings)
+}
+
+// bookChapters returns the chapters of the current document's folder, using
+// the editor's content for the current document
+func (w *MainWindow) bookChapters() ([]export.Chapter, error) {
+	dir := w.workspaceDir()
+	if dir == "" {
+		return nil, errors.New("save the document in the book's folder first")
+	}
+	current := w.editor.GetCurrentFilePath()
+
+	matter, _ := utils.SplitFrontMatter(w.editor.GetContent())
+	paths := matter.Strings("chapters")
+	for i, path := range paths {
+		if !filepath.IsAbs(path) {
+			paths[i] = filepath.Join(dir, path)
+		}
+	}
+	if len(paths) == 0 {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && (&utils.FileUtils{}).IsMarkdownFile(entry.Name()) {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+		sort.Strings(paths)
+	}
+
+	var chapters []export.Chapter
+	for _, path := range paths {
+		if path == current {
+			chapters = append(chapters, export.Chapter{Path: path, Markdown: w.editor.GetContent()})
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, export.Chapter{Path: path, Markdown: string(data)})
+	}
+	if len(chapters) == 0 {
+		return nil, errors.New("the folder has no markdown files")
+	}
+	return chapters, nil
+}
+
+// documentName returns the current file's name without extension, for naming exports
+func (w *MainWindow) documentName() string {
+	path := w.editor.GetCurrentFilePath()
+	if path == "" {
+		return "untitled"
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// tableAsDelimited returns the table at the given line as CSV or TSV,
+// reporting failures to the frontend
+func (w *MainWindow) tableAsDelimited(line int, format string) (string, bool) {
+	table, err := utils.FindTableAt(w.editor.GetContent(), line)
+	if err == nil {
+		var data string
+		if data, err = utils.TableToDelimited(table, format); err == nil {
+			return data, true
+		}
+	}
+
+	runtime.EventsEmit(w.ctx, "error", "Table: "+err.Error())
+	return "", false
+}
+
+// applyDocumentEdits applies edits sent to the frontend to the editor content,
+// keeping both sides in sync
+func (w *MainWindow) applyDocumentEdits(edits []utils.TextEdit) {
+	if len(edits) > 0 {
+		w.editor.SetContent(utils.ApplyEdits(w.editor.GetContent(), edits))
+	}
+}
+
+// newSlidesExporter creates a slide exporter for the current document in the
+// current theme
+func (w *MainWindow) newSlidesExporter() *export.SlidesExporter {
+	return export.NewSlidesExporter(w.newParser(), export.SlidesOptions{
+		SourcePath: w.editor.GetCurrentFilePath(),
+		Colors:     w.theme.GetCurrentColors(),
+		Dark:       w.theme.IsDarkMode(),
+	})
+}
+
+// newFormatter creates a formatter using the style in effect for the current
+// document
+func (w *MainWindow) newFormatter() *utils.Formatter {
+	settings := w.settings()
+	return utils.NewFormatter(utils.NewMarkdownParserWith(settings.Config.Markdown), settings.Config.Format)
+}
+
+// formatOnSave formats the content before saving when enabled,
+// sending the edits to the frontend so the editor stays in sync
+func (w *MainWindow) formatOnSave() {
+	if !w.settings().Config.FormatOnSave {
+		return
+	}
+
+	edits := w.FormatDocument()
+	if len(edits) > 0 {
+		runtime.EventsEmit(w.ctx, "editor:apply-edits", edits)
+	}
+}
+
+// recalculateOnSave evaluates table formulas before saving when enabled.
+// Errors are reported but do not prevent saving.
+func (w *MainWindow) recalculateOnSave() {
+	if !w.settings().Config.RecalculateTablesOnSave {
+		return
+	}
+
+	edits := w.RecalculateAllTables()
+	if len(edits) > 0 {
+		runtime.EventsEmit(w.ctx, "editor:apply-edits", edits)
+	}
+}
+
+// newLinter creates a linter with the lint rules in effect for the current
+// document
+func (w *MainWindow) newLinter() *utils.Linter {
+	settings := w.settings()
+	return utils.NewLinter(utils.NewMarkdownParserWith(settings.Config.Markdown), settings.Config.LintConfig())
+}
+
+// newParser creates a parser with the markdown extensions in effect for the
+// current document
+func (w *MainWindow) newParser() *utils.MarkdownParser {
+	return utils.NewMarkdownParserWith(w.settings().Config.Markdown)
+}
+
+// settings returns the settings in effect for the current document, resolving
+// them again when its folder or front matter, the configuration or the files
+// they come from changed. The problems with the settings of its workspace and
+// front matter are reported when they change.
+func (w *MainWindow) settings() *config.Settings {
+	dir := w.workspaceDir()
+	content := w.editor.GetContent()
+	matter, _ := utils.SplitFrontMatter(content)
+
+	w.settingsMu.Lock()
+	version := w.settingsVersion
+	if w.lastSettings != nil && w.resolvedVersion == version &&
+		w.settingsDir == dir && reflect.DeepEqual(w.settingsMatter, matter) {
+		settings := w.lastSettings
+		w.settingsMu.Unlock()
+		return settings
+	}
+	w.settingsMu.Unlock()
+
+	cfg := w.currentConfig()
+	settings := cfg.Resolve(dir, content)
+
+	w.settingsMu.Lock()
+	problems := strings.Join(settings.Problems, "; ")
+	changed := problems != w.settingsProblems
+	w.settingsProblems = problems
+	w.lastSettings = settings
+	w.settingsDir = dir
+	w.settingsMatter = matter
+	w.resolvedVersion = version
+	w.settingsMu.Unlock()
+	if w.watcher != nil {
+		w.watcher.Watch(settings.Files...)
+	}
+
+	if changed && problems != "" && w.ctx != nil {
+		for _, problem := range settings.Problems {
+			runtime.LogWarning(w.ctx, "Settings: "+problem)
+		}
+		runtime.EventsEmit(w.ctx, "status:update", "Some settings were ignored ("+problems+")")
+	}
+	return settings
+}
+
+// invalidateSettings makes the next call of settings resolve them again
+func (w *MainWindow) invalidateSettings() {
+	w.settingsMu.Lock()
+	w.settingsVersion++
+	w.settingsMu.Unlock()
+}
+
+// workspaceDir returns the directory of the current file, or "" for an unsaved file
+func (w *MainWindow) workspaceDir() string {
+	path := w.editor.GetCurrentFilePath()
+	if path == "" {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// settingsFilesChanged reloads the configuration when its file changed, and
+// applies the settings that changed for the current document. The frontend
+// gets the changes in a settings:changed event.
+func (w *MainWindow) settingsFilesChanged(paths []string) {
+	var status []string
+	for _, path := range paths {
+		current := w.currentConfig()
+		if path != current.Path() {
+			continue
+		}
+		next, problems, err := current.Reload()
+		if err != nil {
+			runtime.LogWarning(w.ctx, "Failed to reload configuration: "+err.Error())
+			runtime.EventsEmit(w.ctx, "status:update", "The configuration could not be reloaded ("+err.Error()+"); the current settings are kept")
+			return
+		}
+		for _, problem := range problems {
+			runtime.LogWarning(w.ctx, "Configuration: "+problem)
+		}
+		status = problems
+		w.configMu.Lock()
+		next.State = w.config.State
+		*w.config = *next
+		w.configMu.Unlock()
+	}
+	w.applySettingsChanges(status)
+}
+
+// applySettingsChanges applies what changed in the settings since they were
+// last resolved and tells the frontend. The problems are reported with them.
+func (w *MainWindow) applySettingsChanges(status []string) {
+	w.settingsMu.Lock()
+	before := w.lastSettings
+	w.settingsVersion++
+	w.settingsMu.Unlock()
+	after := w.settings()
+	if before == nil {
+		return
+	}
+	changes := after.Diff(before)
+	if len(changes) == 0 {
+		if len(status) > 0 {
+			runtime.EventsEmit(w.ctx, "status:update", "Some settings were changed ("+strings.Join(status, "; ")+")")
+		}
+		return
+	}
+
+	w.applyConfiguration()
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Key
+		if change.Key == "keybindings" {
+			w.loadKeymap()
+			w.refreshMenu()
+		}
+	}
+	w.editor.RefreshPreview()
+	runtime.EventsEmit(w.ctx, "settings:changed", changes)
+
+	message := "Settings changed: " + strings.Join(keys, ", ")
+	if len(status) > 0 {
+		message += " (" + strings.Join(status, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", message)
+}
+
+// renderPreview renders the preview with the markdown extensions in effect
+// for the current document
+func (w *MainWindow) renderPreview(md string) string {
+	parser := w.newParser()
+	return parser.RenderFragment(parser.Parse(md), html.RendererOptions{})
+}
+
+// loadThemes reads the user's theme files and watches them and their folder.
+// It returns what was left out of them.
+func (w *MainWindow) loadThemes() []string {
+	dir, err := config.ThemesDir()
+	if err != nil {
+		runtime.LogWarning(w.ctx, "Failed to find the themes folder: "+err.Error())
+		return []string{err.Error()}
+	}
+	files, problems := w.theme.LoadDir(dir)
+	for _, problem := range problems {
+		runtime.LogWarning(w.ctx, "Themes: "+problem)
+	}
+	w.themeWatcher.Watch(append([]string{dir}, files...)...)
+	return problems
+}
+
+// themeFilesChanged reloads the themes when a theme file is added, changed
+// or removed, and applies the one in use
+func (w *MainWindow) themeFilesChanged(paths []string) {
+	w.themesMu.Lock()
+	problems := w.loadThemes()
+	w.selectThemes()
+	w.theme.SetTheme(w.getThemeFromConfig())
+	w.themesMu.Unlock()
+	runtime.EventsEmit(w.ctx, "themes:update", w.theme.Themes())
+
+	message := "Themes reloaded"
+	if len(problems) > 0 {
+		message += " (" + strings.Join(problems, "; ") + ")"
+	}
+	runtime.EventsEmit(w.ctx, "status:update", message)
+}
+
+// selectThemes chooses the themes of the light and dark modes from the
+// configuration
+func (w *MainWindow) selectThemes() {
+	cfg := w.currentConfig()
+	for _, problem := range w.theme.Select(cfg.LightTheme, cfg.DarkTheme) {
+		runtime.LogWarning(w.ctx, "Themes: "+problem)
+	}
+}
+
+// applyConfiguration applies the configuration to components, at startup and
+// whenever the settings change
 func (w *MainWindow) applyConfiguration() {
 	// Apply theme
+	w.themesMu.Lock()
+	w.selectThemes()
 	w.theme.SetTheme(w.getThemeFromConfig())
+	w.themesMu.Unlock()
 
 	// Apply editor settings
-	w.editor.SetAutoSaveEnabled(w.config.AutoSaveEnabled)
-	w.editor.SetAutoSaveDelay(w.config.AutoSaveDelay)
+	cfg := w.currentConfig()
+	w.editor.SetAutoSaveEnabled(cfg.AutoSaveEnabled)
+	w.editor.SetAutoSaveDelay(cfg.AutoSaveDelay)
 }
 
-// getThemeFromConfig gets the theme type from configuration
+// getThemeFromConfig gets the theme type from configuration: the mode chosen,
+// the system's appearance or the mode of the time of day
 func (w *MainWindow) getThemeFromConfig() theme.ThemeType {
-	if w.config.IsDarkMode {
+	cfg := w.currentConfig()
+	dark := cfg.IsDarkMode
+	switch cfg.ThemeMode {
+	case theme.ModeSystem:
+		if systemDark, ok := theme.SystemAppearance(); ok {
+			dark = systemDark
+		} else {
+			w.appearanceMu.Lock()
+			if w.webViewReported {
+				dark = w.webViewDark
+			}
+			w.appearanceMu.Unlock()
+		}
+	case theme.ModeSchedule:
+		dark = theme.ScheduledDark(time.Now(), cfg.DarkModeStart, cfg.DarkModeEnd)
+	}
+	if dark {
 		return theme.DarkTheme
 	}
 	return theme.LightTheme
 }
+
+// followAppearance switches between light and dark mode as the system's
+// appearance changes or the schedule says, until shutdown. The system's
+// appearance is watched while the system mode is in use, and only checked
+// every appearanceInterval where it cannot be watched.
+func (w *MainWindow) followAppearance() {
+	ticker := time.NewTicker(appearanceInterval)
+	defer ticker.Stop()
+	var stopWatching chan struct{}
+	watching := false
+	for {
+		switch mode := w.currentConfig().ThemeMode; {
+		case mode == theme.ModeSystem && stopWatching == nil:
+			stopWatching = make(chan struct{})
+			watching = theme.WatchSystemAppearance(stopWatching, w.updateAppearance)
+		case mode != theme.ModeSystem && stopWatching != nil:
+			close(stopWatching)
+			stopWatching, watching = nil, false
+		}
+
+		select {
+		case <-w.appearanceDone:
+			if stopWatching != nil {
+				close(stopWatching)
+			}
+			return
+		case <-ticker.C:
+			if mode := w.currentConfig().ThemeMode; mode == theme.ModeSchedule || mode == theme.ModeSystem && !watching {
+				w.updateAppearance()
+			}
+		}
+	}
+}
+
+// updateAppearance switches to the mode the system or the schedule asks for
+// when it is not the one in use
+func (w *MainWindow) updateAppearance() {
+	if w.currentConfig().ThemeMode == theme.ModeManual {
+		return
+	}
+	w.themesMu.Lock()
+	defer w.themesMu.Unlock()
+	if themeType := w.getThemeFromConfig(); themeType != w.theme.GetCurrentTheme() {
+		w.theme.SetTheme(themeType)
+	}
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/francescoizzo/markdown-editor-go/internal/config"
+	"github.com/francescoizzo/markdown-editor-go/internal/instance"
+)
+
+// TestReloadWhileReading reloads the configuration while bound methods read
+// and change it. Run it with -race.
+func TestReloadWhileReading(t *testing.T) {
+	t.Setenv(config.DirEnv, t.TempDir())
+	w := NewMainWindow(instance.Launch{}, nil)
+	if _, err := w.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	path := w.config.Path()
+
+	const rounds = 50
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			w.settingsFilesChanged([]string{path})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			w.GetSettings()
+			w.GetRecentFiles()
+			w.GetEditorSettings()
+			w.GetFormatOnSave()
+			w.recentFileCommands()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			w.updateConfig(func(c *config.Config) {
+				c.AddRecentFile("file" + strconv.Itoa(i%15) + ".md")
+				c.WindowWidth = 800 + i
+			})
+		}
+	}()
+	wg.Wait()
+
+	cfg := w.currentConfig()
+	if cfg.WindowWidth != 800+rounds-1 {
+		t.Errorf("WindowWidth = %d, want %d: a reload dropped a change to the state", cfg.WindowWidth, 800+rounds-1)
+	}
+	if len(cfg.RecentFiles) != 10 {
+		t.Errorf("%d recent files, want 10", len(cfg.RecentFiles))
+	}
+}
+
+// TestReloadKeymapWhileReading replaces the keybindings, as the settings
+// watcher does, while bound methods read them. Run it with -race.
+func TestReloadKeymapWhileReading(t *testing.T) {
+	t.Setenv(config.DirEnv, t.TempDir())
+	w := NewMainWindow(instance.Launch{}, nil)
+
+	const rounds = 50
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			w.loadKeymap()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			w.GetKeybindings()
+			w.GetCommands()
+			ApplicationMenu(w)
+		}
+	}()
+	wg.Wait()
+
+	if len(w.GetKeybindings()) == 0 {
+		t.Error("no keybindings")
+	}
+}
@@ -0,0 +1,358 @@
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Definition is a theme: the colors of the interface, the editor's colors
+// and token colors, and the typography of the preview
+type Definition struct {
+	ID      string       `json:"id"` // the file name without its extension
+	Name    string       `json:"name"`
+	Dark    bool         `json:"dark"` // the editor builds on Monaco's dark theme
+	Colors  ThemeColors  `json:"colors"`
+	Editor  EditorColors `json:"editor"`
+	Preview Typography   `json:"preview"`
+	Path    string       `json:"path"` // the file it was read from; empty for the built-in themes
+}
+
+// EditorColors are the colors of the Monaco editor, over those of its light
+// or dark base theme
+type EditorColors struct {
+	Colors map[string]string `json:"colors"` // by Monaco color id, such as "editor.background"
+	Tokens []TokenRule       `json:"tokens"`
+}
+
+// TokenRule colors a kind of token in the editor, as Monaco theme rules do
+type TokenRule struct {
+	Token      string `json:"token"` // such as "keyword" or "string.link"; "" for every token
+	Foreground string `json:"foreground,omitempty"`
+	Background string `json:"background,omitempty"`
+	FontStyle  string `json:"fontStyle,omitempty"` // "italic", "bold" and "underline", separated by spaces
+}
+
+// Typography sets the fonts of the preview, in CSS values
+type Typography struct {
+	FontFamily        string `json:"fontFamily"`
+	FontSize          string `json:"fontSize"`
+	LineHeight        string `json:"lineHeight"`
+	HeadingFontFamily string `json:"headingFontFamily"`
+	CodeFontFamily    string `json:"codeFontFamily"`
+	MaxWidth          string `json:"maxWidth"`
+}
+
+// DefaultTypography returns the typography of the built-in themes
+func DefaultTypography() Typography {
+	return Typography{
+		FontFamily:        "'Roboto', sans-serif",
+		FontSize:          "14px",
+		LineHeight:        "1.6",
+		HeadingFontFamily: "'Roboto', sans-serif",
+		CodeFontFamily:    "'Roboto Mono', monospace",
+		MaxWidth:          "800px",
+	}
+}
+
+// Extensions of theme files
+var themeExtensions = []string{".json", ".toml"}
+
+// hexColor matches the colors Monaco accepts: #rgb, #rgba, #rrggbb and #rrggbbaa
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// cssColor matches the colors the interface and exported documents accept in
+// their stylesheets: hex colors, rgb() and rgba(), and hsl() and hsla()
+var cssColor = func() *regexp.Regexp {
+	number := `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`
+	separator := `(?:\s*,\s*|\s+)`
+	alpha := `(?:\s*[,/]\s*` + number + `%?)?`
+	hex := `#(?:[0-9a-f]{3,4}|[0-9a-f]{6}|[0-9a-f]{8})`
+	rgb := `rgba?\(\s*` + number + `%?` + separator + number + `%?` + separator + number + `%?` + alpha + `\s*\)`
+	hsl := `hsla?\(\s*` + number + `(?:deg|rad|grad|turn)?` + separator + number + `%?` + separator + number + `%?` + alpha + `\s*\)`
+	return regexp.MustCompile(`^(?i:` + hex + `|` + rgb + `|` + hsl + `)$`)
+}()
+
+// tokenColor matches the colors Monaco accepts in token rules
+var tokenColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// fontStyles are the words a token rule's font style is made of
+var fontStyles = map[string]bool{"italic": true, "bold": true, "underline": true, "strikethrough": true}
+
+// ReadDir reads the theme files of a folder. It returns the themes in order
+// of their ids, the files read, and a description of each file or value
+// that was left out. A missing folder has no themes.
+func ReadDir(dir string) ([]Definition, []string, []string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, []string{err.Error()}
+	}
+
+	var themes []Definition
+	var files []string
+	var problems []string
+	seen := map[string]string{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !isThemeExtension(ext) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		files = append(files, path)
+		id := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if other, ok := seen[id]; ok {
+			problems = append(problems, fmt.Sprintf("%s: theme %s is already defined by %s", entry.Name(), id, other))
+			continue
+		}
+
+		definition, fileProblems, err := ReadFile(path)
+		for _, problem := range fileProblems {
+			problems = append(problems, entry.Name()+": "+problem)
+		}
+		if err != nil {
+			problems = append(problems, entry.Name()+": "+err.Error())
+			continue
+		}
+		seen[id] = entry.Name()
+		themes = append(themes, definition)
+	}
+	sort.Slice(themes, func(i, j int) bool { return themes[i].ID < themes[j].ID })
+	return themes, files, problems
+}
+
+// ReadFile reads a JSON or TOML theme file. Colors it leaves out are those of
+// the built-in light or dark theme. The problems describe the values that
+// were left out; an error means the file could not be used at all.
+func ReadFile(path string) (Definition, []string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Definition{}, nil, err
+	}
+
+	var fields map[string]interface{}
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		_, err = toml.Decode(string(data), &fields)
+	} else {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		return Definition{}, nil, err
+	}
+	if fields == nil {
+		return Definition{}, nil, fmt.Errorf("the theme is not an object")
+	}
+
+	problems := unknownFields(fields, "", Definition{}, "id", "path")
+	for _, section := range []struct {
+		name  string
+		known interface{}
+	}{{"colors", ThemeColors{}}, {"editor", EditorColors{}}, {"preview", Typography{}}} {
+		if values, ok := fields[section.name].(map[string]interface{}); ok {
+			problems = append(problems, unknownFields(values, section.name+".", section.known)...)
+		}
+	}
+
+	var definition Definition
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return Definition{}, nil, err
+	}
+	if err := json.Unmarshal(normalized, &definition); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return Definition{}, nil, fmt.Errorf("%s should be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return Definition{}, nil, err
+	}
+	definition.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	definition.Path = path
+	problems = append(problems, definition.complete()...)
+	return definition, problems, nil
+}
+
+// complete fills in what a theme leaves out and drops the colors that are not
+// CSS colors and the editor colors Monaco would reject. It returns a
+// description of each color dropped.
+func (d *Definition) complete() []string {
+	var problems []string
+	if strings.TrimSpace(d.Name) == "" {
+		d.Name = d.ID
+	}
+
+	base := lightDefinition()
+	if d.Dark {
+		base = darkDefinition()
+	}
+	problems = append(problems, checkColors(&d.Colors)...)
+	d.Colors = fillColors(d.Colors, base.Colors)
+	d.Preview = fillTypography(d.Preview, base.Preview)
+
+	colors := map[string]string{}
+	for _, id := range sortedColorIDs(d.Editor.Colors) {
+		color := d.Editor.Colors[id]
+		if !hexColor.MatchString(color) {
+			problems = append(problems, fmt.Sprintf("editor.colors %s %q is not a #rrggbb color; it was left out", id, color))
+			continue
+		}
+		colors[id] = color
+	}
+	if _, ok := colors["editor.background"]; !ok && hexColor.MatchString(d.Colors.EditorBackground) {
+		colors["editor.background"] = d.Colors.EditorBackground
+	}
+	d.Editor.Colors = colors
+
+	tokens := []TokenRule{}
+	for i, rule := range d.Editor.Tokens {
+		if problem := rule.check(); problem != "" {
+			problems = append(problems, fmt.Sprintf("editor.tokens %d (%s) %s; it was left out", i+1, rule.Token, problem))
+			continue
+		}
+		tokens = append(tokens, rule)
+	}
+	d.Editor.Tokens = tokens
+	return problems
+}
+
+// check describes what Monaco would reject in a token rule
+func (r TokenRule) check() string {
+	for _, color := range []string{r.Foreground, r.Background} {
+		if color != "" && !tokenColor.MatchString(color) {
+			return fmt.Sprintf("has the color %q rather than #rrggbb", color)
+		}
+	}
+	for _, style := range strings.Fields(r.FontStyle) {
+		if !fontStyles[style] {
+			return fmt.Sprintf("has the font style %q", style)
+		}
+	}
+	return ""
+}
+
+// fillColors takes the colors a palette leaves empty from another
+func fillColors(colors ThemeColors, fallback ThemeColors) ThemeColors {
+	fallbacks := fallback.fields()
+	for i, field := range colors.fields() {
+		if strings.TrimSpace(*field.value) == "" {
+			*field.value = *fallbacks[i].value
+		}
+	}
+	return colors
+}
+
+// checkColors empties the colors of a palette that are not CSS colors, since
+// they are written into stylesheets as they are. It returns a description of
+// each color emptied.
+func checkColors(colors *ThemeColors) []string {
+	var problems []string
+	for _, field := range colors.fields() {
+		value := strings.TrimSpace(*field.value)
+		if value != "" && !cssColor.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("colors.%s %q is not a CSS color; it was left out", field.name, *field.value))
+			value = ""
+		}
+		*field.value = value
+	}
+	return problems
+}
+
+// colorField is a color of a palette with its key in theme files
+type colorField struct {
+	name  string
+	value *string
+}
+
+// fields returns the colors of a palette in order of declaration
+func (c *ThemeColors) fields() []colorField {
+	return []colorField{
+		{"background", &c.Background},
+		{"backgroundSecondary", &c.BackgroundSecondary},
+		{"text", &c.Text},
+		{"textSecondary", &c.TextSecondary},
+		{"border", &c.Border},
+		{"accent", &c.Accent},
+		{"accentHover", &c.AccentHover},
+		{"editorBackground", &c.EditorBackground},
+		{"previewBackground", &c.PreviewBackground},
+		{"toolbar", &c.Toolbar},
+		{"statusBar", &c.StatusBar},
+		{"highlight", &c.Highlight},
+	}
+}
+
+// fillTypography takes the values a typography leaves empty from another
+func fillTypography(typography Typography, fallback Typography) Typography {
+	if typography.FontFamily == "" {
+		typography.FontFamily = fallback.FontFamily
+	}
+	if typography.FontSize == "" {
+		typography.FontSize = fallback.FontSize
+	}
+	if typography.LineHeight == "" {
+		typography.LineHeight = fallback.LineHeight
+	}
+	if typography.HeadingFontFamily == "" {
+		typography.HeadingFontFamily = typography.FontFamily
+	}
+	if typography.CodeFontFamily == "" {
+		typography.CodeFontFamily = fallback.CodeFontFamily
+	}
+	if typography.MaxWidth == "" {
+		typography.MaxWidth = fallback.MaxWidth
+	}
+	return typography
+}
+
+// unknownFields describes the fields of a theme file that a type has no
+// field for, besides those the file may not set
+func unknownFields(fields map[string]interface{}, prefix string, known interface{}, ignored ...string) []string {
+	var names map[string]interface{}
+	data, _ := json.Marshal(known)
+	json.Unmarshal(data, &names)
+	for _, name := range ignored {
+		delete(names, name)
+	}
+
+	var problems []string
+	for _, name := range sortedKeys(fields) {
+		if _, ok := names[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown key %s%s was ignored", prefix, name))
+		}
+	}
+	return problems
+}
+
+func isThemeExtension(ext string) bool {
+	for _, known := range themeExtensions {
+		if ext == known {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedColorIDs(colors map[string]string) []string {
+	ids := make([]string, 0, len(colors))
+	for id := range colors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,134 @@
+package theme
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSSColor(t *testing.T) {
+	tests := []struct {
+		color string
+		valid bool
+	}{
+		{"#fff", true},
+		{"#FFFA", true},
+		{"#1e1e1e", true},
+		{"#1e1e1e80", true},
+		{"rgb(1, 2, 3)", true},
+		{"rgba(116, 185, 255, 0.2)", true},
+		{"rgb(10% 20% 30% / 50%)", true},
+		{"hsl(120, 50%, 50%)", true},
+		{"hsla(120deg 50% 50% / .5)", true},
+		{"HSL(0.5turn, 10%, 10%)", true},
+		{"red", false},
+		{"#12345", false},
+		{"#12345g", false},
+		{"rgb(1, 2)", false},
+		{"url(x)", false},
+		{"#fff; } body { background: red", false},
+		{"rgb(1, 2, 3)</style><script>", false},
+		{"rgb(1, 2, 3);", false},
+	}
+	for _, test := range tests {
+		if got := cssColor.MatchString(test.color); got != test.valid {
+			t.Errorf("cssColor.MatchString(%q) = %v, want %v", test.color, got, test.valid)
+		}
+	}
+}
+
+func TestReadFileDropsColorsThatAreNotCSS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "injected.json")
+	data := `{
+  "name": "Injected",
+  "dark": true,
+  "colors": {
+    "background": " #101010 ",
+    "text": "rgb(200, 200, 200)",
+    "accent": "#fff; } body { background: url(https://example.com/x)",
+    "highlight": "</style><script>alert(1)</script>"
+  }
+}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	definition, problems, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := darkDefinition().Colors
+	if definition.Colors.Background != "#101010" || definition.Colors.Text != "rgb(200, 200, 200)" {
+		t.Errorf("valid colors were changed: %+v", definition.Colors)
+	}
+	if definition.Colors.Accent != base.Accent || definition.Colors.Highlight != base.Highlight {
+		t.Errorf("invalid colors were kept: %+v", definition.Colors)
+	}
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "colors.accent ") || !strings.HasPrefix(problems[1], "colors.highlight ") {
+		t.Errorf("problems = %q, want the accent and highlight colors", problems)
+	}
+}
+
+func TestReadFileTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "solar.toml")
+	data := `# A theme in TOML
+name = """
+Solar"""
+dark = false
+
+[colors]
+accent = "#268bd2"
+highlight = 'rgba(38, 139, 210, 0.2)'
+
+[editor.colors]
+"editor.background" = "#fdf6e3"
+
+[[editor.tokens]]
+token = "keyword"
+foreground = "#859900"
+fontStyle = "bold"
+
+[preview]
+fontSize = "15px"
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	definition, problems, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("problems = %q", problems)
+	}
+	if definition.ID != "solar" || definition.Name != "Solar" || definition.Dark {
+		t.Errorf("definition = %s %q dark %v", definition.ID, definition.Name, definition.Dark)
+	}
+	if definition.Colors.Accent != "#268bd2" || definition.Colors.Highlight != "rgba(38, 139, 210, 0.2)" {
+		t.Errorf("colors = %+v", definition.Colors)
+	}
+	if definition.Colors.Text != lightDefinition().Colors.Text {
+		t.Errorf("text = %q, want the light theme's", definition.Colors.Text)
+	}
+	if definition.Editor.Colors["editor.background"] != "#fdf6e3" {
+		t.Errorf("editor colors = %v", definition.Editor.Colors)
+	}
+	if len(definition.Editor.Tokens) != 1 || definition.Editor.Tokens[0] != (TokenRule{Token: "keyword", Foreground: "#859900", FontStyle: "bold"}) {
+		t.Errorf("tokens = %+v", definition.Editor.Tokens)
+	}
+	if definition.Preview.FontSize != "15px" {
+		t.Errorf("preview font size = %q", definition.Preview.FontSize)
+	}
+}
+
+func TestReadFileTOMLErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.toml")
+	if err := ioutil.WriteFile(path, []byte("name = \"Broken\"\n[colors\naccent = \"#fff\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadFile(path); err == nil {
+		t.Error("a theme that is not TOML was read")
+	}
+}
@@ -0,0 +1,804 @@
+package theme
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxIncludes limits the chain of VS Code themes including one another
+const maxIncludes = 8
+
+// IsImportableFile reports whether a file can be imported as a theme, by its
+// extension: VS Code themes are JSON and TextMate themes are property lists
+func IsImportableFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonc", ".tmtheme", ".plist":
+		return true
+	}
+	return false
+}
+
+// ImportFile reads a VS Code color theme or a TextMate .tmTheme as a theme.
+// It returns the theme, with the id made from its name, and a report of what
+// could not be mapped or was taken from elsewhere.
+func ImportFile(path string) (Definition, []string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Definition{}, nil, err
+	}
+	fallbackName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var source colorTheme
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tmtheme", ".plist":
+		source, err = readTextMate(data)
+	default:
+		source, err = readVSCode(path, data, 0)
+	}
+	if err != nil {
+		return Definition{}, nil, err
+	}
+	if source.name == "" {
+		source.name = fallbackName
+	}
+	definition, report := source.convert()
+	return definition, report, nil
+}
+
+// WriteFile saves a theme as a native JSON theme file
+func WriteFile(path string, definition Definition) error {
+	data, err := json.MarshalIndent(struct {
+		Name    string       `json:"name"`
+		Dark    bool         `json:"dark"`
+		Colors  ThemeColors  `json:"colors"`
+		Editor  EditorColors `json:"editor"`
+		Preview *Typography  `json:"preview,omitempty"`
+	}{definition.Name, definition.Dark, definition.Colors, definition.Editor, typographyOrNil(definition.Preview)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func typographyOrNil(typography Typography) *Typography {
+	if typography == (Typography{}) {
+		return nil
+	}
+	return &typography
+}
+
+// Slug makes a theme id out of a name: lower case letters, digits and dashes
+func Slug(name string) string {
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		return "theme"
+	}
+	return slug
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// colorTheme is a VS Code or TextMate theme: workbench colors by VS Code id
+// and TextMate token colors
+type colorTheme struct {
+	name        string
+	kind        string // VS Code's "dark", "light", "hc" or "hcLight"; empty when unknown
+	colors      map[string]string
+	tokenColors []textMateRule
+	unsupported []string // parts of the theme that have no equivalent
+}
+
+// textMateRule styles the TextMate scopes it selects
+type textMateRule struct {
+	name       string
+	scopes     []string // empty for the default style of every token
+	foreground string
+	background string
+	fontStyle  string
+}
+
+// readVSCode reads a VS Code color theme, which may be JSON with comments and
+// may include another theme whose colors it overrides
+func readVSCode(path string, data []byte, depth int) (colorTheme, error) {
+	var raw struct {
+		Name                string                 `json:"name"`
+		Type                string                 `json:"type"`
+		Include             string                 `json:"include"`
+		Colors              map[string]interface{} `json:"colors"`
+		TokenColors         json.RawMessage        `json:"tokenColors"`
+		SemanticTokenColors map[string]interface{} `json:"semanticTokenColors"`
+	}
+	if err := json.Unmarshal(stripJSONComments(data), &raw); err != nil {
+		return colorTheme{}, fmt.Errorf("not a VS Code theme: %v", err)
+	}
+
+	theme := colorTheme{name: raw.Name, kind: raw.Type, colors: map[string]string{}}
+	if raw.Include != "" {
+		if depth >= maxIncludes {
+			return colorTheme{}, fmt.Errorf("themes include one another too deeply")
+		}
+		includePath := filepath.Join(filepath.Dir(path), raw.Include)
+		includeData, err := ioutil.ReadFile(includePath)
+		if err != nil {
+			return colorTheme{}, fmt.Errorf("reading the included theme: %v", err)
+		}
+		included, err := readVSCode(includePath, includeData, depth+1)
+		if err != nil {
+			return colorTheme{}, err
+		}
+		theme.colors = included.colors
+		theme.tokenColors = included.tokenColors
+		theme.unsupported = included.unsupported
+		if theme.kind == "" {
+			theme.kind = included.kind
+		}
+	}
+
+	for id, value := range raw.Colors {
+		if color, ok := value.(string); ok {
+			theme.colors[id] = color
+		}
+	}
+	rules, err := readTokenColors(path, raw.TokenColors)
+	if err != nil {
+		return colorTheme{}, err
+	}
+	theme.tokenColors = append(theme.tokenColors, rules...)
+	if len(raw.SemanticTokenColors) > 0 {
+		theme.unsupported = append(theme.unsupported, "semantic token colors")
+	}
+	return theme, nil
+}
+
+// readTokenColors reads the tokenColors of a VS Code theme: a list of rules,
+// or the path of a TextMate theme holding them
+func readTokenColors(path string, raw json.RawMessage) ([]textMateRule, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var file string
+	if json.Unmarshal(raw, &file) == nil {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), file))
+		if err != nil {
+			return nil, fmt.Errorf("reading the token colors: %v", err)
+		}
+		theme, err := readTextMate(data)
+		return theme.tokenColors, err
+	}
+
+	var entries []struct {
+		Name     string      `json:"name"`
+		Scope    interface{} `json:"scope"`
+		Settings struct {
+			Foreground string `json:"foreground"`
+			Background string `json:"background"`
+			FontStyle  string `json:"fontStyle"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("tokenColors is not a list of rules: %v", err)
+	}
+	rules := make([]textMateRule, 0, len(entries))
+	for _, entry := range entries {
+		rules = append(rules, textMateRule{
+			name:       entry.Name,
+			scopes:     splitScopes(entry.Scope),
+			foreground: entry.Settings.Foreground,
+			background: entry.Settings.Background,
+			fontStyle:  entry.Settings.FontStyle,
+		})
+	}
+	return rules, nil
+}
+
+// splitScopes reads the scope of a rule: a comma separated string or a list
+func splitScopes(scope interface{}) []string {
+	var parts []string
+	switch scope := scope.(type) {
+	case string:
+		parts = strings.Split(scope, ",")
+	case []interface{}:
+		for _, part := range scope {
+			if text, ok := part.(string); ok {
+				parts = append(parts, strings.Split(text, ",")...)
+			}
+		}
+	}
+	var scopes []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			scopes = append(scopes, part)
+		}
+	}
+	return scopes
+}
+
+// textMateColors are the global settings of a TextMate theme and the VS Code
+// colors they correspond to
+var textMateColors = map[string]string{
+	"background":       "editor.background",
+	"foreground":       "editor.foreground",
+	"caret":            "editorCursor.foreground",
+	"selection":        "editor.selectionBackground",
+	"lineHighlight":    "editor.lineHighlightBackground",
+	"invisibles":       "editorWhitespace.foreground",
+	"gutter":           "editorGutter.background",
+	"gutterForeground": "editorLineNumber.foreground",
+	"findHighlight":    "editor.findMatchHighlightBackground",
+	"guide":            "editorIndentGuide.background",
+	"activeGuide":      "editorIndentGuide.activeBackground",
+}
+
+// readTextMate reads a TextMate .tmTheme property list
+func readTextMate(data []byte) (colorTheme, error) {
+	value, err := decodePlist(data)
+	if err != nil {
+		return colorTheme{}, fmt.Errorf("not a TextMate theme: %v", err)
+	}
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return colorTheme{}, fmt.Errorf("not a TextMate theme: the property list is not a dictionary")
+	}
+	entries, ok := root["settings"].([]interface{})
+	if !ok {
+		return colorTheme{}, fmt.Errorf("not a TextMate theme: it has no settings")
+	}
+
+	name, _ := root["name"].(string)
+	theme := colorTheme{name: name, colors: map[string]string{}}
+	var unknown []string
+	for _, value := range entries {
+		entry, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		settings, _ := entry["settings"].(map[string]interface{})
+		text := func(key string) string {
+			value, _ := settings[key].(string)
+			return strings.TrimSpace(value)
+		}
+		scope, _ := entry["scope"].(string)
+		entryName, _ := entry["name"].(string)
+
+		// The settings without a scope hold the editor's colors
+		if strings.TrimSpace(scope) == "" {
+			for _, key := range sortedKeys(settings) {
+				if id, ok := textMateColors[key]; ok {
+					theme.colors[id] = text(key)
+				} else if key != "fontStyle" {
+					unknown = append(unknown, key)
+				}
+			}
+			continue
+		}
+		theme.tokenColors = append(theme.tokenColors, textMateRule{
+			name:       entryName,
+			scopes:     splitScopes(scope),
+			foreground: text("foreground"),
+			background: text("background"),
+			fontStyle:  text("fontStyle"),
+		})
+	}
+	if len(unknown) > 0 {
+		theme.unsupported = append(theme.unsupported, "the global settings "+strings.Join(unknown, ", "))
+	}
+	return theme, nil
+}
+
+// decodePlist reads an XML property list into the values JSON decodes to
+func decodePlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistValue(decoder, start)
+		}
+	}
+}
+
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.StartElement:
+				if token.Name.Local == "key" {
+					var text string
+					if err := decoder.DecodeElement(&text, &token); err != nil {
+						return nil, err
+					}
+					key = text
+					continue
+				}
+				value, err := decodePlistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+
+	case "array":
+		array := []interface{}{}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "integer", "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	}
+	return text, nil
+}
+
+// stripJSONComments removes the // and /* */ comments and the trailing
+// commas VS Code allows in its JSON files
+func stripJSONComments(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out.WriteByte(' ')
+		case c == ']' || c == '}':
+			// Drop a comma left before the closing bracket
+			trimmed := bytes.TrimRight(out.Bytes(), " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out.Truncate(len(trimmed) - 1)
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// colorSource is where a color of the interface is taken from: the first of
+// the VS Code colors the theme has, or the first token color of the scopes,
+// or else another color of the interface shaded toward a third
+type colorSource struct {
+	field    string
+	value    func(c *ThemeColors) *string
+	vscode   []string
+	scopes   []string
+	fallback string  // the field used when the theme has none of the colors
+	toward   string  // the field the fallback is shaded toward
+	amount   float64 // how far, from 0 to 1
+}
+
+var colorSources = []colorSource{
+	{field: "background", value: func(c *ThemeColors) *string { return &c.Background },
+		vscode: []string{"editor.background", "sideBar.background"}},
+	{field: "text", value: func(c *ThemeColors) *string { return &c.Text },
+		vscode: []string{"editor.foreground", "foreground"}},
+	{field: "editorBackground", value: func(c *ThemeColors) *string { return &c.EditorBackground },
+		vscode: []string{"editor.background"}, fallback: "background"},
+	{field: "previewBackground", value: func(c *ThemeColors) *string { return &c.PreviewBackground },
+		vscode: []string{"editor.background"}, fallback: "background"},
+	{field: "backgroundSecondary", value: func(c *ThemeColors) *string { return &c.BackgroundSecondary },
+		vscode:   []string{"sideBar.background", "editorWidget.background", "editorGroupHeader.tabsBackground", "tab.inactiveBackground"},
+		fallback: "background", toward: "text", amount: 0.06},
+	{field: "textSecondary", value: func(c *ThemeColors) *string { return &c.TextSecondary },
+		vscode:   []string{"descriptionForeground", "sideBar.foreground", "tab.inactiveForeground", "editorLineNumber.foreground"},
+		scopes:   []string{"comment"},
+		fallback: "text", toward: "background", amount: 0.3},
+	{field: "border", value: func(c *ThemeColors) *string { return &c.Border },
+		vscode:   []string{"panel.border", "editorGroup.border", "sideBar.border", "contrastBorder", "editorIndentGuide.background"},
+		fallback: "background", toward: "text", amount: 0.2},
+	{field: "accent", value: func(c *ThemeColors) *string { return &c.Accent },
+		vscode: []string{"focusBorder", "button.background", "textLink.foreground", "activityBarBadge.background"},
+		scopes: []string{"markup.underline.link", "entity.name.function", "keyword"}},
+	{field: "accentHover", value: func(c *ThemeColors) *string { return &c.AccentHover },
+		vscode:   []string{"textLink.activeForeground", "button.hoverBackground", "textLink.foreground"},
+		fallback: "accent", toward: "text", amount: 0.25},
+	{field: "toolbar", value: func(c *ThemeColors) *string { return &c.Toolbar },
+		vscode:   []string{"titleBar.activeBackground", "editorGroupHeader.tabsBackground", "tab.inactiveBackground"},
+		fallback: "backgroundSecondary"},
+	{field: "statusBar", value: func(c *ThemeColors) *string { return &c.StatusBar },
+		vscode:   []string{"statusBar.background"},
+		fallback: "backgroundSecondary"},
+	{field: "highlight", value: func(c *ThemeColors) *string { return &c.Highlight },
+		vscode: []string{"editor.selectionBackground", "editor.lineHighlightBackground"}},
+}
+
+// editorColorPrefixes are the VS Code colors the Monaco editor has too
+var editorColorPrefixes = []string{
+	"editor.", "editorCursor.", "editorLineNumber.", "editorWhitespace.", "editorIndentGuide.",
+	"editorBracketMatch.", "editorGutter.", "editorWidget.", "editorSuggestWidget.", "editorHoverWidget.",
+	"editorError.", "editorWarning.", "editorInfo.", "editorOverviewRuler.", "editorLink.", "editorRuler.",
+	"minimap.", "minimapSlider.", "scrollbar.", "scrollbarSlider.", "input.", "inputOption.", "list.",
+	"dropdown.", "focusBorder", "widget.shadow",
+}
+
+// tokenMapping styles a Monaco token like the first of the TextMate scopes
+// the theme colors
+type tokenMapping struct {
+	token  string
+	scopes []string
+}
+
+// tokenMappings map TextMate scopes onto the tokens of Monaco's markdown
+// language and of the languages of code blocks
+var tokenMappings = []tokenMapping{
+	{"keyword.md", []string{"markup.heading", "entity.name.section", "heading"}},
+	{"strong.md", []string{"markup.bold"}},
+	{"emphasis.md", []string{"markup.italic"}},
+	{"variable.md", []string{"markup.inline.raw", "markup.raw", "markup.fenced_code"}},
+	{"string.md", []string{"markup.fenced_code", "markup.raw"}},
+	{"string.link.md", []string{"markup.underline.link", "string.other.link", "markup.link"}},
+	{"comment.md", []string{"markup.quote"}},
+	{"meta.separator.md", []string{"meta.separator", "markup.hr"}},
+	{"comment", []string{"comment"}},
+	{"string", []string{"string"}},
+	{"number", []string{"constant.numeric"}},
+	{"constant", []string{"constant.language", "constant"}},
+	{"keyword", []string{"keyword", "storage"}},
+	{"type", []string{"entity.name.type", "support.type", "storage.type"}},
+	{"variable", []string{"variable"}},
+	{"tag", []string{"entity.name.tag"}},
+	{"attribute.name", []string{"entity.other.attribute-name"}},
+	{"attribute.value", []string{"string.quoted"}},
+	{"delimiter", []string{"punctuation"}},
+	{"regexp", []string{"string.regexp"}},
+	{"invalid", []string{"invalid"}},
+}
+
+// convert maps a VS Code or TextMate theme onto a theme of the editor. The
+// report lists what was not mapped and the colors taken from elsewhere.
+func (t colorTheme) convert() (Definition, []string) {
+	var report []string
+	definition := Definition{ID: Slug(t.name), Name: t.name}
+
+	// The default style of the tokens is the editor's color in TextMate themes
+	for _, rule := range t.tokenColors {
+		if len(rule.scopes) > 0 {
+			continue
+		}
+		if _, ok := t.colors["editor.foreground"]; !ok && rule.foreground != "" {
+			t.colors["editor.foreground"] = rule.foreground
+		}
+		if _, ok := t.colors["editor.background"]; !ok && rule.background != "" {
+			t.colors["editor.background"] = rule.background
+		}
+	}
+
+	definition.Dark = t.isDark()
+	baseName := "light"
+	if definition.Dark {
+		baseName = "dark"
+	}
+
+	// Colors of the interface, leaving out those that are not CSS colors since
+	// they are written into stylesheets as they are
+	used := map[string]bool{}
+	rejected := map[string]bool{}
+	fields := map[string]*string{}
+	base := lightDefinition().Colors
+	if definition.Dark {
+		base = darkDefinition().Colors
+	}
+	for _, source := range colorSources {
+		value := source.value(&definition.Colors)
+		fields[source.field] = value
+		for _, id := range source.vscode {
+			color := strings.TrimSpace(t.colors[id])
+			if color == "" || rejected[id] {
+				continue
+			}
+			if !cssColor.MatchString(color) {
+				report = append(report, fmt.Sprintf("colors %s %q is not a CSS color; it was left out", id, color))
+				rejected[id] = true
+				continue
+			}
+			*value = color
+			used[id] = true
+			break
+		}
+		for _, scope := range source.scopes {
+			if *value != "" {
+				break
+			}
+			if index := t.bestRule(scope); index >= 0 && cssColor.MatchString(t.tokenColors[index].foreground) {
+				*value = t.tokenColors[index].foreground
+				report = append(report, fmt.Sprintf("%s: none of %s; using the %s token color", source.field, strings.Join(source.vscode, ", "), scope))
+			}
+		}
+		if *value != "" {
+			continue
+		}
+
+		switch {
+		case source.field == "highlight" && hexColor.MatchString(definition.Colors.Accent):
+			*value = withAlpha(definition.Colors.Accent, 0x33)
+			report = append(report, "highlight: no selection color; using the accent color")
+		case source.fallback != "" && *fields[source.fallback] != "":
+			*value = *fields[source.fallback]
+			how := "the " + source.fallback + " color"
+			if source.toward != "" {
+				if mixed, ok := mix(*value, *fields[source.toward], source.amount); ok {
+					*value = mixed
+					how += " shaded toward the " + source.toward + " color"
+				}
+			}
+			report = append(report, fmt.Sprintf("%s: none of %s; using %s", source.field, strings.Join(source.vscode, ", "), how))
+		default:
+			*value = *source.value(&base)
+			report = append(report, fmt.Sprintf("%s: none of %s; using the built-in %s theme's", source.field, strings.Join(source.vscode, ", "), baseName))
+		}
+	}
+
+	// Colors of the editor
+	definition.Editor.Colors = map[string]string{}
+	var unused []string
+	for _, id := range sortedColorIDs(t.colors) {
+		if rejected[id] {
+			continue
+		}
+		if isEditorColor(id) {
+			definition.Editor.Colors[id] = t.colors[id]
+		} else if !used[id] {
+			unused = append(unused, id)
+		}
+	}
+	if len(unused) > 0 {
+		report = append(report, fmt.Sprintf("workbench colors with no place in the editor: %s (%d colors)", strings.Join(colorGroups(unused), ", "), len(unused)))
+	}
+
+	// Token colors
+	tokens, unmapped := t.mapTokens()
+	definition.Editor.Tokens = tokens
+	if len(unmapped) > 0 {
+		report = append(report, "token colors matching no token of the editor: "+strings.Join(unmapped, ", "))
+	}
+	for _, part := range t.unsupported {
+		report = append(report, part+" are not supported")
+	}
+
+	// What the theme files would drop when read
+	check := definition
+	check.Editor.Colors = map[string]string{}
+	for id, color := range definition.Editor.Colors {
+		check.Editor.Colors[id] = color
+	}
+	check.Editor.Tokens = append([]TokenRule{}, definition.Editor.Tokens...)
+	report = append(report, check.complete()...)
+	definition.Colors = check.Colors
+	definition.Editor = check.Editor
+	return definition, report
+}
+
+// isDark tells dark themes apart by their kind or, when they do not say, by
+// the lightness of the editor's background
+func (t colorTheme) isDark() bool {
+	switch strings.ToLower(t.kind) {
+	case "dark", "hc", "hc-black", "vs-dark":
+		return true
+	case "light", "hclight", "hc-light", "vs":
+		return false
+	}
+	r, g, b, ok := parseHex(t.colors["editor.background"])
+	if !ok {
+		return false
+	}
+	return 0.2126*float64(r)+0.7152*float64(g)+0.0722*float64(b) < 128
+}
+
+// mapTokens returns a Monaco token rule for each token a scope of the theme
+// styles, and the names of the token colors that styled none
+func (t colorTheme) mapTokens() ([]TokenRule, []string) {
+	matched := make([]bool, len(t.tokenColors))
+	var rules []TokenRule
+	for _, mapping := range tokenMappings {
+		for _, scope := range mapping.scopes {
+			index := t.bestRule(scope)
+			if index < 0 {
+				continue
+			}
+			rule := t.tokenColors[index]
+			matched[index] = true
+			rules = append(rules, TokenRule{
+				Token:      mapping.token,
+				Foreground: tokenHex(rule.foreground),
+				Background: tokenHex(rule.background),
+				FontStyle:  tokenFontStyle(rule.fontStyle),
+			})
+			break
+		}
+	}
+
+	var unmapped []string
+	for i, rule := range t.tokenColors {
+		if matched[i] || len(rule.scopes) == 0 {
+			continue
+		}
+		name := rule.name
+		if name == "" {
+			name = rule.scopes[0]
+		}
+		unmapped = append(unmapped, name)
+	}
+	return rules, unmapped
+}
+
+// bestRule returns the token color whose selector matches a scope most
+// closely, the later one winning ties as in TextMate, or -1 when none does.
+// Selectors naming a parent scope first are matched by their last scope.
+func (t colorTheme) bestRule(scope string) int {
+	best, bestLength := -1, 0
+	for i, rule := range t.tokenColors {
+		if rule.foreground == "" && rule.background == "" && rule.fontStyle == "" {
+			continue
+		}
+		for _, selector := range rule.scopes {
+			if strings.Contains(selector, " -") {
+				continue
+			}
+			parts := strings.Fields(selector)
+			last := parts[len(parts)-1]
+			if (last == scope || strings.HasPrefix(scope, last+".")) && len(last) >= bestLength {
+				best, bestLength = i, len(last)
+			}
+		}
+	}
+	return best
+}
+
+// isEditorColor reports whether Monaco has a VS Code color
+func isEditorColor(id string) bool {
+	for _, prefix := range editorColorPrefixes {
+		if strings.HasPrefix(id, prefix) || id == strings.TrimSuffix(prefix, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// colorGroups names the parts of the workbench colors belong to
+func colorGroups(ids []string) []string {
+	seen := map[string]bool{}
+	var groups []string
+	for _, id := range ids {
+		group := strings.SplitN(id, ".", 2)[0]
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// tokenHex writes a color as Monaco token rules take it: #rrggbb without
+// transparency
+func tokenHex(color string) string {
+	r, g, b, ok := parseHex(color)
+	if !ok {
+		return strings.TrimSpace(color)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// tokenFontStyle keeps the font styles Monaco knows
+func tokenFontStyle(style string) string {
+	var kept []string
+	for _, word := range strings.Fields(style) {
+		if fontStyles[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// parseHex reads a #rgb, #rgba, #rrggbb or #rrggbbaa color
+func parseHex(color string) (uint8, uint8, uint8, bool) {
+	color = strings.TrimSpace(color)
+	if !hexColor.MatchString(color) {
+		return 0, 0, 0, false
+	}
+	hex := color[1:]
+	if len(hex) <= 4 {
+		var expanded strings.Builder
+		for _, c := range hex {
+			expanded.WriteRune(c)
+			expanded.WriteRune(c)
+		}
+		hex = expanded.String()
+	}
+	value, err := strconv.ParseUint(hex[:6], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return uint8(value >> 16), uint8(value >> 8), uint8(value), true
+}
+
+// mix shades a hex color toward another, amount being from 0 to 1
+func mix(color string, toward string, amount float64) (string, bool) {
+	r1, g1, b1, ok1 := parseHex(color)
+	r2, g2, b2, ok2 := parseHex(toward)
+	if !ok1 || !ok2 {
+		return "", false
+	}
+	blend := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*amount))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", blend(r1, r2), blend(g1, g2), blend(b1, b2)), true
+}
+
+// withAlpha makes a color transparent, alpha being out of 255
+func withAlpha(color string, alpha uint8) string {
+	r, g, b, _ := parseHex(color)
+	return fmt.Sprintf("rgba(%d, %d, %d, %.2f)", r, g, b, math.Round(float64(alpha)/255*100)/100)
+}
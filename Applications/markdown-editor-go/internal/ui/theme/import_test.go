@@ -0,0 +1,54 @@
+package theme
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportLeavesOutColorsThatAreNotCSS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "injected-color-theme.json")
+	data := `{
+  "name": "Injected",
+  "type": "dark",
+  "colors": {
+    "editor.background": "#1e1e1e",
+    "editor.foreground": "#ccc; } body { background: url(https://example.com/x)",
+    "foreground": "#cccccc",
+    "focusBorder": "</style><script>alert(1)</script>",
+    "button.background": "#007acc",
+    "editor.selectionBackground": "expression(alert(1))"
+  },
+  "tokenColors": []
+}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	definition, report, err := ImportFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if definition.Colors.Text != "#cccccc" || definition.Colors.Accent != "#007acc" {
+		t.Errorf("colors = %+v, want the next valid VS Code colors", definition.Colors)
+	}
+	if strings.Contains(definition.Colors.Highlight, "expression") {
+		t.Errorf("highlight = %q", definition.Colors.Highlight)
+	}
+	if _, ok := definition.Editor.Colors["editor.foreground"]; ok {
+		t.Errorf("editor colors = %v, want editor.foreground left out", definition.Editor.Colors)
+	}
+
+	for _, id := range []string{"editor.foreground", "focusBorder", "editor.selectionBackground"} {
+		found := 0
+		for _, item := range report {
+			if strings.HasPrefix(item, "colors "+id+" ") && strings.HasSuffix(item, "is not a CSS color; it was left out") {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("%s is reported %d times in %q, want once", id, found, report)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package theme
+
+import (
+	"bufio"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Modes of choosing between the light and dark themes
+const (
+	ModeManual   = "manual"   // the user toggles between them
+	ModeSystem   = "system"   // the system's appearance decides
+	ModeSchedule = "schedule" // dark mode from a time of day until another
+)
+
+// clockLayout is how times of day are written in the configuration
+const clockLayout = "15:04"
+
+// SystemAppearance asks the system whether it uses a dark appearance. It
+// reads the macOS interface style and the GNOME color scheme; ok is false
+// where neither is available or the color scheme states no preference, as on
+// Windows, and the appearance the web view reports is used instead.
+func SystemAppearance() (dark bool, ok bool) {
+	switch runtime.GOOS {
+	case "darwin":
+		// The key only exists in dark mode
+		out, err := exec.Command("defaults", "read", "-g", "AppleInterfaceStyle").Output()
+		if err != nil {
+			if _, exited := err.(*exec.ExitError); exited {
+				return false, true
+			}
+			return false, false
+		}
+		return strings.Contains(strings.ToLower(string(out)), "dark"), true
+
+	case "windows":
+		return false, false
+	}
+
+	if out, err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "color-scheme").Output(); err == nil {
+		switch scheme := strings.Trim(strings.TrimSpace(string(out)), "'"); scheme {
+		case "prefer-dark":
+			return true, true
+		case "prefer-light":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// WatchSystemAppearance calls changed each time the GNOME color scheme
+// changes, until stop is closed, with a single gsettings monitor rather than a
+// check every few seconds. It returns false where the color scheme cannot be
+// watched; the macOS interface style has to be checked from time to time
+// instead.
+func WatchSystemAppearance(stop <-chan struct{}, changed func()) bool {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return false
+	}
+	// Older GNOME versions have no color scheme to watch
+	if err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "color-scheme").Run(); err != nil {
+		return false
+	}
+	cmd := exec.Command("gsettings", "monitor", "org.gnome.desktop.interface", "color-scheme")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return false
+	}
+	if err := cmd.Start(); err != nil {
+		return false
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+	go func() {
+		defer close(exited)
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			changed()
+		}
+		cmd.Wait()
+	}()
+	return true
+}
+
+// ScheduledDark reports whether a time falls in the dark period from start to
+// end, times of day written "15:04". The period spans midnight when it ends
+// earlier than it starts, and is empty when it ends as it starts; the
+// configuration rejects such a schedule.
+func ScheduledDark(now time.Time, start string, end string) bool {
+	from, err := time.Parse(clockLayout, start)
+	if err != nil {
+		return false
+	}
+	until, err := time.Parse(clockLayout, end)
+	if err != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	fromMinute := from.Hour()*60 + from.Minute()
+	untilMinute := until.Hour()*60 + until.Minute()
+	if fromMinute <= untilMinute {
+		return minute >= fromMinute && minute < untilMinute
+	}
+	return minute >= fromMinute || minute < untilMinute
+}
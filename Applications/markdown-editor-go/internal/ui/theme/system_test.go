@@ -0,0 +1,96 @@
+package theme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fakeGSettings puts a gsettings command on the path that reports a color
+// scheme and a dark GTK theme and, when monitored, prints two changes and
+// waits to be stopped
+func fakeGSettings(t *testing.T, scheme string) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the GNOME color scheme is only read on Linux and the BSDs")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = monitor ]; then
+	echo "color-scheme: 'prefer-dark'"
+	echo "color-scheme: 'prefer-light'"
+	exec sleep 60
+fi
+case "$3" in
+color-scheme) echo "'` + scheme + `'" ;;
+gtk-theme) echo "'Adwaita-dark'" ;;
+*) exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "gsettings"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSystemAppearance(t *testing.T) {
+	tests := []struct {
+		scheme   string
+		dark, ok bool
+	}{
+		{"prefer-dark", true, true},
+		{"prefer-light", false, true},
+		{"default", false, false},
+	}
+	for _, test := range tests {
+		fakeGSettings(t, test.scheme)
+		if dark, ok := SystemAppearance(); dark != test.dark || ok != test.ok {
+			t.Errorf("%s: SystemAppearance() = %v, %v, want %v, %v", test.scheme, dark, ok, test.dark, test.ok)
+		}
+	}
+}
+
+func TestWatchSystemAppearance(t *testing.T) {
+	fakeGSettings(t, "prefer-light")
+	changes := make(chan struct{}, 2)
+	stop := make(chan struct{})
+	if !WatchSystemAppearance(stop, func() { changes <- struct{}{} }) {
+		t.Fatal("the color scheme is not watched")
+	}
+	defer close(stop)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d changes, want 2", i)
+		}
+	}
+}
+
+func TestScheduledDark(t *testing.T) {
+	tests := []struct {
+		now, start, end string
+		dark            bool
+	}{
+		{"20:00", "19:00", "07:00", true},
+		{"03:00", "19:00", "07:00", true},
+		{"07:00", "19:00", "07:00", false},
+		{"12:00", "19:00", "07:00", false},
+		{"13:00", "12:00", "14:00", true},
+		{"14:00", "12:00", "14:00", false},
+		{"08:00", "08:00", "08:00", false},
+		{"12:00", "08:00", "08:00", false},
+		{"12:00", "noon", "07:00", false},
+	}
+	for _, test := range tests {
+		now, err := time.Parse(clockLayout, test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dark := ScheduledDark(now, test.start, test.end); dark != test.dark {
+			t.Errorf("ScheduledDark(%s, %s, %s) = %v, want %v", test.now, test.start, test.end, dark, test.dark)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package theme
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -33,19 +35,42 @@ type ThemeColors struct {
 	Highlight           string `json:"highlight"`
 }
 
-// Theme manages application theming
+// Theme manages application theming. Each mode, light and dark, uses a theme
+// chosen among the built-in themes and the user's theme files.
 type Theme struct {
-	ctx          context.Context
+	ctx context.Context
+
+	// Bound methods and the watchers of the settings and theme files use the
+	// theme from goroutines of their own, so what follows is guarded by mu
+	mu           sync.Mutex
 	currentTheme ThemeType
-	lightColors  ThemeColors
-	darkColors   ThemeColors
+	themes       []Definition // the built-in themes, then the user's
+	lightID      string
+	darkID       string
 }
 
-// NewTheme creates a new Theme manager
+// Ids of the built-in themes
+const (
+	LightThemeID = "light"
+	DarkThemeID  = "dark"
+)
+
+// NewTheme creates a new Theme manager with the built-in themes
 func NewTheme() *Theme {
 	return &Theme{
 		currentTheme: LightTheme,
-		lightColors: ThemeColors{
+		themes:       []Definition{lightDefinition(), darkDefinition()},
+		lightID:      LightThemeID,
+		darkID:       DarkThemeID,
+	}
+}
+
+// lightDefinition returns the built-in light theme
+func lightDefinition() Definition {
+	return Definition{
+		ID:   LightThemeID,
+		Name: "Light",
+		Colors: ThemeColors{
 			Background:          "#f9f7f7",
 			BackgroundSecondary: "#f0f0f0",
 			Text:                "#2d3436",
@@ -59,7 +84,21 @@ func NewTheme() *Theme {
 			StatusBar:           "#f0f0f0",
 			Highlight:           "rgba(116, 185, 255, 0.2)",
 		},
-		darkColors: ThemeColors{
+		Editor: EditorColors{
+			Colors: map[string]string{"editor.background": "#ffffff"},
+			Tokens: []TokenRule{},
+		},
+		Preview: DefaultTypography(),
+	}
+}
+
+// darkDefinition returns the built-in dark theme
+func darkDefinition() Definition {
+	return Definition{
+		ID:   DarkThemeID,
+		Name: "Dark",
+		Dark: true,
+		Colors: ThemeColors{
 			Background:          "#2d3436",
 			BackgroundSecondary: "#222626",
 			Text:                "#dfe6e9",
@@ -73,6 +112,11 @@ func NewTheme() *Theme {
 			StatusBar:           "#1e2022",
 			Highlight:           "rgba(108, 92, 231, 0.2)",
 		},
+		Editor: EditorColors{
+			Colors: map[string]string{"editor.background": "#232323"},
+			Tokens: []TokenRule{},
+		},
+		Preview: DefaultTypography(),
 	}
 }
 
@@ -81,62 +125,150 @@ func (t *Theme) Initialize(ctx context.Context) {
 	t.ctx = ctx
 }
 
+// LoadDir replaces the user's themes with the theme files of a folder. A file
+// named after a built-in theme replaces it. It returns the files read, to
+// watch them, and a description of what was left out.
+func (t *Theme) LoadDir(dir string) ([]string, []string) {
+	themes, files, problems := ReadDir(dir)
+
+	all := []Definition{}
+	for _, builtIn := range []Definition{lightDefinition(), darkDefinition()} {
+		if !containsTheme(themes, builtIn.ID) {
+			all = append(all, builtIn)
+		}
+	}
+	all = append(all, themes...)
+
+	t.mu.Lock()
+	t.themes = all
+	t.mu.Unlock()
+	return files, problems
+}
+
+// Select chooses the themes of the light and dark modes by id. An unknown id
+// selects the built-in theme of its mode, and is described in the problems.
+func (t *Theme) Select(lightID string, darkID string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var problems []string
+	if _, ok := t.find(lightID); !ok {
+		problems = append(problems, fmt.Sprintf("there is no theme %s; using %s", lightID, LightThemeID))
+		lightID = LightThemeID
+	}
+	if _, ok := t.find(darkID); !ok {
+		problems = append(problems, fmt.Sprintf("there is no theme %s; using %s", darkID, DarkThemeID))
+		darkID = DarkThemeID
+	}
+	t.lightID, t.darkID = lightID, darkID
+	return problems
+}
+
+// Themes returns every theme that can be selected
+func (t *Theme) Themes() []Definition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Definition{}, t.themes...)
+}
+
+// Find returns a theme by id
+func (t *Theme) Find(id string) (Definition, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.find(id)
+}
+
+func (t *Theme) find(id string) (Definition, bool) {
+	for _, definition := range t.themes {
+		if definition.ID == id {
+			return definition, true
+		}
+	}
+	return Definition{}, false
+}
+
 // ToggleTheme switches between light and dark themes
 func (t *Theme) ToggleTheme() {
-	if t.currentTheme == LightTheme {
-		t.SetTheme(DarkTheme)
+	t.mu.Lock()
+	if t.currentTheme == DarkTheme {
+		t.currentTheme = LightTheme
 	} else {
-		t.SetTheme(LightTheme)
+		t.currentTheme = DarkTheme
 	}
+	themeType := t.currentTheme
+	definition := t.definition(themeType)
+	t.mu.Unlock()
+	t.emit(themeType, definition)
 }
 
 // SetTheme changes the active theme
 func (t *Theme) SetTheme(themeType ThemeType) {
+	t.mu.Lock()
 	t.currentTheme = themeType
-	isDark := themeType == DarkTheme
+	definition := t.definition(themeType)
+	t.mu.Unlock()
+	t.emit(themeType, definition)
+}
 
-	// Emit event to frontend to update theme
+// emit sends the active theme to the frontend
+func (t *Theme) emit(themeType ThemeType, definition Definition) {
 	if t.ctx != nil {
-		runtime.EventsEmit(t.ctx, "theme:update", isDark)
+		runtime.EventsEmit(t.ctx, "theme:update", themeType == DarkTheme)
+		runtime.EventsEmit(t.ctx, "theme:definition", definition)
 	}
 }
 
 // GetCurrentTheme returns the current theme type
 func (t *Theme) GetCurrentTheme() ThemeType {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.currentTheme
 }
 
 // IsDarkMode returns true if dark mode is active
 func (t *Theme) IsDarkMode() bool {
-	return t.currentTheme == DarkTheme
+	return t.GetCurrentTheme() == DarkTheme
+}
+
+// GetCurrentDefinition returns the theme of the current mode
+func (t *Theme) GetCurrentDefinition() Definition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.definition(t.currentTheme)
+}
+
+// GetDefinition returns the theme selected for a mode
+func (t *Theme) GetDefinition(themeType ThemeType) Definition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.definition(themeType)
+}
+
+func (t *Theme) definition(themeType ThemeType) Definition {
+	id, fallback := t.lightID, lightDefinition()
+	if themeType == DarkTheme {
+		id, fallback = t.darkID, darkDefinition()
+	}
+	if definition, ok := t.find(id); ok {
+		return definition
+	}
+	return fallback
 }
 
 // GetCurrentColors returns the color palette for the current theme
 func (t *Theme) GetCurrentColors() ThemeColors {
-	if t.currentTheme == DarkTheme {
-		return t.darkColors
-	}
-	return t.lightColors
+	return t.GetCurrentDefinition().Colors
 }
 
 // GetColors returns the color palette for a specific theme
 func (t *Theme) GetColors(themeType ThemeType) ThemeColors {
-	if themeType == DarkTheme {
-		return t.darkColors
-	}
-	return t.lightColors
+	return t.GetDefinition(themeType).Colors
 }
 
-// SetCustomColors updates the color palette for a theme
-func (t *Theme) SetCustomColors(themeType ThemeType, colors ThemeColors) {
-	if themeType == DarkTheme {
-		t.darkColors = colors
-	} else {
-		t.lightColors = colors
-	}
-
-	// If updating the current theme, emit event to refresh UI
-	if themeType == t.currentTheme && t.ctx != nil {
-		runtime.EventsEmit(t.ctx, "theme:colors-update", colors)
+func containsTheme(themes []Definition, id string) bool {
+	for _, definition := range themes {
+		if definition.ID == id {
+			return true
+		}
 	}
+	return false
 }
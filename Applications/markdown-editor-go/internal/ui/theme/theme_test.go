@@ -0,0 +1,49 @@
+package theme
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestThemeFromGoroutines switches and reads the theme from several
+// goroutines at once. Run it with -race.
+func TestThemeFromGoroutines(t *testing.T) {
+	theme := NewTheme()
+	const rounds = 100
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			theme.ToggleTheme()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			theme.SetTheme(DarkTheme)
+			theme.Select(LightThemeID, DarkThemeID)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			theme.IsDarkMode()
+			theme.GetCurrentTheme()
+			theme.GetCurrentColors()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			theme.LoadDir(t.TempDir())
+		}
+	}()
+	wg.Wait()
+
+	theme.SetTheme(LightTheme)
+	theme.ToggleTheme()
+	if !theme.IsDarkMode() || theme.GetCurrentDefinition().ID != DarkThemeID {
+		t.Errorf("toggling light mode gave %s, %s", theme.GetCurrentTheme(), theme.GetCurrentDefinition().ID)
+	}
+}
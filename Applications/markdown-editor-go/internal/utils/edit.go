@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a 1-based line and column in a document, matching Monaco's model
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Range is a span of text between two positions, the end being exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextEdit replaces the text covered by a range with new text
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// LineRange returns the range covering the whole of a 1-based line, excluding its line break
+func LineRange(lines []string, line int) Range {
+	return Range{
+		Start: Position{Line: line, Column: 1},
+		End:   Position{Line: line, Column: utf16Column(lines[line-1], len(lines[line-1]))},
+	}
+}
+
+// ApplyEdits applies a set of edits to content and returns the result.
+// Edits are applied from the end of the document backwards so that earlier
+// ranges stay valid; edits overlapping one already applied are skipped.
+func ApplyEdits(content string, edits []TextEdit) string {
+	if len(edits) == 0 {
+		return content
+	}
+
+	lineOffsets := computeLineOffsets(content)
+
+	sorted := make([]TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePositions(sorted[i].Range.Start, sorted[j].Range.Start) > 0
+	})
+
+	result := content
+	limit := len(content) + 1
+	for _, edit := range sorted {
+		start := positionToOffset(content, lineOffsets, edit.Range.Start)
+		end := positionToOffset(content, lineOffsets, edit.Range.End)
+		if end < start || end > limit {
+			continue
+		}
+		result = result[:start] + edit.NewText + result[end:]
+		limit = start
+	}
+
+	return result
+}
+
+// DiffEdits returns a single edit replacing the lines that differ between
+// before and after, or no edits when they are equal
+func DiffEdits(before, after string) []TextEdit {
+	if before == after {
+		return []TextEdit{}
+	}
+
+	oldLines := strings.SplitAfter(before, "\n")
+	newLines := strings.SplitAfter(after, "\n")
+
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	lineOffsets := computeLineOffsets(before)
+	start := 0
+	for _, line := range oldLines[:prefix] {
+		start += len(line)
+	}
+	end := len(before)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		end -= len(line)
+	}
+
+	return []TextEdit{{
+		Range: Range{
+			Start: offsetToPosition(before, lineOffsets, start),
+			End:   offsetToPosition(before, lineOffsets, end),
+		},
+		NewText: strings.Join(newLines[prefix:len(newLines)-suffix], ""),
+	}}
+}
+
+// NonOverlappingEdits returns the edits in document order, dropping any edit
+// that overlaps one before it
+func NonOverlappingEdits(edits []TextEdit) []TextEdit {
+	sorted := make([]TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePositions(sorted[i].Range.Start, sorted[j].Range.Start) < 0
+	})
+
+	result := []TextEdit{}
+	for _, edit := range sorted {
+		if len(result) > 0 {
+			last := result[len(result)-1]
+			if comparePositions(edit.Range.Start, last.Range.End) < 0 ||
+				comparePositions(edit.Range.Start, last.Range.Start) == 0 {
+				continue
+			}
+		}
+		result = append(result, edit)
+	}
+	return result
+}
+
+// computeLineOffsets returns the byte offset of the start of each line
+func computeLineOffsets(content string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+// positionToOffset converts a position into a byte offset, clamping out of range values
+func positionToOffset(content string, lineOffsets []int, pos Position) int {
+	if pos.Line < 1 {
+		return 0
+	}
+	if pos.Line > len(lineOffsets) {
+		return len(content)
+	}
+
+	lineStart := lineOffsets[pos.Line-1]
+	lineEnd := len(content)
+	if pos.Line < len(lineOffsets) {
+		lineEnd = lineOffsets[pos.Line] - 1
+	}
+
+	return lineStart + byteOffset(content[lineStart:lineEnd], pos.Column)
+}
+
+// offsetToPosition converts a byte offset into a position
+func offsetToPosition(content string, lineOffsets []int, offset int) Position {
+	line := sort.Search(len(lineOffsets), func(i int) bool {
+		return lineOffsets[i] > offset
+	})
+	lineStart := lineOffsets[line-1]
+	return Position{Line: line, Column: utf16Column(content[lineStart:], offset-lineStart)}
+}
+
+// byteOffset converts a 1-based column of a line, counted in UTF-16 code
+// units as Monaco counts them, into a byte offset in the line, clamped to its
+// length
+func byteOffset(line string, column int) int {
+	units := 0
+	for offset, r := range line {
+		if units >= column-1 {
+			return offset
+		}
+		units += utf16Len(r)
+	}
+	return len(line)
+}
+
+// utf16Column converts a byte offset in a line into a 1-based column counted
+// in UTF-16 code units
+func utf16Column(line string, offset int) int {
+	column := 1
+	for _, r := range line[:offset] {
+		column += utf16Len(r)
+	}
+	return column
+}
+
+// utf16Len returns the number of UTF-16 code units of a character
+func utf16Len(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+// comparePositions returns -1, 0 or 1 depending on the order of a and b
+func comparePositions(a, b Position) int {
+	switch {
+	case a.Line < b.Line:
+		return -1
+	case a.Line > b.Line:
+		return 1
+	case a.Column < b.Column:
+		return -1
+	case a.Column > b.Column:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// splitLines splits content into lines, dropping carriage returns
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Split(content, "\n")
+}
@@ -63,8 +63,7 @@ func (f *FileUtils) EnsureExtension(path string) string {
 	}
 
 	// Check if path already has .md or .markdown extension
-	lowerPath := strings.ToLower(path)
-	if strings.HasSuffix(lowerPath, ".md") || strings.HasSuffix(lowerPath, ".markdown") {
+	if f.IsMarkdownFile(path) {
 		return path
 	}
 
@@ -72,6 +71,12 @@ func (f *FileUtils) EnsureExtension(path string) string {
 	return path + ".md"
 }
 
+// IsMarkdownFile reports whether a path has a .md or .markdown extension
+func (f *FileUtils) IsMarkdownFile(path string) bool {
+	lowerPath := strings.ToLower(path)
+	return strings.HasSuffix(lowerPath, ".md") || strings.HasSuffix(lowerPath, ".markdown")
+}
+
 // CreateTempBackup creates a temporary backup of a file
 func (f *FileUtils) CreateTempBackup(path string) (string, error) {
 	if path == "" {
@@ -0,0 +1,826 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/rivo/uniseg"
+)
+
+// Prose wrapping modes
+const (
+	// ProseWrapPreserve keeps line breaks inside paragraphs as they are
+	ProseWrapPreserve = "preserve"
+
+	// ProseWrapAlways reflows paragraphs to fit the print width
+	ProseWrapAlways = "always"
+
+	// ProseWrapNever puts every paragraph on a single line
+	ProseWrapNever = "never"
+)
+
+// Ordered list numbering styles
+const (
+	// NumberingAscending numbers ordered list items 1, 2, 3...
+	NumberingAscending = "ascending"
+
+	// NumberingOne numbers every ordered list item with the list's start number
+	NumberingOne = "one"
+)
+
+// FormatOptions controls the canonical style written by the formatter
+type FormatOptions struct {
+	BulletChar       string `json:"bulletChar"`       // "-", "*" or "+"
+	EmphasisChar     string `json:"emphasisChar"`     // "*" or "_"
+	StrongChar       string `json:"strongChar"`       // "*" or "_"
+	OrderedNumbering string `json:"orderedNumbering"` // "ascending" or "one"
+	ProseWrap        string `json:"proseWrap"`        // "preserve", "always" or "never"
+	PrintWidth       int    `json:"printWidth"`
+	AlignTables      bool   `json:"alignTables"`
+}
+
+// DefaultFormatOptions returns the default formatting style
+func DefaultFormatOptions() FormatOptions {
+	return FormatOptions{
+		BulletChar:       "-",
+		EmphasisChar:     "_",
+		StrongChar:       "*",
+		OrderedNumbering: NumberingAscending,
+		ProseWrap:        ProseWrapPreserve,
+		PrintWidth:       80,
+		AlignTables:      true,
+	}
+}
+
+// Normalize replaces invalid option values with their defaults
+func (o FormatOptions) Normalize() FormatOptions {
+	defaults := DefaultFormatOptions()
+	if o.BulletChar != "-" && o.BulletChar != "*" && o.BulletChar != "+" {
+		o.BulletChar = defaults.BulletChar
+	}
+	if o.EmphasisChar != "*" && o.EmphasisChar != "_" {
+		o.EmphasisChar = defaults.EmphasisChar
+	}
+	if o.StrongChar != "*" && o.StrongChar != "_" {
+		o.StrongChar = defaults.StrongChar
+	}
+	if o.OrderedNumbering != NumberingAscending && o.OrderedNumbering != NumberingOne {
+		o.OrderedNumbering = defaults.OrderedNumbering
+	}
+	if o.ProseWrap != ProseWrapPreserve && o.ProseWrap != ProseWrapAlways && o.ProseWrap != ProseWrapNever {
+		o.ProseWrap = defaults.ProseWrap
+	}
+	if o.PrintWidth < 20 {
+		o.PrintWidth = defaults.PrintWidth
+	}
+	return o
+}
+
+// Formatter rewrites markdown documents in a canonical style
+type Formatter struct {
+	parser  *MarkdownParser
+	options FormatOptions
+}
+
+// NewFormatter creates a formatter that parses documents with the given parser
+func NewFormatter(parser *MarkdownParser, options FormatOptions) *Formatter {
+	return &Formatter{
+		parser:  parser,
+		options: options.Normalize(),
+	}
+}
+
+// Format parses the document and writes it back in the canonical style.
+// YAML front matter is kept as it is.
+func (f *Formatter) Format(md string) string {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	lines := splitLines(md)
+
+	frontMatter := frontMatterLines(lines)
+	body := strings.Join(lines[frontMatter:], "\n")
+
+	w := &markdownWriter{
+		options:    f.options,
+		extensions: f.parser.extensions,
+	}
+	formatted := w.document(f.parser.Parse(body))
+
+	var out strings.Builder
+	if frontMatter > 0 {
+		out.WriteString(strings.Join(lines[:frontMatter], "\n"))
+		out.WriteString("\n")
+		if formatted != "" {
+			out.WriteString("\n")
+		}
+	}
+	if formatted != "" {
+		out.WriteString(formatted)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// FormatEdits returns the minimal edits that turn the document into its formatted form
+func (f *Formatter) FormatEdits(md string) []TextEdit {
+	return DiffEdits(md, f.Format(md))
+}
+
+// noBreakSpace stands in for spaces that prose wrapping must not break at
+const noBreakSpace = '\x00'
+
+// markdownWriter renders an AST back to markdown
+type markdownWriter struct {
+	options    FormatOptions
+	extensions parser.Extensions
+	footnotes  []*ast.ListItem
+}
+
+// inlineContext describes where inline content is being written
+type inlineContext struct {
+	inTable      bool
+	inHeading    bool
+	escapeDollar bool
+	taskList     bool
+	wrap         string
+}
+
+func (w *markdownWriter) document(root ast.Node) string {
+	out := w.blocks(root.GetChildren(), w.options.PrintWidth, false)
+
+	if len(w.footnotes) > 0 {
+		var notes []string
+		for _, item := range w.footnotes {
+			notes = append(notes, w.footnote(item))
+		}
+		if out != "" {
+			out += "\n\n"
+		}
+		out += strings.Join(notes, "\n\n")
+	}
+	return out
+}
+
+// blocks renders sibling block nodes separated by blank lines, or single newlines when tight
+func (w *markdownWriter) blocks(nodes []ast.Node, width int, tight bool) string {
+	separator := "\n\n"
+	if tight {
+		separator = "\n"
+	}
+
+	var parts []string
+	var previous ast.Node
+	alternate := false
+	for _, node := range nodes {
+		// The parser adds the footnote definitions as a list after the Footnotes node
+		if footnotes, ok := node.(*ast.Footnotes); ok {
+			w.collectFootnotes(footnotes)
+			continue
+		}
+		if list, ok := node.(*ast.List); ok && list.IsFootnotesList {
+			w.collectFootnotes(list)
+			continue
+		}
+
+		var out string
+		if list, ok := node.(*ast.List); ok {
+			// Adjacent lists of the same kind would merge, so alternate their markers
+			previousList, adjacent := previous.(*ast.List)
+			alternate = adjacent && sameListKind(list, previousList) && !alternate
+			out = w.list(list, width, alternate)
+		} else {
+			out = w.block(node, width)
+		}
+		previous = node
+		parts = append(parts, out)
+	}
+	return strings.Join(parts, separator)
+}
+
+func (w *markdownWriter) block(node ast.Node, width int) string {
+	switch n := node.(type) {
+	case *ast.Paragraph:
+		return w.paragraph(n, width)
+	case *ast.Heading:
+		return w.heading(n)
+	case *ast.BlockQuote:
+		return prefixLines(w.blocks(n.Children, width-2, false), "> ", ">")
+	case *ast.List:
+		return w.list(n, width, false)
+	case *ast.CodeBlock:
+		return w.codeBlock(n)
+	case *ast.HTMLBlock:
+		return strings.TrimRight(string(n.Literal), "\n")
+	case *ast.HorizontalRule:
+		return "---"
+	case *ast.Table:
+		return w.table(n)
+	case *ast.MathBlock:
+		return "$$\n" + strings.Trim(string(n.Literal), "\n") + "\n$$"
+	case *ast.Text:
+		return w.wrapProse(w.inline([]ast.Node{n}, w.proseContext(n)), width)
+	}
+
+	if container := node.AsContainer(); container != nil {
+		return w.blocks(container.Children, width, false)
+	}
+	return strings.TrimRight(string(node.AsLeaf().Literal), "\n")
+}
+
+func (w *markdownWriter) paragraph(para *ast.Paragraph, width int) string {
+	ctx := w.proseContext(para)
+	if item, ok := para.Parent.(*ast.ListItem); ok && len(item.Children) > 0 && item.Children[0] == ast.Node(para) {
+		ctx.taskList = true
+	}
+	return w.wrapProse(w.inline(para.Children, ctx), width)
+}
+
+func (w *markdownWriter) proseContext(node ast.Node) inlineContext {
+	return inlineContext{
+		escapeDollar: w.extensions&parser.MathJax != 0 && hasMathDelimiters(node),
+		wrap:         w.options.ProseWrap,
+	}
+}
+
+// hasMathDelimiters reports whether dollar signs in the text of a node could pair up as inline math
+func hasMathDelimiters(node ast.Node) bool {
+	dollars, maths := 0, 0
+	ast.WalkFunc(node, func(child ast.Node, entering bool) ast.WalkStatus {
+		switch n := child.(type) {
+		case *ast.Text:
+			dollars += strings.Count(string(n.Literal), "$")
+		case *ast.Math:
+			maths++
+		}
+		return ast.GoToNext
+	})
+	return dollars >= 2 || (dollars == 1 && maths > 0)
+}
+
+func (w *markdownWriter) heading(heading *ast.Heading) string {
+	text := w.inline(heading.Children, inlineContext{inHeading: true, wrap: ProseWrapNever})
+	text = restoreSpaces(text)
+
+	out := strings.Repeat("#", heading.Level)
+	if text != "" {
+		out += " " + text
+	}
+
+	// Keep explicit heading IDs that differ from the generated one
+	if heading.HeadingID != "" && w.extensions&parser.HeadingIDs != 0 && !isAutoHeadingID(heading.HeadingID, text) {
+		out += " {#" + heading.HeadingID + "}"
+	}
+	return out
+}
+
+// isAutoHeadingID reports whether id is what the parser generates for the heading text
+func isAutoHeadingID(id, text string) bool {
+	auto := sanitizeHeadingID(text)
+	if id == auto {
+		return true
+	}
+	suffix := strings.TrimPrefix(id, auto+"-")
+	if suffix == id {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// sanitizeHeadingID mirrors the parser's automatic heading ID generation
+func sanitizeHeadingID(text string) string {
+	var anchor []rune
+	futureDash := false
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if futureDash && len(anchor) > 0 {
+				anchor = append(anchor, '-')
+			}
+			futureDash = false
+			anchor = append(anchor, unicode.ToLower(r))
+		} else {
+			futureDash = true
+		}
+	}
+	if len(anchor) == 0 {
+		return "empty"
+	}
+	return string(anchor)
+}
+
+// sameListKind reports whether two lists would merge if written next to each other
+func sameListKind(a, b *ast.List) bool {
+	ordered := ast.ListTypeOrdered | ast.ListTypeDefinition
+	return a.ListFlags&ordered == b.ListFlags&ordered
+}
+
+func (w *markdownWriter) list(list *ast.List, width int, alternate bool) string {
+	if list.ListFlags&ast.ListTypeDefinition != 0 {
+		return w.definitionList(list, width)
+	}
+
+	ordered := list.ListFlags&ast.ListTypeOrdered != 0
+	bullet := w.options.BulletChar
+	delimiter := "."
+	if alternate {
+		if bullet == "-" {
+			bullet = "*"
+		} else {
+			bullet = "-"
+		}
+		delimiter = ")"
+	}
+
+	number := list.Start
+	if number <= 0 {
+		number = 1
+	}
+
+	var items []string
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+
+		marker := bullet
+		if ordered {
+			marker = strconv.Itoa(number) + delimiter
+			if w.options.OrderedNumbering == NumberingAscending {
+				number++
+			}
+		}
+
+		indent := len(marker) + 1
+		content := w.blocks(item.Children, width-indent, list.Tight)
+		if content == "" {
+			items = append(items, marker)
+			continue
+		}
+		items = append(items, marker+" "+prefixLines(content, strings.Repeat(" ", indent), "")[indent:])
+	}
+
+	if list.Tight {
+		return strings.Join(items, "\n")
+	}
+	return strings.Join(items, "\n\n")
+}
+
+func (w *markdownWriter) definitionList(list *ast.List, width int) string {
+	var out []string
+	for _, child := range list.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+
+		if item.ListFlags&ast.ListTypeTerm != 0 {
+			term := restoreSpaces(w.inline(blockChildren(item), inlineContext{wrap: ProseWrapNever}))
+			if len(out) > 0 {
+				out = append(out, "")
+			}
+			out = append(out, term)
+			continue
+		}
+
+		content := w.blocks(item.Children, width-2, true)
+		out = append(out, ": "+prefixLines(content, "  ", "")[2:])
+	}
+	return strings.Join(out, "\n")
+}
+
+// blockChildren returns the inline children of a node, looking through a single paragraph
+func blockChildren(node ast.Node) []ast.Node {
+	children := node.GetChildren()
+	if len(children) == 1 {
+		if para, ok := children[0].(*ast.Paragraph); ok {
+			return para.Children
+		}
+	}
+	return children
+}
+
+func (w *markdownWriter) collectFootnotes(footnotes ast.Node) {
+	ast.WalkFunc(footnotes, func(node ast.Node, entering bool) ast.WalkStatus {
+		if item, ok := node.(*ast.ListItem); ok && entering && len(item.RefLink) > 0 {
+			w.footnotes = append(w.footnotes, item)
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+}
+
+func (w *markdownWriter) footnote(item *ast.ListItem) string {
+	label := "[^" + string(item.RefLink) + "]: "
+
+	var content string
+	if len(item.Children) > 0 && item.Children[0].AsLeaf() != nil {
+		// Single paragraph notes hold their inline content directly
+		content = w.wrapProse(w.inline(item.Children, w.proseContext(item)), w.options.PrintWidth-4)
+	} else {
+		content = w.blocks(item.Children, w.options.PrintWidth-4, false)
+	}
+	return label + prefixLines(content, "    ", "")[4:]
+}
+
+func (w *markdownWriter) codeBlock(block *ast.CodeBlock) string {
+	content := strings.TrimSuffix(string(block.Literal), "\n")
+
+	fenceLen := 3
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		run := len(trimmed) - len(strings.TrimLeft(trimmed, "`"))
+		if run >= fenceLen {
+			fenceLen = run + 1
+		}
+	}
+	fence := strings.Repeat("`", fenceLen)
+
+	out := fence + string(block.Info) + "\n"
+	if content != "" || len(block.Literal) > 0 {
+		out += content + "\n"
+	}
+	return out + fence
+}
+
+func (w *markdownWriter) table(table *ast.Table) string {
+	var header []string
+	var aligns []CellAlign
+	var body, footer [][]string
+
+	for _, section := range table.Children {
+		for _, row := range section.GetChildren() {
+			var cells []string
+			for _, child := range row.GetChildren() {
+				cell, ok := child.(*ast.TableCell)
+				if !ok {
+					continue
+				}
+				text := w.inline(cell.Children, inlineContext{inTable: true, wrap: ProseWrapNever})
+				cells = append(cells, restoreSpaces(text))
+				if _, isHeader := section.(*ast.TableHeader); isHeader {
+					aligns = append(aligns, cellAlignFromAST(cell.Align))
+				}
+			}
+
+			switch section.(type) {
+			case *ast.TableHeader:
+				header = cells
+			case *ast.TableFooter:
+				footer = append(footer, cells)
+			default:
+				body = append(body, cells)
+			}
+		}
+	}
+
+	return strings.Join(FormatPipeTable(header, aligns, body, footer, w.options.AlignTables), "\n")
+}
+
+// inline renders inline nodes. Spaces that must not be broken by prose
+// wrapping are written as noBreakSpace and restored after wrapping.
+func (w *markdownWriter) inline(nodes []ast.Node, ctx inlineContext) string {
+	var out strings.Builder
+	for i := 0; i < len(nodes); i++ {
+		// Escape runs of text together so escapes can look at neighbouring characters
+		if _, ok := nodes[i].(*ast.Text); ok {
+			var run strings.Builder
+			for ; i < len(nodes); i++ {
+				text, ok := nodes[i].(*ast.Text)
+				if !ok {
+					break
+				}
+				run.Write(text.Literal)
+			}
+			i--
+			out.WriteString(w.escapeText(run.String(), ctx, out.Len() == 0))
+			continue
+		}
+		out.WriteString(w.inlineNode(nodes[i], ctx))
+	}
+	return out.String()
+}
+
+func (w *markdownWriter) inlineNode(node ast.Node, ctx inlineContext) string {
+	ctx.taskList = false
+
+	switch n := node.(type) {
+	case *ast.Emph:
+		marker := w.delimiter(n, w.options.EmphasisChar)
+		return marker + w.inline(n.Children, ctx) + marker
+	case *ast.Strong:
+		marker := w.delimiter(n, w.options.StrongChar)
+		return marker + marker + w.inline(n.Children, ctx) + marker + marker
+	case *ast.Del:
+		return "~~" + w.inline(n.Children, ctx) + "~~"
+	case *ast.Code:
+		return codeSpan(string(n.Literal))
+	case *ast.Link:
+		return w.link(n, ctx)
+	case *ast.Image:
+		return "!" + "[" + w.inline(n.Children, ctx) + "]" + linkTarget(string(n.Destination), string(n.Title))
+	case *ast.Hardbreak:
+		if ctx.inTable || ctx.inHeading {
+			return " "
+		}
+		return "\\\n"
+	case *ast.Softbreak:
+		return "\n"
+	case *ast.NonBlockingSpace:
+		return "\\ "
+	case *ast.HTMLSpan:
+		return nonBreaking(string(n.Literal))
+	case *ast.Math:
+		return "$" + nonBreaking(string(n.Literal)) + "$"
+	case *ast.Subscript:
+		return "~" + string(n.Literal) + "~"
+	case *ast.Superscript:
+		return "^" + string(n.Literal) + "^"
+	}
+
+	if container := node.AsContainer(); container != nil {
+		return w.inline(container.Children, ctx)
+	}
+	return string(node.AsLeaf().Literal)
+}
+
+// delimiter picks the emphasis character for a node, switching to the other
+// character when nested directly in emphasis written with the same one
+func (w *markdownWriter) delimiter(node ast.Node, preferred string) string {
+	other := "*"
+	if preferred == "*" {
+		other = "_"
+	}
+
+	switch node.GetParent().(type) {
+	case *ast.Emph:
+		if w.options.EmphasisChar == preferred {
+			return other
+		}
+	case *ast.Strong:
+		if w.options.StrongChar == preferred {
+			return other
+		}
+	}
+	return preferred
+}
+
+func (w *markdownWriter) link(link *ast.Link, ctx inlineContext) string {
+	if link.NoteID != 0 {
+		label := link.DeferredID
+		if len(label) == 0 {
+			label = link.Destination
+		}
+		return "[^" + string(label) + "]"
+	}
+
+	destination := string(link.Destination)
+	text := NodeText(link)
+	if len(link.Title) == 0 && isAutolinkTarget(destination) &&
+		(text == destination || "mailto:"+text == destination) && len(link.Children) == 1 {
+		return "<" + destination + ">"
+	}
+
+	return "[" + w.inline(link.Children, ctx) + "]" + linkTarget(destination, string(link.Title))
+}
+
+// isAutolinkTarget reports whether a destination can be written as <destination>
+func isAutolinkTarget(destination string) bool {
+	scheme := strings.Index(destination, ":")
+	if scheme < 2 || strings.ContainsAny(destination, " <>\n") {
+		return false
+	}
+	for _, r := range destination[:scheme] {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '+' && r != '.' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// linkTarget writes the (destination "title") part of a link or image
+func linkTarget(destination, title string) string {
+	if destination == "" || strings.ContainsAny(destination, " ()<>") {
+		destination = "<" + destination + ">"
+	}
+
+	out := "(" + destination
+	if title != "" {
+		out += ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+	}
+	return nonBreaking(out + ")")
+}
+
+// codeSpan wraps code in enough backticks to contain it
+func codeSpan(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + nonBreaking(code) + fence
+}
+
+// nonBreaking protects the spaces and line breaks of s from prose wrapping
+func nonBreaking(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, " ", string(noBreakSpace))
+}
+
+// restoreSpaces turns protected spaces back into regular spaces
+func restoreSpaces(s string) string {
+	return strings.ReplaceAll(s, string(noBreakSpace), " ")
+}
+
+var entityPattern = regexp.MustCompile(`^&#?[A-Za-z0-9]+;`)
+
+// escapeText escapes the characters of plain text that would otherwise be read as markup
+func (w *markdownWriter) escapeText(text string, ctx inlineContext, atStart bool) string {
+	var out strings.Builder
+	runes := []rune(text)
+	for i, r := range runes {
+		prev, next := ' ', ' '
+		if i > 0 {
+			prev = runes[i-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		escape := false
+		switch r {
+		case '\\':
+			escape = i+1 == len(runes) || strings.ContainsRune(string(parser.EscapeChars), next)
+		case '`', '~', '[', ']':
+			escape = true
+			if ctx.taskList && atStart && (r == '[' && i == 0 || r == ']' && i == 2) && isTaskListMarker(text) {
+				escape = false
+			}
+		case '*':
+			escape = !unicode.IsSpace(prev) || !unicode.IsSpace(next)
+		case '_':
+			escape = w.extensions&parser.NoIntraEmphasis == 0 || !isWordRune(prev) || !isWordRune(next)
+		case '<':
+			escape = unicode.IsLetter(next) || next == '/' || next == '!' || next == '?'
+		case '&':
+			escape = entityPattern.MatchString(string(runes[i:]))
+		case '$':
+			escape = ctx.escapeDollar
+		case '|':
+			escape = ctx.inTable
+		case '#':
+			escape = ctx.inHeading && i+1 == len(runes)
+		case '{':
+			escape = ctx.inHeading && next == '#'
+		case '\n':
+			if ctx.inTable || ctx.inHeading || ctx.wrap != ProseWrapPreserve {
+				out.WriteRune(' ')
+				continue
+			}
+		}
+
+		if escape {
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// isTaskListMarker reports whether text starts with a task list checkbox
+func isTaskListMarker(text string) bool {
+	return len(text) >= 4 && text[0] == '[' && text[2] == ']' && text[3] == ' ' &&
+		(text[1] == ' ' || text[1] == 'x' || text[1] == 'X')
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wrapProse lays out rendered inline text according to the wrap mode and
+// escapes line starts that would be read as block markup
+func (w *markdownWriter) wrapProse(text string, width int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if w.options.ProseWrap == ProseWrapAlways {
+			lines = append(lines, wrapLine(line, width)...)
+		} else {
+			lines = append(lines, line)
+		}
+	}
+
+	for i, line := range lines {
+		lines[i] = restoreSpaces(escapeLineStart(strings.TrimLeft(line, " ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLine breaks a line into lines no wider than width where possible
+func wrapLine(line string, width int) []string {
+	if width < 20 {
+		width = 20
+	}
+
+	hardBreak := strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\")
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	current := words[0]
+	for _, word := range words[1:] {
+		if TextWidth(current)+1+TextWidth(word) > width && !startsBlock(word) {
+			lines = append(lines, current)
+			current = word
+			continue
+		}
+		current += " " + word
+	}
+	lines = append(lines, current)
+
+	if hardBreak && !strings.HasSuffix(lines[len(lines)-1], "\\") {
+		lines[len(lines)-1] += "\\"
+	}
+	return lines
+}
+
+// startsBlock reports whether a word at the start of a line could open a block
+func startsBlock(word string) bool {
+	if word == "" {
+		return false
+	}
+	switch word[0] {
+	case '#', '>', '-', '+', '*', '=', '|', ':', '$':
+		return true
+	}
+	_, _, ok := parseListMarker(word + " ")
+	return ok
+}
+
+// escapeLineStart escapes a leading character that would start a block construct
+func escapeLineStart(line string) string {
+	if line == "" {
+		return line
+	}
+
+	switch line[0] {
+	case '#', '>', '+', '-', '*', ':':
+		if line[0] == '#' || line[0] == '>' || len(line) == 1 || line[1] == ' ' || line[1] == '\t' ||
+			strings.Trim(line, "-* ") == "" {
+			return "\\" + line
+		}
+		return line
+	}
+
+	if _, marker, ok := parseListMarker(line); ok && marker[0] >= '0' && marker[0] <= '9' {
+		return marker[:len(marker)-1] + "\\" + line[len(marker)-1:]
+	}
+	return line
+}
+
+// prefixLines prefixes every line of text; blank lines get blankPrefix instead
+func prefixLines(text, prefix, blankPrefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blankPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TextWidth returns the display width of text in monospace columns, counting
+// wide characters such as CJK as two columns
+func TextWidth(text string) int {
+	if isASCII(text) {
+		return len(text)
+	}
+	return uniseg.StringWidth(text)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// formatTests are documents that formatting must leave stable and equivalent
+var formatTests = []struct {
+	name string
+	md   string
+}{
+	{"escaped star", "\\* star\n"},
+	{"escaped plus and dash", "\\+ plus\n\n\\- dash\n"},
+	{"escaped heading and quote", "\\# not a heading\n\n\\> not a quote\n"},
+	{"escaped ordered marker", "1\\. not a list\n"},
+	{"escaped thematic break", "\\*\\*\\*\n\n\\---\n"},
+	{"escaped inline markup", "a \\*b\\* \\_c\\_ \\`d\\` \\[e\\] \\<f> \\&amp;\n"},
+	{"star in the middle of a wrapped line", "one two\n\\* three\n"},
+	{"bullet lists", "* one\n* two\n  + nested\n  + items\n"},
+	{"ordered lists", "3. three\n7. four\n\n   continued\n"},
+	{"task list", "- [ ] todo\n- [x] done\n"},
+	{"table", "| a | b |\n|:--|--:|\n| 1 | 22 |\n| x \\| y | z |\n"},
+	{"unaligned table", "a|b\n-|-\n1|2\n"},
+	{"front matter", "---\ntitle: Test\ntags: [a, b]\n---\n# Heading\n\nText\n"},
+	{"front matter only", "---\ntitle: Test\n---\n"},
+	{"emphasis", "_one_ __two__ *three* **four**\n"},
+	{"code", "Inline `code` here.\n\n```go\nfunc main() {}\n```\n\n    indented\n"},
+	{"links", "[text](http://example.com \"title\") <http://example.com> ![img](a.png)\n"},
+	{"quote with list", "> * one\n> * two\n>\n> text\n"},
+	{"headings", "Title\n=====\n\nSub\n---\n\n### Third ###\n"},
+	{"hard breaks", "line one\\\nline two  \nline three\n"},
+	{"long paragraph", "A paragraph long enough to be wrapped, with a [link to a page](http://example.com), *some emphasis* and `code` in it.\n"},
+	{"long list items", "- an item long enough to be wrapped\n  over two lines\n- short\n"},
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	for _, wrap := range []string{ProseWrapPreserve, ProseWrapAlways, ProseWrapNever} {
+		options := DefaultFormatOptions()
+		options.ProseWrap = wrap
+		options.PrintWidth = 20
+		formatter := NewFormatter(NewMarkdownParser(), options)
+		for _, test := range formatTests {
+			once := formatter.Format(test.md)
+			twice := formatter.Format(once)
+			if once != twice {
+				t.Errorf("%s (wrap %s): formatting is not idempotent\ninput:\n%s\nonce:\n%s\ntwice:\n%s", test.name, wrap, test.md, once, twice)
+			}
+		}
+	}
+}
+
+func TestFormatKeepsHTML(t *testing.T) {
+	// Whitespace is left out, as wrapping and indenting change it
+	squash := func(html string) string { return strings.Join(strings.Fields(html), "") }
+
+	parser := NewMarkdownParser()
+	for _, wrap := range []string{ProseWrapPreserve, ProseWrapAlways, ProseWrapNever} {
+		options := DefaultFormatOptions()
+		options.ProseWrap = wrap
+		options.PrintWidth = 20
+		formatter := NewFormatter(parser, options)
+		for _, test := range formatTests {
+			formatted := formatter.Format(test.md)
+			before, after := parser.MarkdownToHTML(test.md), parser.MarkdownToHTML(formatted)
+			if squash(before) != squash(after) {
+				t.Errorf("%s (wrap %s): formatting changes the HTML\ninput:\n%s\nformatted:\n%s\nHTML before:\n%s\nHTML after:\n%s", test.name, wrap, test.md, formatted, before, after)
+			}
+		}
+	}
+}
+
+func TestFormatKeepsEscapes(t *testing.T) {
+	tests := []struct {
+		md   string
+		want string
+	}{
+		{"\\* star\n", "\\* star\n"},
+		{"\\+ plus\n", "\\+ plus\n"},
+		{"\\- dash\n", "\\- dash\n"},
+		{"\\# hash\n", "\\# hash\n"},
+		{"1\\. one\n", "1\\. one\n"},
+	}
+
+	formatter := NewFormatter(NewMarkdownParser(), DefaultFormatOptions())
+	for _, test := range tests {
+		if got := formatter.Format(test.md); got != test.want {
+			t.Errorf("Format(%q) = %q, want %q", test.md, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"strings"
+)
+
+// FrontMatter holds the metadata of a YAML front matter block. Values are
+// strings or, for YAML lists, []string; nested mappings are not supported.
+type FrontMatter map[string]interface{}
+
+// SplitFrontMatter separates a leading front matter block from the markdown body
+func SplitFrontMatter(md string) (FrontMatter, string) {
+	lines := splitLines(md)
+	count := frontMatterLines(lines)
+	if count == 0 {
+		return FrontMatter{}, md
+	}
+	return ParseFrontMatter(lines[1 : count-1]), strings.Join(lines[count:], "\n")
+}
+
+// ParseFrontMatter reads the simple YAML subset used in front matter:
+// "key: value" pairs, quoted strings, and lists written inline as [a, b] or
+// as "- item" lines below their key
+func ParseFrontMatter(lines []string) FrontMatter {
+	matter := FrontMatter{}
+	key := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// List items belong to the last key
+		if strings.HasPrefix(trimmed, "- ") && key != "" {
+			items, _ := matter[key].([]string)
+			matter[key] = append(items, unquoteYAML(trimmed[2:]))
+			continue
+		}
+
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key = strings.TrimSpace(trimmed[:colon])
+		value := strings.TrimSpace(trimmed[colon+1:])
+
+		switch {
+		case value == "":
+			matter[key] = []string{}
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			items := []string{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquoteYAML(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			matter[key] = items
+		default:
+			matter[key] = unquoteYAML(value)
+		}
+	}
+	return matter
+}
+
+// String returns a value as a string, joining lists with commas
+func (m FrontMatter) String(key string) string {
+	switch value := m[key].(type) {
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ", ")
+	default:
+		return ""
+	}
+}
+
+// Strings returns a value as a list, a plain string being a single item
+func (m FrontMatter) Strings(key string) []string {
+	switch value := m[key].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	default:
+		return nil
+	}
+}
+
+// unquoteYAML trims a scalar and removes its quotes and trailing comment
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
@@ -0,0 +1,535 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// LintConfigFiles are the workspace files searched for lint configuration, in order
+var LintConfigFiles = []string{".markdownlint.json", ".markdownlintrc"}
+
+// Diagnostic is a single problem reported by the linter
+type Diagnostic struct {
+	RuleID   string    `json:"ruleId"`
+	RuleName string    `json:"ruleName"`
+	Message  string    `json:"message"`
+	Severity string    `json:"severity"`
+	Range    Range     `json:"range"`
+	Fix      *TextEdit `json:"fix,omitempty"`
+}
+
+// LintRule describes a lint rule and how to check a document against it
+type LintRule struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Fixable     bool   `json:"fixable"`
+
+	check func(doc *lintDocument, opts ruleOptions) []Diagnostic
+}
+
+// LintConfig holds the rule settings of a workspace, in markdownlint format.
+// Each rule is keyed by its ID or name and set to true, false or an object of options.
+type LintConfig struct {
+	Default bool
+	Rules   map[string]interface{}
+}
+
+// DefaultLintConfig returns a configuration with every rule enabled
+func DefaultLintConfig() *LintConfig {
+	return &LintConfig{
+		Default: true,
+		Rules:   map[string]interface{}{},
+	}
+}
+
+// UnmarshalJSON reads a markdownlint style configuration object
+func (c *LintConfig) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	c.Default = true
+	c.Rules = map[string]interface{}{}
+	for key, value := range raw {
+		switch key {
+		case "default":
+			enabled, ok := value.(bool)
+			if !ok {
+				return errors.New("lint config: \"default\" must be a boolean")
+			}
+			c.Default = enabled
+		case "$schema", "extends":
+			// Not supported, ignored
+		default:
+			c.Rules[strings.ToUpper(key)] = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the configuration back in markdownlint format
+func (c *LintConfig) MarshalJSON() ([]byte, error) {
+	raw := map[string]interface{}{"default": c.Default}
+	for key, value := range c.Rules {
+		raw[key] = value
+	}
+	return json.Marshal(raw)
+}
+
+// LoadLintConfig looks for a lint configuration file in dir and its parents.
+// The default configuration is returned when no file is found.
+func LoadLintConfig(dir string) (*LintConfig, error) {
+	path := FindLintConfig(dir)
+	if path == "" {
+		return DefaultLintConfig(), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return DefaultLintConfig(), err
+	}
+
+	config := DefaultLintConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return DefaultLintConfig(), errors.New(path + ": " + err.Error())
+	}
+	return config, nil
+}
+
+// FindLintConfig returns the path of the nearest lint configuration file, or ""
+func FindLintConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		for _, name := range LintConfigFiles {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ruleSetting returns whether a rule is enabled and its options
+func (c *LintConfig) ruleSetting(rule *LintRule) (bool, ruleOptions) {
+	value, ok := c.Rules[rule.ID]
+	if !ok {
+		value, ok = c.Rules[strings.ToUpper(rule.Name)]
+	}
+	if !ok {
+		return c.Default, ruleOptions{}
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, ruleOptions{}
+	case map[string]interface{}:
+		if enabled, ok := v["enabled"].(bool); ok && !enabled {
+			return false, ruleOptions{}
+		}
+		return true, ruleOptions(v)
+	default:
+		return c.Default, ruleOptions{}
+	}
+}
+
+// ruleOptions holds the options configured for a single rule
+type ruleOptions map[string]interface{}
+
+func (o ruleOptions) intOption(name string, def int) int {
+	if value, ok := o[name].(float64); ok {
+		return int(value)
+	}
+	return def
+}
+
+func (o ruleOptions) boolOption(name string, def bool) bool {
+	if value, ok := o[name].(bool); ok {
+		return value
+	}
+	return def
+}
+
+func (o ruleOptions) stringOption(name string, def string) string {
+	if value, ok := o[name].(string); ok {
+		return value
+	}
+	return def
+}
+
+// Linter checks markdown documents against a set of configurable rules
+type Linter struct {
+	parser *MarkdownParser
+	config *LintConfig
+}
+
+// NewLinter creates a linter that parses documents with the given parser
+func NewLinter(parser *MarkdownParser, config *LintConfig) *Linter {
+	if config == nil {
+		config = DefaultLintConfig()
+	}
+	return &Linter{
+		parser: parser,
+		config: config,
+	}
+}
+
+// Rules returns every rule known to the linter
+func (l *Linter) Rules() []LintRule {
+	return lintRules
+}
+
+// Lint checks the document and returns the diagnostics sorted by position
+func (l *Linter) Lint(md string) []Diagnostic {
+	doc := newLintDocument(l.parser, md)
+
+	diagnostics := []Diagnostic{}
+	for i := range lintRules {
+		rule := &lintRules[i]
+		enabled, opts := l.config.ruleSetting(rule)
+		if !enabled {
+			continue
+		}
+
+		for _, diagnostic := range rule.check(doc, opts) {
+			diagnostic.RuleID = rule.ID
+			diagnostic.RuleName = rule.Name
+			if diagnostic.Severity == "" {
+				diagnostic.Severity = "warning"
+			}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return comparePositions(diagnostics[i].Range.Start, diagnostics[j].Range.Start) < 0
+	})
+	return diagnostics
+}
+
+// Fixes returns the autofix edits of the given diagnostics.
+// Fixes overlapping an earlier one are left for a later pass.
+func (l *Linter) Fixes(diagnostics []Diagnostic) []TextEdit {
+	var edits []TextEdit
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Fix != nil {
+			edits = append(edits, *diagnostic.Fix)
+		}
+	}
+	return NonOverlappingEdits(edits)
+}
+
+// FixAll applies every available autofix and returns the fixed document.
+// Overlapping fixes are resolved by linting again after each pass.
+func (l *Linter) FixAll(md string) string {
+	for pass := 0; pass < 10; pass++ {
+		edits := l.Fixes(l.Lint(md))
+		if len(edits) == 0 {
+			break
+		}
+
+		fixed := ApplyEdits(md, edits)
+		if fixed == md {
+			break
+		}
+		md = fixed
+	}
+	return md
+}
+
+// lintDocument is a parsed document shared by all rules
+type lintDocument struct {
+	source      string
+	lines       []string
+	lineOffsets []int
+	root        ast.Node
+
+	// frontMatter is the number of lines taken by YAML front matter
+	frontMatter int
+
+	// codeLines marks the lines belonging to fenced code blocks, fences included
+	codeLines []bool
+
+	// fences lists the 1-based line numbers of opening code fences
+	fences []int
+}
+
+// newLintDocument parses md, blanking front matter so the AST keeps line numbers
+func newLintDocument(parser *MarkdownParser, md string) *lintDocument {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	doc := &lintDocument{
+		source:      md,
+		lines:       splitLines(md),
+		lineOffsets: computeLineOffsets(md),
+	}
+
+	doc.frontMatter = frontMatterLines(doc.lines)
+	body := md
+	if doc.frontMatter > 0 {
+		blank := strings.Repeat("\n", doc.frontMatter)
+		body = blank + strings.Join(doc.lines[doc.frontMatter:], "\n")
+	}
+	doc.root = parser.Parse(body)
+
+	doc.scanCodeBlocks()
+	return doc
+}
+
+// frontMatterLines returns the number of lines of a leading YAML front matter block
+func frontMatterLines(lines []string) int {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " ") != "---" {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		trimmed := strings.TrimRight(lines[i], " ")
+		if trimmed == "---" || trimmed == "..." {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// scanCodeBlocks marks the lines that are part of fenced code blocks
+func (d *lintDocument) scanCodeBlocks() {
+	inCode, openings := scanFences(d.lines[d.frontMatter:])
+
+	d.codeLines = make([]bool, len(d.lines))
+	copy(d.codeLines[d.frontMatter:], inCode)
+	for _, opening := range openings {
+		d.fences = append(d.fences, d.frontMatter+opening+1)
+	}
+}
+
+// isCode reports whether the 1-based line is inside a fenced code block
+func (d *lintDocument) isCode(line int) bool {
+	return d.codeLines[line-1]
+}
+
+// isFrontMatter reports whether the 1-based line belongs to the front matter
+func (d *lintDocument) isFrontMatter(line int) bool {
+	return line <= d.frontMatter
+}
+
+// isContent reports whether the 1-based line is regular markdown
+func (d *lintDocument) isContent(line int) bool {
+	return !d.isFrontMatter(line) && !d.isCode(line)
+}
+
+// isBlank reports whether the 1-based line is empty or whitespace
+func (d *lintDocument) isBlank(line int) bool {
+	return strings.TrimSpace(d.lines[line-1]) == ""
+}
+
+// rangeAt returns the range of length bytes starting at a byte offset
+func (d *lintDocument) rangeAt(offset, length int) Range {
+	return Range{
+		Start: offsetToPosition(d.source, d.lineOffsets, offset),
+		End:   offsetToPosition(d.source, d.lineOffsets, offset+length),
+	}
+}
+
+// position returns the position of a byte offset in a 1-based line
+func (d *lintDocument) position(line, offset int) Position {
+	return Position{Line: line, Column: utf16Column(d.lines[line-1], offset)}
+}
+
+// indexFrom returns the offset of the next occurrence of needle outside code blocks, or -1
+func (d *lintDocument) indexFrom(needle string, from int) int {
+	for from <= len(d.source) {
+		idx := strings.Index(d.source[from:], needle)
+		if idx < 0 {
+			return -1
+		}
+		offset := from + idx
+		if d.isContent(offsetToPosition(d.source, d.lineOffsets, offset).Line) {
+			return offset
+		}
+		from = offset + len(needle)
+	}
+	return -1
+}
+
+// headingLine is an ATX or setext heading found by scanning the source
+type headingLine struct {
+	line   int
+	atx    bool
+	prefix int // length of the text before the heading marker, such as a block quote
+}
+
+// headingLines scans the document for heading lines outside code blocks
+func (d *lintDocument) headingLines() []headingLine {
+	var headings []headingLine
+	for i := d.frontMatter; i < len(d.lines); i++ {
+		line := i + 1
+		if d.isCode(line) {
+			continue
+		}
+
+		stripped := stripBlockQuote(d.lines[i])
+		prefix := len(d.lines[i]) - len(stripped)
+		trimmed := strings.TrimLeft(stripped, " ")
+		if len(stripped)-len(trimmed) <= 3 && atxHeadingLevel(trimmed) > 0 {
+			headings = append(headings, headingLine{line: line, atx: true, prefix: prefix})
+			continue
+		}
+
+		if i+1 < len(d.lines) && strings.TrimSpace(stripped) != "" && !d.codeLines[i+1] {
+			if isSetextUnderline(stripBlockQuote(d.lines[i+1])) && !isListItemLine(stripped) {
+				headings = append(headings, headingLine{line: line, prefix: prefix})
+				i++
+			}
+		}
+	}
+	return headings
+}
+
+// locatedHeading pairs a heading node with its position in the source
+type locatedHeading struct {
+	node *ast.Heading
+	text string
+	headingLine
+}
+
+// headings returns the AST headings matched with their source lines
+func (d *lintDocument) headings() []locatedHeading {
+	lines := d.headingLines()
+
+	var headings []locatedHeading
+	ast.WalkFunc(d.root, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || len(headings) >= len(lines) {
+			return ast.GoToNext
+		}
+		headings = append(headings, locatedHeading{
+			node:        heading,
+			text:        strings.TrimSpace(NodeText(heading)),
+			headingLine: lines[len(headings)],
+		})
+		return ast.SkipChildren
+	})
+	return headings
+}
+
+// parseFence returns the fence character, length and info string of a fence line
+func parseFence(line string) (byte, int, string) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return 0, 0, ""
+	}
+
+	char := trimmed[0]
+	if char != '`' && char != '~' {
+		return 0, 0, ""
+	}
+
+	length := 0
+	for length < len(trimmed) && trimmed[length] == char {
+		length++
+	}
+	if length < 3 {
+		return 0, 0, ""
+	}
+
+	info := strings.TrimSpace(trimmed[length:])
+	if char == '`' && strings.Contains(info, "`") {
+		return 0, 0, ""
+	}
+	return char, length, info
+}
+
+// stripBlockQuote removes leading block quote markers from a line
+func stripBlockQuote(line string) string {
+	for {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 || !strings.HasPrefix(trimmed, ">") {
+			return line
+		}
+		line = strings.TrimPrefix(trimmed[1:], " ")
+	}
+}
+
+// atxHeadingLevel returns the level of an ATX heading line, or 0
+func atxHeadingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0
+	}
+	if level < len(line) && line[level] != ' ' && line[level] != '\t' {
+		return 0
+	}
+	return level
+}
+
+// isSetextUnderline reports whether a line underlines a setext heading
+func isSetextUnderline(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return false
+	}
+	return strings.Trim(trimmed, "=") == "" || strings.Trim(trimmed, "-") == ""
+}
+
+// isListItemLine reports whether a line starts a list item
+func isListItemLine(line string) bool {
+	_, _, ok := parseListMarker(line)
+	return ok
+}
+
+// parseListMarker returns the indentation and marker of a list item line.
+// Ordered markers are returned with their number, such as "1.".
+func parseListMarker(line string) (int, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if trimmed == "" {
+		return 0, "", false
+	}
+
+	switch trimmed[0] {
+	case '-', '*', '+':
+		if len(trimmed) == 1 || trimmed[1] == ' ' || trimmed[1] == '\t' {
+			if strings.Trim(strings.Replace(trimmed, " ", "", -1), string(trimmed[0])) == "" && len(trimmed) >= 3 {
+				// A thematic break such as "- - -" or "***"
+				return 0, "", false
+			}
+			return indent, trimmed[:1], true
+		}
+		return 0, "", false
+	}
+
+	digits := 0
+	for digits < len(trimmed) && digits < 9 && trimmed[digits] >= '0' && trimmed[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits >= len(trimmed) || (trimmed[digits] != '.' && trimmed[digits] != ')') {
+		return 0, "", false
+	}
+	if digits+1 < len(trimmed) && trimmed[digits+1] != ' ' && trimmed[digits+1] != '\t' {
+		return 0, "", false
+	}
+	return indent, trimmed[:digits+1], true
+}
@@ -0,0 +1,623 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// lintRules lists the built-in rules, named after their markdownlint equivalents
+var lintRules = []LintRule{
+	{ID: "MD001", Name: "heading-increment", Description: "Heading levels should only increment by one level at a time", check: checkHeadingIncrement},
+	{ID: "MD004", Name: "ul-style", Description: "Unordered list style", Fixable: true, check: checkListStyle},
+	{ID: "MD007", Name: "ul-indent", Description: "Unordered list indentation", Fixable: true, check: checkListIndent},
+	{ID: "MD009", Name: "no-trailing-spaces", Description: "Trailing spaces", Fixable: true, check: checkTrailingSpaces},
+	{ID: "MD010", Name: "no-hard-tabs", Description: "Hard tabs", Fixable: true, check: checkHardTabs},
+	{ID: "MD012", Name: "no-multiple-blanks", Description: "Multiple consecutive blank lines", Fixable: true, check: checkMultipleBlanks},
+	{ID: "MD013", Name: "line-length", Description: "Line length", check: checkLineLength},
+	{ID: "MD018", Name: "no-missing-space-atx", Description: "No space after hash on atx style heading", Fixable: true, check: checkMissingSpaceATX},
+	{ID: "MD022", Name: "blanks-around-headings", Description: "Headings should be surrounded by blank lines", Fixable: true, check: checkBlanksAroundHeadings},
+	{ID: "MD024", Name: "no-duplicate-heading", Description: "Multiple headings with the same content", check: checkDuplicateHeadings},
+	{ID: "MD025", Name: "single-h1", Description: "Multiple top-level headings in the same document", check: checkSingleH1},
+	{ID: "MD026", Name: "no-trailing-punctuation", Description: "Trailing punctuation in heading", Fixable: true, check: checkHeadingPunctuation},
+	{ID: "MD031", Name: "blanks-around-fences", Description: "Fenced code blocks should be surrounded by blank lines", Fixable: true, check: checkBlanksAroundFences},
+	{ID: "MD034", Name: "no-bare-urls", Description: "Bare URL used", Fixable: true, check: checkBareURLs},
+	{ID: "MD040", Name: "fenced-code-language", Description: "Fenced code blocks should have a language specified", check: checkFenceLanguage},
+	{ID: "MD042", Name: "no-empty-links", Description: "No empty links", check: checkEmptyLinks},
+	{ID: "MD045", Name: "no-alt-text", Description: "Images should have alternate text (alt text)", check: checkImageAltText},
+	{ID: "MD047", Name: "single-trailing-newline", Description: "Files should end with a single newline character", Fixable: true, check: checkTrailingNewline},
+}
+
+// MD001
+func checkHeadingIncrement(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	previous := 0
+	for _, heading := range doc.headings() {
+		level := heading.node.Level
+		if previous > 0 && level > previous+1 {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Expected h%d, found h%d", previous+1, level),
+				Range:   LineRange(doc.lines, heading.line),
+			})
+		}
+		previous = level
+	}
+	return diagnostics
+}
+
+// MD004
+func checkListStyle(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	styles := map[string]string{"dash": "-", "asterisk": "*", "plus": "+"}
+	expected := styles[opts.stringOption("style", "consistent")]
+
+	var diagnostics []Diagnostic
+	for line := 1; line <= len(doc.lines); line++ {
+		if !doc.isContent(line) {
+			continue
+		}
+		text := stripBlockQuote(doc.lines[line-1])
+		indent, marker, ok := parseListMarker(text)
+		if !ok || (marker != "-" && marker != "*" && marker != "+") {
+			continue
+		}
+		if expected == "" {
+			expected = marker
+			continue
+		}
+		if marker != expected {
+			offset := len(doc.lines[line-1]) - len(text) + indent
+			r := Range{Start: doc.position(line, offset), End: doc.position(line, offset+1)}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Expected \"%s\", found \"%s\"", expected, marker),
+				Range:   r,
+				Fix:     &TextEdit{Range: r, NewText: expected},
+			})
+		}
+	}
+	return diagnostics
+}
+
+// MD007
+func checkListIndent(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	size := opts.intOption("indent", 2)
+	startIndented := opts.boolOption("start_indented", false)
+
+	type listLevel struct {
+		indent  int
+		ordered bool
+	}
+
+	var diagnostics []Diagnostic
+	var stack []listLevel
+	for line := 1; line <= len(doc.lines); line++ {
+		if !doc.isContent(line) {
+			continue
+		}
+		text := doc.lines[line-1]
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		indent, marker, ok := parseListMarker(text)
+		if !ok {
+			// Unindented text ends the list
+			if !strings.HasPrefix(text, " ") && !strings.HasPrefix(text, "\t") {
+				stack = nil
+			}
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent > indent {
+			stack = stack[:len(stack)-1]
+		}
+		ordered := marker != "-" && marker != "*" && marker != "+"
+		if len(stack) > 0 && stack[len(stack)-1].indent == indent {
+			stack[len(stack)-1].ordered = ordered
+		} else {
+			stack = append(stack, listLevel{indent: indent, ordered: ordered})
+		}
+
+		if ordered {
+			continue
+		}
+		nestedInOrdered := false
+		for _, level := range stack[:len(stack)-1] {
+			nestedInOrdered = nestedInOrdered || level.ordered
+		}
+		if nestedInOrdered {
+			continue
+		}
+
+		depth := len(stack) - 1
+		if startIndented {
+			depth++
+		}
+		expected := depth * size
+		if indent != expected {
+			r := Range{Start: Position{Line: line, Column: 1}, End: doc.position(line, indent)}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Expected indentation of %d, found %d", expected, indent),
+				Range:   r,
+				Fix:     &TextEdit{Range: r, NewText: strings.Repeat(" ", expected)},
+			})
+			stack[len(stack)-1].indent = indent
+		}
+	}
+	return diagnostics
+}
+
+// MD009
+func checkTrailingSpaces(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	brSpaces := opts.intOption("br_spaces", 2)
+
+	var diagnostics []Diagnostic
+	for line := 1; line <= len(doc.lines); line++ {
+		text := doc.lines[line-1]
+		trimmed := strings.TrimRight(text, " \t")
+		trailing := len(text) - len(trimmed)
+		if trailing == 0 {
+			continue
+		}
+
+		// Hard line breaks are allowed at the end of a paragraph line
+		if trimmed != "" && brSpaces >= 2 && trailing == brSpaces && !doc.isCode(line) &&
+			strings.Trim(text[len(trimmed):], " ") == "" && line < len(doc.lines) && !doc.isBlank(line+1) {
+			continue
+		}
+
+		r := Range{Start: doc.position(line, len(trimmed)), End: doc.position(line, len(text))}
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: fmt.Sprintf("Expected 0 trailing spaces, found %d", trailing),
+			Range:   r,
+			Fix:     &TextEdit{Range: r, NewText: ""},
+		})
+	}
+	return diagnostics
+}
+
+// MD010
+func checkHardTabs(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	codeBlocks := opts.boolOption("code_blocks", true)
+	spaces := strings.Repeat(" ", opts.intOption("spaces_per_tab", 4))
+
+	var diagnostics []Diagnostic
+	for line := 1; line <= len(doc.lines); line++ {
+		if doc.isCode(line) && !codeBlocks {
+			continue
+		}
+		text := doc.lines[line-1]
+		for i := 0; i < len(text); i++ {
+			if text[i] != '\t' {
+				continue
+			}
+			r := Range{Start: doc.position(line, i), End: doc.position(line, i+1)}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Hard tab found",
+				Range:   r,
+				Fix:     &TextEdit{Range: r, NewText: spaces},
+			})
+		}
+	}
+	return diagnostics
+}
+
+// MD012
+func checkMultipleBlanks(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	maximum := opts.intOption("maximum", 1)
+
+	var diagnostics []Diagnostic
+	blanks := 0
+	for line := 1; line <= len(doc.lines); line++ {
+		if !doc.isContent(line) || !doc.isBlank(line) {
+			blanks = 0
+			continue
+		}
+		// The empty string after a final newline is not a line of its own
+		if line == len(doc.lines) && doc.lines[line-1] == "" {
+			continue
+		}
+
+		blanks++
+		if blanks > maximum {
+			r := Range{Start: Position{Line: line, Column: 1}, End: Position{Line: line + 1, Column: 1}}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Expected at most %d blank line(s), found %d", maximum, blanks),
+				Range:   LineRange(doc.lines, line),
+				Fix:     &TextEdit{Range: r, NewText: ""},
+			})
+		}
+	}
+	return diagnostics
+}
+
+// MD013
+func checkLineLength(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	limit := opts.intOption("line_length", 80)
+	headingLimit := opts.intOption("heading_line_length", limit)
+	codeLimit := opts.intOption("code_block_line_length", limit)
+	checkCode := opts.boolOption("code_blocks", true)
+	checkTables := opts.boolOption("tables", true)
+	checkHeadings := opts.boolOption("headings", true)
+	strict := opts.boolOption("strict", false)
+
+	headingSet := map[int]bool{}
+	for _, heading := range doc.headingLines() {
+		headingSet[heading.line] = true
+	}
+
+	var diagnostics []Diagnostic
+	for line := 1; line <= len(doc.lines); line++ {
+		if doc.isFrontMatter(line) {
+			continue
+		}
+		text := doc.lines[line-1]
+		max := limit
+		switch {
+		case doc.isCode(line):
+			if !checkCode {
+				continue
+			}
+			max = codeLimit
+		case headingSet[line]:
+			if !checkHeadings {
+				continue
+			}
+			max = headingLimit
+		case strings.HasPrefix(strings.TrimSpace(text), "|"):
+			if !checkTables {
+				continue
+			}
+		}
+
+		length := utf8.RuneCountInString(text)
+		if length <= max {
+			continue
+		}
+
+		// Without strict, allow long lines when there is no whitespace beyond the limit
+		if !strict {
+			overflow := string([]rune(text)[max:])
+			if !strings.ContainsAny(overflow, " \t") {
+				continue
+			}
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: fmt.Sprintf("Expected maximum %d characters, found %d", max, length),
+			Range:   LineRange(doc.lines, line),
+		})
+	}
+	return diagnostics
+}
+
+// MD018
+func checkMissingSpaceATX(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	for line := 1; line <= len(doc.lines); line++ {
+		if !doc.isContent(line) {
+			continue
+		}
+		text := doc.lines[line-1]
+		trimmed := strings.TrimLeft(text, " ")
+		indent := len(text) - len(trimmed)
+		if indent > 3 || !strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		hashes := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if hashes > 6 || hashes == len(trimmed) {
+			continue
+		}
+		next := trimmed[hashes]
+		if next == ' ' || next == '\t' || next == '!' {
+			continue
+		}
+
+		at := doc.position(line, indent+hashes)
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: "Expected a space after the heading marker",
+			Range:   LineRange(doc.lines, line),
+			Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: " "},
+		})
+	}
+	return diagnostics
+}
+
+// MD022
+func checkBlanksAroundHeadings(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, heading := range doc.headingLines() {
+		if heading.prefix > 0 {
+			continue
+		}
+
+		first := heading.line
+		last := heading.line
+		if !heading.atx {
+			last++
+		}
+
+		if first > doc.frontMatter+1 && !doc.isBlank(first-1) {
+			at := Position{Line: first, Column: 1}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Expected a blank line above the heading",
+				Range:   LineRange(doc.lines, first),
+				Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: "\n"},
+			})
+		}
+		if last < len(doc.lines) && !doc.isBlank(last+1) {
+			at := Position{Line: last + 1, Column: 1}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Expected a blank line below the heading",
+				Range:   LineRange(doc.lines, first),
+				Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: "\n"},
+			})
+		}
+	}
+	return diagnostics
+}
+
+// MD024
+func checkDuplicateHeadings(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	siblingsOnly := opts.boolOption("siblings_only", false)
+
+	var diagnostics []Diagnostic
+	seen := map[string]bool{}
+	var parents []string
+	for _, heading := range doc.headings() {
+		level := heading.node.Level
+		key := heading.text
+		if siblingsOnly {
+			// Scope the heading text by the chain of headings above it
+			for len(parents) >= level {
+				parents = parents[:len(parents)-1]
+			}
+			for len(parents) < level-1 {
+				parents = append(parents, "")
+			}
+			key = strings.Join(parents, "\x00") + "\x00" + heading.text
+			parents = append(parents, heading.text)
+		}
+
+		if seen[key] {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Duplicate heading \"%s\"", heading.text),
+				Range:   LineRange(doc.lines, heading.line),
+			})
+		}
+		seen[key] = true
+	}
+	return diagnostics
+}
+
+// MD025
+func checkSingleH1(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	level := opts.intOption("level", 1)
+
+	var diagnostics []Diagnostic
+	found := false
+	for _, heading := range doc.headings() {
+		if heading.node.Level != level {
+			continue
+		}
+		if found {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("Multiple h%d headings", level),
+				Range:   LineRange(doc.lines, heading.line),
+			})
+		}
+		found = true
+	}
+	return diagnostics
+}
+
+// MD026
+func checkHeadingPunctuation(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	punctuation := opts.stringOption("punctuation", ".,;:!。，；：！")
+
+	var diagnostics []Diagnostic
+	for _, heading := range doc.headingLines() {
+		text := doc.lines[heading.line-1]
+		content := strings.TrimRight(text, " \t")
+		if heading.atx {
+			// Ignore optional closing hashes
+			withoutClosing := strings.TrimRight(content, "#")
+			if withoutClosing != content && strings.HasSuffix(withoutClosing, " ") {
+				content = strings.TrimRight(withoutClosing, " \t")
+			}
+		}
+
+		last, size := utf8.DecodeLastRuneInString(content)
+		if size == 0 || !strings.ContainsRune(punctuation, last) {
+			continue
+		}
+
+		r := Range{Start: doc.position(heading.line, len(content)-size), End: doc.position(heading.line, len(content))}
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: fmt.Sprintf("Punctuation: '%c'", last),
+			Range:   r,
+			Fix:     &TextEdit{Range: r, NewText: ""},
+		})
+	}
+	return diagnostics
+}
+
+// MD031
+func checkBlanksAroundFences(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, open := range doc.fences {
+		if stripBlockQuote(doc.lines[open-1]) != doc.lines[open-1] {
+			continue
+		}
+
+		end := open
+		for end < len(doc.lines) && doc.codeLines[end] {
+			end++
+		}
+
+		if open > doc.frontMatter+1 && !doc.isBlank(open-1) && !isListItemLine(doc.lines[open-2]) {
+			at := Position{Line: open, Column: 1}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Expected a blank line above the fenced code block",
+				Range:   LineRange(doc.lines, open),
+				Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: "\n"},
+			})
+		}
+		if end < len(doc.lines) && !doc.isBlank(end+1) {
+			at := Position{Line: end + 1, Column: 1}
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Expected a blank line below the fenced code block",
+				Range:   LineRange(doc.lines, end),
+				Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: "\n"},
+			})
+		}
+	}
+	return diagnostics
+}
+
+// MD034
+func checkBareURLs(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	cursor := 0
+	ast.WalkFunc(doc.root, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		text := NodeText(link)
+		destination := string(link.Destination)
+		if text == "" || (text != destination && "mailto:"+text != destination) {
+			return ast.SkipChildren
+		}
+
+		offset := doc.indexFrom(text, cursor)
+		if offset < 0 {
+			return ast.SkipChildren
+		}
+		cursor = offset + len(text)
+
+		if offset > 0 && strings.ContainsRune("<([", rune(doc.source[offset-1])) {
+			return ast.SkipChildren
+		}
+
+		r := doc.rangeAt(offset, len(text))
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: "Bare URL used: " + text,
+			Range:   r,
+			Fix:     &TextEdit{Range: r, NewText: "<" + text + ">"},
+		})
+		return ast.SkipChildren
+	})
+	return diagnostics
+}
+
+// MD040
+func checkFenceLanguage(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	index := 0
+	ast.WalkFunc(doc.root, func(node ast.Node, entering bool) ast.WalkStatus {
+		block, ok := node.(*ast.CodeBlock)
+		if !ok || !entering || !block.IsFenced {
+			return ast.GoToNext
+		}
+		if index >= len(doc.fences) {
+			return ast.Terminate
+		}
+
+		line := doc.fences[index]
+		index++
+		if strings.TrimSpace(string(block.Info)) == "" {
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: "Fenced code block has no language",
+				Range:   LineRange(doc.lines, line),
+			})
+		}
+		return ast.GoToNext
+	})
+	return diagnostics
+}
+
+// MD042
+func checkEmptyLinks(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	cursor := 0
+	ast.WalkFunc(doc.root, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering || link.NoteID != 0 {
+			return ast.GoToNext
+		}
+
+		destination := string(link.Destination)
+		if destination != "" && destination != "#" {
+			return ast.SkipChildren
+		}
+
+		offset := doc.indexFrom("]("+destination+")", cursor)
+		if offset < 0 {
+			return ast.SkipChildren
+		}
+		cursor = offset + 1
+
+		start := strings.LastIndex(doc.source[:offset], "[")
+		if start < 0 {
+			start = offset
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: "Link has no destination",
+			Range:   doc.rangeAt(start, offset+len(destination)+3-start),
+		})
+		return ast.SkipChildren
+	})
+	return diagnostics
+}
+
+// MD045
+func checkImageAltText(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	var diagnostics []Diagnostic
+	cursor := 0
+	ast.WalkFunc(doc.root, func(node ast.Node, entering bool) ast.WalkStatus {
+		image, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		offset := doc.indexFrom("![", cursor)
+		if offset < 0 {
+			return ast.SkipChildren
+		}
+		cursor = offset + 2
+
+		if strings.TrimSpace(NodeText(image)) != "" {
+			return ast.SkipChildren
+		}
+
+		length := len("![")
+		if end := strings.IndexAny(doc.source[offset:], ")\n"); end >= 0 {
+			length = end + 1
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: "Image has no alternate text: " + string(image.Destination),
+			Range:   doc.rangeAt(offset, length),
+		})
+		return ast.SkipChildren
+	})
+	return diagnostics
+}
+
+// MD047
+func checkTrailingNewline(doc *lintDocument, opts ruleOptions) []Diagnostic {
+	if doc.source == "" || strings.HasSuffix(doc.source, "\n") {
+		return nil
+	}
+
+	line := len(doc.lines)
+	at := doc.position(line, len(doc.lines[line-1]))
+	return []Diagnostic{{
+		Message: "Expected the file to end with a single newline",
+		Range:   LineRange(doc.lines, line),
+		Fix:     &TextEdit{Range: Range{Start: at, End: at}, NewText: "\n"},
+	}}
+}
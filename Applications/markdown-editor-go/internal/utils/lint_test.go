@@ -0,0 +1,76 @@
+package utils
+
+import "testing"
+
+func TestLintColumnsCountUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		rule string
+		want Range
+	}{
+		{"trailing spaces", "café é  \n", "MD009", Range{Start: Position{Line: 1, Column: 7}, End: Position{Line: 1, Column: 9}}},
+		{"hard tab", "😀\ttab\n", "MD010", Range{Start: Position{Line: 1, Column: 3}, End: Position{Line: 1, Column: 4}}},
+		{"heading punctuation", "# Héllo wörld!\n", "MD026", Range{Start: Position{Line: 1, Column: 14}, End: Position{Line: 1, Column: 15}}},
+		{"bare URL", "日本 http://example.com\n", "MD034", Range{Start: Position{Line: 1, Column: 4}, End: Position{Line: 1, Column: 22}}},
+		{"line length", "# Title\n\n" + "é😀 is a line that runs on well past the limit of eighty characters in width\n", "MD013", Range{Start: Position{Line: 3, Column: 1}, End: Position{Line: 3, Column: 77}}},
+		{"trailing newline", "naïve", "MD047", Range{Start: Position{Line: 1, Column: 1}, End: Position{Line: 1, Column: 6}}},
+	}
+
+	config := DefaultLintConfig()
+	config.Rules["MD013"] = map[string]interface{}{"line_length": 60.0}
+	linter := NewLinter(NewMarkdownParser(), config)
+	for _, test := range tests {
+		var found []Diagnostic
+		for _, diagnostic := range linter.Lint(test.md) {
+			if diagnostic.RuleID == test.rule {
+				found = append(found, diagnostic)
+			}
+		}
+		if len(found) != 1 {
+			t.Errorf("%s: %d %s diagnostics, want 1", test.name, len(found), test.rule)
+			continue
+		}
+		if found[0].Range != test.want {
+			t.Errorf("%s: range = %+v, want %+v", test.name, found[0].Range, test.want)
+		}
+	}
+}
+
+func TestFixAllWithWideCharacters(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"trailing spaces", "café é  \n", "café é\n"},
+		{"hard tab", "😀\ttab\n", "😀    tab\n"},
+		{"heading punctuation", "# Héllo wörld!\n", "# Héllo wörld\n"},
+		{"bare URL", "日本 http://example.com\n", "日本 <http://example.com>\n"},
+		{"missing space", "#日本\n", "# 日本\n"},
+		{"trailing newline", "naïve", "naïve\n"},
+	}
+
+	linter := NewLinter(NewMarkdownParser(), nil)
+	for _, test := range tests {
+		if got := linter.FixAll(test.md); got != test.want {
+			t.Errorf("%s: FixAll(%q) = %q, want %q", test.name, test.md, got, test.want)
+		}
+	}
+}
+
+func TestApplyEditsCountsUTF16(t *testing.T) {
+	content := "a😀b\ncafé\n"
+	edits := []TextEdit{
+		{Range: Range{Start: Position{Line: 1, Column: 4}, End: Position{Line: 1, Column: 5}}, NewText: "B"},
+		{Range: Range{Start: Position{Line: 2, Column: 4}, End: Position{Line: 2, Column: 5}}, NewText: "e"},
+	}
+	if got, want := ApplyEdits(content, edits), "a😀B\ncafe\n"; got != want {
+		t.Errorf("ApplyEdits = %q, want %q", got, want)
+	}
+
+	after := "a😀b\ncafé au lait\n"
+	if got := ApplyEdits(content, DiffEdits(content, after)); got != after {
+		t.Errorf("ApplyEdits(DiffEdits) = %q, want %q", got, after)
+	}
+}
@@ -16,15 +16,64 @@ type MarkdownParser struct {
 	htmlFlags  html.Flags
 }
 
+// ParserOptions turns the optional markdown syntax extensions on and off
+type ParserOptions struct {
+	Tables          bool `json:"tables"`
+	Strikethrough   bool `json:"strikethrough"`   // ~~text~~
+	Footnotes       bool `json:"footnotes"`       // [^note] references and definitions
+	DefinitionLists bool `json:"definitionLists"` // a term followed by ": definition" lines
+	Math            bool `json:"math"`            // $inline$ and $$display$$ math
+	Autolink        bool `json:"autolink"`        // bare URLs become links
+	HardLineBreaks  bool `json:"hardLineBreaks"`  // every newline in a paragraph is a line break
+	SuperSubscript  bool `json:"superSubscript"`  // 2^10^ and H~2~O
+}
+
+// DefaultParserOptions returns the extensions documents are parsed with unless
+// configured otherwise
+func DefaultParserOptions() ParserOptions {
+	return ParserOptions{
+		Tables:          true,
+		Strikethrough:   true,
+		DefinitionLists: true,
+		Math:            true,
+		Autolink:        true,
+	}
+}
+
 // NewMarkdownParser creates a new parser with default settings
 func NewMarkdownParser() *MarkdownParser {
-	// Default parser extensions
-	extensions := parser.CommonExtensions |
-		parser.AutoHeadingIDs |
-		parser.NoEmptyLineBeforeBlock |
-		parser.Tables |
+	return NewMarkdownParserWith(DefaultParserOptions())
+}
+
+// NewMarkdownParserWith creates a parser with the given extensions
+func NewMarkdownParserWith(options ParserOptions) *MarkdownParser {
+	// Extensions that are always on
+	extensions := parser.NoIntraEmphasis |
 		parser.FencedCode |
-		parser.Strikethrough
+		parser.SpaceHeadings |
+		parser.HeadingIDs |
+		parser.AutoHeadingIDs |
+		parser.BackslashLineBreak |
+		parser.NoEmptyLineBeforeBlock
+
+	optional := []struct {
+		enabled   bool
+		extension parser.Extensions
+	}{
+		{options.Tables, parser.Tables},
+		{options.Strikethrough, parser.Strikethrough},
+		{options.Footnotes, parser.Footnotes},
+		{options.DefinitionLists, parser.DefinitionLists},
+		{options.Math, parser.MathJax},
+		{options.Autolink, parser.Autolink},
+		{options.HardLineBreaks, parser.HardLineBreak},
+		{options.SuperSubscript, parser.SuperSubscript},
+	}
+	for _, option := range optional {
+		if option.enabled {
+			extensions |= option.extension
+		}
+	}
 
 	// Default HTML renderer flags
 	htmlFlags := html.CommonFlags |
@@ -38,6 +87,21 @@ func NewMarkdownParser() *MarkdownParser {
 	}
 }
 
+// WithFootnotes returns a parser like this one that also reads footnotes.
+// Exports use it whatever the settings say, since every format they write has
+// footnotes or notes of its own.
+func (p *MarkdownParser) WithFootnotes() *MarkdownParser {
+	return &MarkdownParser{
+		extensions: p.extensions | parser.Footnotes,
+		htmlFlags:  p.htmlFlags,
+	}
+}
+
+// Parse parses markdown text into an AST using the parser's extensions
+func (p *MarkdownParser) Parse(md string) ast.Node {
+	return parser.NewWithExtensions(p.extensions).Parse([]byte(md))
+}
+
 // MarkdownToHTML converts markdown text to HTML
 func (p *MarkdownParser) MarkdownToHTML(md string) string {
 	// Create a new parser with the defined extensions
@@ -57,6 +121,22 @@ func (p *MarkdownParser) MarkdownToHTML(md string) string {
 	return string(html)
 }
 
+// RenderHTML renders a parsed document with the parser's HTML flags; options
+// supply extra flags, the page title, head content and render hooks
+func (p *MarkdownParser) RenderHTML(node ast.Node, options html.RendererOptions) string {
+	options.Flags |= p.htmlFlags
+	renderer := html.NewRenderer(options)
+	return string(markdown.Render(node, renderer))
+}
+
+// RenderFragment renders a node like RenderHTML but without the page around it,
+// for HTML that is placed inside another page
+func (p *MarkdownParser) RenderFragment(node ast.Node, options html.RendererOptions) string {
+	options.Flags |= p.htmlFlags &^ html.CompletePage
+	renderer := html.NewRenderer(options)
+	return string(markdown.Render(node, renderer))
+}
+
 // ExtractTOC extracts a table of contents from markdown
 func (p *MarkdownParser) ExtractTOC(md string) string {
 	parser := parser.NewWithExtensions(p.extensions)
@@ -128,6 +208,26 @@ func (p *MarkdownParser) WordCount(md string) int {
 	return len(words)
 }
 
+// NodeText returns the plain text of a node and its descendants
+func NodeText(node ast.Node) string {
+	var buf strings.Builder
+	ast.WalkFunc(node, func(child ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := child.(type) {
+		case *ast.Text:
+			buf.Write(n.Literal)
+		case *ast.Code:
+			buf.Write(n.Literal)
+		case *ast.Softbreak, *ast.Hardbreak:
+			buf.WriteString(" ")
+		}
+		return ast.GoToNext
+	})
+	return buf.String()
+}
+
 // Helper function to render heading text
 func renderHeadingText(heading *ast.Heading) string {
 	var buf bytes.Buffer
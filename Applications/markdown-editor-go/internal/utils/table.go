@@ -0,0 +1,651 @@
+package utils
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// CellAlign is the alignment of a table column
+type CellAlign string
+
+const (
+	// AlignNone leaves the column alignment to the renderer
+	AlignNone CellAlign = ""
+
+	// AlignLeft aligns the column to the left
+	AlignLeft CellAlign = "left"
+
+	// AlignCenter centers the column
+	AlignCenter CellAlign = "center"
+
+	// AlignRight aligns the column to the right
+	AlignRight CellAlign = "right"
+)
+
+// cellAlignFromAST converts the parser's alignment flags
+func cellAlignFromAST(flags ast.CellAlignFlags) CellAlign {
+	switch flags {
+	case ast.TableAlignmentLeft:
+		return AlignLeft
+	case ast.TableAlignmentRight:
+		return AlignRight
+	case ast.TableAlignmentCenter:
+		return AlignCenter
+	default:
+		return AlignNone
+	}
+}
+
+// FormatPipeTable writes a pipe table from already escaped cell text.
+// When align is true every column is padded to the width of its widest cell.
+func FormatPipeTable(header []string, aligns []CellAlign, body, footer [][]string, align bool) []string {
+	columns := len(header)
+	for _, row := range append(body, footer...) {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	widths := make([]int, columns)
+	for i := range widths {
+		widths[i] = 3
+	}
+	if align {
+		for _, row := range append(append([][]string{header}, body...), footer...) {
+			for i, cell := range row {
+				if width := TextWidth(cell); width > widths[i] {
+					widths[i] = width
+				}
+			}
+		}
+	}
+
+	columnAlign := func(i int) CellAlign {
+		if i < len(aligns) {
+			return aligns[i]
+		}
+		return AlignNone
+	}
+
+	formatRow := func(row []string) string {
+		cells := make([]string, columns)
+		for i := range cells {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			if align {
+				cell = padCell(cell, widths[i], columnAlign(i))
+			}
+			cells[i] = cell
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	delimiterRow := func() string {
+		cells := make([]string, columns)
+		for i := range cells {
+			width := 3
+			if align {
+				width = widths[i]
+			}
+			cells[i] = delimiterCell(width, columnAlign(i))
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	// The footer separator may only contain pipes and equal signs
+	footerRow := func() string {
+		cells := make([]string, columns)
+		for i := range cells {
+			width := 3
+			if align {
+				width = widths[i]
+			}
+			cells[i] = strings.Repeat("=", width+2)
+		}
+		return "|" + strings.Join(cells, "|") + "|"
+	}
+
+	lines := []string{formatRow(header), delimiterRow()}
+	for _, row := range body {
+		lines = append(lines, formatRow(row))
+	}
+	if len(footer) > 0 {
+		lines = append(lines, footerRow())
+		for _, row := range footer {
+			lines = append(lines, formatRow(row))
+		}
+	}
+	return lines
+}
+
+// padCell pads cell text to width according to the column alignment
+func padCell(cell string, width int, align CellAlign) string {
+	padding := width - TextWidth(cell)
+	if padding <= 0 {
+		return cell
+	}
+
+	switch align {
+	case AlignRight:
+		return strings.Repeat(" ", padding) + cell
+	case AlignCenter:
+		left := padding / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", padding-left)
+	default:
+		return cell + strings.Repeat(" ", padding)
+	}
+}
+
+// delimiterCell writes a delimiter row cell such as ":---:"
+func delimiterCell(width int, align CellAlign) string {
+	switch align {
+	case AlignLeft:
+		return ":" + strings.Repeat("-", width-1)
+	case AlignRight:
+		return strings.Repeat("-", width-1) + ":"
+	case AlignCenter:
+		return ":" + strings.Repeat("-", width-2) + ":"
+	default:
+		return strings.Repeat("-", width)
+	}
+}
+
+// Table editing operations
+const (
+	TableFormat            = "format"
+	TableInsertRowAbove    = "insertRowAbove"
+	TableInsertRowBelow    = "insertRowBelow"
+	TableDeleteRow         = "deleteRow"
+	TableInsertColumnLeft  = "insertColumnLeft"
+	TableInsertColumnRight = "insertColumnRight"
+	TableDeleteColumn      = "deleteColumn"
+	TableMoveColumnLeft    = "moveColumnLeft"
+	TableMoveColumnRight   = "moveColumnRight"
+	TableSortAscending     = "sortAscending"
+	TableSortDescending    = "sortDescending"
+	TableTranspose         = "transpose"
+	TableAlignLeft         = "alignLeft"
+	TableAlignCenter       = "alignCenter"
+	TableAlignRight        = "alignRight"
+	TableAlignNone         = "alignNone"
+)
+
+// MarkdownTable is a pipe table read from the source, with cells kept as raw markdown
+type MarkdownTable struct {
+	Header []string    `json:"header"`
+	Aligns []CellAlign `json:"aligns"`
+	Rows   [][]string  `json:"rows"`
+	Footer [][]string  `json:"footer"`
+
+	// StartLine and EndLine are the 1-based lines the table occupies, inclusive
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+
+	// prefix is the indentation or block quote marker in front of every line
+	prefix string
+	source []string
+}
+
+// FindTableAt returns the pipe table containing the given 1-based line
+func FindTableAt(md string, line int) (*MarkdownTable, error) {
+	lines := splitLines(md)
+	if line < 1 || line > len(lines) {
+		return nil, errors.New("no table at the cursor")
+	}
+
+	inCode := fencedCodeLines(lines)
+	isTableLine := func(i int) bool {
+		return !inCode[i] && strings.Contains(lines[i], "|")
+	}
+	if !isTableLine(line - 1) {
+		return nil, errors.New("no table at the cursor")
+	}
+
+	start, end := line-1, line-1
+	for start > 0 && isTableLine(start-1) {
+		start--
+	}
+	for end+1 < len(lines) && isTableLine(end+1) {
+		end++
+	}
+
+	// The block may follow paragraph lines containing pipes, so look for the delimiter row
+	for start < end && !isDelimiterRow(lines[start+1]) {
+		start++
+	}
+	if start >= end || start > line-1 {
+		return nil, errors.New("no table at the cursor")
+	}
+
+	table := &MarkdownTable{
+		StartLine: start + 1,
+		EndLine:   end + 1,
+		source:    lines[start : end+1],
+	}
+	table.prefix = linePrefix(lines[start])
+
+	table.Header = splitTableRow(table.stripPrefix(lines[start]))
+	for _, cell := range splitTableRow(table.stripPrefix(lines[start+1])) {
+		table.Aligns = append(table.Aligns, parseDelimiterCell(cell))
+	}
+
+	inFooter := false
+	for _, row := range lines[start+2 : end+1] {
+		row = table.stripPrefix(row)
+		if isFooterRow(row) {
+			inFooter = true
+			continue
+		}
+		if inFooter {
+			table.Footer = append(table.Footer, splitTableRow(row))
+		} else {
+			table.Rows = append(table.Rows, splitTableRow(row))
+		}
+	}
+
+	table.normalize()
+	return table, nil
+}
+
+// EditTable applies a table operation at the cursor and returns the edits to apply
+func EditTable(md string, pos Position, operation string) ([]TextEdit, error) {
+	table, err := FindTableAt(md, pos.Line)
+	if err != nil {
+		return nil, err
+	}
+
+	row := pos.Line - table.StartLine - 2 // -2 for the header, -1 for the delimiter row
+	column := table.ColumnAt(pos)
+
+	switch operation {
+	case TableFormat:
+	case TableInsertRowAbove, TableInsertRowBelow:
+		index := row
+		if row < 0 || row >= len(table.Rows) {
+			// Rows inserted from the header go to the top of the body
+			index = 0
+			if row >= len(table.Rows) {
+				index = len(table.Rows)
+			}
+		} else if operation == TableInsertRowBelow {
+			index++
+		}
+		table.InsertRow(index)
+	case TableDeleteRow:
+		if row < 0 || row >= len(table.Rows) {
+			return nil, errors.New("only body rows can be deleted")
+		}
+		table.DeleteRow(row)
+	case TableInsertColumnLeft:
+		table.InsertColumn(column)
+	case TableInsertColumnRight:
+		table.InsertColumn(column + 1)
+	case TableDeleteColumn:
+		if len(table.Header) == 1 {
+			return nil, errors.New("cannot delete the last column")
+		}
+		table.DeleteColumn(column)
+	case TableMoveColumnLeft:
+		table.MoveColumn(column, column-1)
+	case TableMoveColumnRight:
+		table.MoveColumn(column, column+1)
+	case TableSortAscending:
+		table.SortByColumn(column, false)
+	case TableSortDescending:
+		table.SortByColumn(column, true)
+	case TableTranspose:
+		if err := table.Transpose(); err != nil {
+			return nil, err
+		}
+	case TableAlignLeft:
+		table.SetAlign(column, AlignLeft)
+	case TableAlignCenter:
+		table.SetAlign(column, AlignCenter)
+	case TableAlignRight:
+		table.SetAlign(column, AlignRight)
+	case TableAlignNone:
+		table.SetAlign(column, AlignNone)
+	default:
+		return nil, errors.New("unknown table operation: " + operation)
+	}
+
+	return table.Edits(true), nil
+}
+
+// ColumnAt returns the index of the column under the cursor
+func (t *MarkdownTable) ColumnAt(pos Position) int {
+	if pos.Line < t.StartLine || pos.Line > t.EndLine {
+		return 0
+	}
+
+	line := t.source[pos.Line-t.StartLine]
+	prefix := len(t.prefix)
+	if len(line) < prefix {
+		prefix = len(line)
+	}
+	text := line[prefix:]
+	column := byteOffset(line, pos.Column) - prefix
+	if column < 0 {
+		column = 0
+	}
+
+	pipes := cellSeparators(text)
+	leading := len(pipes) > 0 && strings.TrimSpace(text[:pipes[0]]) == ""
+	index := 0
+	for _, pipe := range pipes {
+		if pipe < column {
+			index++
+		}
+	}
+	if leading && index > 0 {
+		index--
+	}
+	if index >= len(t.Header) {
+		index = len(t.Header) - 1
+	}
+	return index
+}
+
+// InsertRow inserts an empty body row before index
+func (t *MarkdownTable) InsertRow(index int) {
+	row := make([]string, len(t.Header))
+	t.Rows = append(t.Rows[:index], append([][]string{row}, t.Rows[index:]...)...)
+}
+
+// DeleteRow removes a body row
+func (t *MarkdownTable) DeleteRow(index int) {
+	t.Rows = append(t.Rows[:index], t.Rows[index+1:]...)
+}
+
+// InsertColumn inserts an empty column before index
+func (t *MarkdownTable) InsertColumn(index int) {
+	insert := func(row []string) []string {
+		return append(row[:index], append([]string{""}, row[index:]...)...)
+	}
+
+	t.Header = insert(t.Header)
+	t.Aligns = append(t.Aligns[:index], append([]CellAlign{AlignNone}, t.Aligns[index:]...)...)
+	t.forEachRow(insert)
+}
+
+// DeleteColumn removes a column
+func (t *MarkdownTable) DeleteColumn(index int) {
+	remove := func(row []string) []string {
+		return append(row[:index], row[index+1:]...)
+	}
+
+	t.Header = remove(t.Header)
+	t.Aligns = append(t.Aligns[:index], t.Aligns[index+1:]...)
+	t.forEachRow(remove)
+}
+
+// MoveColumn moves a column to a new index, ignoring moves past either edge
+func (t *MarkdownTable) MoveColumn(from, to int) {
+	if to < 0 || to >= len(t.Header) || from == to {
+		return
+	}
+
+	move := func(row []string) []string {
+		row[from], row[to] = row[to], row[from]
+		return row
+	}
+
+	t.Header = move(t.Header)
+	t.Aligns[from], t.Aligns[to] = t.Aligns[to], t.Aligns[from]
+	t.forEachRow(move)
+}
+
+// SortByColumn sorts the body rows by a column. Columns holding only
+// numbers are sorted numerically, anything else case-insensitively.
+func (t *MarkdownTable) SortByColumn(index int, descending bool) {
+	numeric := true
+	for _, row := range t.Rows {
+		if _, err := parseCellNumber(row[index]); err != nil && strings.TrimSpace(row[index]) != "" {
+			numeric = false
+			break
+		}
+	}
+
+	less := func(a, b string) bool {
+		if numeric {
+			x, _ := parseCellNumber(a)
+			y, _ := parseCellNumber(b)
+			return x < y
+		}
+		return strings.ToLower(a) < strings.ToLower(b)
+	}
+
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		if descending {
+			return less(t.Rows[j][index], t.Rows[i][index])
+		}
+		return less(t.Rows[i][index], t.Rows[j][index])
+	})
+}
+
+// Transpose swaps rows and columns; the first column becomes the header. A
+// table with footer rows cannot be transposed, as its columns would have no
+// place for them.
+func (t *MarkdownTable) Transpose() error {
+	if len(t.Footer) > 0 {
+		return errors.New("tables with footer rows cannot be transposed")
+	}
+	matrix := append([][]string{t.Header}, t.Rows...)
+
+	transposed := make([][]string, len(t.Header))
+	for i := range transposed {
+		transposed[i] = make([]string, len(matrix))
+		for j, row := range matrix {
+			transposed[i][j] = row[i]
+		}
+	}
+
+	t.Header = transposed[0]
+	t.Rows = transposed[1:]
+	t.Aligns = make([]CellAlign, len(t.Header))
+	t.normalize()
+	return nil
+}
+
+// SetAlign changes the alignment of a column
+func (t *MarkdownTable) SetAlign(index int, align CellAlign) {
+	t.Aligns[index] = align
+}
+
+// Lines renders the table, padding columns to equal width when align is true
+func (t *MarkdownTable) Lines(align bool) []string {
+	lines := FormatPipeTable(t.Header, t.Aligns, t.Rows, t.Footer, align)
+	for i, line := range lines {
+		lines[i] = t.prefix + line
+	}
+	return lines
+}
+
+// Edits returns the minimal edits that replace the table in the source with its rendering
+func (t *MarkdownTable) Edits(align bool) []TextEdit {
+	before := strings.Join(t.source, "\n")
+	after := strings.Join(t.Lines(align), "\n")
+
+	edits := DiffEdits(before, after)
+	for i := range edits {
+		edits[i].Range.Start.Line += t.StartLine - 1
+		edits[i].Range.End.Line += t.StartLine - 1
+	}
+	return edits
+}
+
+// forEachRow applies fn to every body and footer row
+func (t *MarkdownTable) forEachRow(fn func([]string) []string) {
+	for i := range t.Rows {
+		t.Rows[i] = fn(t.Rows[i])
+	}
+	for i := range t.Footer {
+		t.Footer[i] = fn(t.Footer[i])
+	}
+}
+
+// normalize gives every row as many cells as the header
+func (t *MarkdownTable) normalize() {
+	columns := len(t.Header)
+	fit := func(row []string) []string {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		return row[:columns]
+	}
+
+	t.Aligns = func(aligns []CellAlign) []CellAlign {
+		for len(aligns) < columns {
+			aligns = append(aligns, AlignNone)
+		}
+		return aligns[:columns]
+	}(t.Aligns)
+	t.forEachRow(fit)
+}
+
+func (t *MarkdownTable) stripPrefix(line string) string {
+	if strings.HasPrefix(line, t.prefix) {
+		return line[len(t.prefix):]
+	}
+	return strings.TrimLeft(line, " ")
+}
+
+// linePrefix returns the indentation and block quote markers in front of a line
+func linePrefix(line string) string {
+	content := strings.TrimLeft(stripBlockQuote(line), " ")
+	return line[:len(line)-len(content)]
+}
+
+// splitTableRow splits a table row into trimmed cells
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	pipes := cellSeparators(line)
+
+	var cells []string
+	start := 0
+	for _, pipe := range pipes {
+		cells = append(cells, strings.TrimSpace(line[start:pipe]))
+		start = pipe + 1
+	}
+	cells = append(cells, strings.TrimSpace(line[start:]))
+
+	// Leading and trailing pipes are optional
+	if strings.HasPrefix(line, "|") {
+		cells = cells[1:]
+	}
+	if len(cells) > 0 && len(pipes) > 0 && strings.HasSuffix(line, "|") && pipes[len(pipes)-1] == len(line)-1 {
+		cells = cells[:len(cells)-1]
+	}
+	return cells
+}
+
+// cellSeparators returns the offsets of the pipes separating cells, skipping
+// escaped pipes and pipes inside code spans
+func cellSeparators(line string) []int {
+	var pipes []int
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			run := 1
+			for i+run < len(line) && line[i+run] == '`' {
+				run++
+			}
+			closing := strings.Index(line[i+run:], strings.Repeat("`", run))
+			if closing >= 0 {
+				i += run + closing + run - 1
+			} else {
+				i += run - 1
+			}
+		case '|':
+			pipes = append(pipes, i)
+		}
+	}
+	return pipes
+}
+
+// isDelimiterRow reports whether a line is the delimiter row below a table header
+func isDelimiterRow(line string) bool {
+	line = stripBlockQuote(line)
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	cells := splitTableRow(line)
+	if len(cells) == 0 {
+		return false
+	}
+	for _, cell := range cells {
+		if strings.Trim(cell, ":-") != "" || !strings.Contains(cell, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// isFooterRow reports whether a line separates the table body from its footer
+func isFooterRow(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.Contains(line, "=") && strings.Contains(line, "|") && strings.Trim(line, "|=") == ""
+}
+
+// parseDelimiterCell reads the alignment of a delimiter row cell
+func parseDelimiterCell(cell string) CellAlign {
+	left := strings.HasPrefix(cell, ":")
+	right := strings.HasSuffix(cell, ":")
+	switch {
+	case left && right:
+		return AlignCenter
+	case left:
+		return AlignLeft
+	case right:
+		return AlignRight
+	default:
+		return AlignNone
+	}
+}
+
+// parseCellNumber parses a numeric cell, ignoring thousands separators
+func parseCellNumber(cell string) (float64, error) {
+	cell = strings.ReplaceAll(strings.TrimSpace(cell), ",", "")
+	return strconv.ParseFloat(cell, 64)
+}
+
+// fencedCodeLines marks the lines belonging to fenced code blocks
+func fencedCodeLines(lines []string) []bool {
+	inCode, _ := scanFences(lines)
+	return inCode
+}
+
+// scanFences marks the lines belonging to fenced code blocks, fences included,
+// and returns the 0-based indexes of the opening fences
+func scanFences(lines []string) ([]bool, []int) {
+	inCode := make([]bool, len(lines))
+	var openings []int
+
+	var fenceChar byte
+	fenceLen := 0
+	for i, line := range lines {
+		char, length, info := parseFence(stripBlockQuote(line))
+		if fenceLen == 0 {
+			if length > 0 {
+				fenceChar, fenceLen = char, length
+				inCode[i] = true
+				openings = append(openings, i)
+			}
+			continue
+		}
+
+		inCode[i] = true
+		if char == fenceChar && length >= fenceLen && info == "" {
+			fenceLen = 0
+		}
+	}
+	return inCode, openings
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColumnAtCountsUTF16(t *testing.T) {
+	md := "| a | b | c |\n|---|---|---|\n| 日本語 | 中文 | x |\n| 😀 | 😀😀 | y |\n"
+	tests := []struct {
+		line   int
+		text   string
+		column int
+	}{
+		{3, "日本語", 0},
+		{3, "中文", 1},
+		{3, "x", 2},
+		{4, "😀😀", 1},
+		{4, "y", 2},
+	}
+	lines := splitLines(md)
+	for _, test := range tests {
+		table, err := FindTableAt(md, test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := lines[test.line-1]
+		before := line[:strings.Index(line, test.text)]
+		// Monaco's 1-based column, counted in UTF-16 code units
+		column := 1
+		for _, r := range before {
+			column += utf16Len(r)
+		}
+		if got := table.ColumnAt(Position{Line: test.line, Column: column}); got != test.column {
+			t.Errorf("ColumnAt on %q = %d, want %d", test.text, got, test.column)
+		}
+	}
+
+	edits, err := EditTable(md, Position{Line: 3, Column: 14}, TableDeleteColumn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ApplyEdits(md, edits)
+	if strings.Contains(got, "x") || !strings.Contains(got, "中文") {
+		t.Errorf("deleting the column of x gave\n%s", got)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	md := "| a | b |\n|---|---|\n| 1 | 2 |\n|===|===|\n| t | 3 |\n"
+	if _, err := EditTable(md, Position{Line: 3, Column: 3}, TableTranspose); err == nil {
+		t.Error("a table with a footer was transposed")
+	}
+
+	md = "| a | b |\n|---|---|\n| 1 | 2 |\n"
+	edits, err := EditTable(md, Position{Line: 3, Column: 3}, TableTranspose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "| a   | 1   |\n| --- | --- |\n| b   | 2   |\n"
+	if got := ApplyEdits(md, edits); got != want {
+		t.Errorf("Transpose gave\n%s\nwant\n%s", got, want)
+	}
+}
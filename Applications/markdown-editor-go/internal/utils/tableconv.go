@@ -0,0 +1,351 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Delimited data formats understood by the table converter
+const (
+	TableFormatAuto = "auto"
+	TableFormatCSV  = "csv"
+	TableFormatTSV  = "tsv"
+	TableFormatHTML = "html"
+)
+
+// Header detection modes
+const (
+	HeaderAuto = "auto"
+	HeaderYes  = "yes"
+	HeaderNo   = "no"
+)
+
+// TableImportOptions controls how delimited or HTML data becomes a markdown table
+type TableImportOptions struct {
+	Format string `json:"format"` // "auto", "csv", "tsv" or "html"
+	Header string `json:"header"` // "auto", "yes" or "no"
+	Align  bool   `json:"align"`
+}
+
+// DefaultTableImportOptions returns options that detect the format and header
+func DefaultTableImportOptions() TableImportOptions {
+	return TableImportOptions{
+		Format: TableFormatAuto,
+		Header: HeaderAuto,
+		Align:  true,
+	}
+}
+
+// ConvertToMarkdownTable converts CSV, TSV or an HTML table into a markdown table
+func ConvertToMarkdownTable(data string, options TableImportOptions) (string, error) {
+	data = strings.TrimSpace(strings.ReplaceAll(data, "\r\n", "\n"))
+	if data == "" {
+		return "", errors.New("nothing to convert")
+	}
+
+	format := options.Format
+	if format == "" || format == TableFormatAuto {
+		format = DetectTableFormat(data)
+	}
+
+	var rows [][]string
+	var headerHint bool
+	var err error
+	switch format {
+	case TableFormatCSV:
+		rows, err = parseDelimited(data, ',')
+	case TableFormatTSV:
+		rows, err = parseDelimited(data, '\t')
+	case TableFormatHTML:
+		rows, headerHint, err = parseHTMLTable(data)
+	default:
+		return "", errors.New("unknown table format: " + format)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", errors.New("no rows found")
+	}
+
+	hasHeader := headerHint
+	switch options.Header {
+	case HeaderYes:
+		hasHeader = true
+	case HeaderNo:
+		hasHeader = false
+	default:
+		hasHeader = hasHeader || detectHeaderRow(rows)
+	}
+
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = escapeTableCell(cell)
+		}
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	var header []string
+	body := rows
+	if hasHeader {
+		header, body = rows[0], rows[1:]
+	}
+	for i := len(header) + 1; i <= columns; i++ {
+		header = append(header, "Column "+strconv.Itoa(i))
+	}
+
+	table := &MarkdownTable{Header: header, Rows: body}
+	table.normalize()
+	return strings.Join(table.Lines(options.Align), "\n"), nil
+}
+
+// DetectTableFormat guesses whether data is an HTML table, TSV or CSV
+func DetectTableFormat(data string) string {
+	lower := strings.ToLower(data)
+	if strings.Contains(lower, "<table") || strings.Contains(lower, "<tr") {
+		return TableFormatHTML
+	}
+
+	firstLine := data
+	if i := strings.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if strings.Count(firstLine, "\t") > 0 && strings.Count(firstLine, "\t") >= strings.Count(firstLine, ",") {
+		return TableFormatTSV
+	}
+	return TableFormatCSV
+}
+
+// TableToDelimited writes a markdown table as CSV or TSV
+func TableToDelimited(table *MarkdownTable, format string) (string, error) {
+	var comma rune
+	switch format {
+	case TableFormatCSV:
+		comma = ','
+	case TableFormatTSV:
+		comma = '\t'
+	default:
+		return "", errors.New("unknown export format: " + format)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+
+	records := append([][]string{table.Header}, table.Rows...)
+	records = append(records, table.Footer...)
+	for _, record := range records {
+		cells := make([]string, len(record))
+		for i, cell := range record {
+			cells[i] = unescapeTableCell(cell)
+		}
+		if err := writer.Write(cells); err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
+
+// parseDelimited reads CSV or TSV records, tolerating ragged rows and stray quotes
+func parseDelimited(data string, comma rune) ([][]string, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+// parseHTMLTable reads the rows of the first table in an HTML fragment and
+// reports whether its first row is a header
+func parseHTMLTable(data string) ([][]string, bool, error) {
+	doc, err := html.Parse(strings.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+
+	table := findHTMLElement(doc, atom.Table)
+	if table == nil {
+		// Spreadsheets sometimes put bare rows on the clipboard
+		table = doc
+	}
+
+	var rows [][]string
+	header := false
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Table:
+				// Nested tables are flattened into their cell's text
+				continue
+			case atom.Tr:
+				var row []string
+				allHeaders := true
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+						continue
+					}
+					allHeaders = allHeaders && (cell.DataAtom == atom.Th || child.Parent.DataAtom == atom.Thead)
+					row = append(row, htmlText(cell))
+
+					// Keep columns lined up by padding cells spanning several columns
+					if span, err := strconv.Atoi(htmlAttr(cell, "colspan")); err == nil {
+						for i := 1; i < span && i < 100; i++ {
+							row = append(row, "")
+						}
+					}
+				}
+				if len(rows) == 0 && len(row) > 0 {
+					header = allHeaders
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(table)
+
+	return rows, header, nil
+}
+
+// findHTMLElement returns the first element of the given type
+func findHTMLElement(node *html.Node, element atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == element {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findHTMLElement(child, element); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// htmlAttr returns the value of an attribute, or ""
+func htmlAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// htmlText returns the text of a node with whitespace collapsed; line breaks become newlines
+func htmlText(node *html.Node) string {
+	var buf strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			buf.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Br:
+			buf.WriteString("\n")
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Div) && n.NextSibling != nil {
+			buf.WriteString("\n")
+		}
+	}
+	walk(node)
+
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// detectHeaderRow guesses whether the first row names the columns: every
+// header cell is filled in and not a number, and some column holds numbers below it
+func detectHeaderRow(rows [][]string) bool {
+	if len(rows) < 2 {
+		return false
+	}
+
+	for _, cell := range rows[0] {
+		if strings.TrimSpace(cell) == "" || isNumericCell(cell) {
+			return false
+		}
+	}
+
+	for column := range rows[0] {
+		numeric := true
+		filled := false
+		for _, row := range rows[1:] {
+			if column >= len(row) || strings.TrimSpace(row[column]) == "" {
+				continue
+			}
+			filled = true
+			numeric = numeric && isNumericCell(row[column])
+		}
+		if filled && numeric {
+			return true
+		}
+	}
+
+	// Without numbers to compare, treat a row of distinct short labels as a header
+	seen := map[string]bool{}
+	for _, cell := range rows[0] {
+		if seen[cell] || TextWidth(cell) > 40 {
+			return false
+		}
+		seen[cell] = true
+	}
+	return true
+}
+
+// isNumericCell reports whether a cell holds a number, currency amount or percentage
+func isNumericCell(cell string) bool {
+	_, err := numericCellValue(cell)
+	return err == nil
+}
+
+// numericCellValue parses a number, ignoring currency symbols and a percent sign
+func numericCellValue(cell string) (float64, error) {
+	cell = strings.TrimSpace(cell)
+	cell = strings.TrimLeft(cell, "$€£¥")
+	cell = strings.TrimSuffix(cell, "%")
+	return parseCellNumber(cell)
+}
+
+// escapeTableCell makes plain text safe to put in a table cell
+func escapeTableCell(cell string) string {
+	cell = strings.TrimSpace(cell)
+	cell = strings.ReplaceAll(cell, "\\", "\\\\")
+	cell = strings.ReplaceAll(cell, "|", "\\|")
+	return strings.ReplaceAll(cell, "\n", "<br>")
+}
+
+// unescapeTableCell turns a table cell back into plain text
+func unescapeTableCell(cell string) string {
+	cell = strings.ReplaceAll(cell, "<br>", "\n")
+	cell = strings.ReplaceAll(cell, "\\|", "|")
+	return strings.ReplaceAll(cell, "\\\\", "\\")
+}
@@ -0,0 +1,839 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Table formulas follow org-mode's TBLFM line, written as an HTML comment after
+// the table so that it does not show up in the preview:
+//
+//	| Item | Qty | Price | Total |
+//	| ---- | --- | ----- | ----- |
+//	| Tea  | 2   | 3.5   |       |
+//	| Sum  |     |       |       |
+//	<!-- TBLFM: $4=$2*$3; @>$4=vsum(@2..@-1) -->
+//
+// Rows are addressed with @ and columns with $, counting from 1 with the header
+// as row 1. @< and @> (or $< and $>) are the first and last row (or column),
+// and @-1 or $+1 are relative to the cell being computed. A column formula
+// ($4=...) fills every body row; a field formula (@>$4=...) fills one cell and
+// takes precedence over column formulas. a..b is a range for the v-functions.
+
+// tableFormulaMarker starts a formula comment
+const tableFormulaMarker = "TBLFM:"
+
+// formulaFunction is a function callable from a formula
+type formulaFunction struct {
+	minArgs int
+	maxArgs int  // -1 for any number of arguments
+	ranges  bool // arguments may be ranges, flattened into their values
+	call    func(args []float64) (float64, error)
+}
+
+// formulaFunctions lists the functions available in formulas
+var formulaFunctions = map[string]formulaFunction{
+	"vsum": {1, -1, true, func(args []float64) (float64, error) {
+		sum := 0.0
+		for _, arg := range args {
+			sum += arg
+		}
+		return sum, nil
+	}},
+	"vmean": {1, -1, true, func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("vmean of no values")
+		}
+		sum := 0.0
+		for _, arg := range args {
+			sum += arg
+		}
+		return sum / float64(len(args)), nil
+	}},
+	"vmin": {1, -1, true, func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("vmin of no values")
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"vmax": {1, -1, true, func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("vmax of no values")
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+	"vcount": {1, -1, true, func(args []float64) (float64, error) {
+		return float64(len(args)), nil
+	}},
+	"abs": {1, 1, false, func(args []float64) (float64, error) {
+		return math.Abs(args[0]), nil
+	}},
+	"floor": {1, 1, false, func(args []float64) (float64, error) {
+		return math.Floor(args[0]), nil
+	}},
+	"ceil": {1, 1, false, func(args []float64) (float64, error) {
+		return math.Ceil(args[0]), nil
+	}},
+	"sqrt": {1, 1, false, func(args []float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, errors.New("square root of a negative number")
+		}
+		return math.Sqrt(args[0]), nil
+	}},
+	"round": {1, 2, false, func(args []float64) (float64, error) {
+		scale := 1.0
+		if len(args) == 2 {
+			scale = math.Pow(10, math.Round(args[1]))
+		}
+		return math.Round(args[0]*scale) / scale, nil
+	}},
+}
+
+// EvaluateTableFormulas recalculates the table at the given line, which may
+// also be a line of its formula comment, and returns the edits to apply
+func EvaluateTableFormulas(md string, line int) ([]TextEdit, error) {
+	lines := splitLines(md)
+	inCode := fencedCodeLines(lines)
+
+	// Move from a formula comment up to its table
+	if line >= 1 && line <= len(lines) && !inCode[line-1] {
+		if start, ok := formulaCommentStart(lines, inCode, line-1); ok {
+			line = precedingContentLine(lines, start) + 1
+		}
+	}
+
+	table, err := FindTableAt(md, line)
+	if err != nil {
+		return nil, err
+	}
+
+	formulas, formulaLine, _ := tableFormulas(lines, inCode, table.EndLine)
+	if len(formulas) == 0 {
+		return nil, errors.New("the table has no TBLFM formulas")
+	}
+	return evaluateTable(table, formulas, formulaLine)
+}
+
+// EvaluateAllTableFormulas recalculates every table followed by a formula
+// comment and returns the edits to apply
+func EvaluateAllTableFormulas(md string) ([]TextEdit, error) {
+	lines := splitLines(md)
+	inCode := fencedCodeLines(lines)
+
+	edits := []TextEdit{}
+	for i := 0; i < len(lines); i++ {
+		if inCode[i] || !isFormulaComment(lines[i]) {
+			continue
+		}
+
+		previous := precedingContentLine(lines, i)
+		if previous < 0 || inCode[previous] {
+			return nil, fmt.Errorf("line %d: TBLFM comment does not follow a table", i+1)
+		}
+		table, err := FindTableAt(md, previous+1)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: TBLFM comment does not follow a table", i+1)
+		}
+
+		formulas, formulaLine, next := tableFormulas(lines, inCode, table.EndLine)
+		tableEdits, err := evaluateTable(table, formulas, formulaLine)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, tableEdits...)
+
+		// Skip the rest of the table's comments
+		i = next - 1
+	}
+	return edits, nil
+}
+
+// evaluateTable applies formulas to a table and returns the edits rewriting it,
+// or no edits when no computed cell changed
+func evaluateTable(table *MarkdownTable, formulas []string, formulaLine int) ([]TextEdit, error) {
+	changed, err := table.ApplyFormulas(formulas)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", formulaLine, err)
+	}
+	if !changed {
+		return []TextEdit{}, nil
+	}
+	return table.Edits(true), nil
+}
+
+// ApplyFormulas evaluates the formulas against the table and writes the results
+// into its cells, reporting whether any cell changed. Column formulas run
+// first, then field formulas, each in the order written.
+func (t *MarkdownTable) ApplyFormulas(formulas []string) (bool, error) {
+	cells := append([][]string{t.Header}, t.Rows...)
+	cells = append(cells, t.Footer...)
+
+	var columnFormulas, fieldFormulas []*tableFormula
+	for _, text := range formulas {
+		formula, err := parseTableFormula(text)
+		if err != nil {
+			return false, fmt.Errorf("formula %q: %v", text, err)
+		}
+		if formula.target.row.kind == refNone {
+			columnFormulas = append(columnFormulas, formula)
+		} else {
+			fieldFormulas = append(fieldFormulas, formula)
+		}
+	}
+
+	// Resolve the targets of field formulas so column formulas can skip them
+	fieldCells := map[[2]int]bool{}
+	for _, formula := range fieldFormulas {
+		row, column, err := resolveCellRef(cells, formula.target, 0, 0)
+		if err != nil {
+			return false, fmt.Errorf("formula %q: %v", formula.text, err)
+		}
+		fieldCells[[2]int{row, column}] = true
+	}
+
+	changed := false
+	evaluate := func(formula *tableFormula, row int) error {
+		_, column, err := resolveCellRef(cells, formula.target, row, 0)
+		if err != nil {
+			return fmt.Errorf("formula %q: %v", formula.text, err)
+		}
+		if formula.target.row.kind == refNone && fieldCells[[2]int{row, column}] {
+			return nil
+		}
+
+		env := &formulaContext{cells: cells, row: row, column: column}
+		value, err := formula.expr.eval(env)
+		if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+			err = errors.New("the result is not a finite number")
+		}
+		if err != nil {
+			return fmt.Errorf("formula %q at %s: %v", formula.text, cellName(row, column), err)
+		}
+
+		text := formatFormulaValue(value)
+		if cells[row][column] != text {
+			cells[row][column] = text
+			changed = true
+		}
+		return nil
+	}
+
+	for _, formula := range columnFormulas {
+		for row := 1; row <= len(t.Rows); row++ {
+			if err := evaluate(formula, row); err != nil {
+				return false, err
+			}
+		}
+	}
+	for _, formula := range fieldFormulas {
+		row, _, _ := resolveCellRef(cells, formula.target, 0, 0)
+		if err := evaluate(formula, row); err != nil {
+			return false, err
+		}
+	}
+
+	return changed, nil
+}
+
+// tableFormulas returns the formulas in the comments following a table, the
+// line of the first comment and the index of the line after the last one
+func tableFormulas(lines []string, inCode []bool, endLine int) ([]string, int, int) {
+	var formulas []string
+	firstLine := 0
+
+	i := endLine
+	for {
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+		if i >= len(lines) || inCode[i] || !isFormulaComment(lines[i]) {
+			break
+		}
+		if firstLine == 0 {
+			firstLine = i + 1
+		}
+
+		// The comment may continue over several lines
+		text := ""
+		for ; i < len(lines); i++ {
+			text += stripBlockQuote(lines[i]) + "\n"
+			if strings.Contains(lines[i], "-->") {
+				i++
+				break
+			}
+		}
+		text = strings.TrimPrefix(strings.TrimSpace(text), "<!--")
+		text = strings.TrimPrefix(strings.TrimSpace(text), tableFormulaMarker)
+		if end := strings.Index(text, "-->"); end >= 0 {
+			text = text[:end]
+		}
+		formulas = append(formulas, splitFormulas(text)...)
+	}
+
+	return formulas, firstLine, i
+}
+
+// splitFormulas splits a formula list on semicolons, org-mode's "::" separator or line breaks
+func splitFormulas(text string) []string {
+	text = strings.ReplaceAll(text, "::", ";")
+	text = strings.ReplaceAll(text, "\n", ";")
+
+	var formulas []string
+	for _, formula := range strings.Split(text, ";") {
+		if formula = strings.TrimSpace(formula); formula != "" {
+			formulas = append(formulas, formula)
+		}
+	}
+	return formulas
+}
+
+// isFormulaComment reports whether a line starts a TBLFM comment
+func isFormulaComment(line string) bool {
+	line = strings.TrimSpace(stripBlockQuote(line))
+	if !strings.HasPrefix(line, "<!--") {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(line[len("<!--"):]), tableFormulaMarker)
+}
+
+// formulaCommentStart finds the TBLFM comment containing the given line index
+func formulaCommentStart(lines []string, inCode []bool, index int) (int, bool) {
+	for i := index; i >= 0 && !inCode[i]; i-- {
+		if isFormulaComment(lines[i]) {
+			return i, true
+		}
+		if strings.TrimSpace(lines[i]) == "" || (i < index && strings.Contains(lines[i], "-->")) {
+			break
+		}
+	}
+	return 0, false
+}
+
+// precedingContentLine returns the index of the last non-blank line before index, or -1
+func precedingContentLine(lines []string, index int) int {
+	for i := index - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatFormulaValue writes a computed number without floating point noise
+func formatFormulaValue(value float64) string {
+	if math.Abs(value) < 1e15 {
+		value = math.Round(value*1e9) / 1e9
+	}
+	if value == 0 {
+		value = 0 // avoid "-0"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// cellName returns the @row$column name of a 0-based cell
+func cellName(row, column int) string {
+	return "@" + strconv.Itoa(row+1) + "$" + strconv.Itoa(column+1)
+}
+
+// Formula references
+
+// Kinds of row or column reference
+const (
+	refNone     = iota // omitted, meaning the current row or column
+	refAbsolute        // @3
+	refRelative        // @-1
+	refFirst           // @<
+	refLast            // @>
+)
+
+// refPart is the row or column half of a cell reference
+type refPart struct {
+	kind   int
+	offset int
+}
+
+// cellRef is a reference such as $2, @>$4 or @-1
+type cellRef struct {
+	row    refPart
+	column refPart
+	text   string
+}
+
+// resolveCellRef returns the 0-based cell a reference points at from the given cell
+func resolveCellRef(cells [][]string, ref cellRef, row, column int) (int, int, error) {
+	rows, columns := len(cells), len(cells[0])
+	r := resolveRefPart(ref.row, row, rows)
+	c := resolveRefPart(ref.column, column, columns)
+	if r < 0 || r >= rows || c < 0 || c >= columns {
+		return 0, 0, fmt.Errorf("reference %s is outside the table (%d rows, %d columns)", ref.text, rows, columns)
+	}
+	return r, c, nil
+}
+
+func resolveRefPart(part refPart, current, count int) int {
+	switch part.kind {
+	case refAbsolute:
+		return part.offset - 1
+	case refRelative:
+		return current + part.offset
+	case refFirst:
+		return 0
+	case refLast:
+		return count - 1
+	default:
+		return current
+	}
+}
+
+// Formula expressions
+
+// tableFormula is a parsed target=expression formula
+type tableFormula struct {
+	text   string
+	target cellRef
+	expr   formulaExpr
+}
+
+// formulaContext is the table and cell a formula is evaluated for
+type formulaContext struct {
+	cells  [][]string
+	row    int
+	column int
+}
+
+// formulaExpr is a node of a parsed formula expression
+type formulaExpr interface {
+	eval(env *formulaContext) (float64, error)
+}
+
+type numberExpr float64
+
+type refExpr cellRef
+
+type rangeExpr struct {
+	from cellRef
+	to   cellRef
+}
+
+type negateExpr struct {
+	operand formulaExpr
+}
+
+type binaryExpr struct {
+	op    byte
+	left  formulaExpr
+	right formulaExpr
+}
+
+type callExpr struct {
+	name string
+	args []formulaExpr
+}
+
+func (e numberExpr) eval(env *formulaContext) (float64, error) {
+	return float64(e), nil
+}
+
+func (e refExpr) eval(env *formulaContext) (float64, error) {
+	row, column, err := resolveCellRef(env.cells, cellRef(e), env.row, env.column)
+	if err != nil {
+		return 0, err
+	}
+	value, _, err := cellValue(env.cells, row, column)
+	return value, err
+}
+
+func (e rangeExpr) eval(env *formulaContext) (float64, error) {
+	return 0, fmt.Errorf("range %s..%s can only be used in vsum, vmean, vmin, vmax or vcount", e.from.text, e.to.text)
+}
+
+// values returns the numbers in the non-empty cells of the range
+func (e rangeExpr) values(env *formulaContext) ([]float64, error) {
+	fromRow, fromColumn, err := resolveCellRef(env.cells, e.from, env.row, env.column)
+	if err != nil {
+		return nil, err
+	}
+	toRow, toColumn, err := resolveCellRef(env.cells, e.to, env.row, env.column)
+	if err != nil {
+		return nil, err
+	}
+	if fromRow > toRow {
+		fromRow, toRow = toRow, fromRow
+	}
+	if fromColumn > toColumn {
+		fromColumn, toColumn = toColumn, fromColumn
+	}
+
+	var values []float64
+	for row := fromRow; row <= toRow; row++ {
+		for column := fromColumn; column <= toColumn; column++ {
+			value, empty, err := cellValue(env.cells, row, column)
+			if err != nil {
+				return nil, err
+			}
+			if !empty {
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (e negateExpr) eval(env *formulaContext) (float64, error) {
+	value, err := e.operand.eval(env)
+	return -value, err
+}
+
+func (e binaryExpr) eval(env *formulaContext) (float64, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	case '/':
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return left / right, nil
+	default:
+		return math.Pow(left, right), nil
+	}
+}
+
+func (e callExpr) eval(env *formulaContext) (float64, error) {
+	function := formulaFunctions[e.name]
+
+	var args []float64
+	for _, arg := range e.args {
+		if r, ok := arg.(rangeExpr); ok && function.ranges {
+			values, err := r.values(env)
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, values...)
+			continue
+		}
+
+		value, err := arg.eval(env)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, value)
+	}
+
+	value, err := function.call(args)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", e.name, err)
+	}
+	return value, nil
+}
+
+// cellValue returns the number in a cell; empty cells count as zero
+func cellValue(cells [][]string, row, column int) (float64, bool, error) {
+	cell := strings.TrimSpace(cells[row][column])
+	if cell == "" {
+		return 0, true, nil
+	}
+	value, err := numericCellValue(cell)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s is not a number: %q", cellName(row, column), cell)
+	}
+	return value, false, nil
+}
+
+// Formula parsing
+
+// formulaParser is a recursive descent parser for formula expressions
+type formulaParser struct {
+	src string
+	pos int
+}
+
+// parseTableFormula parses a target=expression formula
+func parseTableFormula(text string) (*tableFormula, error) {
+	eq := strings.Index(text, "=")
+	if eq < 0 {
+		return nil, errors.New("missing '='")
+	}
+
+	target := &formulaParser{src: strings.TrimSpace(text[:eq])}
+	ref, err := target.parseRef()
+	if err != nil {
+		return nil, err
+	}
+	if !target.done() {
+		return nil, fmt.Errorf("unexpected %q in the target", target.src[target.pos:])
+	}
+	if ref.column.kind == refNone || ref.column.kind == refRelative || ref.row.kind == refRelative {
+		return nil, fmt.Errorf("the target %s must name a column, like $4 or @>$4", ref.text)
+	}
+
+	parser := &formulaParser{src: text[eq+1:]}
+	expr, err := parser.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.done() {
+		return nil, fmt.Errorf("unexpected %q", parser.src[parser.pos:])
+	}
+
+	return &tableFormula{text: text, target: ref, expr: expr}, nil
+}
+
+// done reports whether only whitespace is left
+func (p *formulaParser) done() bool {
+	p.skipSpace()
+	return p.pos >= len(p.src)
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end
+func (p *formulaParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// parseExpr parses additions and subtractions
+func (p *formulaParser) parseExpr() (formulaExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseTerm parses multiplications and divisions
+func (p *formulaParser) parseTerm() (formulaExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses negation and right-associative powers
+func (p *formulaParser) parseUnary() (formulaExpr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand: operand}, nil
+	}
+
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: '^', left: base, right: exponent}, nil
+	}
+	return base, nil
+}
+
+// parsePrimary parses numbers, references, ranges, calls and parentheses
+func (p *formulaParser) parsePrimary() (formulaExpr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, errors.New("unexpected end of formula")
+	case c == '(':
+		p.pos++
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.New("missing ')'")
+		}
+		p.pos++
+		return expr, nil
+	case c == '@' || c == '$':
+		from, err := p.parseRef()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(p.src[p.pos:], "..") {
+			p.pos += 2
+			p.skipSpace()
+			to, err := p.parseRef()
+			if err != nil {
+				return nil, err
+			}
+			return rangeExpr{from: from, to: to}, nil
+		}
+		return refExpr(from), nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return numberExpr(value), nil
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return p.parseCall()
+	default:
+		return nil, fmt.Errorf("unexpected %q", string(c))
+	}
+}
+
+// parseCall parses a function call such as vsum(@2..@-1)
+func (p *formulaParser) parseCall() (formulaExpr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' || p.src[p.pos] >= 'A' && p.src[p.pos] <= 'Z') {
+		p.pos++
+	}
+	name := strings.ToLower(p.src[start:p.pos])
+	function, ok := formulaFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	if p.peek() != '(' {
+		return nil, fmt.Errorf("missing '(' after %s", name)
+	}
+	p.pos++
+
+	call := callExpr{name: name}
+	if p.peek() == ')' {
+		p.pos++
+	} else {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+
+			c := p.peek()
+			p.pos++
+			if c == ')' {
+				break
+			}
+			if c != ',' {
+				return nil, fmt.Errorf("missing ')' after the arguments of %s", name)
+			}
+		}
+	}
+
+	if len(call.args) < function.minArgs || function.maxArgs >= 0 && len(call.args) > function.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	return call, nil
+}
+
+// parseRef parses a reference such as $2, @>$4 or @-1
+func (p *formulaParser) parseRef() (cellRef, error) {
+	p.skipSpace()
+	start := p.pos
+
+	var ref cellRef
+	var err error
+	if p.pos < len(p.src) && p.src[p.pos] == '@' {
+		p.pos++
+		if ref.row, err = p.parseRefPart('@'); err != nil {
+			return ref, err
+		}
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '$' {
+		p.pos++
+		if ref.column, err = p.parseRefPart('$'); err != nil {
+			return ref, err
+		}
+	}
+
+	ref.text = p.src[start:p.pos]
+	if ref.text == "" {
+		return ref, errors.New("expected a reference like $2 or @3$2")
+	}
+	return ref, nil
+}
+
+// parseRefPart parses the part of a reference following @ or $
+func (p *formulaParser) parseRefPart(sigil byte) (refPart, error) {
+	if p.pos >= len(p.src) {
+		return refPart{}, fmt.Errorf("missing row or column after %q", string(sigil))
+	}
+
+	switch c := p.src[p.pos]; {
+	case c == '<':
+		p.pos++
+		return refPart{kind: refFirst}, nil
+	case c == '>':
+		p.pos++
+		return refPart{kind: refLast}, nil
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil {
+			return refPart{}, fmt.Errorf("invalid reference %q", string(sigil)+p.src[start:p.pos])
+		}
+		if c == '+' || c == '-' {
+			return refPart{kind: refRelative, offset: n}, nil
+		}
+		if n < 1 {
+			return refPart{}, fmt.Errorf("invalid reference %q: rows and columns count from 1", string(sigil)+p.src[start:p.pos])
+		}
+		return refPart{kind: refAbsolute, offset: n}, nil
+	default:
+		return refPart{}, fmt.Errorf("missing row or column after %q", string(sigil))
+	}
+}